@@ -0,0 +1,285 @@
+package blockstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+// accessPrefix holds the access time of each block, under the datastore
+// key of the block.
+var accessPrefix = ds.NewKey("/local/access")
+
+// legacyAccessTimesKey held all the access times in a single value, it is
+// converted on startup.
+var legacyAccessTimesKey = accessPrefix.ChildString("times")
+
+// accessSaveInterval is how often changed access times are saved.
+var accessSaveInterval = time.Minute
+
+// accessDeleted marks the pending access times to remove.
+const accessDeleted = -1
+
+var errCorruptAccessTimes = errors.New("corrupt block access times")
+
+// AccessBlockstore tracks when each block was last read or written, so
+// that unpinned blocks can be evicted least recently used first. Times
+// are kept to the second, and saved in store with one key per block.
+// Only the times changed since the last save are held in memory, the
+// others are read from store when asked for. Blocks that were not used
+// since the tracking started have no access time.
+type AccessBlockstore struct {
+	GCBlockstore
+	store ds.Datastore
+
+	lk      sync.Mutex
+	pending map[key.Key]int64 // unix seconds, or accessDeleted
+}
+
+// NewAccessBlockstore tracks the accesses to bs, in store. The changed
+// times are saved periodically until ctx is done, and on Close.
+func NewAccessBlockstore(ctx context.Context, bs GCBlockstore, store ds.Datastore) *AccessBlockstore {
+	a := &AccessBlockstore{
+		GCBlockstore: bs,
+		store:        store,
+		pending:      make(map[key.Key]int64),
+	}
+	if err := a.convertLegacy(); err != nil {
+		// the times only order the eviction, losing them is not fatal
+		log.Warningf("failed to load the block access times: %s", err)
+	}
+	go a.run(ctx)
+	return a
+}
+
+func accessKey(k key.Key) ds.Key {
+	return accessPrefix.Child(k.DsKey())
+}
+
+func (a *AccessBlockstore) touch(k key.Key) {
+	now := time.Now().Unix()
+	a.lk.Lock()
+	a.pending[k] = now
+	a.lk.Unlock()
+}
+
+// LastAccess returns when k was last read or written, or the zero time if
+// it was not since the tracking started.
+func (a *AccessBlockstore) LastAccess(k key.Key) time.Time {
+	a.lk.Lock()
+	t, ok := a.pending[k]
+	a.lk.Unlock()
+	if ok {
+		if t == accessDeleted {
+			return time.Time{}
+		}
+		return time.Unix(t, 0)
+	}
+
+	v, err := a.store.Get(accessKey(k))
+	if err != nil {
+		if err != ds.ErrNotFound {
+			log.Debugf("failed to read the access time of %s: %s", k, err)
+		}
+		return time.Time{}
+	}
+	data, ok := v.([]byte)
+	if !ok {
+		return time.Time{}
+	}
+	t, n := binary.Varint(data)
+	if n <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0)
+}
+
+func (a *AccessBlockstore) Get(k key.Key) (blocks.Block, error) {
+	b, err := a.GCBlockstore.Get(k)
+	if err == nil {
+		a.touch(k)
+	}
+	return b, err
+}
+
+func (a *AccessBlockstore) Peek(k key.Key) (blocks.Block, error) {
+	return Peek(a.GCBlockstore, k)
+}
+
+func (a *AccessBlockstore) Put(b blocks.Block) error {
+	if err := a.GCBlockstore.Put(b); err != nil {
+		return err
+	}
+	a.touch(b.Key())
+	return nil
+}
+
+func (a *AccessBlockstore) PutMany(bs []blocks.Block) error {
+	if err := a.GCBlockstore.PutMany(bs); err != nil {
+		return err
+	}
+	for _, b := range bs {
+		a.touch(b.Key())
+	}
+	return nil
+}
+
+func (a *AccessBlockstore) DeleteBlock(k key.Key) error {
+	if err := a.GCBlockstore.DeleteBlock(k); err != nil {
+		return err
+	}
+	a.lk.Lock()
+	a.pending[k] = accessDeleted
+	a.lk.Unlock()
+	return nil
+}
+
+func (a *AccessBlockstore) run(ctx context.Context) {
+	tick := time.NewTicker(accessSaveInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := a.flush(); err != nil {
+				log.Warningf("failed to save the block access times: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// flush saves the pending access times. They are kept pending if that
+// fails, unless changed meanwhile.
+func (a *AccessBlockstore) flush() error {
+	a.lk.Lock()
+	if len(a.pending) == 0 {
+		a.lk.Unlock()
+		return nil
+	}
+	times := a.pending
+	a.pending = make(map[key.Key]int64)
+	a.lk.Unlock()
+
+	if err := a.save(times); err != nil {
+		a.lk.Lock()
+		for k, t := range times {
+			if _, ok := a.pending[k]; !ok {
+				a.pending[k] = t
+			}
+		}
+		a.lk.Unlock()
+		return err
+	}
+	return nil
+}
+
+// save writes times to the store, in a single batch where possible. Each
+// time is stored as a varint.
+func (a *AccessBlockstore) save(times map[key.Key]int64) error {
+	var b ds.Batch
+	if bs, ok := a.store.(ds.Batching); ok {
+		var err error
+		b, err = bs.Batch()
+		if err != nil {
+			return err
+		}
+	} else {
+		b = ds.NewBasicBatch(a.store)
+	}
+
+	var deleted []ds.Key
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for k, t := range times {
+		if t == accessDeleted {
+			deleted = append(deleted, accessKey(k))
+			continue
+		}
+		v := append([]byte(nil), tmp[:binary.PutVarint(tmp, t)]...)
+		if err := b.Put(accessKey(k), v); err != nil {
+			return err
+		}
+	}
+	if err := b.Commit(); err != nil {
+		return err
+	}
+
+	// not batched, as the time of a block that was never saved is not
+	// found
+	for _, k := range deleted {
+		if err := a.store.Delete(k); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertLegacy stores the access times saved in a single value by older
+// versions under one key per block. They were saved as a sequence of
+// entries, each the uvarint length of the key, the key, and the varint
+// time.
+func (a *AccessBlockstore) convertLegacy() error {
+	v, err := a.store.Get(legacyAccessTimesKey)
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, ok := v.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+
+	// the times are lost either way
+	corrupt := func() error {
+		a.store.Delete(legacyAccessTimesKey)
+		return errCorruptAccessTimes
+	}
+
+	times := make(map[key.Key]int64)
+	r := bytes.NewReader(data)
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || n > uint64(len(data)) {
+			return corrupt()
+		}
+		k := make([]byte, n)
+		if _, err := io.ReadFull(r, k); err != nil {
+			return corrupt()
+		}
+		t, err := binary.ReadVarint(r)
+		if err != nil {
+			return corrupt()
+		}
+		times[key.Key(k)] = t
+	}
+
+	if err := a.save(times); err != nil {
+		return err
+	}
+	return a.store.Delete(legacyAccessTimesKey)
+}
+
+// Close saves the access times.
+func (a *AccessBlockstore) Close() error {
+	err := a.flush()
+	if c, ok := a.GCBlockstore.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package blockstore
+
+import (
+	"testing"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	ds_sync "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/sync"
+)
+
+func TestAccessTimes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := ds_sync.MutexWrap(ds.NewMapDatastore())
+	bs := NewBlockstore(store)
+	a := NewAccessBlockstore(ctx, bs, store)
+
+	put := blocks.NewBlock([]byte("put"))
+	if err := a.Put(put); err != nil {
+		t.Fatal(err)
+	}
+	if a.LastAccess(put.Key()).IsZero() {
+		t.Fatal("a put block should have an access time")
+	}
+
+	// blocks stored before the tracking started have none, until read
+	read := blocks.NewBlock([]byte("read"))
+	if err := bs.Put(read); err != nil {
+		t.Fatal(err)
+	}
+	if !a.LastAccess(read.Key()).IsZero() {
+		t.Fatal("an untouched block should have no access time")
+	}
+	if _, err := a.Get(read.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if a.LastAccess(read.Key()).IsZero() {
+		t.Fatal("a read block should have an access time")
+	}
+
+	deleted := blocks.NewBlock([]byte("deleted"))
+	if err := a.PutMany([]blocks.Block{deleted}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.DeleteBlock(deleted.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if !a.LastAccess(deleted.Key()).IsZero() {
+		t.Fatal("a removed block should have no access time")
+	}
+
+	// the times are saved on close, and loaded by the next blockstore
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened := NewAccessBlockstore(ctx, bs, store)
+	for _, b := range []blocks.Block{put, read} {
+		if !reopened.LastAccess(b.Key()).Equal(a.LastAccess(b.Key())) {
+			t.Fatalf("the access time of %s was not saved", b.Key())
+		}
+	}
+	if !reopened.LastAccess(deleted.Key()).IsZero() {
+		t.Fatal("a removed block should have no access time after reopening")
+	}
+}
+
+func TestAccessTimesSavedPerBlock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := ds_sync.MutexWrap(ds.NewMapDatastore())
+	a := NewAccessBlockstore(ctx, NewBlockstore(store), store)
+	b := blocks.NewBlock([]byte("block"))
+	if err := a.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(accessKey(b.Key())); err != nil {
+		t.Fatalf("the access time should be saved under the block key: %s", err)
+	}
+
+	// a blockstore that was not closed still has the saved times
+	crashed := NewAccessBlockstore(ctx, NewBlockstore(store), store)
+	if !crashed.LastAccess(b.Key()).Equal(a.LastAccess(b.Key())) {
+		t.Fatal("the saved access time should be read back")
+	}
+
+	if err := a.DeleteBlock(b.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(accessKey(b.Key())); err != ds.ErrNotFound {
+		t.Fatal("the access time of a removed block should be removed")
+	}
+}
+
+func TestLegacyAccessTimes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := ds_sync.MutexWrap(ds.NewMapDatastore())
+	b := blocks.NewBlock([]byte("block"))
+	legacy := []byte{byte(len(b.Key()))}
+	legacy = append(legacy, b.Key()...)
+	legacy = append(legacy, 0x80, 0x80, 0x80, 0x80, 0x0a) // 1342177280
+	if err := store.Put(legacyAccessTimesKey, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAccessBlockstore(ctx, NewBlockstore(store), store)
+	if got := a.LastAccess(b.Key()).Unix(); got != 1342177280 {
+		t.Fatalf("expected the legacy access time, got %d", got)
+	}
+	if _, err := store.Get(legacyAccessTimesKey); err != ds.ErrNotFound {
+		t.Fatal("the legacy access times should be removed once converted")
+	}
+}
+
+func TestCorruptAccessTimes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := ds_sync.MutexWrap(ds.NewMapDatastore())
+	if err := store.Put(legacyAccessTimesKey, []byte{0xff, 0xff, 0xff}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blockstore still works, without access times
+	a := NewAccessBlockstore(ctx, NewBlockstore(store), store)
+	b := blocks.NewBlock([]byte("block"))
+	if err := a.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	if a.LastAccess(b.Key()).IsZero() {
+		t.Fatal("a put block should have an access time")
+	}
+}
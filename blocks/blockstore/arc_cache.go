@@ -91,6 +91,13 @@ func (b *arccache) Get(k key.Key) (blocks.Block, error) {
 	return bl, err
 }
 
+func (b *arccache) Peek(k key.Key) (blocks.Block, error) {
+	if has, ok := b.hasCached(k); ok && !has {
+		return nil, ErrNotFound
+	}
+	return Peek(b.blockstore, k)
+}
+
 func (b *arccache) Put(bl blocks.Block) error {
 	if has, ok := b.hasCached(bl.Key()); ok && has {
 		return nil
@@ -0,0 +1,106 @@
+package blockstore
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+// ErrBarrierActive is returned by StartBarrier while another collection
+// uses the write barrier.
+var ErrBarrierActive = errors.New("blockstore: a concurrent garbage collection is already running")
+
+// BarrierBlockstore records the blocks put while a concurrent garbage
+// collection runs, so that the collection does not remove blocks written
+// after it started marking.
+type BarrierBlockstore struct {
+	GCBlockstore
+
+	lk      sync.Mutex
+	written map[key.Key]struct{} // nil when no collection runs
+}
+
+// NewBarrierBlockstore returns bs with a write barrier. It should wrap
+// every other layer, so that all puts are seen.
+func NewBarrierBlockstore(bs GCBlockstore) *BarrierBlockstore {
+	return &BarrierBlockstore{GCBlockstore: bs}
+}
+
+func (b *BarrierBlockstore) Put(bl blocks.Block) error {
+	// record first, a block put after the check in DeleteUnwritten must
+	// not be removed
+	b.record(bl.Key())
+	return b.GCBlockstore.Put(bl)
+}
+
+func (b *BarrierBlockstore) PutMany(bs []blocks.Block) error {
+	for _, bl := range bs {
+		b.record(bl.Key())
+	}
+	return b.GCBlockstore.PutMany(bs)
+}
+
+func (b *BarrierBlockstore) Peek(k key.Key) (blocks.Block, error) {
+	return Peek(b.GCBlockstore, k)
+}
+
+func (b *BarrierBlockstore) record(k key.Key) {
+	b.lk.Lock()
+	if b.written != nil {
+		b.written[k] = struct{}{}
+	}
+	b.lk.Unlock()
+}
+
+// StartBarrier makes the blockstore record the blocks put from now on,
+// until StopBarrier is called. Only one collection may use the barrier at
+// a time.
+func (b *BarrierBlockstore) StartBarrier() error {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if b.written != nil {
+		return ErrBarrierActive
+	}
+	b.written = make(map[key.Key]struct{})
+	return nil
+}
+
+// StopBarrier forgets the recorded blocks.
+func (b *BarrierBlockstore) StopBarrier() {
+	b.lk.Lock()
+	b.written = nil
+	b.lk.Unlock()
+}
+
+// Written returns true if k was put since StartBarrier.
+func (b *BarrierBlockstore) Written(k key.Key) bool {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	_, ok := b.written[k]
+	return ok
+}
+
+// DeleteUnwritten removes k unless it was put since StartBarrier, and
+// returns true if it did. Puts of k wait for it, so that a block is never
+// removed right after it was stored again.
+func (b *BarrierBlockstore) DeleteUnwritten(k key.Key) (bool, error) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if _, ok := b.written[k]; ok {
+		return false, nil
+	}
+	if err := b.GCBlockstore.DeleteBlock(k); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *BarrierBlockstore) Close() error {
+	if c, ok := b.GCBlockstore.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
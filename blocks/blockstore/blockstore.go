@@ -22,6 +22,9 @@ var log = logging.Logger("blockstore")
 // BlockPrefix namespaces blockstore datastores
 var BlockPrefix = ds.NewKey("blocks")
 
+// ColdBlockPrefix namespaces the cold tier of a TieredBlockstore
+var ColdBlockPrefix = ds.NewKey("coldblocks")
+
 var ValueTypeMismatch = errors.New("the retrieved value is not a Block")
 var ErrHashMismatch = errors.New("block in storage has different hash than requested")
 
@@ -57,17 +60,60 @@ type GCBlockstore interface {
 	GCRequested() bool
 }
 
+// Peeker is implemented by the blockstores whose Get does more than read,
+// like moving cold blocks to the hot tier or recording access times. Peek
+// reads a block without counting it as used. Blockstores wrapping others
+// pass Peek down.
+type Peeker interface {
+	Peek(key.Key) (blocks.Block, error)
+}
+
+// Peek reads k from bs without counting it as used, if bs can.
+func Peek(bs Blockstore, k key.Key) (blocks.Block, error) {
+	if p, ok := bs.(Peeker); ok {
+		return p.Peek(k)
+	}
+	return bs.Get(k)
+}
+
+// NewPeekingBlockstore returns bs with Get replaced by Peek, for walks of
+// the whole repo, like the GC marking pinned blocks, that are not uses of
+// the blocks they read.
+func NewPeekingBlockstore(bs GCBlockstore) GCBlockstore {
+	return &peeking{bs}
+}
+
+type peeking struct {
+	GCBlockstore
+}
+
+func (p *peeking) Get(k key.Key) (blocks.Block, error) {
+	return Peek(p.GCBlockstore, k)
+}
+
+func (p *peeking) Peek(k key.Key) (blocks.Block, error) {
+	return Peek(p.GCBlockstore, k)
+}
+
 func NewBlockstore(d ds.Batching) *blockstore {
+	return NewBlockstoreWithPrefix(d, BlockPrefix)
+}
+
+// NewBlockstoreWithPrefix is like NewBlockstore, but keeps the blocks
+// under prefix instead of BlockPrefix.
+func NewBlockstoreWithPrefix(d ds.Batching, prefix ds.Key) *blockstore {
 	var dsb ds.Batching
-	dd := dsns.Wrap(d, BlockPrefix)
+	dd := dsns.Wrap(d, prefix)
 	dsb = dd
 	return &blockstore{
 		datastore: dsb,
+		prefix:    prefix,
 	}
 }
 
 type blockstore struct {
 	datastore ds.Batching
+	prefix    ds.Key
 
 	lk      sync.RWMutex
 	gcreq   int32
@@ -157,7 +203,7 @@ func (bs *blockstore) AllKeysChan(ctx context.Context) (<-chan key.Key, error) {
 	// KeysOnly, because that would be _a lot_ of data.
 	q := dsq.Query{KeysOnly: true}
 	// datastore/namespace does *NOT* fix up Query.Prefix
-	q.Prefix = BlockPrefix.String()
+	q.Prefix = bs.prefix.String()
 	res, err := bs.datastore.Query(q)
 	if err != nil {
 		return nil, err
@@ -1,6 +1,7 @@
 package blockstore
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -9,24 +10,64 @@ import (
 
 	"gx/ipfs/QmRg1gKTHzc3CZXSKzem8aR4E3TubFhbgXwfVuWnSK5CC5/go-metrics-interface"
 	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
 	bloom "gx/ipfs/QmeiMCBkYHxkDkDfnDadzz4YxY5ruL5Pj499essE4vRsGM/bbloom"
 )
 
 // bloomCached returns Blockstore that caches Has requests using Bloom filter
 // Size is size of bloom filter in bytes
 func bloomCached(bs Blockstore, ctx context.Context, bloomSize, hashCount int) (*bloomcache, error) {
-	bl, err := bloom.New(float64(bloomSize), float64(hashCount))
-	if err != nil {
-		return nil, err
+	return savedBloomCached(bs, ctx, bloomSize, hashCount, nil)
+}
+
+// savedBloomCached is like bloomCached, but keeps the filter in store
+// between runs. The filter is only rebuilt if the saved one is missing or
+// out of date.
+func savedBloomCached(bs Blockstore, ctx context.Context, bloomSize, hashCount int, store ds.Datastore) (*bloomcache, error) {
+	var bl *bloom.Bloom
+	var saved *savedBloom
+	if store != nil {
+		var err error
+		bl, saved, err = loadBloom(store, bloomSize, hashCount)
+		if err != nil {
+			log.Infof("rebuilding the bloom filter: %s", err)
+		}
+	}
+	if bl == nil {
+		var err error
+		bl, err = bloom.New(float64(bloomSize), float64(hashCount))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bc := &bloomcache{
+		blockstore: bs,
+		bloom:      bl,
+		store:      store,
+		size:       bloomSize,
+		hashes:     hashCount,
+		closing:    make(chan struct{}),
 	}
-	bc := &bloomcache{blockstore: bs, bloom: bl}
 	bc.hits = metrics.NewCtx(ctx, "bloom.hits_total",
 		"Number of cache hits in bloom cache").Counter()
 	bc.total = metrics.NewCtx(ctx, "bloom_total",
 		"Total number of requests to bloom cache").Counter()
 
 	bc.Invalidate()
-	go bc.Rebuild(ctx)
+	if saved != nil {
+		bc.elements = saved.Elements
+		bc.deleted = saved.Deleted
+		close(bc.rebuildChan)
+		atomic.StoreInt32(&bc.active, 1)
+	} else {
+		bc.changed = 1
+		go bc.Rebuild(ctx)
+	}
+	if store != nil {
+		go bc.saveLoop(ctx)
+	}
+
 	if metrics.Active() {
 		go func() {
 			fill := metrics.NewCtx(ctx, "bloom_fill_ratio",
@@ -49,6 +90,11 @@ func bloomCached(bs Blockstore, ctx context.Context, bloomSize, hashCount int) (
 }
 
 type bloomcache struct {
+	// counts of earlier runs, the filter only counts those of this one.
+	// First in the struct for 64 bit alignment of atomic operations.
+	elements uint64
+	deleted  uint64
+
 	bloom  *bloom.Bloom
 	active int32
 
@@ -56,6 +102,17 @@ type bloomcache struct {
 	rebuildChan chan struct{}
 	blockstore  Blockstore
 
+	// store, if set, keeps the filter between runs, see bloom_snapshot.go.
+	// saveLk is held for writing while the filter is saved, and for
+	// reading while blocks are added.
+	store   ds.Datastore
+	size    int
+	hashes  int
+	saveLk  sync.RWMutex
+	changed int32 // the filter differs from the saved one
+	marked  int32 // bloomDirtyKey was set since the filter was saved
+	closing chan struct{}
+
 	// Statistics
 	hits  metrics.Counter
 	total metrics.Counter
@@ -102,7 +159,12 @@ func (b *bloomcache) DeleteBlock(k key.Key) error {
 		return ErrNotFound
 	}
 
-	return b.blockstore.DeleteBlock(k)
+	err := b.blockstore.DeleteBlock(k)
+	if err == nil {
+		atomic.AddUint64(&b.deleted, 1)
+		atomic.StoreInt32(&b.changed, 1)
+	}
+	return err
 }
 
 // if ok == false has is inconclusive
@@ -140,11 +202,24 @@ func (b *bloomcache) Get(k key.Key) (blocks.Block, error) {
 	return b.blockstore.Get(k)
 }
 
+func (b *bloomcache) Peek(k key.Key) (blocks.Block, error) {
+	if has, ok := b.hasCached(k); ok && !has {
+		return nil, ErrNotFound
+	}
+	return Peek(b.blockstore, k)
+}
+
 func (b *bloomcache) Put(bl blocks.Block) error {
 	if has, ok := b.hasCached(bl.Key()); ok && has {
 		return nil
 	}
 
+	b.saveLk.RLock()
+	defer b.saveLk.RUnlock()
+	if err := b.markDirty(); err != nil {
+		return err
+	}
+
 	err := b.blockstore.Put(bl)
 	if err == nil {
 		b.bloom.AddTS([]byte(bl.Key()))
@@ -157,6 +232,12 @@ func (b *bloomcache) PutMany(bs []blocks.Block) error {
 	// to reduce number of puts we need conclusive infomration if block is contained
 	// this means that PutMany can't be improved with bloom cache so we just
 	// just do a passthrough.
+	b.saveLk.RLock()
+	defer b.saveLk.RUnlock()
+	if err := b.markDirty(); err != nil {
+		return err
+	}
+
 	err := b.blockstore.PutMany(bs)
 	if err != nil {
 		return err
@@ -167,6 +248,73 @@ func (b *bloomcache) PutMany(bs []blocks.Block) error {
 	return nil
 }
 
+// markDirty marks the saved filter as out of date before blocks are added
+// that it does not have. It must be called with saveLk held for reading.
+func (b *bloomcache) markDirty() error {
+	if b.store == nil {
+		return nil
+	}
+	atomic.StoreInt32(&b.changed, 1)
+	if atomic.LoadInt32(&b.marked) != 0 {
+		return nil
+	}
+	if err := InvalidateBloomFilter(b.store); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&b.marked, 1)
+	return nil
+}
+
+// save stores the filter if it changed since it was last saved.
+func (b *bloomcache) save() error {
+	if b.store == nil || !b.BloomActive() {
+		return nil
+	}
+
+	b.saveLk.Lock()
+	defer b.saveLk.Unlock()
+	if atomic.LoadInt32(&b.changed) == 0 {
+		return nil
+	}
+
+	err := storeBloom(b.store, &savedBloom{
+		Size:     b.size,
+		Hashes:   b.hashes,
+		Elements: b.elements + b.bloom.ElementsAdded(),
+		Deleted:  atomic.LoadUint64(&b.deleted),
+		Filter:   b.bloom.JSONMarshalTS(),
+	})
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&b.changed, 0)
+	atomic.StoreInt32(&b.marked, 0)
+	return nil
+}
+
+func (b *bloomcache) saveLoop(ctx context.Context) {
+	t := time.NewTicker(bloomSaveInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := b.save(); err != nil {
+				log.Warning("failed to save the bloom filter: ", err)
+			}
+		case <-b.closing:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close saves the filter, so that it need not be rebuilt on the next run.
+func (b *bloomcache) Close() error {
+	close(b.closing)
+	return b.save()
+}
+
 func (b *bloomcache) AllKeysChan(ctx context.Context) (<-chan key.Key, error) {
 	return b.blockstore.AllKeysChan(ctx)
 }
@@ -1,6 +1,7 @@
 package blockstore
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"testing"
@@ -172,3 +173,106 @@ func (c *callbackDatastore) Query(q dsq.Query) (dsq.Results, error) {
 func (c *callbackDatastore) Batch() (ds.Batch, error) {
 	return ds.NewBasicBatch(c), nil
 }
+
+func TestBloomFilterSaved(t *testing.T) {
+	store := syncds.MutexWrap(ds.NewMapDatastore())
+	bs := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	for i := 0; i < 100; i++ {
+		bs.Put(blocks.NewBlock([]byte(fmt.Sprintf("data: %d", i))))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	first, err := savedBloomCached(bs, ctx, 4096, 7, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-first.rebuildChan:
+	case <-ctx.Done():
+		t.Fatalf("Timeout wating for rebuild: %d", first.bloom.ElementsAdded())
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := savedBloomCached(bs, ctx, 4096, 7, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.BloomActive() || second.elements != 100 {
+		t.Fatal("the saved filter was not loaded")
+	}
+	for i := 0; i < 100; i++ {
+		k := blocks.NewBlock([]byte(fmt.Sprintf("data: %d", i))).Key()
+		if has, err := second.Has(k); !has || err != nil {
+			t.Fatal("the saved filter misses a block")
+		}
+	}
+
+	// adding a block makes the saved filter stale until it is saved again.
+	if err := second.Put(blocks.NewBlock([]byte("new block"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadBloom(store, 4096, 7); err != errBloomStale {
+		t.Fatalf("expected the saved filter to be stale, got %v", err)
+	}
+	if err := second.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadBloom(store, 4096, 7); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadBloom(store, 8192, 7); err == nil {
+		t.Fatal("a filter saved with other settings was loaded")
+	}
+}
+
+func TestCorruptBloomFilterIsRebuilt(t *testing.T) {
+	store := syncds.MutexWrap(ds.NewMapDatastore())
+	bs := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	bs.Put(blocks.NewBlock([]byte("foo")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	bc, err := savedBloomCached(bs, ctx, 4096, 7, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-bc.rebuildChan
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := store.Get(bloomFilterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s savedBloom
+	if err := json.Unmarshal(v.([]byte), &s); err != nil {
+		t.Fatal(err)
+	}
+	s.Filter[len(s.Filter)/2] ^= 0xff
+	data, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put(bloomFilterKey, data)
+
+	if _, _, err := loadBloom(store, 4096, 7); err == nil {
+		t.Fatal("a corrupt filter was loaded")
+	}
+
+	bc, err = savedBloomCached(bs, ctx, 4096, 7, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-bc.rebuildChan:
+	case <-ctx.Done():
+		t.Fatal("the filter was not rebuilt")
+	}
+	if has, err := bc.Has(blocks.NewBlock([]byte("foo")).Key()); !has || err != nil {
+		t.Fatal("the rebuilt filter misses a block")
+	}
+}
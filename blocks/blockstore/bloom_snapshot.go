@@ -0,0 +1,158 @@
+package blockstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	bloom "gx/ipfs/QmeiMCBkYHxkDkDfnDadzz4YxY5ruL5Pj499essE4vRsGM/bbloom"
+)
+
+// bloomFilterKey holds the bloom filter between runs. bloomDirtyKey is set
+// before a block is added that the saved filter does not have, and
+// removed when the filter is saved again.
+var (
+	bloomFilterKey = ds.NewKey("/local/bloom/filter")
+	bloomDirtyKey  = ds.NewKey("/local/bloom/dirty")
+)
+
+// bloomSaveInterval is how often a changed bloom filter is saved.
+var bloomSaveInterval = 10 * time.Minute
+
+var errBloomStale = errors.New("the saved bloom filter is out of date")
+
+// savedBloom is the saved form of a bloom filter.
+type savedBloom struct {
+	// Size and Hashes are the parameters the filter was created with.
+	Size   int
+	Hashes int
+
+	// Elements is the number of blocks added, Deleted the number of
+	// blocks removed since. Removed blocks stay in the filter.
+	Elements uint64
+	Deleted  uint64
+
+	Filter   []byte // as returned by Bloom.JSONMarshal
+	Checksum []byte // sha256 of Filter
+}
+
+// loadBloom returns the filter saved in store, if it was created with the
+// same parameters and no blocks were added since it was saved.
+func loadBloom(store ds.Datastore, size, hashes int) (*bloom.Bloom, *savedBloom, error) {
+	dirty, err := store.Has(bloomDirtyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dirty {
+		return nil, nil, errBloomStale
+	}
+
+	v, err := store.Get(bloomFilterKey)
+	if err == ds.ErrNotFound {
+		return nil, nil, errors.New("no saved bloom filter")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, nil, ds.ErrInvalidType
+	}
+
+	var s savedBloom
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, nil, fmt.Errorf("corrupt bloom filter: %s", err)
+	}
+	sum := sha256.Sum256(s.Filter)
+	if !bytes.Equal(sum[:], s.Checksum) {
+		return nil, nil, errors.New("corrupt bloom filter: checksum mismatch")
+	}
+	if s.Size != size || s.Hashes != hashes {
+		return nil, nil, errors.New("the bloom filter settings changed")
+	}
+	// a filter that mostly holds removed blocks gives too many false
+	// positives, it is better to start over.
+	if s.Deleted > s.Elements/2 {
+		return nil, nil, errBloomStale
+	}
+
+	bl, err := bloom.JSONUnmarshal(s.Filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("corrupt bloom filter: %s", err)
+	}
+	return bl, &s, nil
+}
+
+// storeBloom saves s and clears the dirty marker.
+func storeBloom(store ds.Datastore, s *savedBloom) error {
+	sum := sha256.Sum256(s.Filter)
+	s.Checksum = sum[:]
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := store.Put(bloomFilterKey, data); err != nil {
+		return err
+	}
+	if err := store.Delete(bloomDirtyKey); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// InvalidateBloomFilter marks the bloom filter saved in store as out of
+// date. It must be called before blocks are added to the repo other than
+// through a blockstore from CachedBlockstore.
+func InvalidateBloomFilter(store ds.Datastore) error {
+	return store.Put(bloomDirtyKey, []byte{1})
+}
+
+// bloomInvalidator marks the saved bloom filter as out of date before the
+// first block is added, for blockstores that run without the filter.
+type bloomInvalidator struct {
+	GCBlockstore
+	store ds.Datastore
+
+	lk     sync.Mutex
+	marked bool
+}
+
+func (b *bloomInvalidator) invalidate() error {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if b.marked {
+		return nil
+	}
+	if err := InvalidateBloomFilter(b.store); err != nil {
+		return err
+	}
+	b.marked = true
+	return nil
+}
+
+func (b *bloomInvalidator) Peek(k key.Key) (blocks.Block, error) {
+	return Peek(b.GCBlockstore, k)
+}
+
+func (b *bloomInvalidator) Put(bl blocks.Block) error {
+	if err := b.invalidate(); err != nil {
+		return err
+	}
+	return b.GCBlockstore.Put(bl)
+}
+
+func (b *bloomInvalidator) PutMany(bs []blocks.Block) error {
+	if err := b.invalidate(); err != nil {
+		return err
+	}
+	return b.GCBlockstore.PutMany(bs)
+}
@@ -2,9 +2,11 @@ package blockstore
 
 import (
 	"errors"
+	"time"
 
 	"gx/ipfs/QmRg1gKTHzc3CZXSKzem8aR4E3TubFhbgXwfVuWnSK5CC5/go-metrics-interface"
 	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
 )
 
 // Next to each option is it aproximate memory usage per unit
@@ -12,6 +14,9 @@ type CacheOpts struct {
 	HasBloomFilterSize   int // 1 byte
 	HasBloomFilterHashes int // No size, 7 is usually best, consult bloom papers
 	HasARCCacheSize      int // 32 bytes
+
+	// HasBloomFilterStore, if set, keeps the bloom filter between runs.
+	HasBloomFilterStore ds.Datastore
 }
 
 func DefaultCacheOpts() CacheOpts {
@@ -42,8 +47,56 @@ func CachedBlockstore(bs GCBlockstore,
 	}
 	if opts.HasBloomFilterSize != 0 {
 		// *8 because of bytes to bits conversion
-		cbs, err = bloomCached(cbs, ctx, opts.HasBloomFilterSize*8, opts.HasBloomFilterHashes)
+		cbs, err = savedBloomCached(cbs, ctx, opts.HasBloomFilterSize*8,
+			opts.HasBloomFilterHashes, opts.HasBloomFilterStore)
+	} else if opts.HasBloomFilterStore != nil {
+		// a saved filter would miss the blocks we add.
+		cbs = &bloomInvalidator{GCBlockstore: cbs, store: opts.HasBloomFilterStore}
 	}
 
 	return cbs, err
 }
+
+// TierPolicy selects which blocks TieredBlockstore moves to the cold tier.
+type TierPolicy int
+
+const (
+	// TierLRU moves the least recently used blocks once the hot tier
+	// holds more than HotSize bytes.
+	TierLRU TierPolicy = iota
+
+	// TierAccessTime also moves the blocks that were not used for MaxIdle.
+	TierAccessTime
+)
+
+// TierOpts configures TieredBlockstore.
+type TierOpts struct {
+	Policy  TierPolicy
+	HotSize uint64        // in bytes, no limit if 0 with TierAccessTime
+	MaxIdle time.Duration // only used by TierAccessTime
+}
+
+// TieredBlockstore returns a blockstore writing blocks to hot and moving
+// them to cold as they fall out of use. Blocks read from cold are moved
+// back to hot.
+func TieredBlockstore(hot GCBlockstore, cold Blockstore,
+	ctx context.Context, opts TierOpts) (GCBlockstore, error) {
+	switch opts.Policy {
+	case TierLRU:
+		if opts.HotSize == 0 {
+			return nil, errors.New("the lru tier policy needs a hot tier size")
+		}
+	case TierAccessTime:
+		if opts.MaxIdle <= 0 {
+			return nil, errors.New("the atime tier policy needs a maximum idle time")
+		}
+	default:
+		return nil, errors.New("unknown tier policy")
+	}
+
+	ctx = metrics.CtxSubScope(ctx, "bs.tiers")
+	tbs := newTieredBS(ctx, hot, cold, opts)
+	go tbs.scan(ctx)
+	go tbs.run(ctx)
+	return tbs, nil
+}
@@ -0,0 +1,131 @@
+package blockstore
+
+import (
+	"errors"
+	"sync"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+// ErrQuotaExceeded is returned by Put and PutMany when storing the blocks
+// would take the blockstore over its quota.
+var ErrQuotaExceeded = errors.New("blockstore: storage quota exceeded")
+
+// QuotaOpts configures a QuotaBlockstore.
+type QuotaOpts struct {
+	// StorageMax is the quota, in bytes.
+	StorageMax uint64
+
+	// Watermark is the usage above which NearQuota reports true.
+	Watermark uint64
+
+	// Usage returns the number of bytes currently stored.
+	Usage func() (uint64, error)
+
+	// GC, if set, is started in the background when a put would exceed
+	// the quota. The put still fails: puts hold the pin lock, and the GC
+	// cannot run until it is released.
+	GC func() error
+}
+
+// QuotaBlockstore fails puts that would take the wrapped blockstore over
+// its storage quota.
+type QuotaBlockstore struct {
+	GCBlockstore
+	opts QuotaOpts
+
+	gclk      sync.Mutex
+	gcRunning bool
+}
+
+// NewQuotaBlockstore enforces the quota described by opts on bs.
+func NewQuotaBlockstore(bs GCBlockstore, opts QuotaOpts) *QuotaBlockstore {
+	return &QuotaBlockstore{GCBlockstore: bs, opts: opts}
+}
+
+func (q *QuotaBlockstore) Put(b blocks.Block) error {
+	if err := q.reserve([]blocks.Block{b}); err != nil {
+		return err
+	}
+	return q.GCBlockstore.Put(b)
+}
+
+func (q *QuotaBlockstore) PutMany(bs []blocks.Block) error {
+	if err := q.reserve(bs); err != nil {
+		return err
+	}
+	return q.GCBlockstore.PutMany(bs)
+}
+
+// NearQuota returns true once usage is above the watermark.
+func (q *QuotaBlockstore) NearQuota() bool {
+	usage, err := q.opts.Usage()
+	if err != nil {
+		log.Debug("failed to get storage usage: ", err)
+		return false
+	}
+	return usage > q.opts.Watermark
+}
+
+// Peek reads k from the underlying blockstore without marking it used.
+func (q *QuotaBlockstore) Peek(k key.Key) (blocks.Block, error) {
+	return Peek(q.GCBlockstore, k)
+}
+
+// reserve checks that the blocks of bs we do not have yet fit in the
+// quota, starting the GC if they do not.
+func (q *QuotaBlockstore) reserve(bs []blocks.Block) error {
+	var need uint64
+	for _, b := range bs {
+		has, err := q.GCBlockstore.Has(b.Key())
+		if err != nil {
+			return err
+		}
+		if !has {
+			need += uint64(len(b.RawData()))
+		}
+	}
+	if need == 0 {
+		return nil
+	}
+
+	fits, err := q.fits(need)
+	if err != nil || fits {
+		return err
+	}
+	if q.opts.GC != nil {
+		q.startGC()
+	}
+	return ErrQuotaExceeded
+}
+
+func (q *QuotaBlockstore) fits(need uint64) (bool, error) {
+	usage, err := q.opts.Usage()
+	if err != nil {
+		return false, err
+	}
+	return usage+need <= q.opts.StorageMax, nil
+}
+
+// startGC starts a GC in the background unless one is running already.
+// It takes the GC lock once the puts holding the pin lock are done.
+func (q *QuotaBlockstore) startGC() {
+	q.gclk.Lock()
+	defer q.gclk.Unlock()
+	if q.gcRunning {
+		return
+	}
+	q.gcRunning = true
+
+	log.Info("storage quota reached, starting the garbage collector")
+	go func() {
+		if err := q.opts.GC(); err != nil {
+			log.Error("quota garbage collection failed: ", err)
+		}
+		q.gclk.Lock()
+		q.gcRunning = false
+		q.gclk.Unlock()
+	}()
+}
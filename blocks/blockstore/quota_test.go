@@ -0,0 +1,137 @@
+package blockstore
+
+import (
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	ds_sync "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/sync"
+)
+
+// storeUsage adds up the sizes of the blocks in bs.
+func storeUsage(bs Blockstore) func() (uint64, error) {
+	return func() (uint64, error) {
+		keys, err := bs.AllKeysChan(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		var usage uint64
+		for k := range keys {
+			b, err := bs.Get(k)
+			if err != nil {
+				return 0, err
+			}
+			usage += uint64(len(b.RawData()))
+		}
+		return usage, nil
+	}
+}
+
+func newQuotaTestBlockstore(opts QuotaOpts) (*QuotaBlockstore, GCBlockstore) {
+	bs := NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+	opts.Usage = storeUsage(bs)
+	return NewQuotaBlockstore(bs, opts), bs
+}
+
+func blockOfSize(n int, fill byte) blocks.Block {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = fill
+	}
+	return blocks.NewBlock(data)
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	q, _ := newQuotaTestBlockstore(QuotaOpts{StorageMax: 100, Watermark: 50})
+
+	a := blockOfSize(60, 'a')
+	if err := q.Put(a); err != nil {
+		t.Fatal(err)
+	}
+	if !q.NearQuota() {
+		t.Fatal("expected to be above the watermark")
+	}
+
+	if err := q.Put(blockOfSize(60, 'b')); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if err := q.PutMany([]blocks.Block{blockOfSize(20, 'c'), blockOfSize(30, 'd')}); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded for the batch, got %v", err)
+	}
+
+	// blocks we already have take no space.
+	if err := q.Put(a); err != nil {
+		t.Fatalf("storing a block we have should not fail: %s", err)
+	}
+	if err := q.PutMany([]blocks.Block{a, blockOfSize(40, 'e')}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQuotaGC(t *testing.T) {
+	old := blockOfSize(80, 'o')
+
+	var q *QuotaBlockstore
+	gcDone := make(chan error, 1)
+	q, _ = newQuotaTestBlockstore(QuotaOpts{
+		StorageMax: 100,
+		GC: func() error {
+			// take the real lock, as gc.GC does
+			defer q.GCLock().Unlock()
+			err := q.DeleteBlock(old.Key())
+			gcDone <- err
+			return err
+		},
+	})
+
+	if err := q.Put(old); err != nil {
+		t.Fatal(err)
+	}
+
+	// a put holds the pin lock, as ipfs add does. It must fail at once
+	// rather than wait for the GC, which cannot get the GC lock.
+	unlocker := q.PinLock()
+	b := blockOfSize(50, 'n')
+	start := time.Now()
+	if err := q.Put(b); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("the put waited for the GC")
+	}
+	select {
+	case <-gcDone:
+		t.Fatal("the GC ran while the pin lock was held")
+	default:
+	}
+
+	// another put does not start a second GC
+	if err := q.Put(b); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	unlocker.Unlock()
+
+	select {
+	case err := <-gcDone:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the GC did not run once the pin lock was released")
+	}
+	select {
+	case <-gcDone:
+		t.Fatal("expected a single GC run")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := q.Put(b); err != nil {
+		t.Fatalf("put should succeed after GC: %s", err)
+	}
+	if has, _ := q.Has(b.Key()); !has {
+		t.Fatal("block was not stored")
+	}
+}
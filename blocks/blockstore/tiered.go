@@ -0,0 +1,366 @@
+package blockstore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-ipfs/blocks"
+
+	"gx/ipfs/QmRg1gKTHzc3CZXSKzem8aR4E3TubFhbgXwfVuWnSK5CC5/go-metrics-interface"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+// tierCheckInterval is how often TierAccessTime looks for idle blocks.
+var tierCheckInterval = time.Minute
+
+// tiered writes blocks to a hot tier and moves them to a cold tier as they
+// fall out of use, see TieredBlockstore.
+type tiered struct {
+	hot  GCBlockstore
+	cold Blockstore
+	opts TierOpts
+
+	// lru holds a *tierEntry for every block of the hot tier, most
+	// recently used first.
+	lk      sync.Mutex
+	lru     *list.List
+	entries map[key.Key]*list.Element
+	size    uint64
+
+	// scanned is closed once the blocks that were in the hot tier on
+	// startup are tracked. Nothing is demoted before.
+	scanned  chan struct{}
+	demoteCh chan struct{}
+
+	promotions metrics.Counter
+	demotions  metrics.Counter
+}
+
+type tierEntry struct {
+	k      key.Key
+	size   uint64
+	access time.Time
+}
+
+func newTieredBS(ctx context.Context, hot GCBlockstore, cold Blockstore, opts TierOpts) *tiered {
+	t := &tiered{
+		hot:      hot,
+		cold:     cold,
+		opts:     opts,
+		lru:      list.New(),
+		entries:  make(map[key.Key]*list.Element),
+		scanned:  make(chan struct{}),
+		demoteCh: make(chan struct{}, 1),
+	}
+	t.promotions = metrics.NewCtx(ctx, "promotions_total",
+		"Number of blocks moved to the hot tier").Counter()
+	t.demotions = metrics.NewCtx(ctx, "demotions_total",
+		"Number of blocks moved to the cold tier").Counter()
+	return t
+}
+
+// scan tracks the blocks that are in the hot tier already. They are
+// considered used at startup, but less recently than any block used since.
+func (t *tiered) scan(ctx context.Context) {
+	defer close(t.scanned)
+
+	start := time.Now()
+	ch, err := t.hot.AllKeysChan(ctx)
+	if err != nil {
+		log.Errorf("tiered blockstore: failed to list the hot tier: %s", err)
+		return
+	}
+	for k := range ch {
+		t.lk.Lock()
+		_, ok := t.entries[k]
+		t.lk.Unlock()
+		if ok {
+			continue
+		}
+
+		b, err := t.hot.Get(k)
+		if err != nil {
+			continue
+		}
+
+		t.lk.Lock()
+		if _, ok := t.entries[k]; !ok {
+			e := &tierEntry{k: k, size: uint64(len(b.RawData())), access: start}
+			t.entries[k] = t.lru.PushBack(e)
+			t.size += e.size
+		}
+		t.lk.Unlock()
+	}
+	t.signal()
+}
+
+func (t *tiered) run(ctx context.Context) {
+	select {
+	case <-t.scanned:
+	case <-ctx.Done():
+		return
+	}
+
+	var tick <-chan time.Time
+	if t.opts.Policy == TierAccessTime {
+		ticker := time.NewTicker(tierCheckInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-t.demoteCh:
+		case <-tick:
+		case <-ctx.Done():
+			return
+		}
+		t.demote()
+	}
+}
+
+// signal asks the run loop to look for blocks to demote.
+func (t *tiered) signal() {
+	select {
+	case t.demoteCh <- struct{}{}:
+	default:
+	}
+}
+
+// touch marks k as just used.
+func (t *tiered) touch(k key.Key, size uint64) {
+	t.lk.Lock()
+	if el, ok := t.entries[k]; ok {
+		el.Value.(*tierEntry).access = time.Now()
+		t.lru.MoveToFront(el)
+	} else {
+		t.entries[k] = t.lru.PushFront(&tierEntry{k: k, size: size, access: time.Now()})
+		t.size += size
+	}
+	over := t.opts.HotSize > 0 && t.size > t.opts.HotSize
+	t.lk.Unlock()
+
+	if over {
+		t.signal()
+	}
+}
+
+// forget stops tracking k, which left the hot tier.
+func (t *tiered) forget(k key.Key) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if el, ok := t.entries[k]; ok {
+		t.size -= el.Value.(*tierEntry).size
+		t.lru.Remove(el)
+		delete(t.entries, k)
+	}
+}
+
+// victim returns the block to demote next, if any.
+func (t *tiered) victim(now time.Time) (key.Key, bool) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	el := t.lru.Back()
+	if el == nil {
+		return "", false
+	}
+	e := el.Value.(*tierEntry)
+	if t.opts.HotSize > 0 && t.size > t.opts.HotSize {
+		return e.k, true
+	}
+	if t.opts.Policy == TierAccessTime && now.Sub(e.access) > t.opts.MaxIdle {
+		return e.k, true
+	}
+	return "", false
+}
+
+// demote moves blocks to the cold tier until the policy is satisfied.
+func (t *tiered) demote() {
+	for {
+		k, ok := t.victim(time.Now())
+		if !ok {
+			return
+		}
+		if err := t.moveToCold(k); err != nil {
+			log.Warningf("tiered blockstore: failed to demote %s: %s", k, err)
+			return
+		}
+	}
+}
+
+// moveToCold holds the pin lock, so that the GC does not run while a block
+// is between the tiers.
+func (t *tiered) moveToCold(k key.Key) error {
+	unlocker := t.hot.PinLock()
+	defer unlocker.Unlock()
+
+	b, err := t.hot.Get(k)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		t.forget(k)
+		return nil
+	default:
+		return err
+	}
+
+	if err := t.cold.Put(b); err != nil {
+		return err
+	}
+	if err := t.hot.DeleteBlock(k); err != nil && err != ds.ErrNotFound && err != ErrNotFound {
+		return err
+	}
+	t.forget(k)
+	t.demotions.Inc()
+	return nil
+}
+
+// promote copies b back to the hot tier after it was read from the cold
+// one. This does not take the pin lock, as reads do not. The GC itself
+// reads with Peek, at worst a block collected meanwhile is promoted, and
+// left for the next GC.
+func (t *tiered) promote(b blocks.Block) {
+	if err := t.hot.Put(b); err != nil {
+		log.Warningf("tiered blockstore: failed to promote %s: %s", b.Key(), err)
+		return
+	}
+	t.touch(b.Key(), uint64(len(b.RawData())))
+	if err := t.cold.DeleteBlock(b.Key()); err != nil {
+		log.Debugf("tiered blockstore: failed to remove %s from the cold tier: %s", b.Key(), err)
+	}
+	t.promotions.Inc()
+}
+
+func (t *tiered) Get(k key.Key) (blocks.Block, error) {
+	b, err := t.hot.Get(k)
+	if err == nil {
+		t.touch(k, uint64(len(b.RawData())))
+		return b, nil
+	}
+	if err != ErrNotFound {
+		return nil, err
+	}
+
+	b, err = t.cold.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	t.promote(b)
+	return b, nil
+}
+
+// Peek reads k from either tier without moving it.
+func (t *tiered) Peek(k key.Key) (blocks.Block, error) {
+	b, err := Peek(t.hot, k)
+	if err != ErrNotFound {
+		return b, err
+	}
+	return Peek(t.cold, k)
+}
+
+func (t *tiered) Has(k key.Key) (bool, error) {
+	has, err := t.hot.Has(k)
+	if err != nil || has {
+		return has, err
+	}
+	return t.cold.Has(k)
+}
+
+func (t *tiered) Put(b blocks.Block) error {
+	if has, err := t.cold.Has(b.Key()); err == nil && has {
+		return nil // already stored.
+	}
+	if err := t.hot.Put(b); err != nil {
+		return err
+	}
+	t.touch(b.Key(), uint64(len(b.RawData())))
+	return nil
+}
+
+func (t *tiered) PutMany(bs []blocks.Block) error {
+	var good []blocks.Block
+	for _, b := range bs {
+		if has, err := t.cold.Has(b.Key()); err == nil && has {
+			continue
+		}
+		good = append(good, b)
+	}
+	if err := t.hot.PutMany(good); err != nil {
+		return err
+	}
+	for _, b := range good {
+		t.touch(b.Key(), uint64(len(b.RawData())))
+	}
+	return nil
+}
+
+// DeleteBlock removes k from both tiers. The error of the hot tier is
+// returned if neither of them held k.
+func (t *tiered) DeleteBlock(k key.Key) error {
+	err1 := t.hot.DeleteBlock(k)
+	if err1 != nil && err1 != ds.ErrNotFound && err1 != ErrNotFound {
+		return err1
+	}
+	t.forget(k)
+
+	err2 := t.cold.DeleteBlock(k)
+	switch err2 {
+	case nil:
+		return nil
+	case ds.ErrNotFound, ErrNotFound:
+		return err1
+	default:
+		return err2
+	}
+}
+
+// AllKeysChan lists the keys of both tiers. A block that is being moved
+// may be listed twice.
+func (t *tiered) AllKeysChan(ctx context.Context) (<-chan key.Key, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	a, err := t.hot.AllKeysChan(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	b, err := t.cold.AllKeysChan(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan key.Key)
+	go func() {
+		defer cancel()
+		defer close(out)
+
+		for _, in := range []<-chan key.Key{a, b} {
+			for k := range in {
+				select {
+				case out <- k:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (t *tiered) GCLock() Unlocker {
+	return t.hot.GCLock()
+}
+
+func (t *tiered) PinLock() Unlocker {
+	return t.hot.PinLock()
+}
+
+func (t *tiered) GCRequested() bool {
+	return t.hot.GCRequested()
+}
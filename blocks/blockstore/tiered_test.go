@@ -0,0 +1,188 @@
+package blockstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs/blocks"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	syncds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/sync"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+// testTiered returns a tiered blockstore without the background demotion,
+// tests call demote themselves.
+func testTiered(t *testing.T, d ds.Batching, opts TierOpts) (*tiered, Blockstore, Blockstore) {
+	hot := NewBlockstore(d)
+	cold := NewBlockstoreWithPrefix(d, ColdBlockPrefix)
+
+	tb := newTieredBS(context.Background(), hot, cold, opts)
+	tb.scan(context.Background())
+	return tb, hot, cold
+}
+
+func expectTier(t *testing.T, b blocks.Block, hot, cold Blockstore, inHot bool) {
+	hh, err := hot.Has(b.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := cold.Has(b.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hh != inHot || ch == inHot {
+		t.Fatalf("%s: in hot tier: %t, in cold tier: %t, expected hot: %t", b, hh, ch, inHot)
+	}
+}
+
+func TestTieredLRU(t *testing.T) {
+	tb, hot, cold := testTiered(t, syncds.MutexWrap(ds.NewMapDatastore()),
+		TierOpts{Policy: TierLRU, HotSize: 100})
+
+	a, b, c := blockOfSize(40, 'a'), blockOfSize(40, 'b'), blockOfSize(40, 'c')
+	for _, bl := range []blocks.Block{a, b, c} {
+		if err := tb.Put(bl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tb.Get(a.Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	tb.demote()
+	expectTier(t, a, hot, cold, true)
+	expectTier(t, b, hot, cold, false)
+	expectTier(t, c, hot, cold, true)
+
+	// reading b promotes it, and c is the least recently used now.
+	got, err := tb.Get(b.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Key() != b.Key() {
+		t.Fatal("got the wrong block from the cold tier")
+	}
+	tb.demote()
+	expectTier(t, a, hot, cold, true)
+	expectTier(t, b, hot, cold, true)
+	expectTier(t, c, hot, cold, false)
+
+	if has, err := tb.Has(c.Key()); err != nil || !has {
+		t.Fatal("a demoted block should still be found")
+	}
+	// storing a block of the cold tier does not copy it to the hot one.
+	if err := tb.Put(c); err != nil {
+		t.Fatal(err)
+	}
+	expectTier(t, c, hot, cold, false)
+}
+
+func TestTieredPeek(t *testing.T) {
+	tb, hot, cold := testTiered(t, syncds.MutexWrap(ds.NewMapDatastore()),
+		TierOpts{Policy: TierLRU, HotSize: 100})
+	pbs := NewPeekingBlockstore(NewBarrierBlockstore(tb))
+
+	a, b, c := blockOfSize(40, 'a'), blockOfSize(40, 'b'), blockOfSize(40, 'c')
+	for _, bl := range []blocks.Block{a, b, c} {
+		if err := tb.Put(bl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tb.Get(a.Key()); err != nil {
+		t.Fatal(err)
+	}
+	tb.demote()
+	expectTier(t, b, hot, cold, false)
+
+	// peeking at a cold block leaves it in the cold tier.
+	got, err := pbs.Get(b.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Key() != b.Key() {
+		t.Fatal("got the wrong block from the cold tier")
+	}
+	expectTier(t, b, hot, cold, false)
+
+	// peeking at a hot block does not make it recently used.
+	if _, err := pbs.Get(c.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tb.Put(blockOfSize(40, 'd')); err != nil {
+		t.Fatal(err)
+	}
+	tb.demote()
+	expectTier(t, a, hot, cold, true)
+	expectTier(t, c, hot, cold, false)
+}
+
+func TestTieredAccessTime(t *testing.T) {
+	tb, hot, cold := testTiered(t, syncds.MutexWrap(ds.NewMapDatastore()),
+		TierOpts{Policy: TierAccessTime, MaxIdle: time.Millisecond * 20})
+
+	a, b := blockOfSize(10, 'a'), blockOfSize(10, 'b')
+	if err := tb.Put(a); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 40)
+	if err := tb.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	tb.demote()
+	expectTier(t, a, hot, cold, false)
+	expectTier(t, b, hot, cold, true)
+}
+
+func TestTieredScansHotTier(t *testing.T) {
+	d := syncds.MutexWrap(ds.NewMapDatastore())
+	hot := NewBlockstore(d)
+	a, b := blockOfSize(30, 'a'), blockOfSize(50, 'b')
+	if err := hot.PutMany([]blocks.Block{a, b}); err != nil {
+		t.Fatal(err)
+	}
+
+	tb, _, _ := testTiered(t, d, TierOpts{Policy: TierLRU, HotSize: 1000})
+	if tb.size != 80 {
+		t.Fatalf("expected the 80 bytes of the hot tier to be tracked, got %d", tb.size)
+	}
+}
+
+func TestTieredDeleteAndList(t *testing.T) {
+	tb, hot, cold := testTiered(t, syncds.MutexWrap(ds.NewMapDatastore()),
+		TierOpts{Policy: TierLRU, HotSize: 50})
+
+	a, b := blockOfSize(40, 'a'), blockOfSize(40, 'b')
+	if err := tb.PutMany([]blocks.Block{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	tb.demote()
+	expectTier(t, a, hot, cold, false)
+
+	ch, err := tb.AllKeysChan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[key.Key]bool)
+	for k := range ch {
+		keys[k] = true
+	}
+	if len(keys) != 2 || !keys[a.Key()] || !keys[b.Key()] {
+		t.Fatalf("expected the keys of both tiers, got %v", keys)
+	}
+
+	if err := tb.DeleteBlock(a.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tb.DeleteBlock(b.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := tb.Has(a.Key()); has {
+		t.Fatal("block of the cold tier was not deleted")
+	}
+	if err := tb.DeleteBlock(a.Key()); err == nil {
+		t.Fatal("deleting a missing block should fail")
+	}
+}
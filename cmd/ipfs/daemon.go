@@ -18,6 +18,7 @@ import (
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	"github.com/ipfs/go-ipfs/core/corerouting"
 	nodeMount "github.com/ipfs/go-ipfs/fuse/node"
+	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	migrate "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 
@@ -42,6 +43,7 @@ const (
 	migrateKwd                = "migrate"
 	mountKwd                  = "mount"
 	offlineKwd                = "offline"
+	passphraseFileKwd         = "passphrase-file"
 	routingOptionKwd          = "routing"
 	routingOptionSupernodeKwd = "supernode"
 	unencryptTransportKwd     = "disable-transport-encryption"
@@ -120,6 +122,12 @@ environment variable:
 
     export IPFS_PATH=/path/to/ipfsrepo
 
+Encrypted datastore
+
+If the repo was initialized with 'ipfs init --encrypt-datastore', the
+passphrase of the datastore is read from the file given with
+--passphrase-file, or from the $IPFS_PASSPHRASE environment variable.
+
 DEPRECATION NOTICE
 
 Previously, IPFS used an environment variable as seen below:
@@ -145,6 +153,7 @@ Headers.
 		cmds.BoolOption(adjustFDLimitKwd, "Check and raise file descriptor limits if needed").Default(true),
 		cmds.BoolOption(offlineKwd, "Run offline. Do not connect to the rest of the network but provide local API.").Default(false),
 		cmds.BoolOption(migrateKwd, "If true, assume yes at the migrate prompt. If false, assume no."),
+		cmds.StringOption(passphraseFileKwd, "File holding the passphrase of an encrypted datastore. Defaults to $IPFS_PASSPHRASE."),
 
 		// TODO: add way to override addresses. tricky part: updating the config if also --init.
 		// cmds.StringOption(apiAddrKwd, "Address for the daemon rpc API (overrides config)"),
@@ -219,9 +228,18 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		}
 	}
 
+	passphrase := os.Getenv(fsrepo.EnvPassphrase)
+	if path, found, _ := req.Option(passphraseFileKwd).String(); found {
+		passphrase, err = fsrepo.ReadPassphraseFile(path)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	}
+
 	// acquire the repo lock _before_ constructing a node. we need to make
 	// sure we are permitted to access the resources (datastore, etc.)
-	repo, err := fsrepo.Open(req.InvocContext().ConfigRoot)
+	repo, err := fsrepo.OpenWithPassphrase(req.InvocContext().ConfigRoot, passphrase)
 	switch err {
 	default:
 		res.SetError(err, cmds.ErrNormal)
@@ -236,12 +254,18 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 
 		if !domigrate {
 			fmt.Println("Not running migrations of fs-repo now.")
+			fmt.Println("Run 'ipfs repo migrate' to migrate it with the built in migrations.")
 			fmt.Println("Please get fs-repo-migrations from https://dist.ipfs.io")
 			res.SetError(fmt.Errorf("fs-repo requires migration"), cmds.ErrNormal)
 			return
 		}
 
-		err = migrate.RunMigration(fsrepo.RepoVersion)
+		err = fsrepo.Migrate(req.InvocContext().ConfigRoot, fsrepo.RepoVersion, migrate.Options{Out: os.Stdout})
+		if _, ok := err.(migrate.NoMigrationError); ok {
+			// repos older than the built in migrations
+			fmt.Printf("  => %s.\n", err)
+			err = migrate.RunMigration(fsrepo.RepoVersion)
+		}
 		if err != nil {
 			fmt.Println("The migrations of fs-repo failed:")
 			fmt.Printf("  %s\n", err)
@@ -251,7 +275,7 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 			return
 		}
 
-		repo, err = fsrepo.Open(req.InvocContext().ConfigRoot)
+		repo, err = fsrepo.OpenWithPassphrase(req.InvocContext().ConfigRoot, passphrase)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -266,6 +290,17 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		return
 	}
 
+	if err := cfg.Domain.Validate(); err != nil {
+		res.SetError(fmt.Errorf("invalid Domain config: %s", err), cmds.ErrNormal)
+		repo.Close() // because ownership hasn't been transferred to the node
+		return
+	}
+	if d := cfg.Domain; d.LegacyGroupID != "" && !d.Enabled() {
+		name, _, _ := config.ParseLegacyGroupID(d.LegacyGroupID)
+		fmt.Printf("This node was in group %q of an older version, which is no longer used.\n", name)
+		fmt.Println("Run 'ipfs domain join' to join a domain again, it runs on the public network until then.")
+	}
+
 	// Start assembling node config
 	ncfg := &core.BuildCfg{
 		Repo:      repo,
@@ -366,6 +401,9 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		return
 	}
 
+	// unpin expired pins
+	expireErrc := runPinExpiry(req, node)
+
 	// initialize metrics collector
 	err = mprome.Inject()
 	if err != nil {
@@ -376,7 +414,7 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 	fmt.Printf("Daemon is ready\n")
 	// collect long-running errors and block for shutdown
 	// TODO(cryptix): our fuse currently doesnt follow this pattern for graceful shutdown
-	for err := range merge(apiErrc, gwErrc, gcErrc) {
+	for err := range merge(apiErrc, gwErrc, gcErrc, expireErrc) {
 		if err != nil {
 			log.Error(err)
 			res.SetError(err, cmds.ErrNormal)
@@ -422,7 +460,7 @@ func serveHTTPApi(req cmds.Request) (error, <-chan error) {
 	}
 	gatewayOpt := corehttp.GatewayOption(false, corehttp.WebUIPaths...)
 	if unrestricted {
-		gatewayOpt = corehttp.GatewayOption(true, "/ipfs", "/ipns")
+		gatewayOpt = corehttp.GatewayOption(true, "/ipfs", "/ipns", "/domain")
 	}
 
 	var opts = []corehttp.ServeOption{
@@ -513,7 +551,7 @@ func serveHTTPGateway(req cmds.Request) (error, <-chan error) {
 		corehttp.CommandsROOption(*req.InvocContext()),
 		corehttp.VersionOption(),
 		corehttp.IPNSHostnameOption(),
-		corehttp.GatewayOption(writable, "/ipfs", "/ipns"),
+		corehttp.GatewayOption(writable, "/ipfs", "/ipns", "/domain"),
 	}
 
 	if len(cfg.Gateway.RootRedirect) > 0 {
@@ -587,6 +625,15 @@ func maybeRunGC(req cmds.Request, node *core.IpfsNode) (error, <-chan error) {
 	return nil, errc
 }
 
+func runPinExpiry(req cmds.Request, node *core.IpfsNode) <-chan error {
+	errc := make(chan error)
+	go func() {
+		errc <- corerepo.PeriodicExpire(req.Context(), node)
+		close(errc)
+	}()
+	return errc
+}
+
 // merge does fan-in of multiple read-only error channels
 // taken from http://blog.golang.org/pipelines
 func merge(cs ...<-chan error) <-chan error {
@@ -11,9 +11,11 @@ import (
 	assets "github.com/ipfs/go-ipfs/assets"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
+	group "github.com/ipfs/go-ipfs/group"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
 	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
 )
 
@@ -32,6 +34,18 @@ located at ~/.ipfs. To change the repo location, set the $IPFS_PATH
 environment variable:
 
     export IPFS_PATH=/path/to/ipfsrepo
+
+To create a new private domain with this node as its authority, pass the
+domain name with --domain. Nodes only connect to peers in the same domain;
+other nodes are admitted with 'ipfs domain invite' and 'ipfs domain join':
+
+    ipfs init --domain=example-domain
+
+To encrypt the datastore, pass --encrypt-datastore and set the passphrase
+in the $IPFS_PASSPHRASE environment variable. It is needed whenever the
+repo is opened:
+
+    IPFS_PASSPHRASE=... ipfs init --encrypt-datastore
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -40,6 +54,8 @@ environment variable:
 	Options: []cmds.Option{
 		cmds.IntOption("bits", "b", "Number of bits to use in the generated RSA private key.").Default(nBitsForKeypairDefault),
 		cmds.BoolOption("empty-repo", "e", "Don't add and pin help files to the local storage.").Default(false),
+		cmds.StringOption("domain", "Create a private domain with this name, with this node as its authority."),
+		cmds.BoolOption("encrypt-datastore", "Encrypt the datastore with the passphrase in $IPFS_PASSPHRASE.").Default(false),
 
 		// TODO need to decide whether to expose the override as a file or a
 		// directory. That is: should we allow the user to also specify the
@@ -79,6 +95,18 @@ environment variable:
 			return
 		}
 
+		domain, _, err := req.Option("domain").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		encrypt, _, err := req.Option("encrypt-datastore").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
 		var conf *config.Config
 
 		f := req.Files()
@@ -96,7 +124,7 @@ environment variable:
 			}
 		}
 
-		if err := doInit(os.Stdout, req.InvocContext().ConfigRoot, empty, nBitsForKeypair, conf); err != nil {
+		if err := doInit(os.Stdout, req.InvocContext().ConfigRoot, empty, nBitsForKeypair, domain, encrypt, conf); err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
@@ -108,10 +136,10 @@ Reinitializing would overwrite your keys.
 `)
 
 func initWithDefaults(out io.Writer, repoRoot string) error {
-	return doInit(out, repoRoot, false, nBitsForKeypairDefault, nil)
+	return doInit(out, repoRoot, false, nBitsForKeypairDefault, "", false, nil)
 }
 
-func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, conf *config.Config) error {
+func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, domain string, encrypt bool, conf *config.Config) error {
 	if _, err := fmt.Fprintf(out, "initializing ipfs node at %s\n", repoRoot); err != nil {
 		return err
 	}
@@ -124,6 +152,10 @@ func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, con
 		return errRepoExists
 	}
 
+	if encrypt && os.Getenv(fsrepo.EnvPassphrase) == "" {
+		return fsrepo.ErrNoPassphrase
+	}
+
 	if conf == nil {
 		var err error
 		conf, err = config.Init(out, nBitsForKeypair)
@@ -132,6 +164,28 @@ func doInit(out io.Writer, repoRoot string, empty bool, nBitsForKeypair int, con
 		}
 	}
 
+	if encrypt {
+		conf.Datastore.Encrypted = true
+	}
+
+	if domain != "" {
+		self, err := peer.IDB58Decode(conf.Identity.PeerID)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "generating %v-bit RSA domain authority keypair...", nBitsForKeypair)
+		if err := group.CreateDomain(&conf.Domain, domain, self, nBitsForKeypair); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "done\n")
+		fmt.Fprintf(out, "created domain %s: %s\n", conf.Domain.Name, conf.Domain.GroupID)
+	}
+
+	if err := conf.Domain.Validate(); err != nil {
+		return err
+	}
+
 	if err := fsrepo.Init(repoRoot, conf); err != nil {
 		return err
 	}
@@ -107,5 +107,7 @@ var cmdDetailsMap = map[*cmds.Command]cmdDetails{
 	commands.LogCmd:                       {cannotRunOnClient: true},
 	commands.ActiveReqsCmd:                {cannotRunOnClient: true},
 	commands.RepoFsckCmd:                  {cannotRunOnDaemon: true},
+	commands.RepoRekeyCmd:                 {cannotRunOnDaemon: true},
+	commands.RepoMigrateCmd:               {cannotRunOnDaemon: true, doesNotUseRepo: true},
 	commands.ConfigCmd.Subcommand("edit"): {cannotRunOnDaemon: true, doesNotUseRepo: true},
 }
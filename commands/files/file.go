@@ -43,6 +43,14 @@ type StatFile interface {
 	Stat() os.FileInfo
 }
 
+// AbsPathFile is implemented by files that know where they live on the
+// local filesystem. AbsPath returns the empty string if they do not.
+type AbsPathFile interface {
+	File
+
+	AbsPath() string
+}
+
 type PeekFile interface {
 	SizeFile
 
@@ -16,6 +16,10 @@ const (
 	applicationSymlink   = "application/symlink"
 
 	contentTypeHeader = "Content-Type"
+
+	// AbsPathHeader carries the absolute path of a file on the client's
+	// filesystem, see AbsPathFile.
+	AbsPathHeader = "Abspath"
 )
 
 // MultipartFile implements File, and is created from a `multipart.Part`.
@@ -92,6 +96,17 @@ func (f *MultipartFile) FullPath() string {
 	return f.FileName()
 }
 
+func (f *MultipartFile) AbsPath() string {
+	if f == nil || f.Part == nil {
+		return ""
+	}
+	abspath, err := url.QueryUnescape(f.Part.Header.Get(AbsPathHeader))
+	if err != nil {
+		return ""
+	}
+	return abspath
+}
+
 func (f *MultipartFile) Read(p []byte) (int, error) {
 	if f.IsDirectory() {
 		return 0, ErrNotReader
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 )
 
 // ReaderFile is a implementation of File created from an `io.Reader`.
@@ -11,12 +12,21 @@ import (
 type ReaderFile struct {
 	filename string
 	fullpath string
+	abspath  string
 	reader   io.ReadCloser
 	stat     os.FileInfo
 }
 
 func NewReaderFile(filename, path string, reader io.ReadCloser, stat os.FileInfo) *ReaderFile {
-	return &ReaderFile{filename, path, reader, stat}
+	f := &ReaderFile{filename: filename, fullpath: path, reader: reader, stat: stat}
+
+	// only files opened from disk have a stat, stdin and the like do not.
+	if stat != nil && path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			f.abspath = abs
+		}
+	}
+	return f
 }
 
 func (f *ReaderFile) IsDirectory() bool {
@@ -35,6 +45,10 @@ func (f *ReaderFile) FullPath() string {
 	return f.fullpath
 }
 
+func (f *ReaderFile) AbsPath() string {
+	return f.abspath
+}
+
 func (f *ReaderFile) Read(p []byte) (int, error) {
 	return f.reader.Read(p)
 }
@@ -95,6 +95,9 @@ func (mfr *MultiFileReader) Read(buf []byte) (written int, err error) {
 			header.Set("Content-Disposition", fmt.Sprintf("file; filename=\"%s\"", filename))
 
 			header.Set("Content-Type", contentType)
+			if af, ok := file.(files.AbsPathFile); ok && af.AbsPath() != "" {
+				header.Set(files.AbsPathHeader, url.QueryEscape(af.AbsPath()))
+			}
 
 			_, err := mfr.mpWriter.CreatePart(header)
 			if err != nil {
@@ -11,6 +11,7 @@ import (
 	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
 	bserv "github.com/ipfs/go-ipfs/blockservice"
 	offline "github.com/ipfs/go-ipfs/exchange/offline"
+	filestore "github.com/ipfs/go-ipfs/filestore"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
 	pin "github.com/ipfs/go-ipfs/pin"
@@ -167,11 +168,35 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 	if !cfg.Permament {
 		opts.HasBloomFilterSize = 0
 	}
+	opts.HasBloomFilterStore = rds
 
-	n.Blockstore, err = bstore.CachedBlockstore(bs, ctx, opts)
+	var storeBS bstore.GCBlockstore = bs
+	if conf.Datastore.Tiers != nil {
+		storeBS, err = setupTiers(ctx, bs, rds, conf)
+		if err != nil {
+			return err
+		}
+	}
+
+	quotaBS, err := n.setupQuota(storeBS, conf)
+	if err != nil {
+		return err
+	}
+
+	// files added with --nocopy are kept as references next to the blocks,
+	// they do not count against the quota.
+	n.Filestore = filestore.NewFilestore(quotaBS, filestore.NewFileManager(rds))
+
+	cbs, err := bstore.CachedBlockstore(n.Filestore, ctx, opts)
 	if err != nil {
 		return err
 	}
+	if conf.Datastore.GCPolicy == "lru" {
+		n.BlockAccess = bstore.NewAccessBlockstore(ctx, cbs, rds)
+		cbs = n.BlockAccess
+	}
+	// the barrier sees every put, for incremental GC
+	n.Blockstore = bstore.NewBarrierBlockstore(cbs)
 
 	rcfg, err := n.Repo.Config()
 	if err != nil {
@@ -182,6 +207,12 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		bs.HashOnRead(true)
 	}
 
+	// the inventory must be open before the online services, which sync it
+	// with other peers.
+	if err := n.setupInventory(rcfg); err != nil {
+		return err
+	}
+
 	if cfg.Online {
 		do := setupDiscoveryOption(rcfg.Discovery)
 		if err := n.startOnlineServices(ctx, cfg.Routing, cfg.Host, do); err != nil {
@@ -16,6 +16,7 @@ import (
         dagtest "github.com/ipfs/go-ipfs/merkledag/test"
         mfs "github.com/ipfs/go-ipfs/mfs"
         ft "github.com/ipfs/go-ipfs/unixfs"
+        crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
         u "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
 )
 
@@ -32,6 +33,8 @@ const (
 	onlyHashOptionName = "only-hash"
 	chunkerOptionName  = "chunker"
 	pinOptionName      = "pin"
+	encryptOptionName  = "encrypt"
+	nocopyOptionName   = "nocopy"
 )
 
 var AddCmd = &cmds.Command{
@@ -57,6 +60,19 @@ its filename. For example:
   added QmaG4FuMqEBnQNn3C8XJ5bpW8kLs7zq2ZXgHptJHbKDDVx
 You can now refer to the added file in a gateway, like so:
   /ipfs/QmaG4FuMqEBnQNn3C8XJ5bpW8kLs7zq2ZXgHptJHbKDDVx/example.jpg
+
+The encrypt option, '--encrypt', seals the file data with the domain
+content key from the repo keystore (see 'ipfs domain key'). Directory
+structure and file sizes stay readable, the contents can only be read
+by nodes holding the key. 'ipfs cat', 'ipfs get' and the gateway decrypt
+such files transparently on those nodes.
+
+The nocopy option, '--nocopy', leaves the file data where it is: the
+leaf blocks are stored as references to the original files instead of
+being copied into the repo, and are read back from them when requested.
+Moving, removing or changing the files breaks those blocks; use
+'ipfs filestore verify' to find them. Only files on the filesystem of
+the node can be added this way, and they cannot be encrypted.
 `,
 	},
 
@@ -74,6 +90,8 @@ You can now refer to the added file in a gateway, like so:
 		cmds.BoolOption(hiddenOptionName, "H", "Include files that are hidden. Only takes effect on recursive add.").Default(false),
 		cmds.StringOption(chunkerOptionName, "s", "Chunking algorithm to use."),
 		cmds.BoolOption(pinOptionName, "Pin this object when adding.").Default(true),
+		cmds.BoolOption(encryptOptionName, "Encrypt file data with the domain content key.").Default(false),
+		cmds.BoolOption(nocopyOptionName, "Store references to the files instead of copying their data.").Default(false),
 	},
 	PreRun: func(req cmds.Request) error {
 		if quiet, _, _ := req.Option(quietOptionName).Bool(); quiet {
@@ -131,6 +149,22 @@ You can now refer to the added file in a gateway, like so:
 		silent, _, _ := req.Option(silentOptionName).Bool()
 		chunker, _, _ := req.Option(chunkerOptionName).String()
 		dopin, _, _ := req.Option(pinOptionName).Bool()
+		encrypt, _, _ := req.Option(encryptOptionName).Bool()
+		nocopy, _, _ := req.Option(nocopyOptionName).Bool()
+
+		if nocopy && encrypt {
+			res.SetError(fmt.Errorf("--%s and --%s cannot be combined", nocopyOptionName, encryptOptionName), cmds.ErrNormal)
+			return
+		}
+
+		var key *crypt.Key
+		if encrypt {
+			key, err = n.DomainKey()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
 
 		if hash {
 			nilnode, err := core.NewNode(n.Context(), &core.BuildCfg{
@@ -170,6 +204,11 @@ You can now refer to the added file in a gateway, like so:
 		fileAdder.Wrap = wrap
 		fileAdder.Pin = dopin
 		fileAdder.Silent = silent
+		fileAdder.Key = key
+		fileAdder.NoCopy = nocopy
+		if !hash {
+			fileAdder.Inventory = n.Inventory
+		}
 
 		if hash {
 			md := dagtest.Mock()
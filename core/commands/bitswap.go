@@ -181,7 +181,8 @@ var ledgerCmd = &cmds.Command{
 		ShortDescription: `
 The Bitswap decision engine tracks the number of bytes exchanged between IPFS
 nodes, and stores this information as a collection of ledgers. This command
-prints the ledger associated with a given peer.
+prints the ledger associated with a given peer, including the number of wants
+refused by the serving policy and the most recently refused blocks.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -224,9 +225,14 @@ prints the ledger associated with a given peer.
 				"Debt ratio:\t%f\n"+
 				"Exchanges:\t%d\n"+
 				"Bytes sent:\t%d\n"+
-				"Bytes received:\t%d\n\n",
+				"Bytes received:\t%d\n"+
+				"Wants denied:\t%d\n",
 				out.Peer, out.Value, out.Exchanged,
-				out.Sent, out.Recv)
+				out.Sent, out.Recv, out.Denied)
+			for _, k := range out.DeniedWants {
+				fmt.Fprintf(buf, "\t%s\n", k)
+			}
+			fmt.Fprintln(buf)
 			return buf, nil
 		},
 	},
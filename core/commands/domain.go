@@ -0,0 +1,832 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	group "github.com/ipfs/go-ipfs/group"
+	inventory "github.com/ipfs/go-ipfs/inventory"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	path "github.com/ipfs/go-ipfs/path"
+	replication "github.com/ipfs/go-ipfs/replication"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	u "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+type DomainOutput struct {
+	Name      string
+	NodeUUID  string
+	GroupID   string
+	Authority bool
+	Members   []string `json:",omitempty"`
+	Revoked   []string `json:",omitempty"`
+}
+
+type DomainCertOutput struct {
+	Peer        string
+	Certificate string
+}
+
+type DomainWhereOutput struct {
+	Holders []*inventory.Holding
+}
+
+type DomainReplicateOutput struct {
+	Targets []*replication.Status
+}
+
+type DomainPublishOutput struct {
+	Domain string
+	Value  string
+}
+
+type DomainKeyOutput struct {
+	ID  string
+	Key string `json:",omitempty"`
+}
+
+var DomainCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect and change the private domain of this node.",
+		ShortDescription: `
+Nodes that belong to a domain only keep connections to, and only serve
+blocks and routing requests for, peers holding a membership certificate
+signed by the domain authority.
+
+Running 'ipfs domain' with no arguments will run 'ipfs domain show'.
+`,
+		LongDescription: `
+Nodes that belong to a domain only keep connections to, and only serve
+blocks and routing requests for, peers holding a membership certificate
+signed by the domain authority.
+
+The node that creates a domain becomes its authority. To admit another
+node, run 'ipfs domain invite' with that node's peer ID on the authority
+and pass the printed certificate to 'ipfs domain join' on the new node:
+
+    authority> ipfs domain create example-domain
+    authority> ipfs domain invite QmNewNodePeerID
+    newnode>   ipfs domain join <certificate>
+
+Running 'ipfs domain' with no arguments will run 'ipfs domain show'.
+`,
+	},
+
+	Run:        domainShowCmd.Run,
+	Marshalers: domainShowCmd.Marshalers,
+	Type:       domainShowCmd.Type,
+
+	Subcommands: map[string]*cmds.Command{
+		"show":      domainShowCmd,
+		"create":    domainCreateCmd,
+		"invite":    domainInviteCmd,
+		"join":      domainJoinCmd,
+		"revoke":    domainRevokeCmd,
+		"leave":     domainLeaveCmd,
+		"where":     domainWhereCmd,
+		"replicate": domainReplicateCmd,
+		"publish":   domainPublishCmd,
+		"key":       domainKeyCmd,
+	},
+}
+
+var domainShowCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the domain this node belongs to.",
+		ShortDescription: `
+Prints the domain name, node UUID and GroupID from the config. When the
+daemon is running, the peers verified to be members of the domain and
+the revoked peers are listed as well.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out := domainOutput(cfg.Domain)
+		if nd.Group != nil {
+			for _, p := range nd.Group.Members() {
+				out.Members = append(out.Members, p.Pretty())
+			}
+			for _, p := range nd.Group.Revoked() {
+				out.Revoked = append(out.Revoked, p.Pretty())
+			}
+		}
+		res.SetOutput(out)
+	},
+	Type: DomainOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: domainMarshaler,
+	},
+}
+
+var domainCreateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create a new domain with this node as its authority.",
+		ShortDescription: `
+Generates a domain authority keypair, stores it in the config and issues
+this node a membership certificate. The GroupID of the new domain is the
+peer ID of the authority key. The daemon must be restarted for the
+change to take effect.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the domain to create."),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption("bits", "b", "Number of bits to use in the generated RSA authority key.").Default(2048),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		name := req.Arguments()[0]
+		if err := config.ValidDomainName(name); err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		nbits, _, err := req.Option("bits").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		d, err := updateDomain(req, func(d *config.Domain, self peer.ID) error {
+			return group.CreateDomain(d, name, self, nbits)
+		})
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(domainOutput(d))
+	},
+	Type: DomainOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: domainMarshaler,
+	},
+}
+
+var domainInviteCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Issue a membership certificate for a peer.",
+		ShortDescription: `
+Signs a certificate admitting the given peer to this node's domain and
+prints it. Pass the certificate to 'ipfs domain join' on that peer. Only
+the domain authority can invite peers.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", true, false, "The PeerID (B58) of the node to invite."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("ttl", "Time duration the certificate is valid for. Default: forever."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		p, err := peer.IDB58Decode(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		var ttl time.Duration
+		if ttls, found, _ := req.Option("ttl").String(); found {
+			ttl, err = time.ParseDuration(ttls)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+
+		cfg, err := req.InvocContext().GetConfig()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		cert, err := group.Invite(&cfg.Domain, p, ttl)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&DomainCertOutput{
+			Peer:        p.Pretty(),
+			Certificate: cert,
+		})
+	},
+	Type: DomainCertOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*DomainCertOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(out.Certificate + "\n"), nil
+		},
+	},
+}
+
+var domainJoinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Join a domain using a membership certificate.",
+		ShortDescription: `
+Verifies that the certificate was issued to this node and moves the node
+to the domain it was issued for. The daemon must be restarted for the
+change to take effect.
+
+The authority of a domain cannot join another one, as that discards the
+domain authority key. Export the key first:
+
+    ipfs config Domain.AuthorityKey > authority.key
+
+then join with --force.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("certificate", true, false, "Certificate printed by 'ipfs domain invite'.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("force", "f", "Join even if this discards the domain authority key.").Default(false),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		cert := strings.TrimSpace(req.Arguments()[0])
+		force, _, err := req.Option("force").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		d, err := updateDomain(req, func(d *config.Domain, self peer.ID) error {
+			return group.JoinDomain(d, cert, self, force)
+		})
+		if err == group.ErrAuthorityKeyDiscarded {
+			err = fmt.Errorf("%s. Export it first with 'ipfs config Domain.AuthorityKey', then join with --force", err)
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(domainOutput(d))
+	},
+	Type: DomainOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: domainMarshaler,
+	},
+}
+
+var domainRevokeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Revoke the membership of a peer.",
+		ShortDescription: `
+Adds the peer to the domain revocation list, which is signed by the
+domain authority and published under its IPNS name (the GroupID).
+Members pick up the new list periodically and disconnect from revoked
+peers. Only the domain authority can revoke members, and it must be
+online to publish the list.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", true, false, "The PeerID (B58) of the member to revoke."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		p, err := peer.IDB58Decode(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		if _, err := nd.RevokeDomainMember(req.Context(), p); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out := domainOutput(cfg.Domain)
+		for _, p := range nd.Group.Revoked() {
+			out.Revoked = append(out.Revoked, p.Pretty())
+		}
+		res.SetOutput(out)
+	},
+	Type: DomainOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: domainMarshaler,
+	},
+}
+
+var domainLeaveCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove this node from its domain.",
+		ShortDescription: `
+Clears the domain section of the config, so the node joins the public
+network after the daemon is restarted. On the domain authority this
+discards the authority key, after which no new members can be invited.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		d, err := updateDomain(req, func(d *config.Domain, self peer.ID) error {
+			*d = config.Domain{}
+			return nil
+		})
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(domainOutput(d))
+	},
+	Type: DomainOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: domainMarshaler,
+	},
+}
+
+var domainWhereCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the members of the domain that hold an object.",
+		ShortDescription: `
+Members of a domain exchange their inventories (see 'ipfs inventory')
+with each other, so every node learns which member holds which object.
+The view is eventually consistent: a member's latest adds and removals
+show up once the inventories have been synced. Pass --sync to pull the
+inventories of the connected members before answering.
+
+Each member is listed as 'pinned' when it holds a recursive pin of the
+object, 'direct' when it pinned only the object itself, and 'cached'
+otherwise.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("cid", true, false, "The object to look up."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("sync", "s", "Sync with the connected members first.").Default(false),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if nd.Inventory == nil {
+			res.SetError(errNoInventory, cmds.ErrNormal)
+			return
+		}
+
+		c, err := cid.Decode(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		sync, _, _ := req.Option("sync").Bool()
+		if sync {
+			if !nd.OnlineMode() {
+				res.SetError(errNotOnline, cmds.ErrClient)
+				return
+			}
+			if nd.InventorySync == nil {
+				res.SetError(core.ErrNoDomain, cmds.ErrNormal)
+				return
+			}
+			nd.InventorySync.SyncAll(req.Context())
+		}
+
+		holders, err := nd.Inventory.Where(c)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&DomainWhereOutput{holders})
+	},
+	Type: DomainWhereOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*DomainWhereOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, h := range out.Holders {
+				state := "cached"
+				switch {
+				case h.PinnedRecursively():
+					state = "pinned"
+				case h.Pinned:
+					state = "direct"
+				}
+				fmt.Fprintf(buf, "%s %s %d %s\n", h.Peer, state, h.Size, h.Updated.Format(time.RFC3339))
+			}
+			return buf, nil
+		},
+	},
+}
+
+var domainReplicateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Keep an object pinned on several members of the domain.",
+		ShortDescription: `
+Pins the object locally and asks other connected members to recursively
+pin it, until at least <factor> members hold it. The target is kept:
+the daemon checks it periodically, and whenever a member disconnects,
+and asks further members to pin the object if holders have gone away.
+
+A factor of 0 removes the target; existing pins are left alone. Without
+arguments, lists the replication targets of this node.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("cid", false, false, "The object to replicate."),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption("factor", "f", "Number of members that should pin the object.").Default(2),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		if nd.Replicator == nil {
+			res.SetError(core.ErrNoDomain, cmds.ErrNormal)
+			return
+		}
+
+		if len(req.Arguments()) == 0 {
+			targets, err := nd.Replicator.Targets()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			res.SetOutput(&DomainReplicateOutput{targets})
+			return
+		}
+
+		c, err := cid.Decode(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		factor, _, err := req.Option("factor").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		st, err := nd.Replicator.Replicate(req.Context(), c, factor)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&DomainReplicateOutput{[]*replication.Status{st}})
+	},
+	Type: DomainReplicateOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*DomainReplicateOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, st := range out.Targets {
+				fmt.Fprintf(buf, "%s %d/%d\n", st.Cid, len(st.Holders), st.Factor)
+				for _, p := range st.Holders {
+					fmt.Fprintf(buf, "  %s\n", p)
+				}
+			}
+			return buf, nil
+		},
+	},
+}
+
+// updateDomain applies change to the Domain section of the repo config and
+// writes it back.
+func updateDomain(req cmds.Request, change func(*config.Domain, peer.ID) error) (config.Domain, error) {
+	r, err := fsrepo.Open(req.InvocContext().ConfigRoot)
+	if err != nil {
+		return config.Domain{}, err
+	}
+	defer r.Close()
+
+	cfg, err := r.Config()
+	if err != nil {
+		return config.Domain{}, err
+	}
+
+	self, err := peer.IDB58Decode(cfg.Identity.PeerID)
+	if err != nil {
+		return config.Domain{}, err
+	}
+
+	if err := change(&cfg.Domain, self); err != nil {
+		return config.Domain{}, err
+	}
+
+	if err := cfg.Domain.Validate(); err != nil {
+		return config.Domain{}, err
+	}
+
+	if err := r.SetConfig(cfg); err != nil {
+		return config.Domain{}, err
+	}
+	return cfg.Domain, nil
+}
+
+func domainOutput(d config.Domain) *DomainOutput {
+	return &DomainOutput{
+		Name:      d.Name,
+		NodeUUID:  d.NodeUUID,
+		GroupID:   d.GroupID,
+		Authority: d.IsAuthority(),
+	}
+}
+
+func domainMarshaler(res cmds.Response) (io.Reader, error) {
+	out, ok := res.Output().(*DomainOutput)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+
+	buf := new(bytes.Buffer)
+	if out.Name == "" {
+		fmt.Fprintln(buf, "not a member of any domain")
+		return buf, nil
+	}
+
+	fmt.Fprintf(buf, "Domain:\t%s\n", out.Name)
+	fmt.Fprintf(buf, "Node UUID:\t%s\n", out.NodeUUID)
+	fmt.Fprintf(buf, "GroupID:\t%s\n", out.GroupID)
+	fmt.Fprintf(buf, "Authority:\t%t\n", out.Authority)
+	if len(out.Members) > 0 {
+		fmt.Fprintf(buf, "Members [%d]:\n", len(out.Members))
+		for _, m := range out.Members {
+			fmt.Fprintf(buf, "\t%s\n", m)
+		}
+	}
+	if len(out.Revoked) > 0 {
+		fmt.Fprintf(buf, "Revoked [%d]:\n", len(out.Revoked))
+		for _, m := range out.Revoked {
+			fmt.Fprintf(buf, "\t%s\n", m)
+		}
+	}
+	return buf, nil
+}
+
+var domainPublishCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Publish the content /domain/<name> resolves to.",
+		ShortDescription: `
+Signs a registry record mapping the domain name to an IPNS name or IPFS
+path and stores it in the routing system. Afterwards '/domain/<name>/...'
+paths resolve through it in 'ipfs resolve', 'ipfs cat' and the gateway,
+on members and on nodes that list the domain in Domain.KnownDomains.
+Only the domain authority can publish the record.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, false, "IPFS or IPNS path the domain points to."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		p, err := path.ParsePath(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		if err := nd.PublishDomain(req.Context(), p); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&DomainPublishOutput{
+			Domain: cfg.Domain.Name,
+			Value:  p.String(),
+		})
+	},
+	Type: DomainPublishOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*DomainPublishOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(fmt.Sprintf("Published /domain/%s to %s\n", out.Domain, out.Value)), nil
+		},
+	},
+}
+
+var domainKeyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the domain content key.",
+		ShortDescription: `
+The domain content key is a symmetric key kept in the repo keystore.
+'ipfs add --encrypt' seals file data with it, and 'ipfs cat', 'ipfs get'
+and the gateway use it to decrypt such files. Generate the key once and
+import it on every member that should be able to read encrypted files:
+
+    authority> ipfs domain key gen
+    authority> ipfs domain key export
+    member>    ipfs domain key import <key>
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"gen":    domainKeyGenCmd,
+		"import": domainKeyImportCmd,
+		"export": domainKeyExportCmd,
+	},
+}
+
+var domainKeyGenCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Generate a new domain content key.",
+		ShortDescription: `
+Generates a random content key and stores it in the repo keystore. Fails
+if the keystore already holds one.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		raw, err := crypt.GenerateKey()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out, err := storeDomainKey(req, raw)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(out)
+	},
+	Type: DomainKeyOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: domainKeyMarshaler,
+	},
+}
+
+var domainKeyImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Import the domain content key.",
+		ShortDescription: `
+Stores a content key printed by 'ipfs domain key export' in the repo
+keystore. Fails if the keystore already holds one.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, false, "Key printed by 'ipfs domain key export'.").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(req.Arguments()[0]))
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if _, err := crypt.NewKey(raw); err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		out, err := storeDomainKey(req, raw)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(out)
+	},
+	Type: DomainKeyOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: domainKeyMarshaler,
+	},
+}
+
+var domainKeyExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the domain content key.",
+		ShortDescription: `
+Prints the content key from the repo keystore, for 'ipfs domain key
+import' on other members. Anyone holding the key can read encrypted
+files, handle it like the domain authority key.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		raw, err := nd.Repo.Keystore().Get(core.DomainKeyName)
+		if err == keystore.ErrNoSuchKey {
+			err = core.ErrNoDomainKey
+		}
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		k, err := crypt.NewKey(raw)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&DomainKeyOutput{
+			ID:  hex.EncodeToString(k.ID()),
+			Key: base64.StdEncoding.EncodeToString(raw),
+		})
+	},
+	Type: DomainKeyOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*DomainKeyOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(out.Key + "\n"), nil
+		},
+	},
+}
+
+func storeDomainKey(req cmds.Request, raw []byte) (*DomainKeyOutput, error) {
+	nd, err := req.InvocContext().GetNode()
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := crypt.NewKey(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := nd.Repo.Keystore().Put(core.DomainKeyName, raw); err != nil {
+		return nil, err
+	}
+	return &DomainKeyOutput{ID: hex.EncodeToString(k.ID())}, nil
+}
+
+func domainKeyMarshaler(res cmds.Response) (io.Reader, error) {
+	out, ok := res.Output().(*DomainKeyOutput)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+	return strings.NewReader(fmt.Sprintf("Stored domain content key %s\n", out.ID)), nil
+}
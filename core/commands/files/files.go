@@ -425,7 +425,7 @@ Examples:
 			return
 		}
 
-		rfd, err := fi.Open(mfs.OpenReadOnly, false)
+		rfd, err := fi.OpenContext(n.ContentContext(req.Context()), mfs.OpenReadOnly, false)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -548,6 +548,8 @@ If the '--flush' option is set to false, changes will not be propogated to the
 merkledag root. This can make operations much faster when doing a large number
 of writes to a deeper directory structure.
 
+Files added with 'ipfs add --encrypt' cannot be written to.
+
 EXAMPLE:
 
     echo "hello world" | ipfs files write --create /myfs/a/b/file
@@ -0,0 +1,202 @@
+package commands
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	filestore "github.com/ipfs/go-ipfs/filestore"
+
+	u "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+var errNoFilestore = errors.New("this node does not have a filestore")
+
+var FileStoreCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage files added with 'ipfs add --nocopy'.",
+		ShortDescription: `
+Files added with 'ipfs add --nocopy' are not copied into the repo. Their
+blocks are kept as references (file path, offset and length) to the
+original files, and read from them when requested.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":     lsFileStore,
+		"verify": verifyFileStore,
+		"dups":   dupsFileStore,
+	},
+}
+
+var lsFileStore = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List blocks stored as file references.",
+		ShortDescription: `
+Lists the blocks in the filestore together with the file, offset and
+length they reference. The files are not checked, see
+'ipfs filestore verify' for that. If one or more <obj> are given, only
+those blocks are listed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("obj", false, true, "Hash of a block to list."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		listFileStore(req, res, filestore.List, filestore.ListAll)
+	},
+	Marshalers: listResMarshalerMap,
+	Type:       filestore.ListRes{},
+}
+
+var verifyFileStore = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Verify blocks stored as file references.",
+		ShortDescription: `
+Reads the data every reference in the filestore points to and checks
+that it still hashes to the block. Each block is printed with its
+status:
+
+  ok       the file holds the data of the block
+  changed  the file was modified or truncated
+  no-file  the file was moved or removed
+  error    the file could not be read
+
+If one or more <obj> are given, only those blocks are checked.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("obj", false, true, "Hash of a block to verify."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		listFileStore(req, res, filestore.Verify, filestore.VerifyAll)
+	},
+	Marshalers: listResMarshalerMap,
+	Type:       filestore.ListRes{},
+}
+
+var dupsFileStore = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List blocks that are both referenced and copied into the repo.",
+		ShortDescription: `
+Lists the blocks that are stored twice: as a file reference in the
+filestore and as a copy in the regular blockstore. This happens when the
+same data is added with and without --nocopy.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		fs, err := getFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		dups, err := filestore.Dups(req.Context(), fs)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out := make(chan interface{})
+		res.SetOutput((<-chan interface{})(out))
+
+		go func() {
+			defer close(out)
+			for k := range dups {
+				out <- &RefWrapper{Ref: k.B58String()}
+			}
+		}()
+	},
+	Marshalers: refsMarshallerMap,
+	Type:       RefWrapper{},
+}
+
+func getFilestore(req cmds.Request) (*filestore.Filestore, error) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if n.Filestore == nil {
+		return nil, errNoFilestore
+	}
+	return n.Filestore, nil
+}
+
+type listOneFunc func(*filestore.Filestore, key.Key) *filestore.ListRes
+type listAllFunc func(context.Context, *filestore.Filestore) (<-chan *filestore.ListRes, error)
+
+// listFileStore outputs the references of the blocks given as arguments,
+// or of all blocks in the filestore if there are none.
+func listFileStore(req cmds.Request, res cmds.Response, one listOneFunc, all listAllFunc) {
+	fs, err := getFilestore(req)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	args := req.Arguments()
+	if len(args) > 0 {
+		var keys []key.Key
+		for _, arg := range args {
+			c, err := cid.Decode(arg)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			keys = append(keys, key.Key(c.Hash()))
+		}
+
+		out := make(chan interface{})
+		res.SetOutput((<-chan interface{})(out))
+
+		go func() {
+			defer close(out)
+			for _, k := range keys {
+				out <- one(fs, k)
+			}
+		}()
+		return
+	}
+
+	refs, err := all(req.Context(), fs)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	out := make(chan interface{})
+	res.SetOutput((<-chan interface{})(out))
+
+	go func() {
+		defer close(out)
+		for r := range refs {
+			out <- r
+		}
+	}()
+}
+
+var listResMarshalerMap = cmds.MarshalerMap{
+	cmds.Text: func(res cmds.Response) (io.Reader, error) {
+		outChan, ok := res.Output().(<-chan interface{})
+		if !ok {
+			return nil, u.ErrCast()
+		}
+
+		marshal := func(v interface{}) (io.Reader, error) {
+			r, ok := v.(*filestore.ListRes)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(r.FormatLong() + "\n"), nil
+		}
+
+		return &cmds.ChannelMarshaler{
+			Channel:   outChan,
+			Marshaler: marshal,
+			Res:       res,
+		}, nil
+	},
+}
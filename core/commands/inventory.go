@@ -0,0 +1,273 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	inventory "github.com/ipfs/go-ipfs/inventory"
+
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
+	u "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+var errNoInventory = errors.New("this node does not keep an inventory")
+
+type InventoryOutput struct {
+	Events []*inventory.Event
+}
+
+var InventoryCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Query the ledger of added, pinned and removed objects.",
+		ShortDescription: `
+The node records every add, pin, unpin and garbage collected block in
+its inventory ledger. Events can also be streamed to a file or webhook,
+see the Inventory.Sink config option.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"ls":   inventoryLsCmd,
+		"find": inventoryFindCmd,
+		"stat": inventoryStatCmd,
+	},
+}
+
+var inventoryFilterOptions = []cmds.Option{
+	cmds.StringOption("type", "t", "Only show events of this type: add, pin, unpin or gc."),
+	cmds.StringOption("name", "Only show events whose file name contains this string."),
+	cmds.StringOption("since", "Only show events after this time, either RFC3339 or a duration such as 24h."),
+	cmds.StringOption("until", "Only show events before this time, either RFC3339 or a duration such as 24h."),
+}
+
+var inventoryLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List inventory events.",
+		ShortDescription: `
+Lists the events in the inventory ledger, oldest first.
+`,
+	},
+	Options: append([]cmds.Option{
+		cmds.IntOption("limit", "n", "Only show the most recent <limit> events."),
+	}, inventoryFilterOptions...),
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		f, err := inventoryFilter(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		limit, _, err := req.Option("limit").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		f.Limit = limit
+
+		events, err := queryInventory(n, f)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&InventoryOutput{events})
+	},
+	Type: InventoryOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: inventoryMarshaler,
+	},
+}
+
+var inventoryFindCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the inventory events of an object.",
+		ShortDescription: `
+Lists when the object was added, pinned, unpinned and garbage collected.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("cid", true, false, "The object to look up."),
+	},
+	Options: inventoryFilterOptions,
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		c, err := cid.Decode(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		f, err := inventoryFilter(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		f.Cid = c.String()
+
+		events, err := queryInventory(n, f)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&InventoryOutput{events})
+	},
+	Type: InventoryOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: inventoryMarshaler,
+	},
+}
+
+var inventoryStatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Summarize the inventory.",
+		ShortDescription: `
+Counts the events in the inventory ledger, optionally restricted by the
+same filters as 'ipfs inventory ls'.
+`,
+	},
+	Options: inventoryFilterOptions,
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		f, err := inventoryFilter(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		if n.Inventory == nil {
+			res.SetError(errNoInventory, cmds.ErrNormal)
+			return
+		}
+
+		st, err := n.Inventory.Stat(f)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(st)
+	},
+	Type: inventory.Stat{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			st, ok := res.Output().(*inventory.Stat)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "Events:\t%d\n", st.Events)
+			fmt.Fprintf(buf, "Adds:\t%d\n", st.Adds)
+			fmt.Fprintf(buf, "Pins:\t%d\n", st.Pins)
+			fmt.Fprintf(buf, "Unpins:\t%d\n", st.Unpins)
+			fmt.Fprintf(buf, "Removals:\t%d\n", st.Removals)
+			fmt.Fprintf(buf, "Objects:\t%d\n", st.Objects)
+			fmt.Fprintf(buf, "AddedSize:\t%s\n", humanize.Bytes(st.Bytes))
+			if st.Events > 0 {
+				fmt.Fprintf(buf, "First:\t%s\n", st.First.Format(time.RFC3339))
+				fmt.Fprintf(buf, "Last:\t%s\n", st.Last.Format(time.RFC3339))
+			}
+			return buf, nil
+		},
+	},
+}
+
+func queryInventory(n *core.IpfsNode, f inventory.Filter) ([]*inventory.Event, error) {
+	if n.Inventory == nil {
+		return nil, errNoInventory
+	}
+	return n.Inventory.Query(f)
+}
+
+// inventoryFilter builds a filter from the options shared by the
+// inventory subcommands.
+func inventoryFilter(req cmds.Request) (inventory.Filter, error) {
+	var f inventory.Filter
+
+	typ, found, err := req.Option("type").String()
+	if err != nil {
+		return f, err
+	}
+	if found {
+		f.Type, err = inventory.ParseEventType(typ)
+		if err != nil {
+			return f, err
+		}
+	}
+
+	f.Name, _, err = req.Option("name").String()
+	if err != nil {
+		return f, err
+	}
+
+	since, _, err := req.Option("since").String()
+	if err != nil {
+		return f, err
+	}
+	f.Since, err = parseInventoryTime(since)
+	if err != nil {
+		return f, err
+	}
+
+	until, _, err := req.Option("until").String()
+	if err != nil {
+		return f, err
+	}
+	f.Until, err = parseInventoryTime(until)
+	if err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// parseInventoryTime parses an RFC3339 time, or a duration relative to
+// now. The empty string parses to the zero time.
+func parseInventoryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected RFC3339 or a duration", s)
+	}
+	return t, nil
+}
+
+func inventoryMarshaler(res cmds.Response) (io.Reader, error) {
+	out, ok := res.Output().(*InventoryOutput)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+	for _, e := range out.Events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", e.Time.Format(time.RFC3339), e.Type, e.Cid, e.Size, e.Name)
+	}
+	w.Flush()
+	return buf, nil
+}
@@ -2,8 +2,12 @@ package commands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"time"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
@@ -44,6 +48,9 @@ var addPinCmd = &cmds.Command{
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("recursive", "r", "Recursively pin the object linked to by the specified object(s).").Default(true),
+		cmds.StringOption("name", "A name for the pin(s)."),
+		cmds.StringOption("label", "Comma separated key=value labels for the pin(s)."),
+		cmds.StringOption("ttl", "Unpin the object(s) after this duration, such as 72h. Pinning again without it removes the ttl. Only for recursive pins."),
 	},
 	Type: PinOutput{},
 	Run: func(req cmds.Request, res cmds.Response) {
@@ -62,7 +69,52 @@ var addPinCmd = &cmds.Command{
 			return
 		}
 
-		added, err := corerepo.Pin(n, req.Context(), req.Arguments(), recursive)
+		var info pin.PinInfo
+		info.Name, _, err = req.Option("name").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		labelStr, found, err := req.Option("label").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if found {
+			info.Labels, err = parseLabels(labelStr)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+
+		ttlStr, found, err := req.Option("ttl").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if found {
+			ttl, err := time.ParseDuration(ttlStr)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			if ttl <= 0 {
+				res.SetError(fmt.Errorf("invalid ttl '%s', must be positive", ttlStr), cmds.ErrClient)
+				return
+			}
+			if !recursive {
+				res.SetError(errors.New("only recursive pins can have a ttl"), cmds.ErrClient)
+				return
+			}
+			info.Expires = time.Now().Add(ttl).Unix()
+		}
+		if err := info.Validate(); err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		added, err := corerepo.PinWithInfo(n, req.Context(), req.Arguments(), recursive, info)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -163,6 +215,11 @@ By default, all pinned objects are returned, but the '--type' flag or
 arguments can restrict that to a specific pin type or to some specific objects
 respectively.
 
+Use --label=<key>=<value>,... to list only the direct and recursive pins
+with all the given labels. The names, time-to-live and labels of pins are
+shown after their type. The daemon unpins recursive pins added with a
+--ttl once it has passed.
+
 Use --type=<type> to specify the type of pinned keys to list.
 Valid values are:
     * "direct": pin that specific object.
@@ -189,6 +246,11 @@ Example:
 	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN direct
 	$ ipfs pin ls QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN
 	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN direct
+	# name and label the pin
+	$ ipfs pin add -r=false --name=hello --label=owner=alice QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN
+	pinned QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN directly
+	$ ipfs pin ls --label=owner=alice
+	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN direct "hello" owner=alice
 `,
 	},
 
@@ -198,6 +260,7 @@ Example:
 	Options: []cmds.Option{
 		cmds.StringOption("type", "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\".").Default("all"),
 		cmds.BoolOption("quiet", "q", "Write just hashes of objects.").Default(false),
+		cmds.StringOption("label", "List only pins with these comma separated key=value labels."),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
@@ -220,19 +283,41 @@ Example:
 			return
 		}
 
+		var labels map[string]string
+		labelStr, found, err := req.Option("label").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if found {
+			labels, err = parseLabels(labelStr)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+
 		var keys map[string]RefKeyObject
 
 		if len(req.Arguments()) > 0 {
 			keys, err = pinLsKeys(req.Arguments(), typeStr, req.Context(), n)
 		} else {
-			keys, err = pinLsAll(typeStr, req.Context(), n)
+			keys, err = pinLsAll(typeStr, len(labels) > 0, req.Context(), n)
 		}
 
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
-		} else {
-			res.SetOutput(&RefKeyList{Keys: keys})
+			return
 		}
+
+		if len(labels) > 0 {
+			for k, v := range keys {
+				if !(pin.PinInfo{Labels: v.Labels}).HasLabels(labels) {
+					delete(keys, k)
+				}
+			}
+		}
+		res.SetOutput(&RefKeyList{Keys: keys})
 	},
 	Type: RefKeyList{},
 	Marshalers: cmds.MarshalerMap{
@@ -251,7 +336,7 @@ Example:
 				if quiet {
 					fmt.Fprintf(out, "%s\n", k)
 				} else {
-					fmt.Fprintf(out, "%s %s\n", k, v.Type)
+					fmt.Fprintf(out, "%s %s%s\n", k, v.Type, formatPinInfo(v))
 				}
 			}
 			return out, nil
@@ -260,7 +345,62 @@ Example:
 }
 
 type RefKeyObject struct {
-	Type string
+	Type   string
+	Name   string            `json:",omitempty"`
+	Labels map[string]string `json:",omitempty"`
+
+	// Expires is when the pin expires, in unix seconds.
+	Expires int64 `json:",omitempty"`
+}
+
+// formatPinInfo returns the quoted name, the time-to-live and the sorted
+// labels of a pin, each preceded by a space.
+func formatPinInfo(o RefKeyObject) string {
+	var buf bytes.Buffer
+	if o.Name != "" {
+		fmt.Fprintf(&buf, " %q", o.Name)
+	}
+	if o.Expires != 0 {
+		ttl := time.Unix(o.Expires, 0).Sub(time.Now())
+		if ttl > 0 {
+			fmt.Fprintf(&buf, " ttl=%s", ttl/time.Second*time.Second)
+		} else {
+			buf.WriteString(" ttl=expired")
+		}
+	}
+	keys := make([]string, 0, len(o.Labels))
+	for k := range o.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, " %s=%s", k, o.Labels[k])
+	}
+	return buf.String()
+}
+
+// parseLabels parses comma separated key=value labels.
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid label '%s', must be key=value", kv)
+		}
+		labels[kv[:i]] = kv[i+1:]
+	}
+	return labels, nil
+}
+
+// refKeyObject returns the listing of a pin of c with its info.
+func refKeyObject(n *core.IpfsNode, c *cid.Cid, pinType string) RefKeyObject {
+	o := RefKeyObject{Type: pinType}
+	if info, ok := n.Pinning.Info(c); ok {
+		o.Name = info.Name
+		o.Labels = info.Labels
+		o.Expires = info.Expires
+	}
+	return o
 }
 
 type RefKeyList struct {
@@ -302,30 +442,28 @@ func pinLsKeys(args []string, typeStr string, ctx context.Context, n *core.IpfsN
 		default:
 			pinType = "indirect through " + pinType
 		}
-		keys[c.String()] = RefKeyObject{
-			Type: pinType,
-		}
+		keys[c.String()] = refKeyObject(n, c, pinType)
 	}
 
 	return keys, nil
 }
 
-func pinLsAll(typeStr string, ctx context.Context, n *core.IpfsNode) (map[string]RefKeyObject, error) {
+// pinLsAll lists the pins of typeStr. Indirect pins have no labels, so they
+// are skipped when filtering by labels.
+func pinLsAll(typeStr string, byLabels bool, ctx context.Context, n *core.IpfsNode) (map[string]RefKeyObject, error) {
 
 	keys := make(map[string]RefKeyObject)
 
 	AddToResultKeys := func(keyList []*cid.Cid, typeStr string) {
 		for _, c := range keyList {
-			keys[c.String()] = RefKeyObject{
-				Type: typeStr,
-			}
+			keys[c.String()] = refKeyObject(n, c, typeStr)
 		}
 	}
 
 	if typeStr == "direct" || typeStr == "all" {
 		AddToResultKeys(n.Pinning.DirectKeys(), "direct")
 	}
-	if typeStr == "indirect" || typeStr == "all" {
+	if (typeStr == "indirect" || typeStr == "all") && !byLabels {
 		set := cid.NewSet()
 		for _, k := range n.Pinning.RecursiveKeys() {
 			nd, err := n.DAG.Get(ctx, k)
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,11 +12,15 @@ import (
 	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
+	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 
 	u "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
 )
 
 type RepoVersion struct {
@@ -36,6 +41,10 @@ var RepoCmd = &cmds.Command{
 		"fsck":    RepoFsckCmd,
 		"version": repoVersionCmd,
 		"verify":  repoVerifyCmd,
+		"rekey":   RepoRekeyCmd,
+		"export":  repoExportCmd,
+		"import":  repoImportCmd,
+		"migrate": RepoMigrateCmd,
 	},
 }
 
@@ -46,10 +55,27 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+
+With --incremental, adds and pins are not blocked for the whole
+collection. The blocks to keep are marked while they proceed, and the
+others are removed in batches of --batch-size, which only block them
+for the length of a batch. The progress of the collection is reported
+between the removed keys.
+
+With --dry-run, nothing is removed: the blocks a collection would remove
+are listed with their sizes in bytes. --summary only reports how many
+they are, how many bytes they take and the --top largest unpinned roots,
+the blocks to remove that no other block to remove links to. Use
+--enc=json for output that scripts can read.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("quiet", "q", "Write minimal output.").Default(false),
+		cmds.BoolOption("incremental", "Let adds and pins proceed during the collection.").Default(false),
+		cmds.IntOption("batch-size", "Number of blocks removed at once by an incremental collection.").Default(gc.DefaultSweepBatch),
+		cmds.BoolOption("dry-run", "List the blocks a collection would remove, without removing them.").Default(false),
+		cmds.BoolOption("summary", "Only report the totals and the largest roots of a dry run.").Default(false),
+		cmds.IntOption("top", "Number of unpinned roots in a summary.").Default(10),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
@@ -58,7 +84,35 @@ order to reclaim hard disk space.
 			return
 		}
 
-		gcOutChan, err := corerepo.GarbageCollectAsync(n, req.Context())
+		incremental, _, _ := req.Option("incremental").Bool()
+		batchSize, _, _ := req.Option("batch-size").Int()
+		dryRun, _, _ := req.Option("dry-run").Bool()
+		summary, _, _ := req.Option("summary").Bool()
+		top, _, _ := req.Option("top").Int()
+		if (dryRun || summary) && incremental {
+			res.SetError(errors.New("--dry-run and --incremental cannot be used together"), cmds.ErrClient)
+			return
+		}
+
+		var gcOutChan <-chan *corerepo.KeyRemoved
+		switch {
+		case summary:
+			sum, err := corerepo.GarbageSummary(n, req.Context(), top)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			out := make(chan *corerepo.KeyRemoved, 1)
+			out <- &corerepo.KeyRemoved{Summary: sum}
+			close(out)
+			gcOutChan = out
+		case dryRun:
+			gcOutChan, err = corerepo.GarbageCollectDryRun(n, req.Context())
+		case incremental:
+			gcOutChan, err = corerepo.GarbageCollectIncremental(n, req.Context(), batchSize)
+		default:
+			gcOutChan, err = corerepo.GarbageCollectAsync(n, req.Context())
+		}
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -86,6 +140,7 @@ order to reclaim hard disk space.
 			if err != nil {
 				return nil, err
 			}
+			dryRun, _, _ := res.Request().Option("dry-run").Bool()
 
 			marshal := func(v interface{}) (io.Reader, error) {
 				obj, ok := v.(*corerepo.KeyRemoved)
@@ -93,10 +148,40 @@ order to reclaim hard disk space.
 					return nil, u.ErrCast()
 				}
 
+				if obj.Error != "" {
+					return nil, errors.New(obj.Error)
+				}
+
 				buf := new(bytes.Buffer)
-				if quiet {
+				if p := obj.Progress; p != nil {
+					if quiet {
+						return buf, nil
+					}
+					if p.Phase == gc.PhaseMark {
+						fmt.Fprintf(buf, "marked %d blocks to keep\n", p.Marked)
+					} else {
+						fmt.Fprintf(buf, "scanned %d blocks, %d marked to keep\n", p.Scanned, p.Marked)
+					}
+					return buf, nil
+				}
+
+				if sum := obj.Summary; sum != nil {
+					fmt.Fprintf(buf, "blocks: %d\nbytes: %d\n", sum.Blocks, sum.Bytes)
+					if len(sum.Roots) > 0 && !quiet {
+						fmt.Fprintln(buf, "largest unpinned roots:")
+					}
+					for _, r := range sum.Roots {
+						fmt.Fprintf(buf, "%s %d\n", r.Key, r.Bytes)
+					}
+					return buf, nil
+				}
+
+				switch {
+				case quiet:
 					buf = bytes.NewBufferString(string(obj.Key) + "\n")
-				} else {
+				case dryRun:
+					buf = bytes.NewBufferString(fmt.Sprintf("would remove %s %d\n", obj.Key, obj.Size))
+				default:
 					buf = bytes.NewBufferString(fmt.Sprintf("removed %s\n", obj.Key))
 				}
 				return buf, nil
@@ -120,6 +205,7 @@ set of stored objects and print repo statistics. It outputs to stdout:
 NumObjects      int Number of objects in the local repo.
 RepoPath        string The path to the repo being currently used.
 RepoSize        int Size in bytes that the repo is currently taking.
+LogicalSize     int Size in bytes of the blocks before compression.
 Version         string The repo version.
 `,
 	},
@@ -139,7 +225,7 @@ Version         string The repo version.
 		res.SetOutput(stat)
 	},
 	Options: []cmds.Option{
-		cmds.BoolOption("human", "Output RepoSize in MiB.").Default(false),
+		cmds.BoolOption("human", "Output RepoSize and LogicalSize in MiB.").Default(false),
 	},
 	Type: corerepo.Stat{},
 	Marshalers: cmds.MarshalerMap{
@@ -162,6 +248,12 @@ Version         string The repo version.
 			} else {
 				fmt.Fprintf(buf, "RepoSize \t %d\n", stat.RepoSize)
 			}
+			logicalInMiB := stat.LogicalSize / (1024 * 1024)
+			if human && logicalInMiB > 0 {
+				fmt.Fprintf(buf, "LogicalSize (MiB) \t %d\n", logicalInMiB)
+			} else {
+				fmt.Fprintf(buf, "LogicalSize \t %d\n", stat.LogicalSize)
+			}
 			fmt.Fprintf(buf, "RepoPath \t %s\n", stat.RepoPath)
 			fmt.Fprintf(buf, "Version \t %s\n", stat.Version)
 
@@ -220,6 +312,214 @@ daemons are running.
 	},
 }
 
+var RepoRekeyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Encrypt the datastore with a new key.",
+		ShortDescription: `
+'ipfs repo rekey' generates a new key for an encrypted datastore and
+re-encrypts all values with it. The current passphrase is read from the
+IPFS_PASSPHRASE environment variable. The new key is protected with the
+passphrase in --new-passphrase-file, or with the current one.
+
+If it is interrupted, run it again to finish. This command can only run
+when no ipfs daemons are running.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("new-passphrase-file", "File holding the passphrase to protect the new key with."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		r, ok := nd.Repo.(*fsrepo.FSRepo)
+		if !ok {
+			res.SetError(fmt.Errorf("cannot rekey a %T repo", nd.Repo), cmds.ErrNormal)
+			return
+		}
+
+		var passphrase string
+		if path, found, _ := req.Option("new-passphrase-file").String(); found {
+			passphrase, err = fsrepo.ReadPassphraseFile(path)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if passphrase == "" {
+				res.SetError(errors.New("the new passphrase is empty"), cmds.ErrClient)
+				return
+			}
+		}
+
+		n, err := r.Rekey(passphrase)
+		if err != nil {
+			res.SetError(fmt.Errorf("rekey failed after %d values, run it again to finish: %s", n, err), cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&MessageOutput{fmt.Sprintf("Re-encrypted %d values.\n", n)})
+	},
+	Type: MessageOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: MessageTextMarshaler,
+	},
+}
+
+var RepoMigrateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Migrate the repo to the version of this program.",
+		ShortDescription: `
+'ipfs repo migrate' runs the migrations built into this program to bring
+the repo to the version it uses, or to the version given with --to. It
+does not fetch anything from the network. Each migration backs up the
+parts of the repo it changes first, and restores them if it fails.
+
+Use --dry-run to check the migrations without changing the repo. This
+command can only run when no ipfs daemons are running.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.IntOption("to", "Version to migrate the repo to. Defaults to the version of this program."),
+		cmds.BoolOption("dry-run", "Check the migrations without running them.").Default(false),
+		cmds.BoolOption("keep-backup", "Keep the backups once the migrations succeeded.").Default(false),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		to, found, err := req.Option("to").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if !found {
+			to = fsrepo.RepoVersion
+		}
+		dryRun, _, _ := req.Option("dry-run").Bool()
+		keepBackup, _, _ := req.Option("keep-backup").Bool()
+
+		buf := new(bytes.Buffer)
+		opts := mfsr.Options{DryRun: dryRun, KeepBackup: keepBackup, Out: buf}
+		if err := fsrepo.Migrate(req.InvocContext().ConfigRoot, to, opts); err != nil {
+			res.SetError(fmt.Errorf("%s%s", buf, err), cmds.ErrNormal)
+			return
+		}
+		if buf.Len() == 0 {
+			fmt.Fprintf(buf, "The repo is already at version %d.\n", to)
+		}
+
+		res.SetOutput(&MessageOutput{buf.String()})
+	},
+	Type: MessageOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: MessageTextMarshaler,
+	},
+}
+
+var repoExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Write the blocks and pins of the repo to an archive.",
+		ShortDescription: `
+'ipfs repo export' writes a tar archive holding all blocks of the repo,
+its pins and the root of the files API to stdout. If pinned roots are
+given, only these pins and the blocks they keep are exported. The archive
+is read by 'ipfs repo import'.
+
+    ipfs repo export > backup.tar
+    ipfs repo export QmRoot1 QmRoot2 > subset.tar
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", false, true, "Pinned roots to export. Defaults to the whole repo."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var roots []*cid.Cid
+		for _, arg := range req.Arguments() {
+			c, err := cid.Decode(arg)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			roots = append(roots, c)
+		}
+
+		r, w := io.Pipe()
+		go func() {
+			_, err := corerepo.Export(req.Context(), n, w, roots)
+			w.CloseWithError(err)
+		}()
+		res.SetOutput(r)
+	},
+}
+
+var repoImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Read an archive written by 'ipfs repo export' into the repo.",
+		ShortDescription: `
+'ipfs repo import' stores the blocks of an archive written by
+'ipfs repo export', checking each against its hash, and restores its
+pins. The files of a full export are restored at --mfs-path, which is the
+root of the files API by default; it must be empty then.
+
+    ipfs repo import backup.tar
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("archive", true, false, "The archive to import.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("mfs-path", "Path in the files API to restore the files at, '' to skip them.").Default("/"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		mfsPath, _, err := req.Option("mfs-path").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		file, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out, err := corerepo.Import(req.Context(), n, file, mfsPath)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(out)
+	},
+	Type: corerepo.ImportResult{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*corerepo.ImportResult)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "imported %d blocks and %d pins\n", out.Blocks, out.Pins)
+			if out.FilesRoot != "" {
+				fmt.Fprintf(buf, "restored files root %s\n", out.FilesRoot)
+			}
+			return buf, nil
+		},
+	},
+}
+
 type VerifyProgress struct {
 	Message  string
 	Progress int
@@ -228,6 +528,17 @@ type VerifyProgress struct {
 var repoVerifyCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Verify all blocks in repo are not corrupted.",
+		ShortDescription: `
+'ipfs repo verify' reads all blocks of the repo and checks them against
+their hashes.
+
+With --repair, corrupt blocks are removed. Those kept by a pin or the
+files API are fetched again from the network if the node is online; the
+others are reported as orphaned.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("repair", "Remove corrupt blocks and fetch them again.").Default(false),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		nd, err := req.InvocContext().GetNode()
@@ -236,6 +547,12 @@ var repoVerifyCmd = &cmds.Command{
 			return
 		}
 
+		repair, _, err := req.Option("repair").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
 		out := make(chan interface{})
 		go func() {
 			defer close(out)
@@ -249,7 +566,7 @@ var repoVerifyCmd = &cmds.Command{
 				return
 			}
 
-			var fails int
+			var corrupt []key.Key
 			var i int
 			for k := range keys {
 				_, err := bs.Get(k)
@@ -257,15 +574,40 @@ var repoVerifyCmd = &cmds.Command{
 					out <- &VerifyProgress{
 						Message: fmt.Sprintf("block %s was corrupt (%s)", k, err),
 					}
-					fails++
+					corrupt = append(corrupt, k)
 				}
 				i++
 				out <- &VerifyProgress{Progress: i}
 			}
-			if fails == 0 {
+
+			switch {
+			case len(corrupt) == 0:
 				out <- &VerifyProgress{Message: "verify complete, all blocks validated."}
-			} else {
+			case !repair:
 				out <- &VerifyProgress{Message: "verify complete, some blocks were corrupt."}
+			default:
+				report, err := corerepo.RepairBlocks(req.Context(), nd, corrupt)
+				if err != nil {
+					out <- &VerifyProgress{Message: fmt.Sprintf("repair failed: %s, some blocks were corrupt.", err)}
+					return
+				}
+				for _, k := range report.Repaired {
+					out <- &VerifyProgress{Message: fmt.Sprintf("block %s was repaired", k)}
+				}
+				for _, k := range report.Unrecoverable {
+					out <- &VerifyProgress{Message: fmt.Sprintf("block %s could not be fetched again", k)}
+				}
+				for _, k := range report.Orphaned {
+					out <- &VerifyProgress{Message: fmt.Sprintf("block %s was removed, nothing keeps it", k)}
+				}
+				out <- &VerifyProgress{Message: fmt.Sprintf("repaired: %d, unrecoverable: %d, orphaned: %d",
+					len(report.Repaired), len(report.Unrecoverable), len(report.Orphaned))}
+
+				if len(report.Unrecoverable) > 0 {
+					out <- &VerifyProgress{Message: "verify complete, some blocks were corrupt and could not be repaired."}
+				} else {
+					out <- &VerifyProgress{Message: "verify complete, all corrupt blocks were repaired or removed."}
+				}
 			}
 		}()
 
@@ -47,6 +47,11 @@ Resolve the value of another name recursively:
   $ ipfs resolve -r /ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
   /ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj
 
+Resolve a path within a domain, as published with 'ipfs domain publish':
+
+  $ ipfs resolve -r /domain/example-domain/reports
+  /ipfs/QmYRMjyvAiHKN9UTi8Bzt1HUspmSRD8T8DwxfSMzLgBon1
+
 Resolve the value of an IPFS DAG path:
 
   $ ipfs resolve /ipfs/QmeZy1fGbwgVSrqbfh9fKQrAWgeyRnj7h8fsHS1oy3k99x/beep/boop
@@ -81,7 +86,7 @@ Resolve the value of an IPFS DAG path:
 		recursive, _, _ := req.Option("recursive").Bool()
 
 		// the case when ipns is resolved step by step
-		if strings.HasPrefix(name, "/ipns/") && !recursive {
+		if (strings.HasPrefix(name, "/ipns/") || strings.HasPrefix(name, "/domain/")) && !recursive {
 			p, err := n.Namesys.ResolveN(req.Context(), name, 1)
 			// ErrResolveRecursion is fine
 			if err != nil && err != ns.ErrResolveRecursion {
@@ -43,6 +43,8 @@ ADVANCED COMMANDS
   dns           Resolve DNS links
   pin           Pin objects to local storage
   repo          Manipulate the IPFS repository
+  filestore     Manage files added with 'ipfs add --nocopy'
+  inventory     Query the ledger of added, pinned and removed objects
 
 NETWORK COMMANDS
   id            Show info about ipfs peers
@@ -51,6 +53,7 @@ NETWORK COMMANDS
   dht           Query the DHT for values or peers
   ping          Measure the latency of a connection
   diag          Print diagnostics
+  domain        Inspect and change the private domain of this node
 
 TOOL COMMANDS
   config        Manage configuration
@@ -89,9 +92,12 @@ var rootSubcommands = map[string]*cmds.Command{
 	"dht":       DhtCmd,
 	"diag":      DiagCmd,
 	"dns":       DNSCmd,
+	"domain":    DomainCmd,
 	"files":     files.FilesCmd,
+	"filestore": FileStoreCmd,
 	"get":       GetCmd,
 	"id":        IDCmd,
+	"inventory": InventoryCmd,
 	"log":       LogCmd,
 	"ls":        LsCmd,
 	"mount":     MountCmd,
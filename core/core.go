@@ -5,7 +5,7 @@ Packages underneath core/ provide a (relatively) stable, low-level API
 to carry out most IPFS-related tasks.  For more details on the other
 interfaces and how core/... fits into the bigger IPFS picture, see:
 
-  $ godoc github.com/ipfs/go-ipfs
+	$ godoc github.com/ipfs/go-ipfs
 */
 package core
 
@@ -17,6 +17,9 @@ import (
 	"time"
 
 	diag "github.com/ipfs/go-ipfs/diagnostics"
+	group "github.com/ipfs/go-ipfs/group"
+	inventory "github.com/ipfs/go-ipfs/inventory"
+	replication "github.com/ipfs/go-ipfs/replication"
 	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
 	mamask "gx/ipfs/QmSMZwvs3n4GBikZ7hKzT17c3bk65FmyZo2JqtJ16swqCv/multiaddr-filter"
 	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
@@ -50,6 +53,7 @@ import (
 	rp "github.com/ipfs/go-ipfs/exchange/reprovide"
 	mfs "github.com/ipfs/go-ipfs/mfs"
 
+	filestore "github.com/ipfs/go-ipfs/filestore"
 	mount "github.com/ipfs/go-ipfs/fuse/mount"
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
 	namesys "github.com/ipfs/go-ipfs/namesys"
@@ -87,35 +91,44 @@ type IpfsNode struct {
 	Repo repo.Repo
 
 	// Local node
-	Pinning    pin.Pinner // the pinning manager
-	Mounts     Mounts     // current mount state, if any.
-	PrivateKey ic.PrivKey // the local node's private Key
+	Pinning    pin.Pinner           // the pinning manager
+	Inventory  *inventory.Inventory // ledger of added, pinned and removed objects
+	Mounts     Mounts               // current mount state, if any.
+	PrivateKey ic.PrivKey           // the local node's private Key
 
 	// Services
-	Peerstore  pstore.Peerstore     // storage for other Peer instances
-	Blockstore bstore.GCBlockstore  // the block store (lower level)
-	Blocks     *bserv.BlockService  // the block service, get/add blocks.
-	DAG        merkledag.DAGService // the merkle dag service, get/add objects.
-	Resolver   *path.Resolver       // the path resolution system
-	Reporter   metrics.Reporter
-	Discovery  discovery.Service
-	FilesRoot  *mfs.Root
+	Peerstore   pstore.Peerstore         // storage for other Peer instances
+	Blockstore  bstore.GCBlockstore      // the block store (lower level)
+	Filestore   *filestore.Filestore     // references to files added with --nocopy
+	BlockAccess *bstore.AccessBlockstore // last access to blocks, with the "lru" GC policy
+	Blocks      *bserv.BlockService      // the block service, get/add blocks.
+	DAG         merkledag.DAGService     // the merkle dag service, get/add objects.
+	Resolver    *path.Resolver           // the path resolution system
+	Reporter    metrics.Reporter
+	Discovery   discovery.Service
+	FilesRoot   *mfs.Root
 
 	// Online
-	PeerHost     p2phost.Host        // the network host (server+client)
-	Bootstrapper io.Closer           // the periodic bootstrapper
-	Routing      routing.IpfsRouting // the routing system. recommend ipfs-dht
-	Exchange     exchange.Interface  // the block exchange + strategy (bitswap)
-	Namesys      namesys.NameSystem  // the name system, resolves paths to hashes
-	Diagnostics  *diag.Diagnostics   // the diagnostics service
-	Ping         *ping.PingService
-	Reprovider   *rp.Reprovider // the value reprovider system
-	IpnsRepub    *ipnsrp.Republisher
+	PeerHost      p2phost.Host            // the network host (server+client)
+	Bootstrapper  io.Closer               // the periodic bootstrapper
+	Routing       routing.IpfsRouting     // the routing system. recommend ipfs-dht
+	Exchange      exchange.Interface      // the block exchange + strategy (bitswap)
+	Namesys       namesys.NameSystem      // the name system, resolves paths to hashes
+	Diagnostics   *diag.Diagnostics       // the diagnostics service
+	Group         *group.Membership       // the domain membership service, if the node is in a domain
+	InventorySync *inventory.Syncer       // exchanges inventories with the other members of the domain
+	Replicator    *replication.Replicator // enforces replication factors within the domain
+	Ping          *ping.PingService
+	Reprovider    *rp.Reprovider // the value reprovider system
+	IpnsRepub     *ipnsrp.Republisher
 
 	proc goprocess.Process
 	ctx  context.Context
 
 	mode mode
+
+	// quota enforces Datastore.StorageMax, if enabled
+	quota *bstore.QuotaBlockstore
 }
 
 // Mounts defines what the node's mount state is. This should
@@ -159,6 +172,11 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 		return err
 	}
 
+	peerhost, err = n.setupGroup(peerhost, cfg)
+	if err != nil {
+		return err
+	}
+
 	if err := n.startOnlineServicesWithHost(ctx, peerhost, routingOption); err != nil {
 		return err
 	}
@@ -168,6 +186,10 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 		return err
 	}
 
+	if err := n.startDomainServices(cfg); err != nil {
+		return err
+	}
+
 	n.Reprovider = rp.NewReprovider(n.Routing, n.Blockstore)
 
 	if cfg.Reprovider.Interval != "0" {
@@ -240,6 +262,10 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 	const alwaysSendToPeer = true // use YesManStrategy
 	bitswapNetwork := bsnet.NewFromIpfsHost(n.PeerHost, n.Routing)
 	n.Exchange = bitswap.New(ctx, n.Identity, bitswapNetwork, n.Blockstore, alwaysSendToPeer)
+	if bs, ok := n.Exchange.(*bitswap.Bitswap); ok && n.quota != nil {
+		// do not let peers fill up the repo with blocks we did not ask for.
+		bs.SetStorageGuard(n.quota.NearQuota)
+	}
 
 	size, err := n.getCacheSize()
 	if err != nil {
@@ -247,7 +273,10 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 	}
 
 	// setup name system
-	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
+	n.Namesys, err = n.newNameSystem(size)
+	if err != nil {
+		return err
+	}
 
 	// setup ipns republishing
 	err = n.setupIpnsRepublisher()
@@ -275,6 +304,18 @@ func (n *IpfsNode) getCacheSize() (int, error) {
 	return cs, nil
 }
 
+// newNameSystem sets up the name system on top of n.Routing. /domain/
+// names resolve for our own domain and the configured known domains.
+func (n *IpfsNode) newNameSystem(cachesize int) (namesys.NameSystem, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	domain := cfg.Domain
+	return namesys.NewNameSystemWithDomains(n.Routing, n.Repo.Datastore(), cachesize, domain.LookupGroupID), nil
+}
+
 func (n *IpfsNode) setupIpnsRepublisher() error {
 	cfg, err := n.Repo.Config()
 	if err != nil {
@@ -345,6 +386,10 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, n.FilesRoot)
 	}
 
+	if n.Inventory != nil {
+		closers = append(closers, n.Inventory)
+	}
+
 	if n.Exchange != nil {
 		closers = append(closers, n.Exchange)
 	}
@@ -364,6 +409,11 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, n.Blocks)
 	}
 
+	// saves the bloom filter, if any
+	if c, ok := n.Blockstore.(io.Closer); ok {
+		closers = append(closers, c)
+	}
+
 	if n.Bootstrapper != nil {
 		closers = append(closers, n.Bootstrapper)
 	}
@@ -544,9 +594,8 @@ func (n *IpfsNode) SetupOfflineRouting() error {
 		return err
 	}
 
-	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
-
-	return nil
+	n.Namesys, err = n.newNameSystem(size)
+	return err
 }
 
 func loadPrivateKey(cfg *config.Identity, id peer.ID) (ic.PrivKey, error) {
@@ -635,6 +684,8 @@ func constructDHTRouting(ctx context.Context, host p2phost.Host, dstore repo.Dat
 	dhtRouting := dht.NewDHT(ctx, host, dstore)
 	dhtRouting.Validator[IpnsValidatorTag] = namesys.IpnsRecordValidator
 	dhtRouting.Selector[IpnsValidatorTag] = namesys.IpnsSelectorFunc
+	dhtRouting.Validator[namesys.DomainValidatorTag] = namesys.DomainRecordValidator
+	dhtRouting.Selector[namesys.DomainValidatorTag] = namesys.DomainSelectorFunc
 	return dhtRouting, nil
 }
 
@@ -0,0 +1,154 @@
+package corerepo
+
+import (
+	"sort"
+
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	"github.com/ipfs/go-ipfs/core"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+// GCSummary describes what a GC would remove.
+type GCSummary struct {
+	Blocks int
+	Bytes  uint64
+
+	// Roots are the largest unpinned roots: blocks that no other block a
+	// GC would remove links to. Bytes counts the blocks a GC would remove
+	// below them, blocks shared by several roots count for each.
+	Roots []GCRoot
+}
+
+type GCRoot struct {
+	Key   key.Key
+	Bytes uint64
+}
+
+// GarbageCollectDryRun lists the blocks a GC would remove with their sizes,
+// without removing anything.
+func GarbageCollectDryRun(n *core.IpfsNode, ctx context.Context) (<-chan *KeyRemoved, error) {
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return nil, err
+	}
+	unmarked, err := gc.Unmarked(ctx, n.Blockstore, n.Pinning, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *KeyRemoved)
+	go func() {
+		defer close(out)
+		for k := range unmarked {
+			b, err := bstore.Peek(n.Blockstore, k)
+			if err == bstore.ErrNotFound {
+				continue
+			}
+			kr := &KeyRemoved{Key: k}
+			if err != nil {
+				kr.Error = err.Error()
+			} else {
+				kr.Size = uint64(len(b.RawData()))
+			}
+
+			select {
+			case out <- kr:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// GarbageSummary sums up what a GC would remove, with the top largest
+// unpinned roots.
+func GarbageSummary(n *core.IpfsNode, ctx context.Context, top int) (*GCSummary, error) {
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return nil, err
+	}
+	unmarked, err := gc.Unmarked(ctx, n.Blockstore, n.Pinning, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := &GCSummary{}
+	sizes := make(map[key.Key]uint64)
+	links := make(map[key.Key][]key.Key)
+	for k := range unmarked {
+		b, err := bstore.Peek(n.Blockstore, k)
+		if err != nil {
+			continue
+		}
+		size := uint64(len(b.RawData()))
+		sum.Blocks++
+		sum.Bytes += size
+		sizes[k] = size
+
+		// blocks that are not dag nodes have no links
+		if nd, err := dag.DecodeProtobuf(b.RawData()); err == nil {
+			for _, l := range nd.Links {
+				links[k] = append(links[k], key.Key(l.Hash))
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	linked := make(map[key.Key]bool)
+	for _, children := range links {
+		for _, c := range children {
+			if _, ok := sizes[c]; ok {
+				linked[c] = true
+			}
+		}
+	}
+
+	for k := range sizes {
+		if !linked[k] {
+			sum.Roots = append(sum.Roots, GCRoot{Key: k, Bytes: treeSize(k, sizes, links)})
+		}
+	}
+	sort.Sort(byBytes(sum.Roots))
+	if top >= 0 && len(sum.Roots) > top {
+		sum.Roots = sum.Roots[:top]
+	}
+	return sum, nil
+}
+
+// treeSize returns the bytes of root and the blocks below it that are in
+// sizes.
+func treeSize(root key.Key, sizes map[key.Key]uint64, links map[key.Key][]key.Key) uint64 {
+	var total uint64
+	seen := map[key.Key]bool{root: true}
+	stack := []key.Key{root}
+	for len(stack) > 0 {
+		k := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		total += sizes[k]
+		for _, c := range links[k] {
+			if _, ok := sizes[c]; ok && !seen[c] {
+				seen[c] = true
+				stack = append(stack, c)
+			}
+		}
+	}
+	return total
+}
+
+type byBytes []GCRoot
+
+func (r byBytes) Len() int      { return len(r) }
+func (r byBytes) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byBytes) Less(i, j int) bool {
+	if r[i].Bytes != r[j].Bytes {
+		return r[i].Bytes > r[j].Bytes
+	}
+	return r[i].Key < r[j].Key
+}
@@ -0,0 +1,66 @@
+package corerepo
+
+import (
+	"time"
+
+	"github.com/ipfs/go-ipfs/core"
+	inventory "github.com/ipfs/go-ipfs/inventory"
+	pin "github.com/ipfs/go-ipfs/pin"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+// ExpireInterval is how often PeriodicExpire looks for expired pins.
+var ExpireInterval = time.Minute
+
+// ExpirePins unpins the recursive pins that expired at now, and returns
+// them. Each is recorded as an unpin in the inventory, and logged as a
+// pinExpired event. The blocks stay around until the next GC.
+func ExpirePins(n *core.IpfsNode, ctx context.Context, now time.Time) ([]*cid.Cid, error) {
+	defer n.Blockstore.PinLock().Unlock()
+
+	var expired []*cid.Cid
+	var err error
+	for _, c := range pin.ExpiredPins(n.Pinning, now) {
+		if err = n.Pinning.Unpin(ctx, c, true); err != nil {
+			break
+		}
+		expired = append(expired, c)
+		log.Event(ctx, "pinExpired", logging.LoggableMap{"cid": c.String()})
+
+		if n.Inventory != nil {
+			if _, err = n.Inventory.Record(inventory.Unpin, c, "", 0); err != nil {
+				break
+			}
+		}
+	}
+
+	if len(expired) > 0 {
+		if ferr := n.Pinning.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return expired, err
+}
+
+// PeriodicExpire unpins expired pins on start, and then every
+// ExpireInterval until ctx is done.
+func PeriodicExpire(ctx context.Context, n *core.IpfsNode) error {
+	for {
+		expired, err := ExpirePins(n, ctx, time.Now())
+		if err != nil {
+			log.Error(err)
+		}
+		for _, c := range expired {
+			log.Infof("unpinned %s, its pin expired", c)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(ExpireInterval):
+		}
+	}
+}
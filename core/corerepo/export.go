@@ -0,0 +1,403 @@
+package corerepo
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	bserv "github.com/ipfs/go-ipfs/blockservice"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/exchange/offline"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	mfs "github.com/ipfs/go-ipfs/mfs"
+	pin "github.com/ipfs/go-ipfs/pin"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+// ExportVersion is the version of the archives written by Export.
+const ExportVersion = 1
+
+// An export archive is a tar file holding the manifest, then one entry per
+// block named after its key, then the trailer.
+const (
+	exportManifestName = "ipfs-repo-export.json"
+	exportTrailerName  = "ipfs-repo-export-end.json"
+	exportBlocksDir    = "blocks/"
+)
+
+// importBatchSize is the number of blocks stored at once by Import.
+const importBatchSize = 64
+
+// ExportManifest describes the content of an export archive.
+type ExportManifest struct {
+	Version int
+
+	// Recursive and Direct are the pins in the archive.
+	Recursive []string
+	Direct    []string
+
+	// FilesRoot is the root of the files API, in full exports.
+	FilesRoot string `json:",omitempty"`
+}
+
+// exportTrailer ends an archive, so that truncated archives are detected.
+type exportTrailer struct {
+	Blocks int
+}
+
+// ImportResult is what Import restored.
+type ImportResult struct {
+	Blocks    int
+	Pins      int
+	FilesRoot string
+}
+
+// Export writes an archive of the repo to w, and returns the number of
+// blocks in it. If roots is empty, all blocks, pins and the files root are
+// exported. Otherwise roots must be pinned, and only these pins and the
+// blocks they keep are.
+func Export(ctx context.Context, n *core.IpfsNode, w io.Writer, roots []*cid.Cid) (int, error) {
+	m := &ExportManifest{Version: ExportVersion}
+
+	if len(roots) == 0 && n.FilesRoot != nil {
+		nd, err := n.FilesRoot.GetValue().GetNode()
+		if err != nil {
+			return 0, err
+		}
+		m.FilesRoot = nd.Cid().String()
+	}
+
+	// keep GC from removing blocks while they are being exported
+	unlock := n.Blockstore.PinLock()
+	defer unlock.Unlock()
+
+	var keys <-chan key.Key
+	if len(roots) == 0 {
+		m.Recursive = cidStrings(n.Pinning.RecursiveKeys())
+		m.Direct = cidStrings(n.Pinning.DirectKeys())
+
+		ch, err := n.Blockstore.AllKeysChan(ctx)
+		if err != nil {
+			return 0, err
+		}
+		keys = ch
+	} else {
+		set, err := exportSet(ctx, n, m, roots)
+		if err != nil {
+			return 0, err
+		}
+		keys = keySetChan(set)
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeJSONEntry(tw, exportManifestName, m); err != nil {
+		return 0, err
+	}
+
+	var count int
+	for k := range keys {
+		b, err := bstore.Peek(n.Blockstore, k)
+		if err == bstore.ErrNotFound {
+			// removed since it was listed
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+
+		err = tw.WriteHeader(&tar.Header{
+			Name:     exportBlocksDir + k.B58String(),
+			Mode:     0644,
+			Size:     int64(len(b.RawData())),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return count, err
+		}
+		if _, err := tw.Write(b.RawData()); err != nil {
+			return count, err
+		}
+		count++
+
+		select {
+		case <-ctx.Done():
+			return count, ctx.Err()
+		default:
+		}
+	}
+
+	if err := writeJSONEntry(tw, exportTrailerName, &exportTrailer{Blocks: count}); err != nil {
+		return count, err
+	}
+	return count, tw.Close()
+}
+
+// exportSet fills in the pins of m for roots, and returns the blocks they
+// keep.
+func exportSet(ctx context.Context, n *core.IpfsNode, m *ExportManifest, roots []*cid.Cid) (key.KeySet, error) {
+	recursive := cidSet(n.Pinning.RecursiveKeys())
+	direct := cidSet(n.Pinning.DirectKeys())
+
+	var walk []*cid.Cid
+	set := key.NewKeySet()
+	for _, c := range roots {
+		switch {
+		case recursive.Has(c):
+			m.Recursive = append(m.Recursive, c.String())
+			walk = append(walk, c)
+		case direct.Has(c):
+			m.Direct = append(m.Direct, c.String())
+			set.Add(key.Key(c.Hash()))
+		default:
+			return nil, fmt.Errorf("%s is not pinned directly or recursively", c)
+		}
+	}
+
+	if err := gc.Descendants(ctx, offlineDAG(n), set, walk, false); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Import reads an archive written by Export into the repo. Every block is
+// checked against its hash. The pins are restored once all blocks are
+// stored, and the files root is added to the files API at mfsPath. At "/",
+// the local files root must be empty and is replaced.
+func Import(ctx context.Context, n *core.IpfsNode, r io.Reader, mfsPath string) (*ImportResult, error) {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("reading the archive: %s", err)
+	}
+	if hdr.Name != exportManifestName {
+		return nil, errors.New("not a repo export archive")
+	}
+	var m ExportManifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("corrupt archive manifest: %s", err)
+	}
+	if m.Version != ExportVersion {
+		return nil, fmt.Errorf("unsupported archive version %d, expected %d", m.Version, ExportVersion)
+	}
+
+	restoreFiles := m.FilesRoot != "" && mfsPath != ""
+	if restoreFiles && mfsPath == "/" {
+		if names := n.FilesRoot.GetValue().(*mfs.Directory).ListNames(); len(names) > 0 {
+			return nil, errors.New("the files root is not empty, use another path to import the files into")
+		}
+	}
+
+	// keep GC from removing blocks until their pins are restored
+	unlock := n.Blockstore.PinLock()
+	defer unlock.Unlock()
+
+	res := &ImportResult{}
+	var batch []blocks.Block
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("the archive is truncated")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading the archive: %s", err)
+		}
+
+		if hdr.Name == exportTrailerName {
+			var t exportTrailer
+			if err := json.NewDecoder(tr).Decode(&t); err != nil {
+				return nil, fmt.Errorf("corrupt archive trailer: %s", err)
+			}
+			if t.Blocks != res.Blocks {
+				return nil, fmt.Errorf("the archive holds %d blocks, expected %d", res.Blocks, t.Blocks)
+			}
+			break
+		}
+
+		if !strings.HasPrefix(hdr.Name, exportBlocksDir) {
+			return nil, fmt.Errorf("unexpected entry in the archive: %s", hdr.Name)
+		}
+		k := key.B58KeyDecode(strings.TrimPrefix(hdr.Name, exportBlocksDir))
+		if k == "" {
+			return nil, fmt.Errorf("invalid block name in the archive: %s", hdr.Name)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading the archive: %s", err)
+		}
+		b := blocks.NewBlock(data)
+		if b.Key() != k {
+			return nil, fmt.Errorf("block %s: %s", k, blocks.ErrWrongHash)
+		}
+
+		batch = append(batch, b)
+		res.Blocks++
+		if len(batch) == importBatchSize {
+			if err := n.Blockstore.PutMany(batch); err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+	}
+	if err := n.Blockstore.PutMany(batch); err != nil {
+		return nil, err
+	}
+
+	if err := restorePins(ctx, n, &m); err != nil {
+		return nil, err
+	}
+	res.Pins = len(m.Recursive) + len(m.Direct)
+
+	if restoreFiles {
+		if err := restoreFilesRoot(ctx, n, m.FilesRoot, mfsPath); err != nil {
+			return nil, fmt.Errorf("restoring the files root: %s", err)
+		}
+		res.FilesRoot = m.FilesRoot
+	}
+	return res, nil
+}
+
+// restorePins pins the roots of m, once their blocks are all in the repo.
+func restorePins(ctx context.Context, n *core.IpfsNode, m *ExportManifest) error {
+	recursive, err := decodeCids(m.Recursive)
+	if err != nil {
+		return err
+	}
+	direct, err := decodeCids(m.Direct)
+	if err != nil {
+		return err
+	}
+
+	// the blocks must all be local, the pins are not fetched
+	set := key.NewKeySet()
+	if err := gc.Descendants(ctx, offlineDAG(n), set, recursive, false); err != nil {
+		return fmt.Errorf("the archive is missing blocks of a pin: %s", err)
+	}
+	for _, c := range direct {
+		has, err := n.Blockstore.Has(key.Key(c.Hash()))
+		if err != nil {
+			return err
+		}
+		if !has {
+			return fmt.Errorf("the archive is missing the pinned block %s", c)
+		}
+	}
+
+	for _, c := range recursive {
+		n.Pinning.PinWithMode(c, pin.Recursive)
+	}
+	for _, c := range direct {
+		n.Pinning.PinWithMode(c, pin.Direct)
+	}
+	return n.Pinning.Flush()
+}
+
+func restoreFilesRoot(ctx context.Context, n *core.IpfsNode, root, mfsPath string) error {
+	c, err := cid.Decode(root)
+	if err != nil {
+		return err
+	}
+	ds := offlineDAG(n)
+	nd, err := ds.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if mfsPath != "/" {
+		if err := mfs.PutNode(n.FilesRoot, mfsPath, nd); err != nil {
+			return err
+		}
+		return mfs.FlushPath(n.FilesRoot, mfsPath)
+	}
+
+	dir := n.FilesRoot.GetValue().(*mfs.Directory)
+	for _, l := range nd.Links {
+		child, err := ds.Get(ctx, cid.NewCidV0(l.Hash))
+		if err != nil {
+			return err
+		}
+		if err := dir.AddChild(l.Name, child); err != nil {
+			return err
+		}
+	}
+	return n.FilesRoot.Flush()
+}
+
+// offlineDAG returns a DAGService that does not fetch missing blocks. Its
+// reads are not counted as uses of the blocks.
+func offlineDAG(n *core.IpfsNode) dag.DAGService {
+	bs := bstore.NewPeekingBlockstore(n.Blockstore)
+	return dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+}
+
+func writeJSONEntry(tw *tar.Writer, name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(b)),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(b)
+	return err
+}
+
+func keySetChan(set key.KeySet) <-chan key.Key {
+	keys := set.Keys()
+	out := make(chan key.Key, len(keys))
+	for _, k := range keys {
+		out <- k
+	}
+	close(out)
+	return out
+}
+
+func cidStrings(cids []*cid.Cid) []string {
+	out := make([]string, len(cids))
+	for i, c := range cids {
+		out[i] = c.String()
+	}
+	return out
+}
+
+func cidSet(cids []*cid.Cid) *cid.Set {
+	out := cid.NewSet()
+	for _, c := range cids {
+		out.Add(c)
+	}
+	return out
+}
+
+func decodeCids(strs []string) ([]*cid.Cid, error) {
+	out := make([]*cid.Cid, len(strs))
+	for i, s := range strs {
+		c, err := cid.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pin in the archive: %s", err)
+		}
+		out[i] = c
+	}
+	return out, nil
+}
@@ -2,6 +2,7 @@ package corerepo
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core"
@@ -22,6 +23,22 @@ var ErrMaxStorageExceeded = errors.New("Maximum storage limit exceeded. Maybe un
 
 type KeyRemoved struct {
 	Key key.Key
+
+	// Size is the size of the block, in dry runs.
+	Size uint64 `json:",omitempty"`
+	// Summary is the only output of dry runs asked for a summary.
+	Summary *GCSummary `json:",omitempty"`
+
+	// Progress is sent between removed keys by incremental GCs.
+	Progress *GCProgress `json:",omitempty"`
+	Error    string      `json:",omitempty"`
+}
+
+// GCProgress is the state of an incremental GC.
+type GCProgress struct {
+	Phase   string
+	Marked  int
+	Scanned int
 }
 
 type GC struct {
@@ -31,6 +48,7 @@ type GC struct {
 	StorageGC  uint64
 	SlackGB    uint64
 	Storage    uint64
+	Policy     string
 }
 
 func NewGC(n *core.IpfsNode) (*GC, error) {
@@ -52,6 +70,12 @@ func NewGC(n *core.IpfsNode) (*GC, error) {
 		cfg.Datastore.StorageGCWatermark = 90
 	}
 
+	switch cfg.Datastore.GCPolicy {
+	case "", "all", "lru":
+	default:
+		return nil, fmt.Errorf("unknown Datastore.GCPolicy: %s", cfg.Datastore.GCPolicy)
+	}
+
 	storageMax, err := humanize.ParseBytes(cfg.Datastore.StorageMax)
 	if err != nil {
 		return nil, err
@@ -71,6 +95,7 @@ func NewGC(n *core.IpfsNode) (*GC, error) {
 		StorageMax: storageMax,
 		StorageGC:  storageGC,
 		SlackGB:    slackGB,
+		Policy:     cfg.Datastore.GCPolicy,
 	}, nil
 }
 
@@ -97,10 +122,11 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 
 	for {
 		select {
-		case _, ok := <-rmed:
+		case k, ok := <-rmed:
 			if !ok {
 				return nil
 			}
+			n.RecordRemoved(k)
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -108,6 +134,38 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 
 }
 
+// EvictLRU removes unpinned blocks, least recently used first, until the
+// repo takes less than target bytes.
+func EvictLRU(n *core.IpfsNode, ctx context.Context, target uint64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return err
+	}
+
+	enough := func() (bool, error) {
+		usage, err := n.Repo.GetStorageUsage()
+		return usage < target, err
+	}
+	rmed, err := gc.Evict(ctx, n.Blockstore, n.Pinning, roots, n.BlockAccess.LastAccess, enough)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case k, ok := <-rmed:
+			if !ok {
+				return nil
+			}
+			n.RecordRemoved(k)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) (<-chan *KeyRemoved, error) {
 	roots, err := BestEffortRoots(n.FilesRoot)
 	if err != nil {
@@ -122,9 +180,53 @@ func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) (<-chan *KeyRemo
 	go func() {
 		defer close(out)
 		for k := range rmed {
+			n.RecordRemoved(k)
+			select {
+			case out <- &KeyRemoved{Key: k}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// GarbageCollectIncremental runs an incremental GC, which lets adds and
+// pins proceed between its sweep batches. It streams the removed keys and
+// the progress of the collection.
+func GarbageCollectIncremental(n *core.IpfsNode, ctx context.Context, batchSize int) (<-chan *KeyRemoved, error) {
+	roots := func() ([]*cid.Cid, error) {
+		return BestEffortRoots(n.FilesRoot)
+	}
+	progress, err := gc.Incremental(ctx, n.Blockstore, n.Pinning, roots, batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *KeyRemoved)
+	go func() {
+		defer close(out)
+		send := func(kr *KeyRemoved) bool {
 			select {
-			case out <- &KeyRemoved{k}:
+			case out <- kr:
+				return true
 			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for p := range progress {
+			for _, k := range p.Removed {
+				n.RecordRemoved(k)
+				if !send(&KeyRemoved{Key: k}) {
+					return
+				}
+			}
+			if p.Err != nil {
+				send(&KeyRemoved{Error: p.Err.Error()})
+				return
+			}
+			if !send(&KeyRemoved{Progress: &GCProgress{Phase: p.Phase, Marked: p.Marked, Scanned: p.Scanned}}) {
 				return
 			}
 		}
@@ -195,7 +297,12 @@ func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
 		_ctx, cancel := context.WithTimeout(ctx, time.Duration(gc.SlackGB)*time.Minute)
 		defer cancel()
 
-		if err := GarbageCollect(gc.Node, _ctx); err != nil {
+		if gc.Policy == "lru" && gc.Node.BlockAccess != nil {
+			err = EvictLRU(gc.Node, _ctx, gc.StorageGC)
+		} else {
+			err = GarbageCollect(gc.Node, _ctx)
+		}
+		if err != nil {
 			return err
 		}
 		newStorage, err := gc.Repo.GetStorageUsage()
@@ -17,14 +17,27 @@ import (
 	"fmt"
 
 	"github.com/ipfs/go-ipfs/core"
+	inventory "github.com/ipfs/go-ipfs/inventory"
 	"github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
+	pin "github.com/ipfs/go-ipfs/pin"
 
 	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
 	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
 )
 
 func Pin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool) ([]*cid.Cid, error) {
+	return PinWithInfo(n, ctx, paths, recursive, pin.PinInfo{})
+}
+
+// PinWithInfo pins paths like Pin, and records info for the pins. Pins that
+// existed keep their name unless info has one, and get the labels of info
+// added to theirs. Their expiry is always replaced by that of info.
+func PinWithInfo(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool, info pin.PinInfo) ([]*cid.Cid, error) {
+	if err := info.Validate(); err != nil {
+		return nil, fmt.Errorf("pin: %s", err)
+	}
+
 	dagnodes := make([]*merkledag.Node, 0)
 	for _, fpath := range paths {
 		dagnode, err := core.Resolve(ctx, n, path.Path(fpath))
@@ -45,6 +58,22 @@ func Pin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool)
 			return nil, fmt.Errorf("pin: %s", err)
 		}
 		out = append(out, c)
+
+		if !info.Empty() || recursive {
+			if err := n.Pinning.SetInfo(c, mergeInfo(n.Pinning, c, info)); err != nil {
+				return nil, fmt.Errorf("pin: %s", err)
+			}
+		}
+
+		if n.Inventory != nil {
+			size, err := dagnode.Size()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := n.Inventory.RecordPin(c, recursive, size); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	err := n.Pinning.Flush()
@@ -76,6 +105,12 @@ func Unpin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool
 			return nil, err
 		}
 		unpinned = append(unpinned, k)
+
+		if n.Inventory != nil {
+			if _, err := n.Inventory.Record(inventory.Unpin, k, "", 0); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	err := n.Pinning.Flush()
@@ -84,3 +119,28 @@ func Unpin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool
 	}
 	return unpinned, nil
 }
+
+// mergeInfo returns the info of the pin of c updated with info. The name
+// and labels add to those of the pin, the expiry replaces its own, so that
+// pinning again without a ttl makes the pin permanent.
+func mergeInfo(pinning pin.Pinner, c *cid.Cid, info pin.PinInfo) pin.PinInfo {
+	old, ok := pinning.Info(c)
+	if !ok {
+		return info
+	}
+	merged := pin.PinInfo{
+		Name:    old.Name,
+		Labels:  make(map[string]string, len(old.Labels)+len(info.Labels)),
+		Expires: info.Expires,
+	}
+	if info.Name != "" {
+		merged.Name = info.Name
+	}
+	for k, v := range old.Labels {
+		merged.Labels[k] = v
+	}
+	for k, v := range info.Labels {
+		merged.Labels[k] = v
+	}
+	return merged
+}
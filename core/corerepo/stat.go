@@ -9,10 +9,11 @@ import (
 )
 
 type Stat struct {
-	NumObjects uint64
-	RepoSize   uint64 // size in bytes
-	RepoPath   string
-	Version    string
+	NumObjects  uint64
+	RepoSize    uint64 // size in bytes
+	LogicalSize uint64 // size of the blocks before compression, in bytes
+	RepoPath    string
+	Version     string
 }
 
 func RepoStat(n *core.IpfsNode, ctx context.Context) (*Stat, error) {
@@ -23,6 +24,11 @@ func RepoStat(n *core.IpfsNode, ctx context.Context) (*Stat, error) {
 		return nil, err
 	}
 
+	logical, err := r.GetLogicalStorageUsage()
+	if err != nil {
+		return nil, err
+	}
+
 	allKeys, err := n.Blockstore.AllKeysChan(ctx)
 	if err != nil {
 		return nil, err
@@ -39,9 +45,10 @@ func RepoStat(n *core.IpfsNode, ctx context.Context) (*Stat, error) {
 	}
 
 	return &Stat{
-		NumObjects: count,
-		RepoSize:   usage,
-		RepoPath:   path,
-		Version:    fmt.Sprintf("fs-repo@%d", fsrepo.RepoVersion),
+		NumObjects:  count,
+		RepoSize:    usage,
+		LogicalSize: logical,
+		RepoPath:    path,
+		Version:     fmt.Sprintf("fs-repo@%d", fsrepo.RepoVersion),
 	}, nil
 }
@@ -0,0 +1,189 @@
+package corerepo
+
+import (
+	"time"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	"github.com/ipfs/go-ipfs/core"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+
+	mh "gx/ipfs/QmYf7ng2hG5XBtJA3tN34DQ2GUN5HNksEw1rLDkmr6vGku/go-multihash"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+// repairFetchTimeout bounds the time spent fetching a corrupt block again.
+var repairFetchTimeout = time.Minute
+
+// RepairReport is the outcome of RepairBlocks.
+type RepairReport struct {
+	// Repaired blocks were fetched again from the network.
+	Repaired []key.Key
+	// Unrecoverable blocks are kept by a pin or the files root, but
+	// could not be fetched.
+	Unrecoverable []key.Key
+	// Orphaned blocks are not kept by anything, they were removed.
+	Orphaned []key.Key
+}
+
+// RepairBlocks removes the corrupt blocks from the repo, and fetches those
+// kept by a pin or the files root again if the node is online. Blocks
+// below corrupt ones are only known to be kept once their parents are
+// repaired, so this goes on until no more blocks can be repaired.
+//
+// The pin lock is only held while blocks are removed or stored, so that
+// GC is not held up by the fetches.
+func RepairBlocks(ctx context.Context, n *core.IpfsNode, corrupt []key.Key) (*RepairReport, error) {
+	kept, err := removeCorrupt(ctx, n, corrupt)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RepairReport{}
+	pending := corrupt
+	for len(pending) > 0 {
+		var next []key.Key
+		var fetched []blocks.Block
+		for _, k := range pending {
+			if !kept.Has(k) {
+				next = append(next, k)
+				continue
+			}
+			if b := refetch(ctx, n, k); b != nil {
+				fetched = append(fetched, b)
+			} else {
+				report.Unrecoverable = append(report.Unrecoverable, k)
+			}
+		}
+
+		pending = next
+		if len(fetched) == 0 {
+			break
+		}
+		if err := storeRepaired(ctx, n, kept, fetched); err != nil {
+			return nil, err
+		}
+		for _, b := range fetched {
+			report.Repaired = append(report.Repaired, b.Key())
+		}
+	}
+	report.Orphaned = pending
+	return report, nil
+}
+
+// removeCorrupt deletes the corrupt blocks and returns the blocks kept by
+// the pins and the files root without them.
+func removeCorrupt(ctx context.Context, n *core.IpfsNode, corrupt []key.Key) (key.KeySet, error) {
+	unlock := n.Blockstore.PinLock()
+	defer unlock.Unlock()
+
+	for _, k := range corrupt {
+		err := n.Blockstore.DeleteBlock(k)
+		if err != nil && err != bstore.ErrNotFound {
+			return nil, err
+		}
+	}
+	return keptSet(ctx, n)
+}
+
+// storeRepaired makes sure the fetched blocks are in the repo, and adds
+// the blocks below them to kept.
+func storeRepaired(ctx context.Context, n *core.IpfsNode, kept key.KeySet, fetched []blocks.Block) error {
+	unlock := n.Blockstore.PinLock()
+	defer unlock.Unlock()
+
+	// a GC that ran during the fetch could not tell they were kept while
+	// their parents were missing, and may have removed them again.
+	for _, b := range fetched {
+		has, err := n.Blockstore.Has(b.Key())
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+		if err := n.Blockstore.Put(b); err != nil {
+			return err
+		}
+	}
+
+	roots := make([]*cid.Cid, len(fetched))
+	for i, b := range fetched {
+		roots[i] = cid.NewCidV0(mh.Multihash(b.Key()))
+	}
+	return walkKept(ctx, offlineDAG(n), kept, roots)
+}
+
+// refetch fetches k from the network, and returns the block if a valid
+// copy was stored.
+func refetch(ctx context.Context, n *core.IpfsNode, k key.Key) blocks.Block {
+	if !n.OnlineMode() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, repairFetchTimeout)
+	defer cancel()
+
+	b, err := n.Blocks.GetBlock(ctx, cid.NewCidV0(mh.Multihash(k)))
+	if err != nil {
+		log.Debugf("failed to fetch %s again: %s", k, err)
+		return nil
+	}
+	if blocks.NewBlock(b.RawData()).Key() != k {
+		log.Errorf("fetched a corrupt copy of %s", k)
+		n.Blockstore.DeleteBlock(k)
+		return nil
+	}
+	return b
+}
+
+// keptSet returns the blocks kept by the pins and the files root, as far
+// as the blocks in the repo tell.
+func keptSet(ctx context.Context, n *core.IpfsNode) (key.KeySet, error) {
+	roots := append(n.Pinning.RecursiveKeys(), n.Pinning.InternalPins()...)
+	if n.FilesRoot != nil {
+		files, err := BestEffortRoots(n.FilesRoot)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, files...)
+	}
+
+	set := key.NewKeySet()
+	for _, c := range n.Pinning.DirectKeys() {
+		set.Add(key.Key(c.Hash()))
+	}
+	if err := walkKept(ctx, offlineDAG(n), set, roots); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// walkKept adds the blocks below roots to set, skipping those that are
+// missing. The roots themselves are walked even if set already has them.
+func walkKept(ctx context.Context, ds dag.DAGService, set key.KeySet, roots []*cid.Cid) error {
+	visit := func(c *cid.Cid) bool {
+		k := key.Key(c.Hash())
+		if set.Has(k) {
+			return false
+		}
+		set.Add(k)
+		return true
+	}
+	for _, c := range roots {
+		set.Add(key.Key(c.Hash()))
+		nd, err := ds.Get(ctx, c)
+		if err == dag.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := dag.EnumerateChildren(ctx, ds, nd, visit, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
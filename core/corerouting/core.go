@@ -4,10 +4,12 @@ import (
 	"errors"
 
 	core "github.com/ipfs/go-ipfs/core"
+	group "github.com/ipfs/go-ipfs/group"
 	repo "github.com/ipfs/go-ipfs/repo"
 	supernode "github.com/ipfs/go-ipfs/routing/supernode"
 	gcproxy "github.com/ipfs/go-ipfs/routing/supernode/proxy"
 	"gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
 	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
 	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
 	routing "gx/ipfs/QmcoQiBzRaaVv1DZbbXoDWiEtvDN94Ca1DcwnQKK2tP92s/go-libp2p-routing"
@@ -27,10 +29,11 @@ var (
 
 // SupernodeServer returns a configuration for a routing server that stores
 // routing records to the provided datastore. Only routing records are store in
-// the datastore.
+// the datastore. Records of clients belonging to a domain are kept apart
+// from those of other domains and of public clients.
 func SupernodeServer(recordSource ds.Datastore) core.RoutingOption {
 	return func(ctx context.Context, ph host.Host, dstore repo.Datastore) (routing.IpfsRouting, error) {
-		server, err := supernode.NewServer(recordSource, ph.Peerstore(), ph.ID())
+		server, err := supernode.NewGroupServer(recordSource, ph.Peerstore(), ph.ID(), groupFunc(ph))
 		if err != nil {
 			return nil, err
 		}
@@ -43,6 +46,23 @@ func SupernodeServer(recordSource ds.Datastore) core.RoutingOption {
 	}
 }
 
+// groupFunc tells the domains of supernode clients apart. A server that is
+// itself a domain member only serves its own domain.
+func groupFunc(ph host.Host) supernode.GroupFunc {
+	gh, ok := ph.(*group.GatedHost)
+	if !ok {
+		return group.NewObserver(ph).GroupOf
+	}
+
+	m := gh.Membership()
+	return func(ctx context.Context, p peer.ID) (string, error) {
+		if err := m.Verify(ctx, p); err != nil {
+			return "", err
+		}
+		return m.GroupID(), nil
+	}
+}
+
 // TODO doc
 func SupernodeClient(remotes ...pstore.PeerInfo) core.RoutingOption {
 	return func(ctx context.Context, ph host.Host, dstore repo.Datastore) (routing.IpfsRouting, error) {
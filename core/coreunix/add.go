@@ -13,12 +13,16 @@ import (
 	"github.com/ipfs/go-ipfs/commands/files"
 	core "github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/exchange/offline"
-	importer "github.com/ipfs/go-ipfs/importer"
+	"github.com/ipfs/go-ipfs/importer/balanced"
 	"github.com/ipfs/go-ipfs/importer/chunk"
+	h "github.com/ipfs/go-ipfs/importer/helpers"
+	"github.com/ipfs/go-ipfs/importer/trickle"
+	inventory "github.com/ipfs/go-ipfs/inventory"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	mfs "github.com/ipfs/go-ipfs/mfs"
 	"github.com/ipfs/go-ipfs/pin"
 	unixfs "github.com/ipfs/go-ipfs/unixfs"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
 
 	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
 	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
@@ -92,6 +96,7 @@ type Adder struct {
 	pinning    pin.Pinner
 	blockstore bstore.GCBlockstore
 	dagService dag.DAGService
+	Inventory  *inventory.Inventory // records added files, if set
 	Out        chan interface{}
 	Progress   bool
 	Hidden     bool
@@ -100,6 +105,8 @@ type Adder struct {
 	Silent     bool
 	Wrap       bool
 	Chunker    string
+	Key        *crypt.Key // encrypts file data, if set
+	NoCopy     bool       // store file data as references into the files
 	root       *dag.Node
 	mr         *mfs.Root
 	unlocker   bs.Unlocker
@@ -110,23 +117,26 @@ func (adder *Adder) SetMfsRoot(r *mfs.Root) {
 	adder.mr = r
 }
 
-// Perform the actual add & pin locally, outputting results to reader
-func (adder Adder) add(reader io.Reader) (*dag.Node, error) {
+// Perform the actual add & pin locally, outputting results to reader.
+// fullPath is the absolute path of the file being read for --nocopy adds,
+// and empty otherwise.
+func (adder Adder) add(reader io.Reader, fullPath string) (*dag.Node, error) {
 	chnk, err := chunk.FromString(reader, adder.Chunker)
 	if err != nil {
 		return nil, err
 	}
 
+	dbp := h.DagBuilderParams{
+		Dagserv:  adder.dagService,
+		Maxlinks: h.DefaultLinksPerBlock,
+		Key:      adder.Key,
+		FullPath: fullPath,
+	}
+
 	if adder.Trickle {
-		return importer.BuildTrickleDagFromReader(
-			adder.dagService,
-			chnk,
-		)
-	}
-	return importer.BuildDagFromReader(
-		adder.dagService,
-		chnk,
-	)
+		return trickle.TrickleLayout(dbp.New(chnk))
+	}
+	return balanced.BalancedLayout(dbp.New(chnk))
 }
 
 func (adder *Adder) RootNode() (*dag.Node, error) {
@@ -255,11 +265,17 @@ func Add(n *core.IpfsNode, r io.Reader) (string, error) {
 		return "", err
 	}
 
-	node, err := fileAdder.add(r)
+	fileAdder.Inventory = n.Inventory
+
+	node, err := fileAdder.add(r, "")
 	if err != nil {
 		return "", err
 	}
 
+	if err := fileAdder.record(node, ""); err != nil {
+		return "", err
+	}
+
 	return node.Cid().String(), nil
 }
 
@@ -282,6 +298,7 @@ func AddR(n *core.IpfsNode, root string) (key string, err error) {
 	if err != nil {
 		return "", err
 	}
+	fileAdder.Inventory = n.Inventory
 
 	err = fileAdder.addFile(f)
 	if err != nil {
@@ -307,6 +324,7 @@ func AddWrapped(n *core.IpfsNode, r io.Reader, filename string) (string, *dag.No
 		return "", nil, err
 	}
 	fileAdder.Wrap = true
+	fileAdder.Inventory = n.Inventory
 
 	defer n.Blockstore.PinLock().Unlock()
 
@@ -341,12 +359,31 @@ func (adder *Adder) addNode(node *dag.Node, path string) error {
 		return err
 	}
 
+	if err := adder.record(node, path); err != nil {
+		return err
+	}
+
 	if !adder.Silent {
 		return outputDagnode(adder.Out, path, node)
 	}
 	return nil
 }
 
+// record notes the addition of node in the inventory ledger.
+func (adder *Adder) record(node *dag.Node, name string) error {
+	if adder.Inventory == nil {
+		return nil
+	}
+
+	size, err := node.Size()
+	if err != nil {
+		return err
+	}
+
+	_, err = adder.Inventory.Record(inventory.Add, node.Cid(), name, size)
+	return err
+}
+
 // Add the given file while respecting the adder.
 func (adder *Adder) AddFile(file files.File) error {
 	if adder.Pin {
@@ -390,12 +427,21 @@ func (adder *Adder) addFile(file files.File) error {
 	// case for regular file
 	// if the progress flag was specified, wrap the file so that we can send
 	// progress updates to the client (over the output channel)
+	var fullPath string
+	if adder.NoCopy {
+		af, ok := file.(files.AbsPathFile)
+		if !ok || af.AbsPath() == "" {
+			return fmt.Errorf("cannot add %s without copying it: not a file on the local filesystem", file.FileName())
+		}
+		fullPath = af.AbsPath()
+	}
+
 	var reader io.Reader = file
 	if adder.Progress {
 		reader = &progressReader{file: file, out: adder.Out}
 	}
 
-	dagnode, err := adder.add(reader)
+	dagnode, err := adder.add(reader, fullPath)
 	if err != nil {
 		return err
 	}
@@ -12,5 +12,5 @@ func Cat(ctx context.Context, n *core.IpfsNode, pstr string) (*uio.DagReader, er
 	if err != nil {
 		return nil, err
 	}
-	return uio.NewDagReader(ctx, dagNode, n.DAG)
+	return uio.NewDagReader(n.ContentContext(ctx), dagNode, n.DAG)
 }
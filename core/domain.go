@@ -0,0 +1,356 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
+	decision "github.com/ipfs/go-ipfs/exchange/bitswap/decision"
+	bsnet "github.com/ipfs/go-ipfs/exchange/bitswap/network"
+	group "github.com/ipfs/go-ipfs/group"
+	grouppb "github.com/ipfs/go-ipfs/group/pb"
+	inventory "github.com/ipfs/go-ipfs/inventory"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	merkledag "github.com/ipfs/go-ipfs/merkledag"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	path "github.com/ipfs/go-ipfs/path"
+	replication "github.com/ipfs/go-ipfs/replication"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
+
+	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+	p2phost "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+// RevocationCheckInterval is how often members look up the revocation
+// list published by the domain authority.
+var RevocationCheckInterval = time.Minute * 10
+
+// revocationsKey is where the authority keeps the last revocation list it
+// published.
+var revocationsKey = ds.NewKey("/local/domain/revocations")
+
+// DomainKeyName is the keystore entry holding the domain content key,
+// which 'ipfs add --encrypt' seals file data with.
+const DomainKeyName = "domain"
+
+var ErrNoDomain = errors.New("node is not a member of a domain")
+
+var ErrNoDomainKey = errors.New("no domain content key in the keystore, see 'ipfs domain key'")
+
+// setupGroup restricts host to the members of our domain, if we belong
+// to one. It must run before any other service registers stream handlers.
+func (n *IpfsNode) setupGroup(host p2phost.Host, cfg *config.Config) (p2phost.Host, error) {
+	if !cfg.Domain.Enabled() {
+		return host, nil
+	}
+
+	cert, err := group.LoadCertificate(&cfg.Domain, n.Identity)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := group.NewMembership(host, cert)
+	if err != nil {
+		return nil, err
+	}
+
+	// supernodes may be shared with other domains, they cannot be members
+	// of ours. Our routing queries still need a connection to them.
+	servers, err := cfg.SupernodeRouting.ServerIPFSAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range servers {
+		m.Exempt(addr.ID())
+	}
+
+	gh := group.Wrap(host, m)
+
+	// peers on the allowlist fetch blocks from us, nothing else.
+	allow, err := cfg.Domain.ServeAllowlistIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range allow {
+		m.Exempt(p)
+		gh.Allow(bsnet.ProtocolBitswap, p)
+		gh.Allow(bsnet.ProtocolBitswapOld, p)
+	}
+
+	n.Group = m
+	return gh, nil
+}
+
+// startDomainServices keeps the domain revocation list up to date,
+// restricts bitswap to members, exchanges inventories with the other
+// members and enforces replication targets. On the authority node it also
+// keeps the published list alive.
+func (n *IpfsNode) startDomainServices(cfg *config.Config) error {
+	if n.Group == nil {
+		return nil
+	}
+
+	if cfg.Domain.IsAuthority() {
+		sk, err := cfg.Domain.DecodeAuthorityKey()
+		if err != nil {
+			return err
+		}
+
+		id, err := peer.IDFromPrivateKey(sk)
+		if err != nil {
+			return err
+		}
+
+		n.Peerstore.AddPrivKey(id, sk)
+		n.Peerstore.AddPubKey(id, sk.GetPublic())
+		n.IpnsRepub.AddName(id)
+
+		// apply our own list right away, the network may not have it yet.
+		rl, err := n.loadRevocationList()
+		if err != nil {
+			return err
+		}
+		if rl != nil {
+			if err := n.Group.SetRevocationList(rl); err != nil {
+				return err
+			}
+		}
+	}
+
+	n.Process().Go(n.watchRevocations)
+
+	allow, err := cfg.Domain.ServeAllowlistIDs()
+	if err != nil {
+		return err
+	}
+	if bs, ok := n.Exchange.(*bitswap.Bitswap); ok {
+		bs.SetServingPolicy(decision.MemberPolicy(n.Group.IsMember, allow))
+	}
+
+	n.InventorySync = inventory.NewSyncer(n.PeerHost, n.Inventory, n.Group.Members)
+	n.Process().Go(n.InventorySync.Run)
+
+	n.Replicator = replication.New(n.PeerHost, n.Repo.Datastore(), n.Inventory, n.InventorySync, n.Group.Members, n.pinRecursive)
+	n.Process().Go(n.Replicator.Run)
+	return nil
+}
+
+// pinRecursive fetches c and pins it recursively, on behalf of the
+// replicator.
+func (n *IpfsNode) pinRecursive(ctx context.Context, c *cid.Cid) error {
+	defer n.Blockstore.PinLock().Unlock()
+
+	nd, err := n.DAG.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if err := n.Pinning.Pin(ctx, nd, true); err != nil {
+		return err
+	}
+	if err := n.Pinning.Flush(); err != nil {
+		return err
+	}
+
+	size, err := nd.Size()
+	if err != nil {
+		return err
+	}
+	_, err = n.Inventory.RecordPin(c, true, size)
+	return err
+}
+
+func (n *IpfsNode) watchRevocations(proc goprocess.Process) {
+	tick := time.NewTicker(RevocationCheckInterval)
+	defer tick.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(n.Context(), RevocationCheckInterval)
+		if err := n.UpdateRevocations(ctx); err != nil {
+			log.Debug("failed to update domain revocation list: ", err)
+		}
+		cancel()
+
+		select {
+		case <-tick.C:
+		case <-proc.Closing():
+			return
+		}
+	}
+}
+
+// UpdateRevocations resolves the revocation list published under the
+// authority's IPNS name and applies it.
+func (n *IpfsNode) UpdateRevocations(ctx context.Context) error {
+	if n.Group == nil {
+		return ErrNoDomain
+	}
+
+	p, err := n.Namesys.Resolve(ctx, "/ipns/"+n.Group.GroupID())
+	if err != nil {
+		return err
+	}
+
+	nd, err := Resolve(ctx, n, p)
+	if err != nil {
+		return err
+	}
+
+	rl := new(grouppb.RevocationList)
+	if err := proto.Unmarshal(nd.Data(), rl); err != nil {
+		return err
+	}
+
+	err = n.Group.SetRevocationList(rl)
+	if err == group.ErrStaleRevocationList {
+		return nil
+	}
+	return err
+}
+
+// RevokeDomainMember adds p to the domain revocation list and publishes
+// the new list under the authority's IPNS name. Only the domain authority
+// can revoke members.
+func (n *IpfsNode) RevokeDomainMember(ctx context.Context, p peer.ID) (*grouppb.RevocationList, error) {
+	if n.Group == nil {
+		return nil, ErrNoDomain
+	}
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	sk, err := cfg.Domain.DecodeAuthorityKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if p == n.Identity {
+		return nil, fmt.Errorf("the domain authority cannot revoke itself")
+	}
+
+	old, err := n.loadRevocationList()
+	if err != nil {
+		return nil, err
+	}
+
+	var revoked []peer.ID
+	var seq uint64
+	if old != nil {
+		for _, b := range old.GetPeers() {
+			if peer.ID(b) == p {
+				return old, nil
+			}
+			revoked = append(revoked, peer.ID(b))
+		}
+		seq = old.GetSequence()
+	}
+	revoked = append(revoked, p)
+
+	rl, err := group.NewRevocationList(sk, cfg.Domain.Name, seq+1, revoked)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := proto.Marshal(rl)
+	if err != nil {
+		return nil, err
+	}
+
+	nd := merkledag.NodeWithData(data)
+	c, err := n.DAG.Add(nd)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the published list around; unpinning the previous one is left
+	// to the operator, it is tiny.
+	if err := n.Pinning.Pin(ctx, nd, false); err != nil {
+		return nil, err
+	}
+	if err := n.Pinning.Flush(); err != nil {
+		return nil, err
+	}
+
+	if err := n.Repo.Datastore().Put(revocationsKey, data); err != nil {
+		return nil, err
+	}
+
+	if err := n.Group.SetRevocationList(rl); err != nil {
+		return nil, err
+	}
+
+	if err := n.Namesys.Publish(ctx, sk, path.FromCid(c)); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+// PublishDomain points the domain registry record at p, so that
+// /domain/<name> resolves to it. Only the domain authority can publish
+// the registry record.
+func (n *IpfsNode) PublishDomain(ctx context.Context, p path.Path) error {
+	if n.Group == nil {
+		return ErrNoDomain
+	}
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+
+	sk, err := cfg.Domain.DecodeAuthorityKey()
+	if err != nil {
+		return err
+	}
+	return namesys.PublishDomainRecord(ctx, n.Routing, sk, cfg.Domain.Name, p)
+}
+
+// DomainKey loads the domain content key from the repo keystore.
+func (n *IpfsNode) DomainKey() (*crypt.Key, error) {
+	raw, err := n.Repo.Keystore().Get(DomainKeyName)
+	switch {
+	case err == keystore.ErrNoSuchKey:
+		return nil, ErrNoDomainKey
+	case err != nil:
+		return nil, err
+	}
+	return crypt.NewKey(raw)
+}
+
+// ContentContext returns ctx carrying the content keys of this node, so
+// that encrypted files read with it are decrypted transparently.
+func (n *IpfsNode) ContentContext(ctx context.Context) context.Context {
+	k, err := n.DomainKey()
+	if err != nil {
+		if err != ErrNoDomainKey {
+			log.Warning("failed to load the domain content key: ", err)
+		}
+		return ctx
+	}
+	return crypt.WithKeys(ctx, k)
+}
+
+func (n *IpfsNode) loadRevocationList() (*grouppb.RevocationList, error) {
+	val, err := n.Repo.Datastore().Get(revocationsKey)
+	switch {
+	case err == ds.ErrNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	rl := new(grouppb.RevocationList)
+	if err := proto.Unmarshal(val.([]byte), rl); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
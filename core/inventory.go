@@ -0,0 +1,43 @@
+package core
+
+import (
+	inventory "github.com/ipfs/go-ipfs/inventory"
+	config "github.com/ipfs/go-ipfs/repo/config"
+
+	mh "gx/ipfs/QmYf7ng2hG5XBtJA3tN34DQ2GUN5HNksEw1rLDkmr6vGku/go-multihash"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+// setupInventory opens the inventory ledger kept in the repo and attaches
+// the configured event sink.
+func (n *IpfsNode) setupInventory(cfg *config.Config) error {
+	inv, err := inventory.New(n.Repo.Datastore(), n.Identity)
+	if err != nil {
+		return err
+	}
+
+	sink, err := inventory.NewSink(cfg.Inventory.Sink)
+	if err != nil {
+		return err
+	}
+	if sink != nil {
+		inv.AddSink(sink)
+	}
+
+	n.Inventory = inv
+	return nil
+}
+
+// RecordRemoved notes the garbage collection of k in the inventory ledger.
+// The block is already gone, so failures are only logged.
+func (n *IpfsNode) RecordRemoved(k key.Key) {
+	if n.Inventory == nil {
+		return
+	}
+
+	c := cid.NewCidV0(mh.Multihash(k))
+	if _, err := n.Inventory.Record(inventory.Remove, c, "", 0); err != nil {
+		log.Warningf("inventory: failed to record removal of %s: %s", c, err)
+	}
+}
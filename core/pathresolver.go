@@ -17,11 +17,11 @@ var ErrNoNamesys = errors.New(
 	"core/resolve: no Namesys on IpfsNode - can't resolve ipns entry")
 
 // Resolve resolves the given path by parsing out protocol-specific
-// entries (e.g. /ipns/<node-key>) and then going through the /ipfs/
-// entries and returning the final merkledag node.
+// entries (e.g. /ipns/<node-key> or /domain/<name>) and then going through
+// the /ipfs/ entries and returning the final merkledag node.
 func Resolve(ctx context.Context, n *IpfsNode, p path.Path) (*merkledag.Node, error) {
-	if strings.HasPrefix(p.String(), "/ipns/") {
-		// resolve ipns paths
+	if strings.HasPrefix(p.String(), "/ipns/") || strings.HasPrefix(p.String(), "/domain/") {
+		// resolve ipns and domain paths
 
 		// TODO(cryptix): we sould be able to query the local cache for the path
 		if n.Namesys == nil {
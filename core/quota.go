@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
+	config "github.com/ipfs/go-ipfs/repo/config"
+
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+// defaultStorageGCWatermark is used when Datastore.StorageGCWatermark is
+// not set, see corerepo.NewGC.
+const defaultStorageGCWatermark = 90
+
+// setupQuota makes bs enforce Datastore.StorageMax, if enabled. Usage is
+// the size of the blocks as tracked by the repo.
+func (n *IpfsNode) setupQuota(bs bstore.GCBlockstore, cfg *config.Config) (bstore.GCBlockstore, error) {
+	if !cfg.Datastore.EnforceStorageMax {
+		return bs, nil
+	}
+
+	storageMax, err := humanize.ParseBytes(cfg.Datastore.StorageMax)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Datastore.StorageMax: %s", err)
+	}
+
+	watermark := cfg.Datastore.StorageGCWatermark
+	if watermark == 0 {
+		watermark = defaultStorageGCWatermark
+	}
+
+	opts := bstore.QuotaOpts{
+		StorageMax: storageMax,
+		Watermark:  storageMax * uint64(watermark) / 100,
+		Usage:      n.Repo.GetStorageUsage,
+	}
+	if cfg.Datastore.GCOnStorageMax {
+		opts.GC = n.quotaGC
+	}
+
+	n.quota = bstore.NewQuotaBlockstore(bs, opts)
+	return n.quota, nil
+}
+
+// quotaGC removes unpinned blocks to make room after a write failed for
+// exceeding the storage quota. It runs in the background, once the write
+// released the pin lock.
+func (n *IpfsNode) quotaGC() error {
+	var roots []*cid.Cid
+	if n.FilesRoot != nil {
+		nd, err := n.FilesRoot.GetValue().GetNode()
+		if err != nil {
+			return err
+		}
+		roots = append(roots, nd.Cid())
+	}
+
+	rmed, err := gc.GC(n.Context(), n.Blockstore, n.Pinning, roots)
+	if err != nil {
+		return err
+	}
+	for k := range rmed {
+		n.RecordRemoved(k)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	config "github.com/ipfs/go-ipfs/repo/config"
+
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// setupTiers puts the cold tier configured in Datastore.Tiers behind hot.
+// The cold tier is mounted at /coldblocks by the repo.
+func setupTiers(ctx context.Context, hot bstore.GCBlockstore, d ds.Batching, cfg *config.Config) (bstore.GCBlockstore, error) {
+	tiers := cfg.Datastore.Tiers
+
+	var opts bstore.TierOpts
+	switch tiers.Policy {
+	case "", "lru":
+		opts.Policy = bstore.TierLRU
+	case "atime":
+		opts.Policy = bstore.TierAccessTime
+	default:
+		return nil, fmt.Errorf("unknown Datastore.Tiers.Policy: %s", tiers.Policy)
+	}
+
+	if tiers.HotSize != "" {
+		size, err := humanize.ParseBytes(tiers.HotSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Datastore.Tiers.HotSize: %s", err)
+		}
+		opts.HotSize = size
+	}
+
+	if tiers.MaxIdle != "" {
+		idle, err := time.ParseDuration(tiers.MaxIdle)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Datastore.Tiers.MaxIdle: %s", err)
+		}
+		opts.MaxIdle = idle
+	}
+
+	cold := bstore.NewBlockstoreWithPrefix(d, bstore.ColdBlockPrefix)
+	if cfg.Datastore.HashOnRead {
+		cold.HashOnRead(true)
+	}
+	return bstore.TieredBlockstore(hot, cold, ctx, opts)
+}
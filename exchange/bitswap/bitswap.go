@@ -145,6 +145,11 @@ type Bitswap struct {
 	blocksRecvd    int
 	dupBlocksRecvd int
 	dupDataRecvd   uint64
+
+	// full reports whether the blockstore is too full to store blocks we
+	// did not ask for.
+	guardLk sync.Mutex
+	full    func() bool
 }
 
 type blockRequest struct {
@@ -209,6 +214,27 @@ func (bs *Bitswap) LedgerForPeer(p peer.ID) *decision.Receipt {
 	return bs.engine.LedgerForPeer(p)
 }
 
+// SetServingPolicy restricts which peers we send blocks to. Wants refused
+// by the policy are recorded in the peer's ledger.
+func (bs *Bitswap) SetServingPolicy(pol decision.Policy) {
+	bs.engine.SetPolicy(pol)
+}
+
+// SetStorageGuard makes bitswap drop blocks it did not ask for while full
+// returns true, so that peers cannot fill up our blockstore.
+func (bs *Bitswap) SetStorageGuard(full func() bool) {
+	bs.guardLk.Lock()
+	bs.full = full
+	bs.guardLk.Unlock()
+}
+
+func (bs *Bitswap) storageFull() bool {
+	bs.guardLk.Lock()
+	full := bs.full
+	bs.guardLk.Unlock()
+	return full != nil && full()
+}
+
 // GetBlocks returns a channel where the caller may receive blocks that
 // correspond to the provided |keys|. Returns an error if BitSwap is unable to
 // begin this request within the deadline enforced by the context.
@@ -336,17 +362,25 @@ func (bs *Bitswap) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg
 
 	// quickly send out cancels, reduces chances of duplicate block receives
 	var keys []key.Key
+	var accepted []blocks.Block
+	full := bs.storageFull()
 	for _, block := range iblocks {
 		if _, found := bs.wm.wl.Contains(block.Key()); !found {
 			log.Infof("received un-asked-for %s from %s", block, p)
+			if full {
+				log.Infof("blockstore is nearly full, dropping %s", block)
+				continue
+			}
+			accepted = append(accepted, block)
 			continue
 		}
 		keys = append(keys, block.Key())
+		accepted = append(accepted, block)
 	}
 	bs.wm.CancelWants(keys)
 
 	wg := sync.WaitGroup{}
-	for _, block := range iblocks {
+	for _, block := range accepted {
 		wg.Add(1)
 		go func(b blocks.Block) {
 			defer wg.Done()
@@ -13,6 +13,7 @@ import (
 	blocks "github.com/ipfs/go-ipfs/blocks"
 	blockstore "github.com/ipfs/go-ipfs/blocks/blockstore"
 	blocksutil "github.com/ipfs/go-ipfs/blocks/blocksutil"
+	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
 	tn "github.com/ipfs/go-ipfs/exchange/bitswap/testnet"
 	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
 	delay "github.com/ipfs/go-ipfs/thirdparty/delay"
@@ -450,3 +451,51 @@ func TestWantlistCleanup(t *testing.T) {
 		t.Fatal("should only have keys[0] in wantlist")
 	}
 }
+
+func TestStorageGuardDropsUnsolicitedBlocks(t *testing.T) {
+	vnet := getVirtualNetwork()
+	sesgen := NewTestSessionGenerator(vnet)
+	defer sesgen.Close()
+	bgen := blocksutil.NewBlockGenerator()
+
+	peers := sesgen.Instances(2)
+	self := peers[0]
+	other := peers[1].Peer
+	defer self.Exchange.Close()
+
+	var full bool
+	self.Exchange.SetStorageGuard(func() bool { return full })
+
+	ctx := context.Background()
+	receive := func(b blocks.Block) bool {
+		msg := bsmsg.New(false)
+		msg.AddBlock(b)
+		self.Exchange.ReceiveMessage(ctx, other, msg)
+		has, err := self.Blockstore().Has(b.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return has
+	}
+
+	if !receive(bgen.Next()) {
+		t.Fatal("unsolicited block should be stored while there is room")
+	}
+
+	full = true
+	if receive(bgen.Next()) {
+		t.Fatal("unsolicited block should be dropped when the blockstore is full")
+	}
+
+	// blocks we asked for are still accepted.
+	wanted := bgen.Next()
+	gctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := self.Exchange.GetBlocks(gctx, []key.Key{wanted.Key()}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 50)
+	if !receive(wanted) {
+		t.Fatal("wanted block should be stored even when the blockstore is full")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
 	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
 	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
 )
 
 // TODO consider taking responsibility for other types of requests. For
@@ -88,12 +89,19 @@ type Engine struct {
 	// ledgerMap lists Ledgers by their Partner key.
 	ledgerMap map[peer.ID]*ledger
 
+	// policyLk protects policy. It is separate from lock as the policy is
+	// checked while holding a ledger lock, which nests inside lock.
+	policyLk sync.RWMutex
+	// policy decides which peers we serve blocks to.
+	policy Policy
+
 	ticker *time.Ticker
 }
 
 func NewEngine(ctx context.Context, bs bstore.Blockstore) *Engine {
 	e := &Engine{
 		ledgerMap:        make(map[peer.ID]*ledger),
+		policy:           ServeAll,
 		bs:               bs,
 		peerRequestQueue: newPRQ(),
 		outbox:           make(chan (<-chan *Envelope), outboxChanBuffer),
@@ -104,6 +112,23 @@ func NewEngine(ctx context.Context, bs bstore.Blockstore) *Engine {
 	return e
 }
 
+// SetPolicy replaces the serving policy. A nil policy serves everyone.
+func (e *Engine) SetPolicy(pol Policy) {
+	if pol == nil {
+		pol = ServeAll
+	}
+	e.policyLk.Lock()
+	e.policy = pol
+	e.policyLk.Unlock()
+}
+
+func (e *Engine) serves(p peer.ID, k key.Key) bool {
+	e.policyLk.RLock()
+	pol := e.policy
+	e.policyLk.RUnlock()
+	return pol.Serve(p, k)
+}
+
 func (e *Engine) WantlistForPeer(p peer.ID) (out []*wl.Entry) {
 	e.lock.Lock()
 	partner, ok := e.ledgerMap[p]
@@ -120,12 +145,19 @@ func (e *Engine) LedgerForPeer(p peer.ID) *Receipt {
 	ledger.lk.Lock()
 	defer ledger.lk.Unlock()
 
+	var denied []string
+	for _, k := range ledger.deniedWants {
+		denied = append(denied, k.B58String())
+	}
+
 	return &Receipt{
-		Peer:      ledger.Partner.String(),
-		Value:     ledger.Accounting.Value(),
-		Sent:      ledger.Accounting.BytesSent,
-		Recv:      ledger.Accounting.BytesRecv,
-		Exchanged: ledger.ExchangeCount(),
+		Peer:        ledger.Partner.String(),
+		Value:       ledger.Accounting.Value(),
+		Sent:        ledger.Accounting.BytesSent,
+		Recv:        ledger.Accounting.BytesRecv,
+		Exchanged:   ledger.ExchangeCount(),
+		Denied:      ledger.deniedCount,
+		DeniedWants: denied,
 	}
 }
 
@@ -169,6 +201,16 @@ func (e *Engine) nextEnvelope(ctx context.Context) (*Envelope, error) {
 
 		// with a task in hand, we're ready to prepare the envelope...
 
+		// the policy may have changed since the want was queued.
+		if !e.serves(nextTask.Target, nextTask.Entry.Key) {
+			l := e.findOrCreate(nextTask.Target)
+			l.lk.Lock()
+			l.Denied(nextTask.Entry.Key)
+			l.lk.Unlock()
+			nextTask.Done()
+			continue
+		}
+
 		block, err := e.bs.Get(nextTask.Entry.Key)
 		if err != nil {
 			// If we don't have the block, don't hold that against the peer
@@ -237,6 +279,11 @@ func (e *Engine) MessageReceived(p peer.ID, m bsmsg.BitSwapMessage) error {
 			l.CancelWant(entry.Key)
 			e.peerRequestQueue.Remove(entry.Key, p)
 		} else {
+			if !e.serves(p, entry.Key) {
+				log.Debugf("not serving %s to %s", entry.Key, p)
+				l.Denied(entry.Key)
+				continue
+			}
 			log.Debugf("wants %s - %d", entry.Key, entry.Priority)
 			l.Wants(entry.Key, entry.Priority)
 			if exists, err := e.bs.Has(entry.Key); err == nil && exists {
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	blocks "github.com/ipfs/go-ipfs/blocks"
 	blockstore "github.com/ipfs/go-ipfs/blocks/blockstore"
@@ -163,6 +164,123 @@ func TestPartnerWantsThenCancels(t *testing.T) {
 	}
 }
 
+func TestPolicyDeniesWants(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	for _, letter := range []string{"a", "b"} {
+		if err := bs.Put(blocks.NewBlock([]byte(letter))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	member := testutil.RandPeerIDFatal(t)
+	friend := testutil.RandPeerIDFatal(t)
+	stranger := testutil.RandPeerIDFatal(t)
+
+	e := NewEngine(ctx, bs)
+	e.SetPolicy(MemberPolicy(func(p peer.ID) bool { return p == member }, []peer.ID{friend}))
+
+	partnerWants(e, []string{"a", "b"}, stranger)
+	partnerWants(e, []string{"a"}, member)
+	partnerWants(e, []string{"b"}, friend)
+
+	served := make(map[peer.ID]int)
+	for i := 0; i < 2; i++ {
+		envelope := <-<-e.Outbox()
+		served[envelope.Peer]++
+		envelope.Sent()
+	}
+	if served[member] != 1 || served[friend] != 1 {
+		t.Fatalf("expected the member and the allowed peer to be served, got %v", served)
+	}
+
+	next := <-e.Outbox()
+	select {
+	case envelope, ok := <-next:
+		if ok {
+			t.Fatalf("served %s to a peer outside the policy", envelope.Block.Key())
+		}
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	r := e.LedgerForPeer(stranger)
+	if r.Denied != 2 || len(r.DeniedWants) != 2 {
+		t.Fatalf("expected 2 denied wants in the ledger, got %d (%v)", r.Denied, r.DeniedWants)
+	}
+	if len(e.WantlistForPeer(stranger)) != 0 {
+		t.Fatal("denied wants should not be kept on the wantlist")
+	}
+}
+
+func TestPolicyCheckedBeforeSending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if err := bs.Put(blocks.NewBlock([]byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+
+	partner := testutil.RandPeerIDFatal(t)
+	e := NewEngine(ctx, bs)
+	partnerWants(e, []string{"a"}, partner)
+
+	// revoked after the want was queued.
+	e.SetPolicy(MemberPolicy(func(peer.ID) bool { return false }, nil))
+
+	next := <-e.Outbox()
+	select {
+	case _, ok := <-next:
+		if ok {
+			t.Fatal("served a block after the policy changed")
+		}
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	if r := e.LedgerForPeer(partner); r.Denied != 1 {
+		t.Fatalf("expected the dropped task to be recorded as denied, got %d", r.Denied)
+	}
+}
+
+func TestPolicyWithConcurrentBlocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	e := NewEngine(ctx, bs)
+	e.SetPolicy(MemberPolicy(func(peer.ID) bool { return true }, nil))
+	partner := testutil.RandPeerIDFatal(t)
+
+	// wantlists are checked against the policy under the ledger lock,
+	// while new blocks take the engine lock first.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			letter := fmt.Sprint(i)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				partnerWants(e, []string{letter}, partner)
+			}()
+			go func() {
+				defer wg.Done()
+				e.AddBlock(blocks.NewBlock([]byte(letter)))
+			}()
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("wantlists and new blocks deadlocked")
+	}
+}
+
 func partnerWants(e *Engine, keys []string, partner peer.ID) {
 	add := message.New(false)
 	for i, letter := range keys {
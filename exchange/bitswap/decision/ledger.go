@@ -9,6 +9,9 @@ import (
 	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
 )
 
+// maxDeniedWants is the number of denied wants remembered per ledger.
+const maxDeniedWants = 16
+
 // keySet is just a convenient alias for maps of keys, where we only care
 // access/lookups.
 type keySet map[key.Key]struct{}
@@ -46,15 +49,23 @@ type ledger struct {
 	// to a given peer
 	sentToPeer map[key.Key]time.Time
 
+	// deniedCount is the number of wants refused by the serving policy.
+	deniedCount uint64
+
+	// deniedWants holds the most recently refused wants, oldest first.
+	deniedWants []key.Key
+
 	lk sync.Mutex
 }
 
 type Receipt struct {
-	Peer      string
-	Value     float64
-	Sent      uint64
-	Recv      uint64
-	Exchanged uint64
+	Peer        string
+	Value       float64
+	Sent        uint64
+	Recv        uint64
+	Exchanged   uint64
+	Denied      uint64
+	DeniedWants []string
 }
 
 type debtRatio struct {
@@ -83,6 +94,20 @@ func (l *ledger) Wants(k key.Key, priority int) {
 	l.wantList.Add(k, priority)
 }
 
+// Denied records a want refused by the serving policy.
+func (l *ledger) Denied(k key.Key) {
+	l.deniedCount++
+	for _, dk := range l.deniedWants {
+		if dk == k {
+			return
+		}
+	}
+	if len(l.deniedWants) == maxDeniedWants {
+		l.deniedWants = l.deniedWants[1:]
+	}
+	l.deniedWants = append(l.deniedWants, k)
+}
+
 func (l *ledger) CancelWant(k key.Key) {
 	l.wantList.Remove(k)
 }
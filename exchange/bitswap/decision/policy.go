@@ -0,0 +1,48 @@
+package decision
+
+import (
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+// Policy decides which blocks the engine serves to which peers. It is
+// consulted when a want arrives and again right before the block is
+// sent, so a peer that loses access in between is not served.
+type Policy interface {
+	Serve(p peer.ID, k key.Key) bool
+}
+
+// PolicyFunc adapts a function to the Policy interface.
+type PolicyFunc func(p peer.ID, k key.Key) bool
+
+func (f PolicyFunc) Serve(p peer.ID, k key.Key) bool {
+	return f(p, k)
+}
+
+// ServeAll is the default policy: every peer gets every block we have.
+var ServeAll Policy = PolicyFunc(func(peer.ID, key.Key) bool { return true })
+
+type memberPolicy struct {
+	isMember func(peer.ID) bool
+	allow    map[peer.ID]struct{}
+}
+
+// MemberPolicy serves blocks only to peers for which isMember returns
+// true, such as the members of our domain, and to the peers in allow.
+func MemberPolicy(isMember func(peer.ID) bool, allow []peer.ID) Policy {
+	mp := &memberPolicy{
+		isMember: isMember,
+		allow:    make(map[peer.ID]struct{}),
+	}
+	for _, p := range allow {
+		mp.allow[p] = struct{}{}
+	}
+	return mp
+}
+
+func (mp *memberPolicy) Serve(p peer.ID, k key.Key) bool {
+	if _, ok := mp.allow[p]; ok {
+		return true
+	}
+	return mp.isMember(p)
+}
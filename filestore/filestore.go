@@ -0,0 +1,179 @@
+// package filestore implements a Blockstore that keeps the leaves of files
+// added with 'ipfs add --nocopy' as references into the original files,
+// instead of copying their data into the repo.
+package filestore
+
+import (
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+var log = logging.Logger("filestore")
+
+// Filestore combines a regular blockstore with a FileManager. Leaf nodes
+// that know where their data came from (see merkledag.PosInfo) are stored
+// as references, everything else goes to the blockstore.
+type Filestore struct {
+	fm *FileManager
+	bs bstore.GCBlockstore
+}
+
+// NewFilestore constructs a Filestore on top of bs.
+func NewFilestore(bs bstore.GCBlockstore, fm *FileManager) *Filestore {
+	return &Filestore{fm: fm, bs: bs}
+}
+
+// FileManager returns the store of file references.
+func (f *Filestore) FileManager() *FileManager {
+	return f.fm
+}
+
+// MainBlockstore returns the blockstore holding copied blocks.
+func (f *Filestore) MainBlockstore() bstore.GCBlockstore {
+	return f.bs
+}
+
+func (f *Filestore) AllKeysChan(ctx context.Context) (<-chan key.Key, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	a, err := f.bs.AllKeysChan(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	b, err := f.fm.AllKeysChan(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan key.Key)
+	go func() {
+		defer cancel()
+		defer close(out)
+
+		for _, in := range []<-chan key.Key{a, b} {
+			for k := range in {
+				select {
+				case out <- k:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// DeleteBlock removes k from both stores. The error of the blockstore is
+// returned if neither of them held k.
+func (f *Filestore) DeleteBlock(k key.Key) error {
+	err1 := f.bs.DeleteBlock(k)
+	if err1 != nil && err1 != ds.ErrNotFound && err1 != bstore.ErrNotFound {
+		return err1
+	}
+
+	switch err2 := f.fm.DeleteBlock(k); err2 {
+	case nil:
+		return nil
+	case ds.ErrNotFound:
+		return err1
+	default:
+		return err2
+	}
+}
+
+func (f *Filestore) Get(k key.Key) (blocks.Block, error) {
+	blk, err := f.bs.Get(k)
+	if err != bstore.ErrNotFound {
+		return blk, err
+	}
+	return f.fm.Get(k)
+}
+
+func (f *Filestore) Peek(k key.Key) (blocks.Block, error) {
+	blk, err := bstore.Peek(f.bs, k)
+	if err != bstore.ErrNotFound {
+		return blk, err
+	}
+	return f.fm.Get(k)
+}
+
+func (f *Filestore) Has(k key.Key) (bool, error) {
+	has, err := f.bs.Has(k)
+	if err != nil || has {
+		return has, err
+	}
+	return f.fm.Has(k)
+}
+
+func (f *Filestore) Put(b blocks.Block) error {
+	nd, ok := isFileRef(b)
+	if !ok {
+		return f.bs.Put(b)
+	}
+
+	has, err := f.Has(b.Key())
+	if err == nil && has {
+		return nil
+	}
+	return f.fm.Put(nd)
+}
+
+func (f *Filestore) PutMany(bs []blocks.Block) error {
+	var normals []blocks.Block
+	var refs []*dag.Node
+	for _, b := range bs {
+		nd, ok := isFileRef(b)
+		if !ok {
+			normals = append(normals, b)
+			continue
+		}
+
+		has, err := f.Has(b.Key())
+		if err == nil && has {
+			continue
+		}
+		refs = append(refs, nd)
+	}
+
+	if len(normals) > 0 {
+		if err := f.bs.PutMany(normals); err != nil {
+			return err
+		}
+	}
+	if len(refs) > 0 {
+		return f.fm.PutMany(refs)
+	}
+	return nil
+}
+
+func (f *Filestore) GCLock() bstore.Unlocker {
+	return f.bs.GCLock()
+}
+
+func (f *Filestore) PinLock() bstore.Unlocker {
+	return f.bs.PinLock()
+}
+
+func (f *Filestore) GCRequested() bool {
+	return f.bs.GCRequested()
+}
+
+// isFileRef returns b as a node if it should be stored as a reference.
+func isFileRef(b blocks.Block) (*dag.Node, bool) {
+	nd, ok := b.(*dag.Node)
+	if !ok || nd.PosInfo == nil || len(nd.Links) > 0 {
+		return nil, false
+	}
+	return nd, true
+}
+
+var _ bstore.GCBlockstore = (*Filestore)(nil)
@@ -0,0 +1,238 @@
+package filestore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	bserv "github.com/ipfs/go-ipfs/blockservice"
+	offline "github.com/ipfs/go-ipfs/exchange/offline"
+	"github.com/ipfs/go-ipfs/importer/balanced"
+	"github.com/ipfs/go-ipfs/importer/chunk"
+	h "github.com/ipfs/go-ipfs/importer/helpers"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dssync "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/sync"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+func newTestFilestore(t *testing.T) (*Filestore, dag.DAGService) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	fs := NewFilestore(bstore.NewBlockstore(d), NewFileManager(d))
+	return fs, dag.NewDAGService(bserv.New(fs, offline.Exchange(fs)))
+}
+
+func addFile(t *testing.T, dserv dag.DAGService, path string, data []byte) *dag.Node {
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dbp := h.DagBuilderParams{
+		Dagserv:  dserv,
+		Maxlinks: h.DefaultLinksPerBlock,
+		FullPath: path,
+	}
+	nd, err := balanced.BalancedLayout(dbp.New(chunk.NewSizeSplitter(bytes.NewReader(data), 1024)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func collect(t *testing.T, ch <-chan *ListRes) map[string]*ListRes {
+	out := make(map[string]*ListRes)
+	for r := range ch {
+		out[r.Key] = r
+	}
+	return out
+}
+
+func TestAddByReference(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, dserv := newTestFilestore(t)
+
+	data := make([]byte, 10000)
+	rand.Read(data)
+	path := filepath.Join(dir, "file")
+	root := addFile(t, dserv, path, data)
+
+	// the leaves are references, the root is a regular block.
+	if len(root.Links) != 10 {
+		t.Fatalf("expected 10 leaves, got %d", len(root.Links))
+	}
+	if has, _ := fs.fm.Has(root.Key()); has {
+		t.Fatal("the root should not be stored as a reference")
+	}
+	for _, l := range root.Links {
+		k := key.Key(l.Hash)
+		if has, _ := fs.fm.Has(k); !has {
+			t.Fatalf("leaf %s is not a reference", k)
+		}
+		if has, _ := fs.bs.Has(k); has {
+			t.Fatalf("leaf %s was copied into the blockstore", k)
+		}
+	}
+
+	// read the file back through the references.
+	nd, err := dserv.Get(ctx, root.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := uio.NewDagReader(ctx, nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("data read back differs from the file")
+	}
+
+	all, err := ListAll(ctx, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := collect(t, all)
+	if len(res) != 10 {
+		t.Fatalf("expected 10 references, got %d", len(res))
+	}
+	var offset uint64
+	for _, l := range root.Links {
+		r := res[key.Key(l.Hash).B58String()]
+		if r == nil || r.FilePath != path || r.Offset != offset {
+			t.Fatalf("unexpected reference: %#v", r)
+		}
+		offset += r.Size
+	}
+	if offset != uint64(len(data)) {
+		t.Fatalf("references cover %d bytes, expected %d", offset, len(data))
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, dserv := newTestFilestore(t)
+
+	a := make([]byte, 4096)
+	rand.Read(a)
+	b := make([]byte, 4096)
+	rand.Read(b)
+	pathA := filepath.Join(dir, "a")
+	pathB := filepath.Join(dir, "b")
+	rootA := addFile(t, dserv, pathA, a)
+	rootB := addFile(t, dserv, pathB, b)
+
+	vs, err := VerifyAll(ctx, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range collect(t, vs) {
+		if r.Status != StatusOk {
+			t.Fatalf("unexpected status before changing files: %s", r.FormatLong())
+		}
+	}
+
+	// change the second chunk of a, and remove b.
+	a[1500] ^= 0xff
+	if err := ioutil.WriteFile(pathA, a, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(pathB); err != nil {
+		t.Fatal(err)
+	}
+
+	vs, err = VerifyAll(ctx, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := collect(t, vs)
+	for i, l := range rootA.Links {
+		exp := StatusOk
+		if i == 1 {
+			exp = StatusFileChanged
+		}
+		if st := res[key.Key(l.Hash).B58String()].Status; st != exp {
+			t.Fatalf("chunk %d of a: expected %s, got %s", i, exp, st)
+		}
+	}
+	for _, l := range rootB.Links {
+		if st := res[key.Key(l.Hash).B58String()].Status; st != StatusFileNotFound {
+			t.Fatalf("expected %s for b, got %s", StatusFileNotFound, st)
+		}
+	}
+
+	if _, err := fs.Get(key.Key(rootA.Links[1].Hash)); err == nil {
+		t.Fatal("expected an error reading a changed reference")
+	}
+	if r := Verify(fs, rootA.Key()); r.Status != StatusKeyNotFound {
+		t.Fatalf("expected %s for a non-reference, got %s", StatusKeyNotFound, r.Status)
+	}
+}
+
+func TestDups(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, dserv := newTestFilestore(t)
+
+	data := make([]byte, 3000)
+	rand.Read(data)
+	root := addFile(t, dserv, filepath.Join(dir, "file"), data)
+
+	// copy one leaf into the blockstore as well.
+	leaf, err := root.Links[0].GetNode(ctx, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.bs.Put(dag.NodeWithData(leaf.Data())); err != nil {
+		t.Fatal(err)
+	}
+
+	dups, err := Dups(ctx, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []key.Key
+	for k := range dups {
+		found = append(found, k)
+	}
+	if len(found) != 1 || found[0] != leaf.Key() {
+		t.Fatalf("expected %s to be the only duplicate, got %v", leaf.Key(), found)
+	}
+
+	// deleting removes both copies.
+	if err := fs.DeleteBlock(leaf.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := fs.Has(leaf.Key()); has {
+		t.Fatal("block still present after delete")
+	}
+	if err := fs.DeleteBlock(leaf.Key()); err == nil {
+		t.Fatal("expected an error deleting a missing block")
+	}
+}
@@ -0,0 +1,220 @@
+package filestore
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	pb "github.com/ipfs/go-ipfs/filestore/pb"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	upb "github.com/ipfs/go-ipfs/unixfs/pb"
+
+	mh "gx/ipfs/QmYf7ng2hG5XBtJA3tN34DQ2GUN5HNksEw1rLDkmr6vGku/go-multihash"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dsq "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/query"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+// FilestorePrefix namespaces the file references in the repo datastore.
+var FilestorePrefix = ds.NewKey("/filestore")
+
+// CorruptReferenceError is returned when the data a reference points to
+// cannot be read back, or no longer hashes to the referenced block.
+type CorruptReferenceError struct {
+	Code Status
+	Err  error
+}
+
+func (c *CorruptReferenceError) Error() string {
+	return c.Err.Error()
+}
+
+// FileManager stores references to leaf data kept in files on the local
+// filesystem, and serves them as blocks.
+type FileManager struct {
+	ds ds.Batching
+}
+
+// NewFileManager constructs a FileManager keeping its references in d,
+// under FilestorePrefix.
+func NewFileManager(d ds.Batching) *FileManager {
+	return &FileManager{ds: d}
+}
+
+func dsKey(k key.Key) ds.Key {
+	return FilestorePrefix.Child(k.DsKey())
+}
+
+// AllKeysChan returns the keys of all referenced blocks.
+func (f *FileManager) AllKeysChan(ctx context.Context) (<-chan key.Key, error) {
+	q := dsq.Query{KeysOnly: true, Prefix: FilestorePrefix.String()}
+	res, err := f.ds.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan key.Key, dsq.KeysOnlyBufSize)
+	go func() {
+		defer close(out)
+
+		for {
+			var v dsq.Result
+			var more bool
+			select {
+			case v, more = <-res.Next():
+			case <-ctx.Done():
+				return
+			}
+			if !more {
+				return
+			}
+			if v.Error != nil {
+				log.Debug("filestore.AllKeysChan got err: ", v.Error)
+				return
+			}
+
+			k, err := key.KeyFromDsKey(ds.NewKey(ds.NewKey(v.Key).BaseNamespace()))
+			if err != nil {
+				log.Warning("error parsing key from DsKey: ", err)
+				continue
+			}
+
+			select {
+			case out <- k:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// DeleteBlock removes the reference to k. The referenced file is left
+// alone.
+func (f *FileManager) DeleteBlock(k key.Key) error {
+	return f.ds.Delete(dsKey(k))
+}
+
+// Get reads the data k references and rebuilds the block from it.
+func (f *FileManager) Get(k key.Key) (blocks.Block, error) {
+	dobj, err := f.getDataObj(k)
+	if err != nil {
+		return nil, err
+	}
+	return readBlock(k, dobj)
+}
+
+func (f *FileManager) getDataObj(k key.Key) (*pb.DataObj, error) {
+	o, err := f.ds.Get(dsKey(k))
+	switch err {
+	case ds.ErrNotFound:
+		return nil, bstore.ErrNotFound
+	case nil:
+	default:
+		return nil, err
+	}
+
+	data, ok := o.([]byte)
+	if !ok {
+		return nil, bstore.ValueTypeMismatch
+	}
+
+	dobj := new(pb.DataObj)
+	if err := proto.Unmarshal(data, dobj); err != nil {
+		return nil, err
+	}
+	return dobj, nil
+}
+
+func readBlock(k key.Key, d *pb.DataObj) (blocks.Block, error) {
+	fi, err := os.Open(d.GetFilePath())
+	if os.IsNotExist(err) {
+		return nil, &CorruptReferenceError{StatusFileNotFound, err}
+	} else if err != nil {
+		return nil, &CorruptReferenceError{StatusFileError, err}
+	}
+	defer fi.Close()
+
+	buf := make([]byte, d.GetSize())
+	_, err = fi.ReadAt(buf, int64(d.GetOffset()))
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, &CorruptReferenceError{StatusFileChanged,
+			fmt.Errorf("%s is shorter than expected", d.GetFilePath())}
+	} else if err != nil {
+		return nil, &CorruptReferenceError{StatusFileError, err}
+	}
+
+	fsn := &ft.FSNode{Type: upb.Data_DataType(d.GetType()), Data: buf}
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return nil, &CorruptReferenceError{StatusOtherError, err}
+	}
+
+	nd := dag.NodeWithData(data)
+	if nd.Key() != k {
+		return nil, &CorruptReferenceError{StatusFileChanged,
+			fmt.Errorf("data in %s at offset %d has changed", d.GetFilePath(), d.GetOffset())}
+	}
+	return blocks.NewBlockWithHash(nd.RawData(), mh.Multihash(k))
+}
+
+func (f *FileManager) Has(k key.Key) (bool, error) {
+	return f.ds.Has(dsKey(k))
+}
+
+// Put stores a reference to the data of nd, which must be a leaf carrying
+// its PosInfo.
+func (f *FileManager) Put(nd *dag.Node) error {
+	b, err := f.ds.Batch()
+	if err != nil {
+		return err
+	}
+	if err := putTo(b, nd); err != nil {
+		return err
+	}
+	return b.Commit()
+}
+
+func (f *FileManager) PutMany(nds []*dag.Node) error {
+	b, err := f.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for _, nd := range nds {
+		if err := putTo(b, nd); err != nil {
+			return err
+		}
+	}
+	return b.Commit()
+}
+
+func putTo(b ds.Batch, nd *dag.Node) error {
+	if nd.PosInfo == nil || len(nd.Links) > 0 {
+		return fmt.Errorf("filestore: %s is not a leaf read from a file", nd.Key())
+	}
+
+	fsn, err := ft.FSNodeFromBytes(nd.Data())
+	if err != nil {
+		return err
+	}
+	if fsn.KeyID != nil {
+		return fmt.Errorf("filestore: cannot reference encrypted data")
+	}
+
+	dobj := &pb.DataObj{
+		FilePath: proto.String(nd.PosInfo.FullPath),
+		Offset:   proto.Uint64(nd.PosInfo.Offset),
+		Size:     proto.Uint64(uint64(len(fsn.Data))),
+		Type:     proto.Int32(int32(fsn.Type)),
+	}
+	data, err := proto.Marshal(dobj)
+	if err != nil {
+		return err
+	}
+	return b.Put(dsKey(nd.Key()), data)
+}
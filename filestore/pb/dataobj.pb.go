@@ -0,0 +1,66 @@
+// Code generated by protoc-gen-gogo.
+// source: dataobj.proto
+// DO NOT EDIT!
+
+/*
+Package filestore_pb is a generated protocol buffer package.
+
+It is generated from these files:
+	dataobj.proto
+
+It has these top-level messages:
+	DataObj
+*/
+package filestore_pb
+
+import proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+// DataObj references the data of a leaf block kept in a file on the
+// local filesystem instead of in the blockstore.
+type DataObj struct {
+	FilePath         *string `protobuf:"bytes,1,opt,name=filePath" json:"filePath,omitempty"`
+	Offset           *uint64 `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	Size             *uint64 `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
+	Type             *int32  `protobuf:"varint,4,opt,name=type" json:"type,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *DataObj) Reset()         { *m = DataObj{} }
+func (m *DataObj) String() string { return proto.CompactTextString(m) }
+func (*DataObj) ProtoMessage()    {}
+
+func (m *DataObj) GetFilePath() string {
+	if m != nil && m.FilePath != nil {
+		return *m.FilePath
+	}
+	return ""
+}
+
+func (m *DataObj) GetOffset() uint64 {
+	if m != nil && m.Offset != nil {
+		return *m.Offset
+	}
+	return 0
+}
+
+func (m *DataObj) GetSize() uint64 {
+	if m != nil && m.Size != nil {
+		return *m.Size
+	}
+	return 0
+}
+
+func (m *DataObj) GetType() int32 {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return 0
+}
+
+func init() {
+}
@@ -0,0 +1,172 @@
+package filestore
+
+import (
+	"fmt"
+
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	pb "github.com/ipfs/go-ipfs/filestore/pb"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+)
+
+// Status is the outcome of checking a file reference.
+type Status int32
+
+const (
+	StatusOk           Status = 0
+	StatusFileError    Status = 10 // the file could not be read
+	StatusFileNotFound Status = 11 // the file is gone
+	StatusFileChanged  Status = 12 // the file no longer holds the data
+	StatusOtherError   Status = 20
+	StatusKeyNotFound  Status = 30 // no reference to the block
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOk:
+		return "ok"
+	case StatusFileError:
+		return "error"
+	case StatusFileNotFound:
+		return "no-file"
+	case StatusFileChanged:
+		return "changed"
+	case StatusKeyNotFound:
+		return "no-ref"
+	default:
+		return "ERROR"
+	}
+}
+
+// ListRes describes a file reference and, when verified, its state.
+type ListRes struct {
+	Status   Status
+	ErrorMsg string
+	Key      string
+	FilePath string
+	Offset   uint64
+	Size     uint64
+}
+
+// FormatLong renders r as one line of 'ipfs filestore ls/verify' output.
+func (r *ListRes) FormatLong() string {
+	switch {
+	case r.Key == "":
+		return fmt.Sprintf("%-7s %s", r.Status, r.ErrorMsg)
+	case r.FilePath == "":
+		return fmt.Sprintf("%-7s %s", r.Status, r.Key)
+	default:
+		return fmt.Sprintf("%-7s %s %10d %s %d", r.Status, r.Key, r.Size, r.FilePath, r.Offset)
+	}
+}
+
+// List returns the reference of k, without checking the file.
+func List(fs *Filestore, k key.Key) *ListRes {
+	return list(fs.fm, k, false)
+}
+
+// Verify returns the reference of k and whether the file still holds the
+// data of the block.
+func Verify(fs *Filestore, k key.Key) *ListRes {
+	return list(fs.fm, k, true)
+}
+
+// ListAll returns the references of all blocks in the filestore.
+func ListAll(ctx context.Context, fs *Filestore) (<-chan *ListRes, error) {
+	return listAll(ctx, fs.fm, false)
+}
+
+// VerifyAll checks all references in the filestore.
+func VerifyAll(ctx context.Context, fs *Filestore) (<-chan *ListRes, error) {
+	return listAll(ctx, fs.fm, true)
+}
+
+func listAll(ctx context.Context, fm *FileManager, verify bool) (<-chan *ListRes, error) {
+	keys, err := fm.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *ListRes)
+	go func() {
+		defer close(out)
+		for k := range keys {
+			select {
+			case out <- list(fm, k, verify):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func list(fm *FileManager, k key.Key, verify bool) *ListRes {
+	dobj, err := fm.getDataObj(k)
+	if err != nil {
+		return mkListRes(k, nil, err)
+	}
+	if !verify {
+		return mkListRes(k, dobj, nil)
+	}
+	_, err = readBlock(k, dobj)
+	return mkListRes(k, dobj, err)
+}
+
+func mkListRes(k key.Key, d *pb.DataObj, err error) *ListRes {
+	r := &ListRes{Key: k.B58String()}
+	switch e := err.(type) {
+	case nil:
+		r.Status = StatusOk
+	case *CorruptReferenceError:
+		r.Status = e.Code
+		r.ErrorMsg = e.Error()
+	default:
+		if err == bstore.ErrNotFound {
+			r.Status = StatusKeyNotFound
+		} else {
+			r.Status = StatusOtherError
+		}
+		r.ErrorMsg = err.Error()
+	}
+
+	if d != nil {
+		r.FilePath = d.GetFilePath()
+		r.Offset = d.GetOffset()
+		r.Size = d.GetSize()
+	}
+	return r
+}
+
+// Dups returns the keys of blocks that are both referenced and copied
+// into the main blockstore, such as files added once with and once
+// without --nocopy.
+func Dups(ctx context.Context, fs *Filestore) (<-chan key.Key, error) {
+	keys, err := fs.fm.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan key.Key)
+	go func() {
+		defer close(out)
+		for k := range keys {
+			has, err := fs.bs.Has(k)
+			if err != nil {
+				log.Warningf("checking %s: %s", k, err)
+				continue
+			}
+			if !has {
+				continue
+			}
+
+			select {
+			case out <- k:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
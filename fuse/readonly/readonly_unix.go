@@ -174,7 +174,7 @@ func (s *Node) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 	lm["req_size"] = req.Size
 	defer log.EventBegin(ctx, "fuseRead", lm).Done()
 
-	r, err := uio.NewDagReader(ctx, s.Nd, s.Ipfs.DAG)
+	r, err := uio.NewDagReader(s.Ipfs.ContentContext(ctx), s.Nd, s.Ipfs.DAG)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,186 @@
+package group
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/group/pb"
+	ic "gx/ipfs/QmVoi5es8D5fNHZDqoW6DgDAEPEV5hQp8GBz161vZXiwpQ/go-libp2p-crypto"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+)
+
+var (
+	ErrNoCertificate       = errors.New("no membership certificate")
+	ErrBadSignature        = errors.New("signature does not match the domain authority")
+	ErrWrongAuthority      = errors.New("signed by a different domain authority")
+	ErrWrongPeer           = errors.New("certificate was issued to a different peer")
+	ErrCertificateExpired  = errors.New("certificate has expired")
+	ErrCertificateRevoked  = errors.New("certificate has been revoked")
+	ErrStaleRevocationList = errors.New("revocation list is older than the current one")
+)
+
+// GroupIDFromKey returns the GroupID of the domain whose authority holds
+// the private half of pk. It is the authority's peer ID, which also makes
+// it the IPNS name the authority publishes revocations under.
+func GroupIDFromKey(pk ic.PubKey) (string, error) {
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		return "", err
+	}
+	return id.Pretty(), nil
+}
+
+// IssueCertificate signs a certificate admitting p to domain. A zero ttl
+// issues a certificate that never expires.
+func IssueCertificate(authority ic.PrivKey, domain string, p peer.ID, ttl time.Duration) (*pb.Certificate, error) {
+	pkb, err := ic.MarshalPublicKey(authority.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	c := &pb.Certificate{
+		Domain:    proto.String(domain),
+		Peer:      []byte(p),
+		Authority: pkb,
+		Issued:    proto.Int64(now.Unix()),
+	}
+	if ttl > 0 {
+		c.Expires = proto.Int64(now.Add(ttl).Unix())
+	}
+
+	c.Signature, err = authority.Sign(certDataForSig(c))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// VerifyCertificate checks that c was signed by the authority of groupID,
+// was issued to p and has not expired.
+func VerifyCertificate(c *pb.Certificate, groupID string, p peer.ID) error {
+	if c == nil {
+		return ErrNoCertificate
+	}
+
+	pk, err := ic.UnmarshalPublicKey(c.GetAuthority())
+	if err != nil {
+		return err
+	}
+
+	gid, err := GroupIDFromKey(pk)
+	if err != nil {
+		return err
+	}
+	if gid != groupID {
+		return ErrWrongAuthority
+	}
+
+	ok, err := pk.Verify(certDataForSig(c), c.GetSignature())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrBadSignature
+	}
+
+	if peer.ID(c.GetPeer()) != p {
+		return ErrWrongPeer
+	}
+
+	if exp := c.GetExpires(); exp != 0 && time.Now().Unix() > exp {
+		return ErrCertificateExpired
+	}
+	return nil
+}
+
+// EncodeCertificate returns the textual form of c, suitable for passing
+// to 'ipfs domain join' and storing in the config.
+func EncodeCertificate(c *pb.Certificate) (string, error) {
+	b, err := proto.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// DecodeCertificate parses a certificate produced by EncodeCertificate.
+func DecodeCertificate(s string) (*pb.Certificate, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed certificate: %s", err)
+	}
+
+	c := new(pb.Certificate)
+	if err := proto.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("malformed certificate: %s", err)
+	}
+	return c, nil
+}
+
+// certDataForSig returns the bytes covered by the certificate signature.
+func certDataForSig(c *pb.Certificate) []byte {
+	cpy := *c
+	cpy.Signature = nil
+	cpy.XXX_unrecognized = nil
+	b, err := proto.Marshal(&cpy)
+	if err != nil {
+		// only fails for invalid messages, which we never construct
+		panic(err)
+	}
+	return b
+}
+
+// NewRevocationList signs a revocation list for domain revoking peers.
+// seq must increase with every list the authority publishes.
+func NewRevocationList(authority ic.PrivKey, domain string, seq uint64, peers []peer.ID) (*pb.RevocationList, error) {
+	rl := &pb.RevocationList{
+		Domain:   proto.String(domain),
+		Sequence: proto.Uint64(seq),
+	}
+	for _, p := range peers {
+		rl.Peers = append(rl.Peers, []byte(p))
+	}
+
+	sig, err := authority.Sign(revocationDataForSig(rl))
+	if err != nil {
+		return nil, err
+	}
+	rl.Signature = sig
+	return rl, nil
+}
+
+// VerifyRevocationList checks that rl was signed by the authority whose
+// public key is pk, and that pk belongs to groupID.
+func VerifyRevocationList(rl *pb.RevocationList, pk ic.PubKey, groupID string) error {
+	gid, err := GroupIDFromKey(pk)
+	if err != nil {
+		return err
+	}
+	if gid != groupID {
+		return ErrWrongAuthority
+	}
+
+	ok, err := pk.Verify(revocationDataForSig(rl), rl.GetSignature())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func revocationDataForSig(rl *pb.RevocationList) []byte {
+	cpy := *rl
+	cpy.Signature = nil
+	cpy.XXX_unrecognized = nil
+	b, err := proto.Marshal(&cpy)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
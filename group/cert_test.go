@@ -0,0 +1,72 @@
+package group
+
+import (
+	"testing"
+	"time"
+
+	testutil "github.com/ipfs/go-ipfs/thirdparty/testutil"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+)
+
+func TestCertificateRoundtrip(t *testing.T) {
+	auth := genAuthority(t)
+	gid, err := GroupIDFromKey(auth.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := testutil.RandPeerIDFatal(t)
+	c := issue(t, auth, p)
+
+	s, err := EncodeCertificate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, err := DecodeCertificate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyCertificate(c2, gid, p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateRejected(t *testing.T) {
+	auth := genAuthority(t)
+	gid, err := GroupIDFromKey(auth.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := testutil.RandPeerIDFatal(t)
+	c := issue(t, auth, p)
+
+	if err := VerifyCertificate(c, gid, testutil.RandPeerIDFatal(t)); err != ErrWrongPeer {
+		t.Fatalf("expected ErrWrongPeer, got: %v", err)
+	}
+
+	other, err := GroupIDFromKey(genAuthority(t).GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCertificate(c, other, p); err != ErrWrongAuthority {
+		t.Fatalf("expected ErrWrongAuthority, got: %v", err)
+	}
+
+	c.Domain = nil
+	if err := VerifyCertificate(c, gid, p); err != ErrBadSignature {
+		t.Fatalf("expected ErrBadSignature for tampered certificate, got: %v", err)
+	}
+
+	expired := issue(t, auth, p)
+	expired.Expires = proto.Int64(time.Now().Add(-time.Hour).Unix())
+	expired.Signature, err = auth.Sign(certDataForSig(expired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCertificate(expired, gid, p); err != ErrCertificateExpired {
+		t.Fatalf("expected ErrCertificateExpired, got: %v", err)
+	}
+}
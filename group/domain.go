@@ -0,0 +1,138 @@
+package group
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/group/pb"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	ic "gx/ipfs/QmVoi5es8D5fNHZDqoW6DgDAEPEV5hQp8GBz161vZXiwpQ/go-libp2p-crypto"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+)
+
+// ErrAuthorityKeyDiscarded is returned by JoinDomain when joining would
+// throw away the authority key of the current domain.
+var ErrAuthorityKeyDiscarded = errors.New("this node holds the authority key of its domain, joining another domain discards it")
+
+// CreateDomain fills d with a new domain called name. A fresh authority
+// keypair of nbits bits is generated and kept in d, and self is issued
+// the first membership certificate.
+func CreateDomain(d *config.Domain, name string, self peer.ID, nbits int) error {
+	if err := config.ValidDomainName(name); err != nil {
+		return err
+	}
+
+	sk, _, err := ic.GenerateKeyPair(ic.RSA, nbits)
+	if err != nil {
+		return err
+	}
+
+	skb, err := sk.Bytes()
+	if err != nil {
+		return err
+	}
+
+	gid, err := GroupIDFromKey(sk.GetPublic())
+	if err != nil {
+		return err
+	}
+
+	cert, err := IssueCertificate(sk, name, self, 0)
+	if err != nil {
+		return err
+	}
+
+	certs, err := EncodeCertificate(cert)
+	if err != nil {
+		return err
+	}
+
+	if err := d.EnsureNodeUUID(); err != nil {
+		return err
+	}
+	d.Name = name
+	d.GroupID = gid
+	d.Certificate = certs
+	d.AuthorityKey = base64.StdEncoding.EncodeToString(skb)
+	d.LegacyGroupID = ""
+	return nil
+}
+
+// Invite issues a certificate admitting p to the domain described by d,
+// which must hold the authority key.
+func Invite(d *config.Domain, p peer.ID, ttl time.Duration) (string, error) {
+	sk, err := d.DecodeAuthorityKey()
+	if err != nil {
+		return "", err
+	}
+
+	cert, err := IssueCertificate(sk, d.Name, p, ttl)
+	if err != nil {
+		return "", err
+	}
+	return EncodeCertificate(cert)
+}
+
+// JoinDomain verifies that certs admits self and moves d to the domain the
+// certificate was issued for. It refuses to drop the authority key of the
+// current domain, which is its only copy, unless force is set.
+func JoinDomain(d *config.Domain, certs string, self peer.ID, force bool) error {
+	cert, err := DecodeCertificate(certs)
+	if err != nil {
+		return err
+	}
+
+	gid, err := certGroupID(cert)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyCertificate(cert, gid, self); err != nil {
+		return err
+	}
+
+	if err := config.ValidDomainName(cert.GetDomain()); err != nil {
+		return err
+	}
+
+	// keep the authority key only if we stay in the domain it governs.
+	if d.GroupID != gid && d.AuthorityKey != "" {
+		if !force {
+			return ErrAuthorityKeyDiscarded
+		}
+		d.AuthorityKey = ""
+	}
+
+	if err := d.EnsureNodeUUID(); err != nil {
+		return err
+	}
+	d.Name = cert.GetDomain()
+	d.GroupID = gid
+	d.Certificate = certs
+	d.LegacyGroupID = ""
+	return nil
+}
+
+// LoadCertificate decodes the node's own certificate from d and checks
+// that it is a valid certificate for self in d's group.
+func LoadCertificate(d *config.Domain, self peer.ID) (*pb.Certificate, error) {
+	cert, err := DecodeCertificate(d.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifyCertificate(cert, d.GroupID, self); err != nil {
+		return nil, fmt.Errorf("Domain.Certificate: %s", err)
+	}
+	return cert, nil
+}
+
+func certGroupID(c *pb.Certificate) (string, error) {
+	pk, err := ic.UnmarshalPublicKey(c.GetAuthority())
+	if err != nil {
+		return "", err
+	}
+	return GroupIDFromKey(pk)
+}
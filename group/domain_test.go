@@ -0,0 +1,51 @@
+package group
+
+import (
+	"testing"
+
+	config "github.com/ipfs/go-ipfs/repo/config"
+	testutil "github.com/ipfs/go-ipfs/thirdparty/testutil"
+)
+
+func TestJoinDomainKeepsAuthorityKey(t *testing.T) {
+	self := testutil.RandPeerIDFatal(t)
+	var d config.Domain
+	if err := CreateDomain(&d, "first", self, 512); err != nil {
+		t.Fatal(err)
+	}
+	authorityKey := d.AuthorityKey
+
+	// rejoining the same domain keeps the key
+	same, err := d.DecodeAuthorityKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := EncodeCertificate(issue(t, same, self))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := JoinDomain(&d, certs, self, false); err != nil {
+		t.Fatal(err)
+	}
+	if d.AuthorityKey != authorityKey {
+		t.Fatal("rejoining the domain should keep the authority key")
+	}
+
+	certs, err = EncodeCertificate(issue(t, genAuthority(t), self))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := JoinDomain(&d, certs, self, false); err != ErrAuthorityKeyDiscarded {
+		t.Fatalf("expected ErrAuthorityKeyDiscarded, got: %v", err)
+	}
+	if d.AuthorityKey != authorityKey {
+		t.Fatal("a refused join should keep the authority key")
+	}
+
+	if err := JoinDomain(&d, certs, self, true); err != nil {
+		t.Fatal(err)
+	}
+	if d.AuthorityKey != "" || d.Name != "test" {
+		t.Fatal("a forced join should move to the new domain without the key")
+	}
+}
@@ -0,0 +1,403 @@
+// package group implements a membership handshake that restricts a node's
+// swarm to peers of the same domain.
+//
+// A domain is identified by its GroupID, the peer ID of the domain
+// authority's key. The authority issues signed certificates to member
+// peers. When a connection is established both sides exchange their
+// certificates over the group protocol. Connections to peers without a
+// valid, unrevoked certificate for our GroupID (or peers that do not speak
+// the protocol at all) are closed, and streams opened by such peers are
+// never handed to the registered protocol handlers.
+package group
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/group/pb"
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	host "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	inet "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/net"
+	protocol "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/protocol"
+	ic "gx/ipfs/QmVoi5es8D5fNHZDqoW6DgDAEPEV5hQp8GBz161vZXiwpQ/go-libp2p-crypto"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	ctxio "gx/ipfs/QmX6DhWrpBB5NtadXmPSXYNdVvuLfJXoFNMvUMoVvP5UJa/go-context/io"
+	ma "gx/ipfs/QmYzDkkgAEmrcNzFCiYo6L1dTX4EAG1gZkbtdbd9trL4vd/go-multiaddr"
+	ggio "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/io"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+)
+
+var log = logging.Logger("group")
+
+// ProtocolGroup is the group handshake protocol.ID
+var ProtocolGroup protocol.ID = "/ipfs/group/1.0.0"
+
+// HandshakeTimeout bounds how long we wait for a remote peer to complete
+// the handshake before treating it as a non-member.
+var HandshakeTimeout = time.Second * 10
+
+var ErrNotMember = errors.New("peer is not a member of this group")
+
+// peerState tracks the handshake with a single remote peer. done is closed
+// once member has been decided.
+type peerState struct {
+	done   chan struct{}
+	member bool
+}
+
+// Membership runs the group handshake on a host and remembers which of the
+// connected peers have been verified as members of the local group.
+type Membership struct {
+	host      host.Host
+	groupID   string
+	cert      *pb.Certificate
+	authority ic.PubKey
+
+	lk      sync.Mutex
+	peers   map[peer.ID]*peerState
+	revoked map[peer.ID]struct{}
+	revSeq  uint64
+	exempt  map[peer.ID]struct{}
+}
+
+// NewMembership registers the group protocol on h and starts verifying
+// every new connection. cert is the local node's own membership
+// certificate; the GroupID is taken from its authority.
+func NewMembership(h host.Host, cert *pb.Certificate) (*Membership, error) {
+	if cert == nil {
+		return nil, ErrNoCertificate
+	}
+
+	authority, err := ic.UnmarshalPublicKey(cert.GetAuthority())
+	if err != nil {
+		return nil, err
+	}
+
+	groupID, err := GroupIDFromKey(authority)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifyCertificate(cert, groupID, h.ID()); err != nil {
+		return nil, fmt.Errorf("invalid membership certificate for %s: %s", h.ID(), err)
+	}
+
+	m := &Membership{
+		host:      h,
+		groupID:   groupID,
+		cert:      cert,
+		authority: authority,
+		peers:     make(map[peer.ID]*peerState),
+		revoked:   make(map[peer.ID]struct{}),
+		exempt:    make(map[peer.ID]struct{}),
+	}
+
+	h.SetStreamHandler(ProtocolGroup, m.handleNewStream)
+	h.Network().Notify((*netNotifiee)(m))
+	return m, nil
+}
+
+// GroupID returns the local group identifier.
+func (m *Membership) GroupID() string {
+	return m.groupID
+}
+
+// IsMember reports whether p has already been verified as a member. It
+// does not wait for a pending handshake.
+func (m *Membership) IsMember(p peer.ID) bool {
+	if p == m.host.ID() {
+		return true
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	ps, ok := m.peers[p]
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-ps.done:
+		return m.admitted(ps, p)
+	default:
+		return false
+	}
+}
+
+// Verify blocks until the handshake with p has completed (starting one if
+// needed) and returns ErrNotMember if p belongs to a different group.
+func (m *Membership) Verify(ctx context.Context, p peer.ID) error {
+	if p == m.host.ID() {
+		return nil
+	}
+
+	ps, created := m.getOrCreate(p)
+	if created {
+		go m.handshake(p)
+	}
+
+	select {
+	case <-ps.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if !m.admitted(ps, p) {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// Exempt keeps connections to p open even though it is not a member,
+// so that we can use services it runs for several domains, such as
+// supernode routing. p still cannot open streams to gated handlers.
+func (m *Membership) Exempt(p peer.ID) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.exempt[p] = struct{}{}
+}
+
+// Revoked returns the peers on the current revocation list.
+func (m *Membership) Revoked() []peer.ID {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	out := make([]peer.ID, 0, len(m.revoked))
+	for p := range m.revoked {
+		out = append(out, p)
+	}
+	return out
+}
+
+// SetRevocationList verifies rl against the domain authority and, if it is
+// newer than the list currently in effect, replaces it. Connections to
+// newly revoked peers are closed.
+func (m *Membership) SetRevocationList(rl *pb.RevocationList) error {
+	if err := VerifyRevocationList(rl, m.authority, m.groupID); err != nil {
+		return err
+	}
+
+	m.lk.Lock()
+	switch seq := rl.GetSequence(); {
+	case seq < m.revSeq:
+		m.lk.Unlock()
+		return ErrStaleRevocationList
+	case seq == m.revSeq && seq != 0:
+		m.lk.Unlock()
+		return nil
+	}
+
+	m.revSeq = rl.GetSequence()
+	m.revoked = make(map[peer.ID]struct{})
+	for _, b := range rl.GetPeers() {
+		m.revoked[peer.ID(b)] = struct{}{}
+	}
+	m.lk.Unlock()
+
+	for _, p := range m.host.Network().Peers() {
+		if m.isRevoked(p) {
+			log.Warningf("closing connection to %s: certificate revoked", p)
+			m.host.Network().ClosePeer(p)
+		}
+	}
+	return nil
+}
+
+// RevocationSequence returns the sequence number of the revocation list
+// currently in effect.
+func (m *Membership) RevocationSequence() uint64 {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	return m.revSeq
+}
+
+func (m *Membership) isRevoked(p peer.ID) bool {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	_, ok := m.revoked[p]
+	return ok
+}
+
+// admitted must be called with m.lk held and ps.done closed.
+func (m *Membership) admitted(ps *peerState, p peer.ID) bool {
+	if _, revoked := m.revoked[p]; revoked {
+		return false
+	}
+	return ps.member
+}
+
+// Members returns the currently connected peers verified to share our
+// GroupID.
+func (m *Membership) Members() []peer.ID {
+	var out []peer.ID
+	for _, p := range m.host.Network().Peers() {
+		if m.IsMember(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (m *Membership) getOrCreate(p peer.ID) (*peerState, bool) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	ps, ok := m.peers[p]
+	if ok {
+		return ps, false
+	}
+	ps = &peerState{done: make(chan struct{})}
+	m.peers[p] = ps
+	return ps, true
+}
+
+// finish records the outcome of a handshake with p. Only the first outcome
+// is kept; later handshakes over the same connection are ignored.
+func (m *Membership) finish(p peer.ID, member bool) {
+	ps, _ := m.getOrCreate(p)
+
+	m.lk.Lock()
+	select {
+	case <-ps.done:
+		m.lk.Unlock()
+		return
+	default:
+	}
+	ps.member = member
+	close(ps.done)
+	_, exempt := m.exempt[p]
+	m.lk.Unlock()
+
+	if !member && exempt {
+		log.Debugf("keeping connection to exempt non-member %s", p)
+		return
+	}
+
+	if !member {
+		log.Warningf("closing connection to %s: not a member of group", p)
+		if err := m.host.Network().ClosePeer(p); err != nil {
+			log.Debugf("error closing connection to %s: %s", p, err)
+		}
+	}
+}
+
+func (m *Membership) forget(p peer.ID) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	delete(m.peers, p)
+}
+
+// handshake opens a group stream to p, sends our GroupID and compares it
+// against the one p sends back.
+func (m *Membership) handshake(p peer.ID) {
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+
+	s, err := m.host.NewStream(ctx, p, ProtocolGroup)
+	if err != nil {
+		log.Debugf("group handshake with %s failed: %s", p, err)
+		m.finish(p, false)
+		return
+	}
+	defer s.Close()
+
+	cr := ctxio.NewReader(ctx, s) // ok to use. we defer close stream in this func
+	cw := ctxio.NewWriter(ctx, s) // ok to use. we defer close stream in this func
+	r := ggio.NewDelimitedReader(cr, inet.MessageSizeMax)
+	w := ggio.NewDelimitedWriter(cw)
+
+	if err := w.WriteMsg(m.newHandshake()); err != nil {
+		log.Debugf("group handshake with %s failed: %s", p, err)
+		m.finish(p, false)
+		return
+	}
+
+	resp := new(pb.Handshake)
+	if err := r.ReadMsg(resp); err != nil {
+		log.Debugf("group handshake with %s failed: %s", p, err)
+		m.finish(p, false)
+		return
+	}
+
+	m.finish(p, m.check(p, resp))
+}
+
+// handleNewStream answers a handshake started by a remote peer.
+func (m *Membership) handleNewStream(s inet.Stream) {
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+
+	p := s.Conn().RemotePeer()
+	r := ggio.NewDelimitedReader(ctxio.NewReader(ctx, s), inet.MessageSizeMax)
+	w := ggio.NewDelimitedWriter(ctxio.NewWriter(ctx, s))
+
+	req := new(pb.Handshake)
+	if err := r.ReadMsg(req); err != nil {
+		log.Debugf("failed to read group handshake from %s: %s", p, err)
+		m.finish(p, false)
+		return
+	}
+
+	if err := w.WriteMsg(m.newHandshake()); err != nil {
+		log.Debugf("failed to write group handshake to %s: %s", p, err)
+	}
+
+	m.finish(p, m.check(p, req))
+}
+
+func (m *Membership) newHandshake() *pb.Handshake {
+	return &pb.Handshake{
+		GroupID:     proto.String(m.groupID),
+		Certificate: m.cert,
+	}
+}
+
+// check verifies the handshake sent by p.
+func (m *Membership) check(p peer.ID, hs *pb.Handshake) bool {
+	if hs.GetGroupID() != m.groupID {
+		log.Debugf("%s is in group %q, not ours", p, hs.GetGroupID())
+		return false
+	}
+
+	if err := VerifyCertificate(hs.GetCertificate(), m.groupID, p); err != nil {
+		log.Warningf("rejecting membership certificate of %s: %s", p, err)
+		return false
+	}
+
+	if m.isRevoked(p) {
+		log.Warningf("rejecting membership certificate of %s: %s", p, ErrCertificateRevoked)
+		return false
+	}
+	return true
+}
+
+type netNotifiee Membership
+
+func (nn *netNotifiee) membership() *Membership {
+	return (*Membership)(nn)
+}
+
+func (nn *netNotifiee) Connected(n inet.Network, v inet.Conn) {
+	m := nn.membership()
+	p := v.RemotePeer()
+	if _, created := m.getOrCreate(p); created {
+		go m.handshake(p)
+	}
+}
+
+func (nn *netNotifiee) Disconnected(n inet.Network, v inet.Conn) {
+	p := v.RemotePeer()
+	if len(n.ConnsToPeer(p)) == 0 {
+		nn.membership().forget(p)
+	}
+}
+
+func (nn *netNotifiee) OpenedStream(n inet.Network, v inet.Stream) {}
+func (nn *netNotifiee) ClosedStream(n inet.Network, v inet.Stream) {}
+func (nn *netNotifiee) Listen(n inet.Network, a ma.Multiaddr)      {}
+func (nn *netNotifiee) ListenClose(n inet.Network, a ma.Multiaddr) {}
@@ -0,0 +1,212 @@
+package group
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/group/pb"
+	host "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	inet "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/net"
+	mocknet "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/net/mock"
+	ic "gx/ipfs/QmVoi5es8D5fNHZDqoW6DgDAEPEV5hQp8GBz161vZXiwpQ/go-libp2p-crypto"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	pstore "gx/ipfs/QmdMfSLMDBDYhtc4oF3NYGCZr5dy4wQb6Ji26N4D4mdxa2/go-libp2p-peerstore"
+)
+
+func genHosts(t *testing.T, ctx context.Context, n int) (mocknet.Mocknet, []host.Host) {
+	mn := mocknet.New(ctx)
+	var hosts []host.Host
+	for i := 0; i < n; i++ {
+		h, err := mn.GenPeer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts = append(hosts, h)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	return mn, hosts
+}
+
+func genAuthority(t *testing.T) ic.PrivKey {
+	sk, _, err := ic.GenerateKeyPair(ic.RSA, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk
+}
+
+func issue(t *testing.T, authority ic.PrivKey, p peer.ID) *pb.Certificate {
+	c, err := IssueCertificate(authority, "test", p, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func member(t *testing.T, h host.Host, authority ic.PrivKey) *Membership {
+	m, err := NewMembership(h, issue(t, authority, h.ID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func connect(t *testing.T, ctx context.Context, a, b host.Host) {
+	pi := pstore.PeerInfo{ID: b.ID(), Addrs: b.Addrs()}
+	if err := a.Connect(ctx, pi); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSameGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, hosts := genHosts(t, ctx, 2)
+	auth := genAuthority(t)
+	a := member(t, hosts[0], auth)
+	b := member(t, hosts[1], auth)
+
+	connect(t, ctx, hosts[0], hosts[1])
+
+	if err := a.Verify(ctx, hosts[1].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Verify(ctx, hosts[0].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsMember(hosts[1].ID()) {
+		t.Fatal("expected peer to be a verified member")
+	}
+}
+
+func TestDifferentGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, hosts := genHosts(t, ctx, 2)
+	a := member(t, hosts[0], genAuthority(t))
+	member(t, hosts[1], genAuthority(t))
+
+	connect(t, ctx, hosts[0], hosts[1])
+
+	if err := a.Verify(ctx, hosts[1].ID()); err != ErrNotMember {
+		t.Fatalf("expected ErrNotMember, got: %v", err)
+	}
+	if a.IsMember(hosts[1].ID()) {
+		t.Fatal("peer from another group should not be a member")
+	}
+}
+
+func TestGatedHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, hosts := genHosts(t, ctx, 3)
+	auth := genAuthority(t)
+	server := Wrap(hosts[0], member(t, hosts[0], auth))
+	member(t, hosts[1], auth)
+	member(t, hosts[2], genAuthority(t))
+
+	served := make(chan struct{}, 2)
+	server.SetStreamHandler("/test/echo", func(s inet.Stream) {
+		defer s.Close()
+		served <- struct{}{}
+	})
+
+	connect(t, ctx, hosts[1], hosts[0])
+	connect(t, ctx, hosts[2], hosts[0])
+
+	for _, h := range hosts[1:] {
+		s, err := h.NewStream(ctx, hosts[0].ID(), "/test/echo")
+		if err != nil {
+			continue
+		}
+		s.Write([]byte("hello"))
+		s.Close()
+	}
+
+	select {
+	case <-served:
+	case <-ctx.Done():
+		t.Fatal("stream from group member was not served")
+	}
+
+	select {
+	case <-served:
+		t.Fatal("stream from another group was served")
+	case <-time.After(time.Millisecond * 200):
+	}
+}
+
+func TestRevokedMember(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, hosts := genHosts(t, ctx, 2)
+	auth := genAuthority(t)
+	a := member(t, hosts[0], auth)
+	member(t, hosts[1], auth)
+
+	rl, err := NewRevocationList(auth, "test", 1, []peer.ID{hosts[1].ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetRevocationList(rl); err != nil {
+		t.Fatal(err)
+	}
+
+	connect(t, ctx, hosts[0], hosts[1])
+
+	if err := a.Verify(ctx, hosts[1].ID()); err != ErrNotMember {
+		t.Fatalf("expected ErrNotMember for revoked peer, got: %v", err)
+	}
+
+	old, err := NewRevocationList(auth, "test", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetRevocationList(old); err != ErrStaleRevocationList {
+		t.Fatalf("expected ErrStaleRevocationList, got: %v", err)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, hosts := genHosts(t, ctx, 3)
+	obs := NewObserver(hosts[0])
+	auth := genAuthority(t)
+	m := member(t, hosts[1], auth)
+	m.Exempt(hosts[0].ID())
+
+	connect(t, ctx, hosts[1], hosts[0])
+	connect(t, ctx, hosts[2], hosts[0])
+
+	gid, err := obs.GroupOf(ctx, hosts[1].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gid != m.GroupID() {
+		t.Fatalf("expected group %s, got %q", m.GroupID(), gid)
+	}
+
+	gid, err = obs.GroupOf(ctx, hosts[2].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gid != "" {
+		t.Fatalf("peer without a group should be public, got %q", gid)
+	}
+
+	if err := m.Verify(ctx, hosts[0].ID()); err != ErrNotMember {
+		t.Fatalf("expected ErrNotMember for the observer, got: %v", err)
+	}
+	if len(hosts[1].Network().ConnsToPeer(hosts[0].ID())) == 0 {
+		t.Fatal("connection to exempt peer was closed")
+	}
+}
@@ -0,0 +1,82 @@
+package group
+
+import (
+	"sync"
+
+	host "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	inet "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/net"
+	protocol "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/protocol"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+)
+
+// GatedHost is a host.Host that only hands incoming streams to protocol
+// handlers once the remote peer has been verified as a group member. All
+// services built on top of it (bitswap, the DHT, diagnostics, ...) thereby
+// refuse to serve peers from other groups.
+type GatedHost struct {
+	host.Host
+	m *Membership
+
+	lk      sync.Mutex
+	allowed map[protocol.ID]map[peer.ID]struct{}
+}
+
+// Wrap returns a host whose stream handlers are gated by m.
+func Wrap(h host.Host, m *Membership) *GatedHost {
+	return &GatedHost{
+		Host:    h,
+		m:       m,
+		allowed: make(map[protocol.ID]map[peer.ID]struct{}),
+	}
+}
+
+// Allow lets p open pid streams even though it is not a member.
+func (gh *GatedHost) Allow(pid protocol.ID, p peer.ID) {
+	gh.lk.Lock()
+	defer gh.lk.Unlock()
+	ps, ok := gh.allowed[pid]
+	if !ok {
+		ps = make(map[peer.ID]struct{})
+		gh.allowed[pid] = ps
+	}
+	ps[p] = struct{}{}
+}
+
+func (gh *GatedHost) isAllowed(pid protocol.ID, p peer.ID) bool {
+	gh.lk.Lock()
+	defer gh.lk.Unlock()
+	_, ok := gh.allowed[pid][p]
+	return ok
+}
+
+// Membership returns the membership service used to gate streams.
+func (gh *GatedHost) Membership() *Membership {
+	return gh.m
+}
+
+// SetStreamHandler registers handler for pid, dropping streams from peers
+// that fail the group handshake.
+func (gh *GatedHost) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	gh.Host.SetStreamHandler(pid, gh.gate(pid, handler))
+}
+
+func (gh *GatedHost) gate(pid protocol.ID, handler inet.StreamHandler) inet.StreamHandler {
+	return func(s inet.Stream) {
+		p := s.Conn().RemotePeer()
+		if gh.isAllowed(pid, p) {
+			handler(s)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+		defer cancel()
+		if err := gh.m.Verify(ctx, p); err != nil {
+			log.Debugf("refusing %s stream from %s: %s", pid, p, err)
+			s.Close()
+			return
+		}
+
+		handler(s)
+	}
+}
@@ -0,0 +1,202 @@
+package group
+
+import (
+	"sync"
+
+	pb "github.com/ipfs/go-ipfs/group/pb"
+	host "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	inet "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/net"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	ctxio "gx/ipfs/QmX6DhWrpBB5NtadXmPSXYNdVvuLfJXoFNMvUMoVvP5UJa/go-context/io"
+	ma "gx/ipfs/QmYzDkkgAEmrcNzFCiYo6L1dTX4EAG1gZkbtdbd9trL4vd/go-multiaddr"
+	ggio "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/io"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+)
+
+// observation is the outcome of a handshake seen by an Observer. done is
+// closed once groupID and err have been decided.
+type observation struct {
+	done    chan struct{}
+	groupID string
+	err     error
+}
+
+// Observer speaks the group protocol without belonging to a group. It
+// verifies the certificate each connected peer presents and remembers
+// which group the peer belongs to, so that a service shared between
+// several domains (such as a supernode routing server) can keep them
+// apart.
+//
+// Members close connections to peers outside their group unless they
+// exempted them, see Membership.Exempt. The Observer does not know the
+// revocation lists of the groups it sees; it only checks that
+// certificates are validly signed and unexpired.
+type Observer struct {
+	host host.Host
+
+	lk    sync.Mutex
+	peers map[peer.ID]*observation
+}
+
+// NewObserver registers the group protocol on h.
+func NewObserver(h host.Host) *Observer {
+	o := &Observer{
+		host:  h,
+		peers: make(map[peer.ID]*observation),
+	}
+	h.SetStreamHandler(ProtocolGroup, o.handleNewStream)
+	h.Network().Notify((*observerNotifiee)(o))
+	return o
+}
+
+// GroupOf returns the GroupID p proved membership of, starting a
+// handshake if needed. Peers that do not speak the group protocol, or
+// do not claim a group, are public and have the empty GroupID. An error
+// is returned if p claims a group it holds no valid certificate for.
+func (o *Observer) GroupOf(ctx context.Context, p peer.ID) (string, error) {
+	if p == o.host.ID() {
+		return "", nil
+	}
+
+	ob, created := o.getOrCreate(p)
+	if created {
+		go o.handshake(p)
+	}
+
+	select {
+	case <-ob.done:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	return ob.groupID, ob.err
+}
+
+func (o *Observer) getOrCreate(p peer.ID) (*observation, bool) {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	ob, ok := o.peers[p]
+	if ok {
+		return ob, false
+	}
+	ob = &observation{done: make(chan struct{})}
+	o.peers[p] = ob
+	return ob, true
+}
+
+// finish records the group p presented. A handshake carrying a group
+// replaces an earlier public outcome, since our own handshake may have
+// failed before the member got to start theirs.
+func (o *Observer) finish(p peer.ID, groupID string, err error) {
+	ob, _ := o.getOrCreate(p)
+
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	select {
+	case <-ob.done:
+		if ob.groupID != "" || ob.err != nil || (groupID == "" && err == nil) {
+			return
+		}
+	default:
+		defer close(ob.done)
+	}
+	ob.groupID = groupID
+	ob.err = err
+}
+
+func (o *Observer) forget(p peer.ID) {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	delete(o.peers, p)
+}
+
+// handshake asks p for its certificate, sending an empty handshake of
+// our own.
+func (o *Observer) handshake(p peer.ID) {
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+
+	s, err := o.host.NewStream(ctx, p, ProtocolGroup)
+	if err != nil {
+		log.Debugf("%s does not speak the group protocol: %s", p, err)
+		o.finish(p, "", nil)
+		return
+	}
+	defer s.Close()
+
+	r := ggio.NewDelimitedReader(ctxio.NewReader(ctx, s), inet.MessageSizeMax)
+	w := ggio.NewDelimitedWriter(ctxio.NewWriter(ctx, s))
+
+	if err := w.WriteMsg(new(pb.Handshake)); err != nil {
+		log.Debugf("group handshake with %s failed: %s", p, err)
+		o.finish(p, "", nil)
+		return
+	}
+
+	resp := new(pb.Handshake)
+	if err := r.ReadMsg(resp); err != nil {
+		log.Debugf("group handshake with %s failed: %s", p, err)
+		o.finish(p, "", nil)
+		return
+	}
+
+	gid, err := o.check(p, resp)
+	o.finish(p, gid, err)
+}
+
+// handleNewStream answers a handshake started by a member.
+func (o *Observer) handleNewStream(s inet.Stream) {
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+
+	p := s.Conn().RemotePeer()
+	r := ggio.NewDelimitedReader(ctxio.NewReader(ctx, s), inet.MessageSizeMax)
+	w := ggio.NewDelimitedWriter(ctxio.NewWriter(ctx, s))
+
+	req := new(pb.Handshake)
+	if err := r.ReadMsg(req); err != nil {
+		log.Debugf("failed to read group handshake from %s: %s", p, err)
+		return
+	}
+
+	if err := w.WriteMsg(new(pb.Handshake)); err != nil {
+		log.Debugf("failed to write group handshake to %s: %s", p, err)
+	}
+
+	gid, err := o.check(p, req)
+	o.finish(p, gid, err)
+}
+
+// check verifies the certificate of the group claimed in hs.
+func (o *Observer) check(p peer.ID, hs *pb.Handshake) (string, error) {
+	gid := hs.GetGroupID()
+	if gid == "" {
+		return "", nil
+	}
+
+	if err := VerifyCertificate(hs.GetCertificate(), gid, p); err != nil {
+		log.Warningf("rejecting membership certificate of %s: %s", p, err)
+		return "", err
+	}
+	return gid, nil
+}
+
+type observerNotifiee Observer
+
+func (nn *observerNotifiee) Connected(n inet.Network, v inet.Conn) {}
+
+func (nn *observerNotifiee) Disconnected(n inet.Network, v inet.Conn) {
+	p := v.RemotePeer()
+	if len(n.ConnsToPeer(p)) == 0 {
+		(*Observer)(nn).forget(p)
+	}
+}
+
+func (nn *observerNotifiee) OpenedStream(n inet.Network, v inet.Stream) {}
+func (nn *observerNotifiee) ClosedStream(n inet.Network, v inet.Stream) {}
+func (nn *observerNotifiee) Listen(n inet.Network, a ma.Multiaddr)      {}
+func (nn *observerNotifiee) ListenClose(n inet.Network, a ma.Multiaddr) {}
@@ -0,0 +1,152 @@
+// Code generated by protoc-gen-gogo.
+// source: group.proto
+// DO NOT EDIT!
+
+/*
+Package group_pb is a generated protocol buffer package.
+
+It is generated from these files:
+	group.proto
+
+It has these top-level messages:
+	Handshake
+	Certificate
+	RevocationList
+*/
+package group_pb
+
+import proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type Handshake struct {
+	// GroupID of the sending peer.
+	GroupID *string `protobuf:"bytes,1,opt,name=groupID" json:"groupID,omitempty"`
+	// Certificate proving the sending peer's membership.
+	Certificate      *Certificate `protobuf:"bytes,2,opt,name=certificate" json:"certificate,omitempty"`
+	XXX_unrecognized []byte       `json:"-"`
+}
+
+func (m *Handshake) Reset()         { *m = Handshake{} }
+func (m *Handshake) String() string { return proto.CompactTextString(m) }
+func (*Handshake) ProtoMessage()    {}
+
+func (m *Handshake) GetGroupID() string {
+	if m != nil && m.GroupID != nil {
+		return *m.GroupID
+	}
+	return ""
+}
+
+func (m *Handshake) GetCertificate() *Certificate {
+	if m != nil {
+		return m.Certificate
+	}
+	return nil
+}
+
+// Certificate binds a peer to a domain. It is signed by the domain
+// authority, whose key hashes to the domain's GroupID.
+type Certificate struct {
+	Domain           *string `protobuf:"bytes,1,opt,name=domain" json:"domain,omitempty"`
+	Peer             []byte  `protobuf:"bytes,2,opt,name=peer" json:"peer,omitempty"`
+	Authority        []byte  `protobuf:"bytes,3,opt,name=authority" json:"authority,omitempty"`
+	Issued           *int64  `protobuf:"varint,4,opt,name=issued" json:"issued,omitempty"`
+	Expires          *int64  `protobuf:"varint,5,opt,name=expires" json:"expires,omitempty"`
+	Signature        []byte  `protobuf:"bytes,6,opt,name=signature" json:"signature,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Certificate) Reset()         { *m = Certificate{} }
+func (m *Certificate) String() string { return proto.CompactTextString(m) }
+func (*Certificate) ProtoMessage()    {}
+
+func (m *Certificate) GetDomain() string {
+	if m != nil && m.Domain != nil {
+		return *m.Domain
+	}
+	return ""
+}
+
+func (m *Certificate) GetPeer() []byte {
+	if m != nil {
+		return m.Peer
+	}
+	return nil
+}
+
+func (m *Certificate) GetAuthority() []byte {
+	if m != nil {
+		return m.Authority
+	}
+	return nil
+}
+
+func (m *Certificate) GetIssued() int64 {
+	if m != nil && m.Issued != nil {
+		return *m.Issued
+	}
+	return 0
+}
+
+func (m *Certificate) GetExpires() int64 {
+	if m != nil && m.Expires != nil {
+		return *m.Expires
+	}
+	return 0
+}
+
+func (m *Certificate) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+// RevocationList lists the peers whose certificates are no longer valid.
+// The authority publishes it under its IPNS name.
+type RevocationList struct {
+	Domain           *string  `protobuf:"bytes,1,opt,name=domain" json:"domain,omitempty"`
+	Sequence         *uint64  `protobuf:"varint,2,opt,name=sequence" json:"sequence,omitempty"`
+	Peers            [][]byte `protobuf:"bytes,3,rep,name=peers" json:"peers,omitempty"`
+	Signature        []byte   `protobuf:"bytes,4,opt,name=signature" json:"signature,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *RevocationList) Reset()         { *m = RevocationList{} }
+func (m *RevocationList) String() string { return proto.CompactTextString(m) }
+func (*RevocationList) ProtoMessage()    {}
+
+func (m *RevocationList) GetDomain() string {
+	if m != nil && m.Domain != nil {
+		return *m.Domain
+	}
+	return ""
+}
+
+func (m *RevocationList) GetSequence() uint64 {
+	if m != nil && m.Sequence != nil {
+		return *m.Sequence
+	}
+	return 0
+}
+
+func (m *RevocationList) GetPeers() [][]byte {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+func (m *RevocationList) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+func init() {
+}
@@ -3,6 +3,7 @@ package helpers
 import (
 	"github.com/ipfs/go-ipfs/importer/chunk"
 	dag "github.com/ipfs/go-ipfs/merkledag"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
 )
 
 // DagBuilderHelper wraps together a bunch of objects needed to
@@ -14,6 +15,9 @@ type DagBuilderHelper struct {
 	nextData []byte // the next item to return.
 	maxlinks int
 	batch    *dag.Batch
+	key      *crypt.Key
+	fullPath string
+	offset   uint64
 }
 
 type DagBuilderParams struct {
@@ -22,6 +26,14 @@ type DagBuilderParams struct {
 
 	// DAGService to write blocks to (required)
 	Dagserv dag.DAGService
+
+	// Key to encrypt chunk data with, nil to store it in the clear
+	Key *crypt.Key
+
+	// FullPath is the absolute path of the file the chunks are read from.
+	// If set, leaf nodes record their position in it, so that a filestore
+	// can keep a reference to the file instead of a copy of the data.
+	FullPath string
 }
 
 // Generate a new DagBuilderHelper from the given params, which data source comes
@@ -32,6 +44,8 @@ func (dbp *DagBuilderParams) New(spl chunk.Splitter) *DagBuilderHelper {
 		spl:      spl,
 		maxlinks: dbp.Maxlinks,
 		batch:    dbp.Dagserv.Batch(),
+		key:      dbp.Key,
+		fullPath: dbp.FullPath,
 	}
 }
 
@@ -98,15 +112,35 @@ func (db *DagBuilderHelper) FillNodeWithData(node *UnixfsNode) error {
 		return nil
 	}
 
+	offset := db.offset
+	db.offset += uint64(len(data))
+
+	if db.key != nil {
+		data = db.key.Seal(data)
+	}
+
 	if len(data) > BlockSizeLimit {
 		return ErrSizeLimitExceeded
 	}
 
+	if db.key != nil {
+		node.SetEncryptedData(data, db.key.ID())
+		return nil
+	}
 	node.SetData(data)
+	if db.fullPath != "" {
+		node.SetPosInfo(offset, db.fullPath)
+	}
 	return nil
 }
 
 func (db *DagBuilderHelper) Add(node *UnixfsNode) (*dag.Node, error) {
+	// mark the root of encrypted files even if it holds no data, so that
+	// readers without the key fail before reading anything.
+	if db.key != nil {
+		node.ufmt.KeyID = db.key.ID()
+	}
+
 	dn, err := node.GetDagNode()
 	if err != nil {
 		return nil, err
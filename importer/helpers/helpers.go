@@ -119,6 +119,19 @@ func (n *UnixfsNode) SetData(data []byte) {
 	n.ufmt.Data = data
 }
 
+// SetEncryptedData sets data sealed with the content key identified by
+// keyID as the data of this node.
+func (n *UnixfsNode) SetEncryptedData(data []byte, keyID []byte) {
+	n.ufmt.Data = data
+	n.ufmt.KeyID = keyID
+}
+
+// SetPosInfo records that the data of this node was read from the file
+// at fullPath, starting at offset.
+func (n *UnixfsNode) SetPosInfo(offset uint64, fullPath string) {
+	n.node.PosInfo = &dag.PosInfo{Offset: offset, FullPath: fullPath}
+}
+
 // getDagNode fills out the proper formatting for the unixfs node
 // inside of a DAG node and returns the dag node
 func (n *UnixfsNode) GetDagNode() (*dag.Node, error) {
@@ -12,6 +12,7 @@ import (
 	h "github.com/ipfs/go-ipfs/importer/helpers"
 	trickle "github.com/ipfs/go-ipfs/importer/trickle"
 	dag "github.com/ipfs/go-ipfs/merkledag"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
 	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
 )
 
@@ -39,18 +40,32 @@ func BuildDagFromFile(fpath string, ds dag.DAGService) (*dag.Node, error) {
 }
 
 func BuildDagFromReader(ds dag.DAGService, spl chunk.Splitter) (*dag.Node, error) {
+	return BuildEncryptedDagFromReader(ds, spl, nil)
+}
+
+// BuildEncryptedDagFromReader builds a balanced DAG, sealing the data of
+// every chunk with key. A nil key stores the data in the clear.
+func BuildEncryptedDagFromReader(ds dag.DAGService, spl chunk.Splitter, key *crypt.Key) (*dag.Node, error) {
 	dbp := h.DagBuilderParams{
 		Dagserv:  ds,
 		Maxlinks: h.DefaultLinksPerBlock,
+		Key:      key,
 	}
 
 	return bal.BalancedLayout(dbp.New(spl))
 }
 
 func BuildTrickleDagFromReader(ds dag.DAGService, spl chunk.Splitter) (*dag.Node, error) {
+	return BuildEncryptedTrickleDagFromReader(ds, spl, nil)
+}
+
+// BuildEncryptedTrickleDagFromReader is like BuildEncryptedDagFromReader
+// but uses the trickle layout.
+func BuildEncryptedTrickleDagFromReader(ds dag.DAGService, spl chunk.Splitter, key *crypt.Key) (*dag.Node, error) {
 	dbp := h.DagBuilderParams{
 		Dagserv:  ds,
 		Maxlinks: h.DefaultLinksPerBlock,
+		Key:      key,
 	}
 
 	return trickle.TrickleLayout(dbp.New(spl))
@@ -0,0 +1,625 @@
+// Package inventory implements a ledger of the objects a node adds, pins,
+// unpins and garbage collects.
+//
+// Every event is stored in the repo datastore under /local/inventory, so
+// the ledger survives restarts, and is optionally streamed to a Sink so
+// that management nodes can follow what a node holds.
+//
+// Nodes of the same domain also exchange their ledgers with the sync
+// protocol (see Syncer). Events received from other peers are kept next to
+// the local ledger and folded into an index of which peer holds which
+// object, which Where queries.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dsq "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/query"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+var log = logging.Logger("inventory")
+
+var (
+	headKey      = ds.NewKey("/local/inventory/head")
+	indexedKey   = ds.NewKey("/local/inventory/indexed")
+	eventsPrefix = ds.NewKey("/local/inventory/events")
+
+	// events and heads of the ledgers of other peers
+	remotePrefix = ds.NewKey("/local/inventory/remote")
+	headsPrefix  = ds.NewKey("/local/inventory/heads")
+
+	// holders/<cid>/<peer> is set while peer holds cid
+	holdersPrefix = ds.NewKey("/local/inventory/holders")
+)
+
+// EventType is the kind of change an Event records.
+type EventType string
+
+const (
+	Add    EventType = "add"
+	Pin    EventType = "pin"
+	Unpin  EventType = "unpin"
+	Remove EventType = "gc"
+)
+
+// ParseEventType parses the name of an event type.
+func ParseEventType(s string) (EventType, error) {
+	switch t := EventType(s); t {
+	case Add, Pin, Unpin, Remove:
+		return t, nil
+	default:
+		return "", fmt.Errorf("invalid event type: %q", s)
+	}
+}
+
+// Event is a single entry of the inventory ledger.
+type Event struct {
+	Seq  uint64    // position in the ledger of Peer
+	Type EventType // what happened
+	Peer string    // the node the event happened on
+	Cid  string    // the object affected
+	Name string    `json:",omitempty"` // file name, for adds
+	Size uint64    `json:",omitempty"` // cumulative size, if known
+	Time time.Time
+
+	// Direct is set on pins that are not recursive. Older ledgers only
+	// recorded recursive pins.
+	Direct bool `json:",omitempty"`
+}
+
+// Filter selects events from the ledger. Zero fields match everything.
+type Filter struct {
+	Type  EventType
+	Peer  string
+	Cid   string
+	Name  string // substring of the file name
+	Since time.Time
+	Until time.Time
+	Limit int // return at most the Limit most recent events
+}
+
+// Match reports whether e is selected by f. Limit is not considered.
+func (f *Filter) Match(e *Event) bool {
+	switch {
+	case f.Type != "" && e.Type != f.Type:
+		return false
+	case f.Peer != "" && e.Peer != f.Peer:
+		return false
+	case f.Cid != "" && e.Cid != f.Cid:
+		return false
+	case f.Name != "" && !strings.Contains(e.Name, f.Name):
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// Stat summarizes a set of events.
+type Stat struct {
+	Events   uint64
+	Adds     uint64
+	Pins     uint64
+	Unpins   uint64
+	Removals uint64
+	Bytes    uint64 // total size of the added objects
+	Objects  uint64 // number of distinct objects
+	First    time.Time
+	Last     time.Time
+}
+
+// Holding records that a peer holds an object, as far as we know.
+type Holding struct {
+	Peer    string
+	Cid     string
+	Pinned  bool
+	Direct  bool   `json:",omitempty"` // pinned, but not recursively
+	Size    uint64 `json:",omitempty"`
+	Updated time.Time
+}
+
+// PinnedRecursively reports whether the peer holds a recursive pin.
+func (h *Holding) PinnedRecursively() bool {
+	return h.Pinned && !h.Direct
+}
+
+// Inventory is the ledger of a single node, along with the ledgers it
+// received from other peers.
+type Inventory struct {
+	dstore ds.Datastore
+	self   peer.ID
+
+	lk    sync.Mutex
+	seq   uint64
+	sinks []Sink
+}
+
+// New opens the ledger kept in d for the node self.
+func New(d ds.Datastore, self peer.ID) (*Inventory, error) {
+	inv := &Inventory{
+		dstore: d,
+		self:   self,
+	}
+
+	var err error
+	inv.seq, err = getUint(d, headKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := inv.reindex(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// reindex folds local events that are missing from the holders index into
+// it, e.g. after a crash between recording and indexing an event.
+func (inv *Inventory) reindex() error {
+	indexed, err := getUint(inv.dstore, indexedKey)
+	if err != nil {
+		return err
+	}
+
+	for seq := indexed + 1; seq <= inv.seq; seq++ {
+		e, err := inv.getEvent(eventKey(seq))
+		if err != nil {
+			return err
+		}
+		if err := inv.index(e); err != nil {
+			return err
+		}
+	}
+	return putUint(inv.dstore, indexedKey, inv.seq)
+}
+
+// AddSink streams all events recorded from now on to s.
+func (inv *Inventory) AddSink(s Sink) {
+	inv.lk.Lock()
+	defer inv.lk.Unlock()
+	inv.sinks = append(inv.sinks, s)
+}
+
+// Head returns the sequence number of the last recorded event.
+func (inv *Inventory) Head() uint64 {
+	inv.lk.Lock()
+	defer inv.lk.Unlock()
+	return inv.seq
+}
+
+// Record appends an event about c to the ledger. name and size may be
+// left empty when they are unknown.
+func (inv *Inventory) Record(t EventType, c *cid.Cid, name string, size uint64) (*Event, error) {
+	return inv.record(&Event{Type: t, Cid: c.String(), Name: name, Size: size})
+}
+
+// RecordPin appends a Pin event about c to the ledger, along with the
+// mode of the pin.
+func (inv *Inventory) RecordPin(c *cid.Cid, recursive bool, size uint64) (*Event, error) {
+	return inv.record(&Event{Type: Pin, Cid: c.String(), Size: size, Direct: !recursive})
+}
+
+func (inv *Inventory) record(e *Event) (*Event, error) {
+	inv.lk.Lock()
+	defer inv.lk.Unlock()
+
+	e.Seq = inv.seq + 1
+	e.Peer = inv.self.Pretty()
+	e.Time = time.Now().UTC()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := inv.dstore.Put(eventKey(e.Seq), data); err != nil {
+		return nil, err
+	}
+	if err := putUint(inv.dstore, headKey, e.Seq); err != nil {
+		return nil, err
+	}
+	inv.seq = e.Seq
+
+	if err := inv.index(e); err != nil {
+		return nil, err
+	}
+	if err := putUint(inv.dstore, indexedKey, e.Seq); err != nil {
+		return nil, err
+	}
+
+	for _, s := range inv.sinks {
+		if err := s.Send(e); err != nil {
+			log.Warningf("inventory sink: %s", err)
+		}
+	}
+	return e, nil
+}
+
+// Query returns the events selected by f, oldest first.
+func (inv *Inventory) Query(f Filter) ([]*Event, error) {
+	var out []*Event
+	err := inv.walk(f, func(e *Event) {
+		out = append(out, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// Stat summarizes the events selected by f.
+func (inv *Inventory) Stat(f Filter) (*Stat, error) {
+	s := newSummary()
+	if err := inv.walk(f, s.add); err != nil {
+		return nil, err
+	}
+	return s.stat(), nil
+}
+
+// walk calls fn with the events selected by f, newest first, until
+// f.Limit of them were selected. Events are read one at a time, so that
+// limited queries of a long ledger only read its end.
+func (inv *Inventory) walk(f Filter, fn func(*Event)) error {
+	var n int
+	for seq := inv.Head(); seq > 0; seq-- {
+		if f.Limit > 0 && n >= f.Limit {
+			break
+		}
+		e, err := inv.getEvent(eventKey(seq))
+		if err != nil {
+			return err
+		}
+		if f.Match(e) {
+			fn(e)
+			n++
+		}
+	}
+	return nil
+}
+
+// Close closes all sinks of the ledger.
+func (inv *Inventory) Close() error {
+	inv.lk.Lock()
+	defer inv.lk.Unlock()
+
+	var err error
+	for _, s := range inv.sinks {
+		if cerr := s.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	inv.sinks = nil
+	return err
+}
+
+// Cursors returns the sequence number of the last event known from every
+// peer whose ledger we have, including our own.
+func (inv *Inventory) Cursors() (map[peer.ID]uint64, error) {
+	inv.lk.Lock()
+	defer inv.lk.Unlock()
+	return inv.cursors()
+}
+
+func (inv *Inventory) cursors() (map[peer.ID]uint64, error) {
+	res, err := inv.dstore.Query(dsq.Query{Prefix: headsPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Process().Close()
+
+	out := map[peer.ID]uint64{inv.self: inv.seq}
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+
+		k := ds.NewKey(r.Key)
+		p, err := peer.IDB58Decode(k.BaseNamespace())
+		if err != nil {
+			return nil, fmt.Errorf("invalid inventory head %s: %s", k, err)
+		}
+
+		seq, err := parseUint(r.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inventory head %s: %s", k, err)
+		}
+		out[p] = seq
+	}
+	return out, nil
+}
+
+// Events returns up to max events of the ledger of p, starting with
+// sequence number from.
+func (inv *Inventory) Events(p peer.ID, from uint64, max int) ([]*Event, error) {
+	inv.lk.Lock()
+	defer inv.lk.Unlock()
+
+	head, err := inv.head(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*Event
+	for seq := from; seq <= head && len(out) < max; seq++ {
+		k := eventKey(seq)
+		if p != inv.self {
+			k = remoteEventKey(p, seq)
+		}
+
+		e, err := inv.getEvent(k)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Merge adds events received from other peers to their ledgers and to
+// the holders index. Events must be in ledger order per peer; events we
+// already have are skipped, and the events of a peer following a gap are
+// dropped, to be fetched again later. Events of our own ledger are
+// ignored. Merge returns the number of events added.
+func (inv *Inventory) Merge(events []*Event) (int, error) {
+	inv.lk.Lock()
+	defer inv.lk.Unlock()
+
+	heads := make(map[peer.ID]uint64)
+	var merged int
+	for _, e := range events {
+		p, err := peer.IDB58Decode(e.Peer)
+		if err != nil {
+			return merged, fmt.Errorf("inventory event with invalid peer %q: %s", e.Peer, err)
+		}
+		if p == inv.self {
+			continue
+		}
+		if _, err := ParseEventType(string(e.Type)); err != nil {
+			return merged, err
+		}
+
+		head, ok := heads[p]
+		if !ok {
+			head, err = inv.head(p)
+			if err != nil {
+				return merged, err
+			}
+		}
+		if e.Seq != head+1 {
+			heads[p] = head
+			continue
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return merged, err
+		}
+		if err := inv.dstore.Put(remoteEventKey(p, e.Seq), data); err != nil {
+			return merged, err
+		}
+		if err := inv.index(e); err != nil {
+			return merged, err
+		}
+		if err := putUint(inv.dstore, headsPrefix.ChildString(p.Pretty()), e.Seq); err != nil {
+			return merged, err
+		}
+		heads[p] = e.Seq
+		merged++
+	}
+	return merged, nil
+}
+
+// Where returns the peers known to hold c.
+func (inv *Inventory) Where(c *cid.Cid) ([]*Holding, error) {
+	prefix := holdersPrefix.ChildString(c.String())
+	res, err := inv.dstore.Query(dsq.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Process().Close()
+
+	var out []*Holding
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+
+		// the prefix also matches longer CIDs.
+		if ds.NewKey(r.Key).Parent() != prefix {
+			continue
+		}
+
+		b, ok := r.Value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("inventory holding %s has unexpected type %T", r.Key, r.Value)
+		}
+
+		h := new(Holding)
+		if err := json.Unmarshal(b, h); err != nil {
+			return nil, fmt.Errorf("inventory holding %s: %s", r.Key, err)
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+// head returns the last sequence number we have of the ledger of p.
+// inv.lk must be held.
+func (inv *Inventory) head(p peer.ID) (uint64, error) {
+	if p == inv.self {
+		return inv.seq, nil
+	}
+	return getUint(inv.dstore, headsPrefix.ChildString(p.Pretty()))
+}
+
+// index updates the holders index with e.
+func (inv *Inventory) index(e *Event) error {
+	k := holdersPrefix.ChildString(e.Cid).ChildString(e.Peer)
+
+	if e.Type == Remove {
+		err := inv.dstore.Delete(k)
+		if err == ds.ErrNotFound {
+			// most removed blocks are not roots of anything recorded.
+			return nil
+		}
+		return err
+	}
+
+	h := &Holding{Peer: e.Peer, Cid: e.Cid}
+	val, err := inv.dstore.Get(k)
+	switch {
+	case err == ds.ErrNotFound:
+	case err != nil:
+		return err
+	default:
+		b, ok := val.([]byte)
+		if !ok {
+			return fmt.Errorf("inventory holding %s has unexpected type %T", k, val)
+		}
+		if err := json.Unmarshal(b, h); err != nil {
+			return fmt.Errorf("inventory holding %s: %s", k, err)
+		}
+	}
+
+	switch e.Type {
+	case Pin:
+		h.Pinned = true
+		h.Direct = e.Direct
+	case Unpin:
+		// the blocks stay around until the next GC.
+		h.Pinned = false
+		h.Direct = false
+	}
+	if e.Size > 0 {
+		h.Size = e.Size
+	}
+	h.Updated = e.Time
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return inv.dstore.Put(k, data)
+}
+
+func (inv *Inventory) getEvent(k ds.Key) (*Event, error) {
+	val, err := inv.dstore.Get(k)
+	if err != nil {
+		return nil, fmt.Errorf("inventory event %s: %s", k, err)
+	}
+	return decodeEvent(k.String(), val)
+}
+
+func decodeEvent(k string, val interface{}) (*Event, error) {
+	b, ok := val.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("inventory event %s has unexpected type %T", k, val)
+	}
+
+	e := new(Event)
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, fmt.Errorf("inventory event %s: %s", k, err)
+	}
+	return e, nil
+}
+
+func getUint(d ds.Datastore, k ds.Key) (uint64, error) {
+	val, err := d.Get(k)
+	switch {
+	case err == ds.ErrNotFound:
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+
+	n, err := parseUint(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %s", k, err)
+	}
+	return n, nil
+}
+
+func parseUint(val interface{}) (uint64, error) {
+	b, ok := val.([]byte)
+	if !ok {
+		return 0, fmt.Errorf("unexpected type %T", val)
+	}
+	return strconv.ParseUint(string(b), 10, 64)
+}
+
+func putUint(d ds.Datastore, k ds.Key, n uint64) error {
+	return d.Put(k, []byte(strconv.FormatUint(n, 10)))
+}
+
+// Summarize computes the Stat of events.
+func Summarize(events []*Event) *Stat {
+	s := newSummary()
+	for _, e := range events {
+		s.add(e)
+	}
+	return s.stat()
+}
+
+// summary computes a Stat one event at a time.
+type summary struct {
+	st      Stat
+	objects map[string]struct{}
+}
+
+func newSummary() *summary {
+	return &summary{objects: make(map[string]struct{})}
+}
+
+func (s *summary) add(e *Event) {
+	st := &s.st
+	st.Events++
+	switch e.Type {
+	case Add:
+		st.Adds++
+		st.Bytes += e.Size
+	case Pin:
+		st.Pins++
+	case Unpin:
+		st.Unpins++
+	case Remove:
+		st.Removals++
+	}
+	s.objects[e.Cid] = struct{}{}
+
+	if st.First.IsZero() || e.Time.Before(st.First) {
+		st.First = e.Time
+	}
+	if e.Time.After(st.Last) {
+		st.Last = e.Time
+	}
+}
+
+func (s *summary) stat() *Stat {
+	st := s.st
+	st.Objects = uint64(len(s.objects))
+	return &st
+}
+
+func eventKey(seq uint64) ds.Key {
+	// zero padded, so that the keys sort in ledger order.
+	return eventsPrefix.ChildString(fmt.Sprintf("%020d", seq))
+}
+
+func remoteEventKey(p peer.ID, seq uint64) ds.Key {
+	return remotePrefix.ChildString(p.Pretty()).ChildString(fmt.Sprintf("%020d", seq))
+}
@@ -0,0 +1,257 @@
+package inventory
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	testutil "github.com/ipfs/go-ipfs/thirdparty/testutil"
+	u "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dssync "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/sync"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+func randCid(t *testing.T) *cid.Cid {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV0(u.Hash(buf))
+}
+
+func record(t *testing.T, inv *Inventory, typ EventType, c *cid.Cid, name string, size uint64) {
+	if _, err := inv.Record(typ, c, name, size); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordAndQuery(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	self := testutil.RandPeerIDFatal(t)
+	inv, err := New(d, self)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := randCid(t), randCid(t)
+	record(t, inv, Add, a, "a.txt", 100)
+	record(t, inv, Add, b, "b.jpg", 200)
+	record(t, inv, Pin, a, "", 0)
+	record(t, inv, Unpin, a, "", 0)
+	record(t, inv, Remove, a, "", 0)
+
+	all, err := inv.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(all))
+	}
+	for i, e := range all {
+		if e.Seq != uint64(i+1) {
+			t.Fatalf("event %d has sequence number %d", i, e.Seq)
+		}
+		if e.Peer != self.Pretty() {
+			t.Fatalf("event %d recorded for wrong peer %s", i, e.Peer)
+		}
+	}
+
+	found, err := inv.Query(Filter{Cid: a.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 4 {
+		t.Fatalf("expected 4 events for %s, got %d", a, len(found))
+	}
+
+	adds, err := inv.Query(Filter{Type: Add, Name: ".jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adds) != 1 || adds[0].Cid != b.String() {
+		t.Fatalf("name filter returned %v", adds)
+	}
+
+	last, err := inv.Query(Filter{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 2 || last[1].Type != Remove {
+		t.Fatalf("limit should keep the most recent events, got %v", last)
+	}
+
+	st, err := inv.Stat(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Events != 5 || st.Adds != 2 || st.Bytes != 300 || st.Objects != 2 || st.Removals != 1 {
+		t.Fatalf("unexpected stat: %+v", st)
+	}
+
+	// the ledger continues where it left off after a restart.
+	inv, err = New(d, self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Head() != 5 {
+		t.Fatalf("expected head 5 after reopening, got %d", inv.Head())
+	}
+	record(t, inv, Pin, b, "", 0)
+	all, err = inv.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 6 || all[5].Seq != 6 {
+		t.Fatal("event recorded after reopening did not extend the ledger")
+	}
+}
+
+func TestQueryLimitReadsTheEnd(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	inv, err := New(d, testutil.RandPeerIDFatal(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		record(t, inv, Add, randCid(t), "", 0)
+	}
+
+	// a limited query stops before it reaches the start of the ledger.
+	if err := d.Delete(eventKey(1)); err != nil {
+		t.Fatal(err)
+	}
+	last, err := inv.Query(Filter{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 3 || last[0].Seq != 8 || last[2].Seq != 10 {
+		t.Fatalf("expected events 8 to 10, got %v", last)
+	}
+	if _, err := inv.Query(Filter{}); err == nil {
+		t.Fatal("expected a full query to read the missing event")
+	}
+}
+
+func TestPinModes(t *testing.T) {
+	inv, err := New(dssync.MutexWrap(ds.NewMapDatastore()), testutil.RandPeerIDFatal(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := randCid(t)
+	holding := func() *Holding {
+		hs, err := inv.Where(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hs) != 1 {
+			t.Fatalf("expected one holding, got %d", len(hs))
+		}
+		return hs[0]
+	}
+
+	if _, err := inv.RecordPin(c, false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if h := holding(); !h.Pinned || h.PinnedRecursively() {
+		t.Fatalf("expected a direct pin, got %+v", h)
+	}
+
+	if _, err := inv.RecordPin(c, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if h := holding(); !h.PinnedRecursively() {
+		t.Fatalf("expected a recursive pin, got %+v", h)
+	}
+
+	// older ledgers only recorded recursive pins.
+	record(t, inv, Unpin, c, "", 0)
+	record(t, inv, Pin, c, "", 0)
+	if h := holding(); !h.PinnedRecursively() {
+		t.Fatalf("expected a pin without a mode to be recursive, got %+v", h)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.log")
+
+	inv, err := New(dssync.MutexWrap(ds.NewMapDatastore()), testutil.RandPeerIDFatal(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv.AddSink(s)
+
+	c := randCid(t)
+	record(t, inv, Add, c, "file", 10)
+	record(t, inv, Pin, c, "", 0)
+	if err := inv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []*Event
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		e := new(Event)
+		if err := json.Unmarshal(scan.Bytes(), e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 || events[0].Type != Add || events[1].Type != Pin {
+		t.Fatalf("unexpected events in sink file: %v", events)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	got := make(chan *Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := new(Event)
+		if err := json.NewDecoder(r.Body).Decode(e); err != nil {
+			t.Error(err)
+		}
+		got <- e
+	}))
+	defer srv.Close()
+
+	inv, err := New(dssync.MutexWrap(ds.NewMapDatastore()), testutil.RandPeerIDFatal(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv.AddSink(NewWebhookSink(srv.URL))
+	defer inv.Close()
+
+	c := randCid(t)
+	record(t, inv, Add, c, "file", 10)
+
+	select {
+	case e := <-got:
+		if e.Cid != c.String() || e.Type != Add {
+			t.Fatalf("webhook received wrong event: %+v", e)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("webhook did not receive the event")
+	}
+}
@@ -0,0 +1,168 @@
+// Code generated by protoc-gen-gogo.
+// source: inventory.proto
+// DO NOT EDIT!
+
+/*
+Package inventory_pb is a generated protocol buffer package.
+
+It is generated from these files:
+	inventory.proto
+
+It has these top-level messages:
+	Event
+	Cursor
+	SyncRequest
+	SyncResponse
+*/
+package inventory_pb
+
+import proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+// Event is an entry of a node's inventory ledger.
+type Event struct {
+	Seq              *uint64 `protobuf:"varint,1,opt,name=seq" json:"seq,omitempty"`
+	Type             *string `protobuf:"bytes,2,opt,name=type" json:"type,omitempty"`
+	Peer             []byte  `protobuf:"bytes,3,opt,name=peer" json:"peer,omitempty"`
+	Cid              *string `protobuf:"bytes,4,opt,name=cid" json:"cid,omitempty"`
+	Name             *string `protobuf:"bytes,5,opt,name=name" json:"name,omitempty"`
+	Size             *uint64 `protobuf:"varint,6,opt,name=size" json:"size,omitempty"`
+	Time             *int64  `protobuf:"varint,7,opt,name=time" json:"time,omitempty"`
+	Direct           *bool   `protobuf:"varint,8,opt,name=direct" json:"direct,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Event) Reset()         { *m = Event{} }
+func (m *Event) String() string { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()    {}
+
+func (m *Event) GetSeq() uint64 {
+	if m != nil && m.Seq != nil {
+		return *m.Seq
+	}
+	return 0
+}
+
+func (m *Event) GetType() string {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return ""
+}
+
+func (m *Event) GetPeer() []byte {
+	if m != nil {
+		return m.Peer
+	}
+	return nil
+}
+
+func (m *Event) GetCid() string {
+	if m != nil && m.Cid != nil {
+		return *m.Cid
+	}
+	return ""
+}
+
+func (m *Event) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Event) GetSize() uint64 {
+	if m != nil && m.Size != nil {
+		return *m.Size
+	}
+	return 0
+}
+
+func (m *Event) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
+	}
+	return 0
+}
+
+func (m *Event) GetDirect() bool {
+	if m != nil && m.Direct != nil {
+		return *m.Direct
+	}
+	return false
+}
+
+// Cursor is the sequence number of the last event known from a peer.
+type Cursor struct {
+	Peer             []byte  `protobuf:"bytes,1,opt,name=peer" json:"peer,omitempty"`
+	Seq              *uint64 `protobuf:"varint,2,opt,name=seq" json:"seq,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Cursor) Reset()         { *m = Cursor{} }
+func (m *Cursor) String() string { return proto.CompactTextString(m) }
+func (*Cursor) ProtoMessage()    {}
+
+func (m *Cursor) GetPeer() []byte {
+	if m != nil {
+		return m.Peer
+	}
+	return nil
+}
+
+func (m *Cursor) GetSeq() uint64 {
+	if m != nil && m.Seq != nil {
+		return *m.Seq
+	}
+	return 0
+}
+
+// SyncRequest asks for the events following the requester's cursors.
+type SyncRequest struct {
+	Cursors          []*Cursor `protobuf:"bytes,1,rep,name=cursors" json:"cursors,omitempty"`
+	XXX_unrecognized []byte    `json:"-"`
+}
+
+func (m *SyncRequest) Reset()         { *m = SyncRequest{} }
+func (m *SyncRequest) String() string { return proto.CompactTextString(m) }
+func (*SyncRequest) ProtoMessage()    {}
+
+func (m *SyncRequest) GetCursors() []*Cursor {
+	if m != nil {
+		return m.Cursors
+	}
+	return nil
+}
+
+// SyncResponse carries events of one or more peers, in ledger order per
+// peer. more is set if the responder has further events to send.
+type SyncResponse struct {
+	Events           []*Event `protobuf:"bytes,1,rep,name=events" json:"events,omitempty"`
+	More             *bool    `protobuf:"varint,2,opt,name=more" json:"more,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *SyncResponse) Reset()         { *m = SyncResponse{} }
+func (m *SyncResponse) String() string { return proto.CompactTextString(m) }
+func (*SyncResponse) ProtoMessage()    {}
+
+func (m *SyncResponse) GetEvents() []*Event {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+func (m *SyncResponse) GetMore() bool {
+	if m != nil && m.More != nil {
+		return *m.More
+	}
+	return false
+}
+
+func init() {
+}
@@ -0,0 +1,136 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// WebhookQueueSize is the number of events a webhook sink buffers before
+// it starts dropping events.
+var WebhookQueueSize = 1024
+
+// WebhookTimeout bounds every delivery to a webhook.
+var WebhookTimeout = time.Second * 10
+
+// Sink receives every event recorded by an Inventory. Send is called with
+// the inventory lock held, so it should not block for long.
+type Sink interface {
+	Send(e *Event) error
+	Close() error
+}
+
+// NewSink creates the sink described by c. It returns nil if c does not
+// enable a sink.
+func NewSink(c config.InventorySink) (Sink, error) {
+	switch c.Type {
+	case "":
+		return nil, nil
+	case "file":
+		return NewFileSink(c.Target)
+	case "webhook":
+		return NewWebhookSink(c.Target), nil
+	default:
+		return nil, fmt.Errorf("unknown inventory sink type: %q", c.Type)
+	}
+}
+
+// fileSink appends one JSON encoded event per line to a file.
+type fileSink struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewFileSink opens (or creates) the file at path for appending events.
+func NewFileSink(path string) (Sink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("inventory file sink: no path given")
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *fileSink) Send(e *Event) error {
+	return s.enc.Encode(e)
+}
+
+func (s *fileSink) Close() error {
+	return s.f.Close()
+}
+
+// webhookSink POSTs every event to a URL. Deliveries happen in the
+// background so that a slow endpoint does not hold up adds and pins.
+type webhookSink struct {
+	url    string
+	client *http.Client
+	queue  chan *Event
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewWebhookSink returns a sink that POSTs every event as JSON to url.
+func NewWebhookSink(url string) Sink {
+	s := &webhookSink{
+		url:    url,
+		client: &http.Client{Timeout: WebhookTimeout},
+		queue:  make(chan *Event, WebhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *webhookSink) Send(e *Event) error {
+	select {
+	case s.queue <- e:
+		return nil
+	default:
+		return fmt.Errorf("webhook %s is not keeping up, dropped event %d", s.url, e.Seq)
+	}
+}
+
+func (s *webhookSink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.queue)
+	})
+	<-s.done
+	return nil
+}
+
+func (s *webhookSink) loop() {
+	defer close(s.done)
+	for e := range s.queue {
+		if err := s.post(e); err != nil {
+			log.Warningf("inventory webhook %s: %s", s.url, err)
+		}
+	}
+}
+
+func (s *webhookSink) post(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package inventory
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/inventory/pb"
+
+	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+	host "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	inet "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/net"
+	protocol "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/protocol"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	ctxio "gx/ipfs/QmX6DhWrpBB5NtadXmPSXYNdVvuLfJXoFNMvUMoVvP5UJa/go-context/io"
+	ggio "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/io"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+)
+
+// ProtocolSync is the inventory sync protocol.ID
+var ProtocolSync protocol.ID = "/ipfs/inventory/sync/1.0.0"
+
+// SyncInterval is how often a Syncer pulls the ledgers of its peers.
+var SyncInterval = time.Minute
+
+// SyncTimeout bounds a single sync with one peer.
+var SyncTimeout = time.Minute
+
+// MaxSyncEvents is the number of events sent in a single response.
+var MaxSyncEvents = 1000
+
+// Syncer exchanges ledgers with other peers. Peers pull the events they
+// are missing from each other, including events that originated on a third
+// peer, so every node converges to the same view of which peer holds which
+// object.
+//
+// The Syncer does not check who it talks to; it is meant to run on a host
+// that only admits members of the local domain.
+type Syncer struct {
+	host  host.Host
+	inv   *Inventory
+	peers func() []peer.ID
+}
+
+// NewSyncer serves the ledgers of inv on h. peers lists the peers to pull
+// from periodically, see Run.
+func NewSyncer(h host.Host, inv *Inventory, peers func() []peer.ID) *Syncer {
+	s := &Syncer{
+		host:  h,
+		inv:   inv,
+		peers: peers,
+	}
+	h.SetStreamHandler(ProtocolSync, s.handleNewStream)
+	return s
+}
+
+// Run syncs with all peers every SyncInterval, until proc closes.
+func (s *Syncer) Run(proc goprocess.Process) {
+	tick := time.NewTicker(SyncInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+		case <-proc.Closing():
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-proc.Closing():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		s.SyncAll(ctx)
+		cancel()
+	}
+}
+
+// SyncAll pulls the ledgers of all peers.
+func (s *Syncer) SyncAll(ctx context.Context) {
+	for _, p := range s.peers() {
+		if p == s.host.ID() {
+			continue
+		}
+		if err := s.SyncPeer(ctx, p); err != nil {
+			log.Debugf("inventory sync with %s failed: %s", p, err)
+		}
+	}
+}
+
+// SyncPeer pulls the events we are missing from p.
+func (s *Syncer) SyncPeer(ctx context.Context, p peer.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, SyncTimeout)
+	defer cancel()
+
+	st, err := s.host.NewStream(ctx, p, ProtocolSync)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	r := ggio.NewDelimitedReader(ctxio.NewReader(ctx, st), inet.MessageSizeMax)
+	w := ggio.NewDelimitedWriter(ctxio.NewWriter(ctx, st))
+
+	for {
+		cursors, err := s.inv.Cursors()
+		if err != nil {
+			return err
+		}
+
+		req := new(pb.SyncRequest)
+		for p, seq := range cursors {
+			req.Cursors = append(req.Cursors, &pb.Cursor{
+				Peer: []byte(p),
+				Seq:  proto.Uint64(seq),
+			})
+		}
+		if err := w.WriteMsg(req); err != nil {
+			return err
+		}
+
+		resp := new(pb.SyncResponse)
+		if err := r.ReadMsg(resp); err != nil {
+			return err
+		}
+
+		events := make([]*Event, 0, len(resp.GetEvents()))
+		for _, pe := range resp.GetEvents() {
+			events = append(events, eventFromPB(pe))
+		}
+
+		n, err := s.inv.Merge(events)
+		if err != nil {
+			return err
+		}
+		log.Debugf("merged %d inventory events from %s", n, p)
+
+		// stop if we made no progress, rather than asking for the same
+		// events forever.
+		if !resp.GetMore() || n == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *Syncer) handleNewStream(st inet.Stream) {
+	defer st.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), SyncTimeout)
+	defer cancel()
+
+	r := ggio.NewDelimitedReader(ctxio.NewReader(ctx, st), inet.MessageSizeMax)
+	w := ggio.NewDelimitedWriter(ctxio.NewWriter(ctx, st))
+
+	for {
+		req := new(pb.SyncRequest)
+		if err := r.ReadMsg(req); err != nil {
+			if err != io.EOF {
+				log.Debugf("inventory sync: failed to read request: %s", err)
+			}
+			return
+		}
+
+		resp, err := s.respond(req)
+		if err != nil {
+			log.Warningf("inventory sync: %s", err)
+			return
+		}
+
+		if err := w.WriteMsg(resp); err != nil {
+			log.Debugf("inventory sync: failed to write response: %s", err)
+			return
+		}
+	}
+}
+
+// respond collects the events following the cursors of req, up to
+// MaxSyncEvents.
+func (s *Syncer) respond(req *pb.SyncRequest) (*pb.SyncResponse, error) {
+	known := make(map[peer.ID]uint64)
+	for _, c := range req.GetCursors() {
+		known[peer.ID(c.GetPeer())] = c.GetSeq()
+	}
+
+	heads, err := s.inv.Cursors()
+	if err != nil {
+		return nil, err
+	}
+
+	// sorted, so that repeated requests are answered consistently.
+	var origins []string
+	for p := range heads {
+		origins = append(origins, string(p))
+	}
+	sort.Strings(origins)
+
+	resp := new(pb.SyncResponse)
+	budget := MaxSyncEvents
+	for _, o := range origins {
+		p := peer.ID(o)
+		if heads[p] <= known[p] {
+			continue
+		}
+		if budget == 0 {
+			resp.More = proto.Bool(true)
+			break
+		}
+
+		events, err := s.inv.Events(p, known[p]+1, budget)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			resp.Events = append(resp.Events, eventToPB(p, e))
+		}
+		budget -= len(events)
+
+		if known[p]+uint64(len(events)) < heads[p] {
+			resp.More = proto.Bool(true)
+		}
+	}
+	return resp, nil
+}
+
+func eventToPB(p peer.ID, e *Event) *pb.Event {
+	return &pb.Event{
+		Seq:    proto.Uint64(e.Seq),
+		Type:   proto.String(string(e.Type)),
+		Peer:   []byte(p),
+		Cid:    proto.String(e.Cid),
+		Name:   proto.String(e.Name),
+		Size:   proto.Uint64(e.Size),
+		Time:   proto.Int64(e.Time.UnixNano()),
+		Direct: proto.Bool(e.Direct),
+	}
+}
+
+func eventFromPB(pe *pb.Event) *Event {
+	return &Event{
+		Seq:    pe.GetSeq(),
+		Type:   EventType(pe.GetType()),
+		Peer:   peer.ID(pe.GetPeer()).Pretty(),
+		Cid:    pe.GetCid(),
+		Name:   pe.GetName(),
+		Size:   pe.GetSize(),
+		Time:   time.Unix(0, pe.GetTime()).UTC(),
+		Direct: pe.GetDirect(),
+	}
+}
@@ -0,0 +1,169 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	testutil "github.com/ipfs/go-ipfs/thirdparty/testutil"
+
+	host "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	mocknet "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/net/mock"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dssync "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/sync"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+func genSyncers(t *testing.T, ctx context.Context, n int) ([]host.Host, []*Syncer) {
+	mn := mocknet.New(ctx)
+	var hosts []host.Host
+	var syncers []*Syncer
+	for i := 0; i < n; i++ {
+		h, err := mn.GenPeer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inv, err := New(dssync.MutexWrap(ds.NewMapDatastore()), h.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hosts = append(hosts, h)
+		syncers = append(syncers, NewSyncer(h, inv, h.Network().Peers))
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	return hosts, syncers
+}
+
+func holders(t *testing.T, inv *Inventory, c *cid.Cid) map[string]*Holding {
+	hs, err := inv.Where(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]*Holding)
+	for _, h := range hs {
+		out[h.Peer] = h
+	}
+	return out
+}
+
+func TestSyncTransitive(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	hosts, syncers := genSyncers(t, ctx, 3)
+	a, b, c := syncers[0], syncers[1], syncers[2]
+
+	obj := randCid(t)
+	record(t, a.inv, Add, obj, "file", 42)
+	record(t, a.inv, Pin, obj, "", 42)
+	record(t, c.inv, Add, obj, "copy", 42)
+
+	// a and c never talk to each other directly.
+	if err := b.SyncPeer(ctx, hosts[0].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SyncPeer(ctx, hosts[2].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncPeer(ctx, hosts[1].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SyncPeer(ctx, hosts[1].ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, s := range syncers {
+		hs := holders(t, s.inv, obj)
+		if len(hs) != 2 {
+			t.Fatalf("node %d knows %d holders, expected 2", i, len(hs))
+		}
+		if h := hs[hosts[0].ID().Pretty()]; h == nil || !h.Pinned {
+			t.Fatalf("node %d does not know that the first node pinned the object", i)
+		}
+	}
+
+	// removals propagate as well, and syncing again is a no-op.
+	record(t, a.inv, Unpin, obj, "", 0)
+	record(t, a.inv, Remove, obj, "", 0)
+	if err := b.SyncPeer(ctx, hosts[0].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SyncPeer(ctx, hosts[0].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncPeer(ctx, hosts[1].ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := holders(t, c.inv, obj)
+	if len(hs) != 1 || hs[hosts[2].ID().Pretty()] == nil {
+		t.Fatalf("expected only the third node to hold the object, got %v", hs)
+	}
+
+	cursors, err := c.inv.Cursors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursors[hosts[0].ID()] != 4 {
+		t.Fatalf("expected to have 4 events of the first node, got %d", cursors[hosts[0].ID()])
+	}
+}
+
+func TestSyncBatches(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	defer func(n int) { MaxSyncEvents = n }(MaxSyncEvents)
+	MaxSyncEvents = 3
+
+	hosts, syncers := genSyncers(t, ctx, 2)
+	for i := 0; i < 10; i++ {
+		record(t, syncers[0].inv, Add, randCid(t), "", 1)
+	}
+
+	if err := syncers[1].SyncPeer(ctx, hosts[0].ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := syncers[1].inv.Events(hosts[0].ID(), 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 10 {
+		t.Fatalf("expected all 10 events after syncing in batches, got %d", len(events))
+	}
+}
+
+func TestMergeSkipsGaps(t *testing.T) {
+	self := testutil.RandPeerIDFatal(t)
+	inv, err := New(dssync.MutexWrap(ds.NewMapDatastore()), self)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := testutil.RandPeerIDFatal(t)
+	obj := randCid(t)
+	ev := func(seq uint64) *Event {
+		return &Event{Seq: seq, Type: Add, Peer: other.Pretty(), Cid: obj.String(), Time: time.Now()}
+	}
+
+	n, err := inv.Merge([]*Event{ev(1), ev(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected only the first event to be merged, merged %d", n)
+	}
+
+	n, err = inv.Merge([]*Event{ev(1), ev(2), ev(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected the missing events to be merged, merged %d", n)
+	}
+}
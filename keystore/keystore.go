@@ -0,0 +1,231 @@
+// package keystore stores secret keys belonging to the repo, such as the
+// symmetric key encrypted content is sealed with.
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNoSuchKey = errors.New("no key by the given name was found")
+	ErrKeyExists = errors.New("key by that name already exists, refusing to overwrite")
+)
+
+// Keystore provides a key management interface.
+type Keystore interface {
+	// Has returns whether or not a key exists in the Keystore
+	Has(name string) (bool, error)
+	// Put stores a key in the Keystore, if a key with the same name
+	// already exists, returns ErrKeyExists
+	Put(name string, key []byte) error
+	// Get retrieves a key from the Keystore if it exists, and returns
+	// ErrNoSuchKey otherwise.
+	Get(name string) ([]byte, error)
+	// Delete removes a key from the Keystore
+	Delete(name string) error
+	// List returns the names of all the keys in the Keystore, sorted
+	List() ([]string, error)
+}
+
+// validateName rejects names that could escape the keystore directory.
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("key names must be at least one character")
+	}
+	if strings.Contains(name, "/") || strings.Contains(name, string(filepath.Separator)) {
+		return fmt.Errorf("key names may not contain slashes")
+	}
+	if strings.HasPrefix(name, ".") {
+		return fmt.Errorf("key names may not begin with a period")
+	}
+	return nil
+}
+
+// FSKeystore keeps each key in a file of its own, readable only by the
+// owner of the repo.
+type FSKeystore struct {
+	dir string
+}
+
+// NewFSKeystore opens the keystore in dir, creating the directory if
+// needed.
+func NewFSKeystore(dir string) (*FSKeystore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FSKeystore{dir: dir}, nil
+}
+
+func (ks *FSKeystore) Has(name string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+
+	_, err := os.Stat(filepath.Join(ks.dir, name))
+	switch {
+	case os.IsNotExist(err):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
+func (ks *FSKeystore) Put(name string, key []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(ks.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if os.IsExist(err) {
+		return ErrKeyExists
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(key)
+	return err
+}
+
+// Replace stores key under name whether or not it exists. The key file
+// is replaced atomically, so that a failure never loses the old key.
+func (ks *FSKeystore) Replace(name string, key []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	// names starting with a period are not listed
+	tmp := filepath.Join(ks.dir, "."+name+".tmp")
+	os.Remove(tmp)
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(ks.dir, name))
+}
+
+func (ks *FSKeystore) Get(name string) ([]byte, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNoSuchKey
+	}
+	return b, err
+}
+
+func (ks *FSKeystore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return ErrNoSuchKey
+	}
+	return err
+}
+
+func (ks *FSKeystore) List() ([]string, error) {
+	dir, err := os.Open(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, n := range names {
+		if validateName(n) == nil {
+			out = append(out, n)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// MemKeystore is an in memory Keystore, for tests and mock repos.
+type MemKeystore struct {
+	lk   sync.Mutex
+	keys map[string][]byte
+}
+
+func NewMemKeystore() *MemKeystore {
+	return &MemKeystore{keys: make(map[string][]byte)}
+}
+
+func (mk *MemKeystore) Has(name string) (bool, error) {
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+	_, ok := mk.keys[name]
+	return ok, nil
+}
+
+func (mk *MemKeystore) Put(name string, key []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+	if _, ok := mk.keys[name]; ok {
+		return ErrKeyExists
+	}
+	mk.keys[name] = append([]byte(nil), key...)
+	return nil
+}
+
+func (mk *MemKeystore) Get(name string) ([]byte, error) {
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+	k, ok := mk.keys[name]
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+	return append([]byte(nil), k...), nil
+}
+
+func (mk *MemKeystore) Delete(name string) error {
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+	if _, ok := mk.keys[name]; !ok {
+		return ErrNoSuchKey
+	}
+	delete(mk.keys, name)
+	return nil
+}
+
+func (mk *MemKeystore) List() ([]string, error) {
+	mk.lk.Lock()
+	defer mk.lk.Unlock()
+	var out []string
+	for n := range mk.keys {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package keystore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testKeystore(t *testing.T, ks Keystore) {
+	if _, err := ks.Get("foo"); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+
+	if err := ks.Put("foo", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("foo", []byte("other")); err != ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+
+	has, err := ks.Has("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("keystore should have foo")
+	}
+
+	k, err := ks.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(k, []byte("secret")) {
+		t.Fatalf("got wrong key back: %q", k)
+	}
+
+	if err := ks.Put("bar", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	names, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "bar" || names[1] != "foo" {
+		t.Fatalf("unexpected key list: %v", names)
+	}
+
+	if err := ks.Delete("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := ks.Has("foo"); has {
+		t.Fatal("foo should have been deleted")
+	}
+
+	for _, bad := range []string{"", "../foo", ".hidden"} {
+		if err := ks.Put(bad, []byte("x")); err == nil {
+			t.Fatalf("expected name %q to be rejected", bad)
+		}
+	}
+}
+
+func TestFSKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks, err := NewFSKeystore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKeystore(t, ks)
+}
+
+func TestMemKeystore(t *testing.T) {
+	testKeystore(t, NewMemKeystore())
+}
+
+func TestFSKeystoreReplace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks, err := NewFSKeystore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("foo", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Replace("foo", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ks.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte("new")) {
+		t.Fatalf("expected the replaced key, got %q", b)
+	}
+	names, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Fatalf("expected one key, got %v", names)
+	}
+}
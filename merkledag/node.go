@@ -22,6 +22,17 @@ type Node struct {
 	encoded []byte
 
 	cached *cid.Cid
+
+	// PosInfo says where the data of this node was read from, when it was
+	// imported from a file on the local filesystem. It is not part of the
+	// encoded node.
+	PosInfo *PosInfo
+}
+
+// PosInfo locates the data of a leaf node within a file.
+type PosInfo struct {
+	Offset   uint64
+	FullPath string
 }
 
 // NodeStat is a statistics object for a Node. Mostly sizes.
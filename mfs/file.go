@@ -41,6 +41,13 @@ const (
 )
 
 func (fi *File) Open(flags int, sync bool) (FileDescriptor, error) {
+	return fi.OpenContext(context.TODO(), flags, sync)
+}
+
+// OpenContext is like Open, but the descriptor reads with ctx, which
+// carries the keys of encrypted files (see crypt.WithKeys) and must last
+// as long as the descriptor. Encrypted files cannot be written to.
+func (fi *File) OpenContext(ctx context.Context, flags int, sync bool) (FileDescriptor, error) {
 	fi.nodelk.Lock()
 	node := fi.node
 	fi.nodelk.Unlock()
@@ -69,7 +76,7 @@ func (fi *File) Open(flags int, sync bool) (FileDescriptor, error) {
 		return nil, fmt.Errorf("mode not supported")
 	}
 
-	dmod, err := mod.NewDagModifier(context.TODO(), node, fi.dserv, chunk.DefaultSplitter)
+	dmod, err := mod.NewDagModifier(ctx, node, fi.dserv, chunk.DefaultSplitter)
 	if err != nil {
 		return nil, err
 	}
@@ -21,7 +21,9 @@ import (
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	"github.com/ipfs/go-ipfs/path"
 	ft "github.com/ipfs/go-ipfs/unixfs"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	mod "github.com/ipfs/go-ipfs/unixfs/mod"
 
 	u "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
 	"gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
@@ -721,6 +723,68 @@ func testActor(rt *Root, iterations int, errs chan error) {
 	errs <- nil
 }
 
+func TestEncryptedFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds, rt := setupRoot(ctx, t)
+	rootdir := rt.GetValue().(*Directory)
+
+	raw, err := crypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := crypt.NewKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("some secret file data")
+	nd, err := importer.BuildEncryptedDagFromReader(ds, chunk.DefaultSplitter(bytes.NewReader(data)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rootdir.AddChild("file", nd); err != nil {
+		t.Fatal(err)
+	}
+	fsn, err := rootdir.Child("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi := fsn.(*File)
+
+	wfd, err := fi.Open(OpenWriteOnly, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wfd.Write([]byte("plain")); err != mod.ErrEncrypted {
+		t.Fatalf("expected mod.ErrEncrypted, got %v", err)
+	}
+	if err := wfd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rfd, err := fi.Open(OpenReadOnly, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(rfd); err != crypt.ErrMissingKey {
+		t.Fatalf("expected crypt.ErrMissingKey without the key, got %v", err)
+	}
+	rfd.Close()
+
+	rfd, err = fi.OpenContext(crypt.WithKeys(ctx, key), OpenReadOnly, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rfd.Close()
+	out, err := ioutil.ReadAll(rfd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("read the wrong data from the encrypted file")
+	}
+}
+
 func TestMfsStress(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -0,0 +1,272 @@
+package namesys
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/namesys/pb"
+	path "github.com/ipfs/go-ipfs/path"
+
+	ci "gx/ipfs/QmVoi5es8D5fNHZDqoW6DgDAEPEV5hQp8GBz161vZXiwpQ/go-libp2p-crypto"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	routing "gx/ipfs/QmcoQiBzRaaVv1DZbbXoDWiEtvDN94Ca1DcwnQKK2tP92s/go-libp2p-routing"
+	record "gx/ipfs/Qme7D9iKHYxwq28p6PzCymywsYSRBx9uyGzW7qNB3s9VbC/go-libp2p-record"
+)
+
+// DomainValidatorTag is the routing namespace domain registry records
+// are stored under.
+const DomainValidatorTag = "domain"
+
+// DomainResolveTimeout bounds the registry lookup of a single domain.
+var DomainResolveTimeout = time.Minute
+
+var (
+	ErrUnknownDomain      = errors.New("unknown domain")
+	ErrDomainRecordSig    = errors.New("domain record has an invalid signature")
+	ErrDomainRecordKey    = errors.New("domain record is not stored under its authority's key")
+	ErrDomainRecordDomain = errors.New("domain record is for a different domain")
+)
+
+// DomainLookupFunc maps a domain name to the GroupID of its authority. ok
+// is false for names we do not know; such names are only resolved if they
+// are a GroupID themselves.
+type DomainLookupFunc func(name string) (groupID string, ok bool)
+
+// DomainResolver implements a Resolver for /domain/<name>/<path>. The
+// domain authority publishes a signed registry record mapping the
+// domain to an IPNS name or a root CID.
+type DomainResolver struct {
+	routing routing.ValueStore
+	lookup  DomainLookupFunc
+}
+
+// NewDomainResolver constructs a resolver for /domain/ paths. lookup may
+// be nil, in which case only domains given by their GroupID resolve.
+func NewDomainResolver(r routing.ValueStore, lookup DomainLookupFunc) *DomainResolver {
+	return &DomainResolver{routing: r, lookup: lookup}
+}
+
+// Resolve implements Resolver.
+func (r *DomainResolver) Resolve(ctx context.Context, name string) (path.Path, error) {
+	return r.ResolveN(ctx, name, DefaultDepthLimit)
+}
+
+// ResolveN implements Resolver.
+func (r *DomainResolver) ResolveN(ctx context.Context, name string, depth int) (path.Path, error) {
+	return resolve(ctx, r, strings.TrimPrefix(name, "/domain/"), depth, "/domain/")
+}
+
+// resolveOnce implements resolver. name is <domain>[/<path>].
+func (r *DomainResolver) resolveOnce(ctx context.Context, name string) (path.Path, error) {
+	segments := strings.SplitN(name, "/", 2)
+	domain := segments[0]
+
+	groupID, err := r.groupID(domain)
+	if err != nil {
+		return "", err
+	}
+	log.Debugf("DomainResolver resolving %s (%s)", domain, groupID)
+
+	k, err := DomainRecordKey(groupID)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DomainResolveTimeout)
+	defer cancel()
+
+	val, err := r.routing.GetValue(ctx, k)
+	if err != nil {
+		log.Debugf("DomainResolver get failed for %s: %s", domain, err)
+		return "", err
+	}
+
+	rec := new(pb.DomainRecord)
+	if err := proto.Unmarshal(val, rec); err != nil {
+		return "", err
+	}
+	if err := VerifyDomainRecord(rec, groupID); err != nil {
+		return "", err
+	}
+	if domain != groupID && rec.GetDomain() != domain {
+		return "", ErrDomainRecordDomain
+	}
+
+	p, err := path.ParsePath(string(rec.GetValue()))
+	if err != nil {
+		return "", err
+	}
+
+	if len(segments) > 1 {
+		return path.FromSegments("", strings.TrimRight(p.String(), "/"), segments[1])
+	}
+	return p, nil
+}
+
+func (r *DomainResolver) groupID(domain string) (string, error) {
+	if r.lookup != nil {
+		if gid, ok := r.lookup(domain); ok {
+			return gid, nil
+		}
+	}
+	if _, err := peer.IDB58Decode(domain); err == nil {
+		return domain, nil
+	}
+	return "", ErrUnknownDomain
+}
+
+// DomainRecordKey returns the routing key of the registry record of the
+// domain with the given GroupID.
+func DomainRecordKey(groupID string) (key.Key, error) {
+	id, err := peer.IDB58Decode(groupID)
+	if err != nil {
+		return "", err
+	}
+	return key.Key("/" + DomainValidatorTag + "/" + string(id)), nil
+}
+
+// CreateDomainRecord signs a registry record mapping domain to val with
+// the domain authority key.
+func CreateDomainRecord(authority ci.PrivKey, domain string, val path.Path, seq uint64) (*pb.DomainRecord, error) {
+	pkb, err := ci.MarshalPublicKey(authority.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &pb.DomainRecord{
+		Domain:    proto.String(domain),
+		Value:     []byte(val),
+		Sequence:  proto.Uint64(seq),
+		Authority: pkb,
+	}
+
+	sig, err := authority.Sign(domainRecordDataForSig(rec))
+	if err != nil {
+		return nil, err
+	}
+	rec.Signature = sig
+	return rec, nil
+}
+
+// VerifyDomainRecord checks that rec was signed by the authority of the
+// domain with the given GroupID.
+func VerifyDomainRecord(rec *pb.DomainRecord, groupID string) error {
+	pk, err := ci.UnmarshalPublicKey(rec.GetAuthority())
+	if err != nil {
+		return err
+	}
+
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		return err
+	}
+	if id.Pretty() != groupID {
+		return ErrDomainRecordKey
+	}
+
+	ok, err := pk.Verify(domainRecordDataForSig(rec), rec.GetSignature())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrDomainRecordSig
+	}
+	return nil
+}
+
+// PublishDomainRecord signs and stores a registry record pointing domain
+// at val, superseding the record currently in the routing system.
+func PublishDomainRecord(ctx context.Context, r routing.ValueStore, authority ci.PrivKey, domain string, val path.Path) error {
+	id, err := peer.IDFromPrivateKey(authority)
+	if err != nil {
+		return err
+	}
+
+	k, err := DomainRecordKey(id.Pretty())
+	if err != nil {
+		return err
+	}
+
+	var seq uint64
+	if old, err := r.GetValue(ctx, k); err == nil {
+		rec := new(pb.DomainRecord)
+		if err := proto.Unmarshal(old, rec); err == nil {
+			seq = rec.GetSequence() + 1
+		}
+	}
+
+	rec, err := CreateDomainRecord(authority, domain, val, seq)
+	if err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	timectx, cancel := context.WithTimeout(ctx, PublishPutValTimeout)
+	defer cancel()
+	return r.PutValue(timectx, k, data)
+}
+
+// DomainRecordValidator checks registry records before they are stored.
+// The records carry their own signature, the routing record need not be
+// signed by the authority.
+var DomainRecordValidator = &record.ValidChecker{
+	Func: ValidateDomainRecord,
+	Sign: false,
+}
+
+// ValidateDomainRecord implements ValidatorFunc and verifies that val is
+// a DomainRecord signed by the authority k belongs to.
+func ValidateDomainRecord(k key.Key, val []byte) error {
+	rec := new(pb.DomainRecord)
+	if err := proto.Unmarshal(val, rec); err != nil {
+		return err
+	}
+
+	id := strings.TrimPrefix(string(k), "/"+DomainValidatorTag+"/")
+	return VerifyDomainRecord(rec, peer.ID(id).Pretty())
+}
+
+// DomainSelectorFunc selects the registry record with the highest
+// sequence number.
+func DomainSelectorFunc(k key.Key, vals [][]byte) (int, error) {
+	best := -1
+	var bestSeq uint64
+	for i, v := range vals {
+		rec := new(pb.DomainRecord)
+		if err := proto.Unmarshal(v, rec); err != nil {
+			continue
+		}
+		if best == -1 || rec.GetSequence() > bestSeq ||
+			(rec.GetSequence() == bestSeq && bytes.Compare(v, vals[best]) > 0) {
+			best = i
+			bestSeq = rec.GetSequence()
+		}
+	}
+	if best == -1 {
+		return 0, errors.New("no usable records in given set")
+	}
+	return best, nil
+}
+
+// domainRecordDataForSig returns the bytes covered by the record
+// signature.
+func domainRecordDataForSig(rec *pb.DomainRecord) []byte {
+	cpy := *rec
+	cpy.Signature = nil
+	cpy.XXX_unrecognized = nil
+	b, err := proto.Marshal(&cpy)
+	if err != nil {
+		// only fails for invalid messages, which we never construct
+		panic(err)
+	}
+	return b
+}
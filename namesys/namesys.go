@@ -18,15 +18,25 @@ import (
 // (b) dns domains: resolves using links in DNS TXT records
 // (c) proquints: interprets string as the raw byte data.
 //
+// /domain/ names are resolved through the registry records published by
+// domain authorities.
+//
 // It can only publish to: (a) ipfs routing naming.
 //
 type mpns struct {
 	resolvers  map[string]resolver
 	publishers map[string]Publisher
+	domains    resolver
 }
 
 // NewNameSystem will construct the IPFS naming system based on Routing
 func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSystem {
+	return NewNameSystemWithDomains(r, ds, cachesize, nil)
+}
+
+// NewNameSystemWithDomains is like NewNameSystem, additionally resolving
+// the domain names known to lookup under /domain/.
+func NewNameSystemWithDomains(r routing.ValueStore, ds ds.Datastore, cachesize int, lookup DomainLookupFunc) NameSystem {
 	return &mpns{
 		resolvers: map[string]resolver{
 			"dns":      newDNSResolver(),
@@ -36,6 +46,7 @@ func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSys
 		publishers: map[string]Publisher{
 			"/ipns/": NewRoutingPublisher(r, ds),
 		},
+		domains: NewDomainResolver(r, lookup),
 	}
 }
 
@@ -61,6 +72,14 @@ func (ns *mpns) ResolveN(ctx context.Context, name string, depth int) (path.Path
 
 // resolveOnce implements resolver.
 func (ns *mpns) resolveOnce(ctx context.Context, name string) (path.Path, error) {
+	if strings.HasPrefix(name, "/domain/") {
+		if ns.domains == nil {
+			log.Warningf("No domain resolver for %s", name)
+			return "", ErrResolveFailed
+		}
+		return ns.domains.resolveOnce(ctx, strings.TrimPrefix(name, "/domain/"))
+	}
+
 	if !strings.HasPrefix(name, "/ipns/") {
 		name = "/ipns/" + name
 	}
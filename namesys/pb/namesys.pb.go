@@ -10,6 +10,7 @@ It is generated from these files:
 
 It has these top-level messages:
 	IpnsEntry
+	DomainRecord
 */
 package namesys_pb
 
@@ -107,6 +108,56 @@ func (m *IpnsEntry) GetTtl() uint64 {
 	return 0
 }
 
+// DomainRecord maps a domain name to the path of its content. It is
+// signed by the domain authority and stored under /domain/<authority id>.
+type DomainRecord struct {
+	Domain           *string `protobuf:"bytes,1,req,name=domain" json:"domain,omitempty"`
+	Value            []byte  `protobuf:"bytes,2,req,name=value" json:"value,omitempty"`
+	Sequence         *uint64 `protobuf:"varint,3,opt,name=sequence" json:"sequence,omitempty"`
+	Authority        []byte  `protobuf:"bytes,4,req,name=authority" json:"authority,omitempty"`
+	Signature        []byte  `protobuf:"bytes,5,req,name=signature" json:"signature,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *DomainRecord) Reset()         { *m = DomainRecord{} }
+func (m *DomainRecord) String() string { return proto.CompactTextString(m) }
+func (*DomainRecord) ProtoMessage()    {}
+
+func (m *DomainRecord) GetDomain() string {
+	if m != nil && m.Domain != nil {
+		return *m.Domain
+	}
+	return ""
+}
+
+func (m *DomainRecord) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *DomainRecord) GetSequence() uint64 {
+	if m != nil && m.Sequence != nil {
+		return *m.Sequence
+	}
+	return 0
+}
+
+func (m *DomainRecord) GetAuthority() []byte {
+	if m != nil {
+		return m.Authority
+	}
+	return nil
+}
+
+func (m *DomainRecord) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("namesys.pb.IpnsEntry_ValidityType", IpnsEntry_ValidityType_name, IpnsEntry_ValidityType_value)
 }
@@ -9,6 +9,7 @@ import (
 	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
 	testutil "github.com/ipfs/go-ipfs/thirdparty/testutil"
 	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
 	u "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
 	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
 	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
@@ -138,3 +139,84 @@ func verifyCanResolve(r Resolver, name string, exp path.Path) error {
 
 	return nil
 }
+
+func TestDomainResolve(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	d := mockrouting.NewServer().ClientWithDatastore(ctx, testutil.RandIdentityOrFatal(t), dstore)
+
+	authority, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pubk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupID := id.Pretty()
+
+	lookup := func(name string) (string, bool) {
+		if name == "acme" {
+			return groupID, true
+		}
+		return "", false
+	}
+	ns := NewNameSystemWithDomains(d, dstore, 0, lookup)
+
+	h := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	if err := PublishDomainRecord(ctx, d, authority, "acme", h); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ns.Resolve(ctx, "/domain/acme/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.String() != h.String()+"/a/b" {
+		t.Fatalf("resolved to %s", res)
+	}
+
+	// the GroupID works as a name, too.
+	if res, err := ns.Resolve(ctx, "/domain/"+groupID); err != nil || res != h {
+		t.Fatalf("resolving by GroupID failed: %s %v", res, err)
+	}
+
+	if _, err := ns.Resolve(ctx, "/domain/unknown"); err == nil {
+		t.Fatal("expected an unknown domain not to resolve")
+	}
+
+	h2 := path.FromString("/ipfs/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n")
+	if err := PublishDomainRecord(ctx, d, authority, "acme", h2); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ns.Resolve(ctx, "/domain/acme"); err != nil || res != h2 {
+		t.Fatalf("expected the new record to win, got %s %v", res, err)
+	}
+
+	// a record signed by someone else is rejected.
+	mallory, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := CreateDomainRecord(mallory, "acme", h, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := DomainRecordKey(groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := proto.Marshal(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateDomainRecord(k, data); err != ErrDomainRecordKey {
+		t.Fatalf("expected ErrDomainRecordKey, got %v", err)
+	}
+	if err := d.PutValue(ctx, k, data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ns.Resolve(ctx, "/domain/acme"); err == nil {
+		t.Fatal("resolved a forged domain record")
+	}
+}
@@ -15,8 +15,9 @@ func TestPathParsing(t *testing.T) {
 		"QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n":                   true,
 		"/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n":                  false,
 		"/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n/a":                false,
-		"/ipfs/": false,
-		"ipfs/":  false,
+		"/ipfs/":              false,
+		"ipfs/":               false,
+		"/domain/example/a/b": true,
 		"ipfs/QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n": false,
 	}
 
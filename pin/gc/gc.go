@@ -1,6 +1,9 @@
 package gc
 
 import (
+	"sort"
+	"time"
+
 	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
 	bserv "github.com/ipfs/go-ipfs/blockservice"
 	offline "github.com/ipfs/go-ipfs/exchange/offline"
@@ -27,8 +30,7 @@ var log = logging.Logger("gc")
 func GC(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRoots []*cid.Cid) (<-chan key.Key, error) {
 	unlocker := bs.GCLock()
 
-	bsrv := bserv.New(bs, offline.Exchange(bs))
-	ds := dag.NewDAGService(bsrv)
+	ds := peekingDAG(bs)
 
 	gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots)
 	if err != nil {
@@ -71,6 +73,117 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRo
 	return output, nil
 }
 
+// Evict performs a garbage collection like GC, but removes the unmarked
+// blocks least recently used first according to lastAccess, and stops as
+// soon as enough returns true. Blocks without an access time go first.
+func Evict(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRoots []*cid.Cid, lastAccess func(key.Key) time.Time, enough func() (bool, error)) (<-chan key.Key, error) {
+	unlocker := bs.GCLock()
+
+	ds := peekingDAG(bs)
+
+	gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots)
+	if err != nil {
+		unlocker.Unlock()
+		return nil, err
+	}
+
+	keychan, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		unlocker.Unlock()
+		return nil, err
+	}
+
+	var candidates byAccess
+	for k := range keychan {
+		if !gcs.Has(k) {
+			candidates = append(candidates, accessed{k: k, t: lastAccess(k)})
+		}
+	}
+	sort.Sort(candidates)
+
+	output := make(chan key.Key)
+	go func() {
+		defer close(output)
+		defer unlocker.Unlock()
+		for _, c := range candidates {
+			done, err := enough()
+			if err != nil {
+				log.Errorf("Error checking the storage usage: %s", err)
+				return
+			}
+			if done {
+				return
+			}
+
+			if err := bs.DeleteBlock(c.k); err != nil {
+				log.Debugf("Error removing key from blockstore: %s", err)
+				return
+			}
+			select {
+			case output <- c.k:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+type accessed struct {
+	k key.Key
+	t time.Time
+}
+
+type byAccess []accessed
+
+func (a byAccess) Len() int      { return len(a) }
+func (a byAccess) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byAccess) Less(i, j int) bool {
+	if !a[i].t.Equal(a[j].t) {
+		return a[i].t.Before(a[j].t)
+	}
+	return a[i].k < a[j].k
+}
+
+// Unmarked lists the blocks GC would remove, without removing them. It
+// holds the pin lock until the list is done, so that no GC runs meanwhile.
+func Unmarked(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRoots []*cid.Cid) (<-chan key.Key, error) {
+	unlocker := bs.PinLock()
+
+	ds := peekingDAG(bs)
+
+	gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots)
+	if err != nil {
+		unlocker.Unlock()
+		return nil, err
+	}
+
+	keychan, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		unlocker.Unlock()
+		return nil, err
+	}
+
+	output := make(chan key.Key)
+	go func() {
+		defer close(output)
+		defer unlocker.Unlock()
+		for k := range keychan {
+			if gcs.Has(k) {
+				continue
+			}
+			select {
+			case output <- k:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
 func Descendants(ctx context.Context, ds dag.DAGService, set key.KeySet, roots []*cid.Cid, bestEffort bool) error {
 	for _, c := range roots {
 		set.Add(key.Key(c.Hash()))
@@ -122,3 +235,11 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ds dag.DAGService, bestEffor
 
 	return gcs, nil
 }
+
+// peekingDAG returns a DAGService reading the blocks of bs without
+// counting them as used, so that marking does not move cold blocks to the
+// hot tier nor refresh their access times.
+func peekingDAG(bs bstore.GCBlockstore) dag.DAGService {
+	pbs := bstore.NewPeekingBlockstore(bs)
+	return dag.NewDAGService(bserv.New(pbs, offline.Exchange(pbs)))
+}
@@ -0,0 +1,92 @@
+package gc
+
+import (
+	"testing"
+	"time"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+func TestUnmarkedRemovesNothing(t *testing.T) {
+	r := newTestRepo()
+	pinned, err := r.addPinned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := r.add(t, randNode())
+
+	unmarked, err := Unmarked(context.Background(), r.bs, r.pn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[key.Key]bool)
+	for k := range unmarked {
+		found[k] = true
+	}
+
+	if !found[key.Key(garbage.Hash())] {
+		t.Fatal("the unpinned block should be listed")
+	}
+	if found[key.Key(pinned.Cid().Hash())] {
+		t.Fatal("the pinned block should not be listed")
+	}
+	r.expectHas(t, garbage, true)
+
+	// the pin lock is released once the list is done
+	r.bs.GCLock().Unlock()
+}
+
+func TestEvictOldestFirst(t *testing.T) {
+	r := newTestRepo()
+	pinned, err := r.addPinned()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the garbage was used in this order, the pinned block long ago
+	var garbage []*cid.Cid
+	access := make(map[key.Key]time.Time)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		c := r.add(t, randNode())
+		garbage = append(garbage, c)
+		access[key.Key(c.Hash())] = start.Add(time.Duration(i) * time.Minute)
+	}
+	access[key.Key(pinned.Cid().Hash())] = start.Add(-time.Hour)
+	lastAccess := func(k key.Key) time.Time {
+		return access[k]
+	}
+
+	// stop once two blocks are gone
+	enough := func() (bool, error) {
+		left := 0
+		for _, c := range garbage {
+			has, err := r.bs.Has(key.Key(c.Hash()))
+			if err != nil {
+				return false, err
+			}
+			if has {
+				left++
+			}
+		}
+		return left == 3, nil
+	}
+	rmed, err := Evict(context.Background(), r.bs, r.pn, nil, lastAccess, enough)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var removed []key.Key
+	for k := range rmed {
+		removed = append(removed, k)
+	}
+
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 blocks evicted, got %d", len(removed))
+	}
+	for i, c := range garbage {
+		r.expectHas(t, c, i >= 2)
+	}
+	r.expectHas(t, pinned.Cid(), true)
+}
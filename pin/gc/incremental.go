@@ -0,0 +1,226 @@
+package gc
+
+import (
+	"errors"
+
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	pin "github.com/ipfs/go-ipfs/pin"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+// DefaultSweepBatch is the number of blocks an incremental GC removes at
+// once while holding the GC lock.
+var DefaultSweepBatch = 1024
+
+// ErrNoBarrier is returned by Incremental for blockstores without a write
+// barrier.
+var ErrNoBarrier = errors.New("gc: the blockstore has no write barrier, incremental GC is not possible")
+
+// The phases of an incremental GC.
+const (
+	PhaseMark  = "mark"
+	PhaseSweep = "sweep"
+)
+
+// Progress reports the state of an incremental GC.
+type Progress struct {
+	Phase string
+
+	// Marked is the number of blocks found to be kept, Scanned the number
+	// of blocks the sweep went through.
+	Marked  int
+	Scanned int
+
+	// Removed are the blocks removed by the last sweep batch.
+	Removed []key.Key
+
+	// Err ends the collection.
+	Err error
+}
+
+// Incremental performs a garbage collection that does not stop adds and
+// pins for its whole length. The blocks to keep are marked without any
+// lock, from the same roots as GC. Blocks put during the collection are
+// recorded by the write barrier of bs, and never removed.
+//
+// The sweep then removes unmarked blocks in batches of batchSize. Each
+// batch holds the GC lock, and first marks the roots that were pinned or
+// written since the collection started, so that operations holding the pin
+// lock complete between batches. bestEffortRoots is called for every batch,
+// as the roots may change during the collection.
+func Incremental(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRoots func() ([]*cid.Cid, error), batchSize int) (<-chan *Progress, error) {
+	bbs, ok := bs.(*bstore.BarrierBlockstore)
+	if !ok {
+		return nil, ErrNoBarrier
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultSweepBatch
+	}
+	if err := bbs.StartBarrier(); err != nil {
+		return nil, err
+	}
+
+	out := make(chan *Progress)
+	go func() {
+		defer close(out)
+		defer bbs.StopBarrier()
+
+		send := func(p *Progress) bool {
+			select {
+			case out <- p:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		g := &incremental{
+			bs:     bbs,
+			pn:     pn,
+			ds:     peekingDAG(bbs),
+			roots:  bestEffortRoots,
+			marked: key.NewKeySet(),
+		}
+		if err := g.remark(ctx); err != nil {
+			send(&Progress{Phase: PhaseMark, Err: err})
+			return
+		}
+		if !send(&Progress{Phase: PhaseMark, Marked: g.count}) {
+			return
+		}
+
+		keys, err := bbs.AllKeysChan(ctx)
+		if err != nil {
+			send(&Progress{Phase: PhaseSweep, Err: err})
+			return
+		}
+
+		var scanned int
+		batch := make([]key.Key, 0, batchSize)
+		for {
+			k, more := <-keys
+			if more {
+				scanned++
+				if !g.marked.Has(k) {
+					batch = append(batch, k)
+				}
+				if len(batch) < batchSize {
+					continue
+				}
+			}
+
+			if len(batch) > 0 {
+				removed, err := g.sweep(ctx, batch)
+				p := &Progress{
+					Phase:   PhaseSweep,
+					Marked:  g.count,
+					Scanned: scanned,
+					Removed: removed,
+					Err:     err,
+				}
+				if !send(p) || err != nil {
+					return
+				}
+				batch = batch[:0]
+			}
+			if !more {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+type incremental struct {
+	bs     *bstore.BarrierBlockstore
+	pn     pin.Pinner
+	ds     dag.DAGService
+	roots  func() ([]*cid.Cid, error)
+	marked key.KeySet
+	count  int
+}
+
+// sweep removes the blocks of batch that are still garbage.
+func (g *incremental) sweep(ctx context.Context, batch []key.Key) ([]key.Key, error) {
+	unlocker := g.bs.GCLock()
+	defer unlocker.Unlock()
+
+	if err := g.remark(ctx); err != nil {
+		return nil, err
+	}
+
+	var removed []key.Key
+	for _, k := range batch {
+		if g.marked.Has(k) {
+			continue
+		}
+		ok, err := g.bs.DeleteUnwritten(k)
+		if err != nil {
+			log.Debugf("Error removing key from blockstore: %s", err)
+			return removed, err
+		}
+		if ok {
+			removed = append(removed, k)
+		}
+	}
+	return removed, nil
+}
+
+// remark marks the blocks kept by roots that are not marked yet. The
+// descendants of marked blocks are marked already, so this only walks the
+// parts of the graph that changed since the last call.
+func (g *incremental) remark(ctx context.Context) error {
+	if err := g.mark(ctx, g.pn.RecursiveKeys(), false); err != nil {
+		return err
+	}
+
+	roots, err := g.roots()
+	if err != nil {
+		return err
+	}
+	if err := g.mark(ctx, roots, true); err != nil {
+		return err
+	}
+
+	for _, c := range g.pn.DirectKeys() {
+		if k := key.Key(c.Hash()); !g.marked.Has(k) {
+			g.marked.Add(k)
+			g.count++
+		}
+	}
+
+	return g.mark(ctx, g.pn.InternalPins(), false)
+}
+
+func (g *incremental) mark(ctx context.Context, roots []*cid.Cid, bestEffort bool) error {
+	visit := func(c *cid.Cid) bool {
+		k := key.Key(c.Hash())
+		if g.marked.Has(k) {
+			return false
+		}
+		g.marked.Add(k)
+		g.count++
+		return true
+	}
+
+	for _, c := range roots {
+		if !visit(c) {
+			continue
+		}
+		nd, err := g.ds.Get(ctx, c)
+		if err == dag.ErrNotFound && bestEffort {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := dag.EnumerateChildren(ctx, g.ds, nd, visit, bestEffort); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package gc
+
+import (
+	"testing"
+	"time"
+
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	bserv "github.com/ipfs/go-ipfs/blockservice"
+	offline "github.com/ipfs/go-ipfs/exchange/offline"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	pin "github.com/ipfs/go-ipfs/pin"
+
+	"gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dssync "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/sync"
+	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+type testRepo struct {
+	bs    *bstore.BarrierBlockstore
+	dserv dag.DAGService
+	pn    pin.Pinner
+}
+
+func newTestRepo() *testRepo {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewBarrierBlockstore(bstore.NewBlockstore(dstore))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	return &testRepo{bs: bs, dserv: dserv, pn: pin.NewPinner(dstore, dserv, dserv)}
+}
+
+func randNode() *dag.Node {
+	nd := new(dag.Node)
+	nd.SetData(make([]byte, 32))
+	util.NewTimeSeededRand().Read(nd.Data())
+	return nd
+}
+
+func (r *testRepo) add(t *testing.T, nd *dag.Node) *cid.Cid {
+	c, err := r.dserv.Add(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// addPinned adds a node with a child and pins it, as ipfs add does.
+func (r *testRepo) addPinned() (*dag.Node, error) {
+	defer r.bs.PinLock().Unlock()
+
+	child := randNode()
+	if _, err := r.dserv.Add(child); err != nil {
+		return nil, err
+	}
+	parent := randNode()
+	if err := parent.AddNodeLink("child", child); err != nil {
+		return nil, err
+	}
+	if _, err := r.dserv.Add(parent); err != nil {
+		return nil, err
+	}
+
+	if err := r.pn.Pin(context.Background(), parent, true); err != nil {
+		return nil, err
+	}
+	return parent, r.pn.Flush()
+}
+
+func (r *testRepo) expectHas(t *testing.T, c *cid.Cid, has bool) {
+	ok, err := r.bs.Has(key.Key(c.Hash()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != has {
+		t.Fatalf("block %s: expected present=%t", c, has)
+	}
+}
+
+func noRoots() ([]*cid.Cid, error) {
+	return nil, nil
+}
+
+func TestIncrementalRemovesGarbage(t *testing.T) {
+	r := newTestRepo()
+	pinned, err := r.addPinned()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var garbage []*cid.Cid
+	for i := 0; i < 5; i++ {
+		garbage = append(garbage, r.add(t, randNode()))
+	}
+
+	progress, err := Incremental(context.Background(), r.bs, r.pn, noRoots, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var removed int
+	for p := range progress {
+		if p.Err != nil {
+			t.Fatal(p.Err)
+		}
+		removed += len(p.Removed)
+	}
+
+	if removed < len(garbage) {
+		t.Fatalf("expected at least %d blocks removed, got %d", len(garbage), removed)
+	}
+	for _, c := range garbage {
+		r.expectHas(t, c, false)
+	}
+	r.expectHas(t, pinned.Cid(), true)
+	r.expectHas(t, cid.NewCidV0(pinned.Links[0].Hash), true)
+}
+
+func TestAddDuringIncrementalGC(t *testing.T) {
+	r := newTestRepo()
+
+	var garbage []*cid.Cid
+	for i := 0; i < 10; i++ {
+		garbage = append(garbage, r.add(t, randNode()))
+	}
+
+	progress, err := Incremental(context.Background(), r.bs, r.pn, noRoots, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the first sweep batch, the GC is now half way
+	for p := range progress {
+		if p.Err != nil {
+			t.Fatal(p.Err)
+		}
+		if p.Phase == PhaseSweep {
+			break
+		}
+	}
+
+	// adds, pins and puts must complete while the GC has not finished.
+	done := make(chan error)
+	var added *dag.Node
+	go func() {
+		var err error
+		added, err = r.addPinned()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("an add was blocked by the GC")
+	}
+
+	unpinned := r.add(t, randNode())
+	reput := garbage[len(garbage)-1]
+	b, err := r.dserv.Get(context.Background(), reput)
+	if err == nil {
+		// the block was not swept yet, store it again
+		r.add(t, b)
+	} else {
+		reput = nil
+	}
+
+	lastPinned := garbage[len(garbage)-2]
+	pinnedLate := true
+	func() {
+		defer r.bs.PinLock().Unlock()
+		nd, err := r.dserv.Get(context.Background(), lastPinned)
+		if err != nil {
+			pinnedLate = false
+			return
+		}
+		r.pn.PinWithMode(nd.Cid(), pin.Direct)
+		if err := r.pn.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for p := range progress {
+		if p.Err != nil {
+			t.Fatal(p.Err)
+		}
+	}
+
+	r.expectHas(t, added.Cid(), true)
+	r.expectHas(t, cid.NewCidV0(added.Links[0].Hash), true)
+	r.expectHas(t, unpinned, true)
+	if reput != nil {
+		r.expectHas(t, reput, true)
+	}
+	if pinnedLate {
+		r.expectHas(t, lastPinned, true)
+	}
+	r.expectHas(t, garbage[0], false)
+}
+
+func TestIncrementalNeedsBarrier(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewBlockstore(dstore)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	_, err := Incremental(context.Background(), bs, pin.NewPinner(dstore, dserv, dserv), noRoots, 0)
+	if err != ErrNoBarrier {
+		t.Fatalf("expected ErrNoBarrier, got %v", err)
+	}
+}
+
+func TestOneIncrementalAtATime(t *testing.T) {
+	r := newTestRepo()
+	r.add(t, randNode())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	progress, err := Incremental(ctx, r.bs, r.pn, noRoots, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Incremental(ctx, r.bs, r.pn, noRoots, 0); err != bstore.ErrBarrierActive {
+		t.Fatalf("expected ErrBarrierActive, got %v", err)
+	}
+
+	for range progress {
+	}
+}
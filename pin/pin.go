@@ -21,6 +21,9 @@ var log = logging.Logger("pin")
 
 var pinDatastoreKey = ds.NewKey("/local/pins")
 
+// linkInfos is the link of the pin state root to the pin infos.
+const linkInfos = "infos"
+
 var emptyKey *cid.Cid
 
 func init() {
@@ -80,6 +83,61 @@ func StringToPinMode(s string) (PinMode, bool) {
 	return mode, ok
 }
 
+// PinInfo describes a recursive or direct pin, so that operators can tell
+// why something is pinned.
+type PinInfo struct {
+	Name   string            `json:",omitempty"`
+	Labels map[string]string `json:",omitempty"`
+
+	// Expires is when a recursive pin expires, in unix seconds. Pins
+	// without it never expire.
+	Expires int64 `json:",omitempty"`
+}
+
+// Limits of a PinInfo, so that any info fits in the nodes the pin infos
+// are stored in.
+const (
+	MaxInfoNameLen  = 256
+	MaxInfoLabels   = 32
+	MaxInfoLabelLen = 256
+)
+
+// Validate checks that info is within the limits above.
+func (info PinInfo) Validate() error {
+	if len(info.Name) > MaxInfoNameLen {
+		return fmt.Errorf("pin name is longer than %d bytes", MaxInfoNameLen)
+	}
+	if len(info.Labels) > MaxInfoLabels {
+		return fmt.Errorf("pin has more than %d labels", MaxInfoLabels)
+	}
+	for k, v := range info.Labels {
+		if len(k) > MaxInfoLabelLen || len(v) > MaxInfoLabelLen {
+			return fmt.Errorf("pin label '%s' is longer than %d bytes", k, MaxInfoLabelLen)
+		}
+	}
+	return nil
+}
+
+// Empty returns true if info has no name, labels or expiry.
+func (info PinInfo) Empty() bool {
+	return info.Name == "" && len(info.Labels) == 0 && info.Expires == 0
+}
+
+// Expired returns true if the pin expired at now.
+func (info PinInfo) Expired(now time.Time) bool {
+	return info.Expires != 0 && info.Expires <= now.Unix()
+}
+
+// HasLabels returns true if info has all the given labels.
+func (info PinInfo) HasLabels(labels map[string]string) bool {
+	for k, v := range labels {
+		if lv, ok := info.Labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
 type Pinner interface {
 	IsPinned(*cid.Cid) (string, bool, error)
 	IsPinnedWithType(*cid.Cid, PinMode) (string, bool, error)
@@ -99,6 +157,12 @@ type Pinner interface {
 	// be successful.
 	RemovePinWithMode(*cid.Cid, PinMode)
 
+	// SetInfo replaces the info of a recursive or direct pin. The info
+	// is removed with the pin, and must pass PinInfo.Validate.
+	SetInfo(*cid.Cid, PinInfo) error
+	// Info returns the info of a pin, and false if it has none.
+	Info(*cid.Cid) (PinInfo, bool)
+
 	Flush() error
 	DirectKeys() []*cid.Cid
 	RecursiveKeys() []*cid.Cid
@@ -143,6 +207,9 @@ type pinner struct {
 	dserv       mdag.DAGService
 	internal    mdag.DAGService // dagservice used to store internal objects
 	dstore      ds.Datastore
+
+	// infos are the names and labels of pins, by cid string.
+	infos map[string]PinInfo
 }
 
 // NewPinner creates a new pinner using the given datastore as a backend
@@ -158,6 +225,7 @@ func NewPinner(dstore ds.Datastore, serv, internal mdag.DAGService) Pinner {
 		dstore:      dstore,
 		internal:    internal,
 		internalPin: cid.NewSet(),
+		infos:       make(map[string]PinInfo),
 	}
 }
 
@@ -215,12 +283,14 @@ func (p *pinner) Unpin(ctx context.Context, c *cid.Cid, recursive bool) error {
 	case "recursive":
 		if recursive {
 			p.recursePin.Remove(c)
+			delete(p.infos, c.String())
 			return nil
 		} else {
 			return fmt.Errorf("%s is pinned recursively", c)
 		}
 	case "direct":
 		p.directPin.Remove(c)
+		delete(p.infos, c.String())
 		return nil
 	default:
 		return fmt.Errorf("%s is pinned indirectly under %s", c, reason)
@@ -372,6 +442,44 @@ func (p *pinner) RemovePinWithMode(c *cid.Cid, mode PinMode) {
 		// programmer error, panic OK
 		panic("unrecognized pin type")
 	}
+	if !p.recursePin.Has(c) && !p.directPin.Has(c) {
+		delete(p.infos, c.String())
+	}
+}
+
+func (p *pinner) SetInfo(c *cid.Cid, info PinInfo) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.recursePin.Has(c) && !p.directPin.Has(c) {
+		return ErrNotPinned
+	}
+	if err := info.Validate(); err != nil {
+		return err
+	}
+	if info.Empty() {
+		delete(p.infos, c.String())
+	} else {
+		p.infos[c.String()] = info
+	}
+	return nil
+}
+
+func (p *pinner) Info(c *cid.Cid) (PinInfo, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	info, ok := p.infos[c.String()]
+	return info, ok
+}
+
+// ExpiredPins returns the recursive pins of p that expired at now.
+func ExpiredPins(p Pinner, now time.Time) []*cid.Cid {
+	var out []*cid.Cid
+	for _, c := range p.RecursiveKeys() {
+		if info, ok := p.Info(c); ok && info.Expired(now) {
+			out = append(out, c)
+		}
+	}
+	return out
 }
 
 func cidSetWithValues(cids []*cid.Cid) *cid.Set {
@@ -428,6 +536,14 @@ func LoadPinner(d ds.Datastore, dserv, internal mdag.DAGService) (Pinner, error)
 		p.directPin = cidSetWithValues(directKeys)
 	}
 
+	{ // load pin infos
+		infos, err := loadInfos(ctx, internal, root, linkInfos, recordInternal)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load pin infos: %v", err)
+		}
+		p.infos = infos
+	}
+
 	p.internalPin = internalset
 
 	// assign services
@@ -479,6 +595,16 @@ func (p *pinner) Flush() error {
 		}
 	}
 
+	{
+		n, err := storeInfos(ctx, p.internal, p.infos, recordInternal)
+		if err != nil {
+			return err
+		}
+		if err := root.AddNodeLink(linkInfos, n); err != nil {
+			return err
+		}
+	}
+
 	// add the empty node, its referenced by the pin sets but never created
 	_, err := p.internal.Add(new(mdag.Node))
 	if err != nil {
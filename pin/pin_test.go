@@ -1,6 +1,8 @@
 package pin
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -232,3 +234,176 @@ func TestPinRecursiveFail(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPinInfo(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv, dserv)
+
+	a, ak := randNode()
+	if _, err := dserv.Add(a); err != nil {
+		t.Fatal(err)
+	}
+	_, bk := randNode()
+
+	if err := p.SetInfo(bk, PinInfo{Name: "b"}); err != ErrNotPinned {
+		t.Fatalf("expected ErrNotPinned, got %v", err)
+	}
+
+	if err := p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	info := PinInfo{
+		Name:   "dataset",
+		Labels: map[string]string{"owner": "alice", "ticket": "OPS-12"},
+	}
+	if err := p.SetInfo(ak, info); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := np.Info(ak)
+	if !ok {
+		t.Fatal("pin info was not persisted")
+	}
+	if got.Name != info.Name || !got.HasLabels(info.Labels) || len(got.Labels) != len(info.Labels) {
+		t.Fatalf("expected %v, got %v", info, got)
+	}
+	if got.HasLabels(map[string]string{"owner": "bob"}) {
+		t.Fatal("labels should not match")
+	}
+
+	if err := np.Unpin(ctx, ak, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := np.Info(ak); ok {
+		t.Fatal("pin info should be removed with the pin")
+	}
+}
+
+func TestLoadInfosWithoutLink(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	dserv := mdag.NewDAGService(bs.New(bstore, offline.Exchange(bstore)))
+
+	// pin states written before pins had infos have no infos link
+	infos, err := loadInfos(context.Background(), dserv, new(mdag.Node), linkInfos, func(*cid.Cid) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Fatalf("expected no infos, got %d", len(infos))
+	}
+}
+
+func TestPinInfoLimits(t *testing.T) {
+	long := strings.Repeat("x", MaxInfoLabelLen+1)
+	for _, info := range []PinInfo{
+		{Name: strings.Repeat("x", MaxInfoNameLen+1)},
+		{Labels: map[string]string{long: "v"}},
+		{Labels: map[string]string{"k": long}},
+	} {
+		if info.Validate() == nil {
+			t.Fatalf("expected %v to be rejected", info)
+		}
+	}
+
+	labels := make(map[string]string)
+	for i := 0; i <= MaxInfoLabels; i++ {
+		labels[fmt.Sprint(i)] = "v"
+	}
+	if (PinInfo{Labels: labels}).Validate() == nil {
+		t.Fatal("expected too many labels to be rejected")
+	}
+}
+
+func TestStoreInfosSplitsBySize(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	dserv := mdag.NewDAGService(bs.New(bstore, offline.Exchange(bstore)))
+
+	// the largest infos allowed.
+	labels := make(map[string]string)
+	for i := 0; i < MaxInfoLabels; i++ {
+		k := fmt.Sprintf("%03d", i)
+		labels[k+strings.Repeat("k", MaxInfoLabelLen-len(k))] = strings.Repeat("v", MaxInfoLabelLen)
+	}
+	infos := make(map[string]PinInfo)
+	for i := 0; i < 64; i++ {
+		_, c := randNode()
+		infos[c.String()] = PinInfo{Name: strings.Repeat("n", MaxInfoNameLen), Labels: labels}
+	}
+
+	root, err := storeInfos(ctx, dserv, infos, func(*cid.Cid) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Links) < 2 {
+		t.Fatalf("expected the infos to be split, got %d nodes", len(root.Links))
+	}
+	for _, l := range root.Links {
+		if l.Size > 2*infoNodeSize {
+			t.Fatalf("info node of %d bytes is too large", l.Size)
+		}
+	}
+
+	parent := new(mdag.Node)
+	if err := parent.AddNodeLinkClean(linkInfos, root); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadInfos(ctx, dserv, parent, linkInfos, func(*cid.Cid) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(infos) {
+		t.Fatalf("expected %d infos, got %d", len(infos), len(loaded))
+	}
+}
+
+func TestExpiredPins(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	dserv := mdag.NewDAGService(bs.New(bstore, offline.Exchange(bstore)))
+	p := NewPinner(dstore, dserv, dserv)
+
+	now := time.Now()
+	_, expired := randNode()
+	_, later := randNode()
+	_, never := randNode()
+	_, direct := randNode()
+	p.PinWithMode(expired, Recursive)
+	p.PinWithMode(later, Recursive)
+	p.PinWithMode(never, Recursive)
+	p.PinWithMode(direct, Direct)
+
+	if err := p.SetInfo(expired, PinInfo{Expires: now.Add(-time.Minute).Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetInfo(later, PinInfo{Expires: now.Add(time.Hour).Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetInfo(never, PinInfo{Name: "never"}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := ExpiredPins(p, now)
+	if len(out) != 1 || !out[0].Equals(expired) {
+		t.Fatalf("expected only %s to be expired, got %v", expired, out)
+	}
+
+	out = ExpiredPins(p, now.Add(2*time.Hour))
+	if len(out) != 2 {
+		t.Fatalf("expected 2 expired pins, got %d", len(out))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"hash/fnv"
@@ -325,3 +326,90 @@ func copyRefcounts(orig map[key.Key]uint64) map[key.Key]uint64 {
 	}
 	return r
 }
+
+// infoNodeSize is the size above which the pin infos are split into
+// another node. PinInfo.Validate bounds the size of a single info, so the
+// nodes stay well under the block size limit.
+const infoNodeSize = 256 * 1024
+
+// storeInfos stores the pin infos as JSON, in child nodes of the returned
+// node holding about infoNodeSize bytes of infos each, sorted by cid.
+func storeInfos(ctx context.Context, dag merkledag.DAGService, infos map[string]PinInfo, internalKeys keyObserver) (*merkledag.Node, error) {
+	keys := make([]string, 0, len(infos))
+	for k := range infos {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	n := new(merkledag.Node)
+	for len(keys) > 0 {
+		m := make(map[string]PinInfo)
+		var size int
+		for len(keys) > 0 && size < infoNodeSize {
+			k := keys[0]
+			data, err := json.Marshal(infos[k])
+			if err != nil {
+				return nil, err
+			}
+			size += len(k) + len(data)
+			m[k] = infos[k]
+			keys = keys[1:]
+		}
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		child := new(merkledag.Node)
+		child.SetData(data)
+		c, err := dag.Add(child)
+		if err != nil {
+			return nil, err
+		}
+		internalKeys(c)
+		if err := n.AddNodeLinkClean("", child); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := dag.Add(n)
+	if err != nil {
+		return nil, err
+	}
+	internalKeys(c)
+	return n, nil
+}
+
+// loadInfos loads the pin infos stored by storeInfos under the link name
+// of root. Pin states written before pins had infos have no such link.
+func loadInfos(ctx context.Context, dag merkledag.DAGService, root *merkledag.Node, name string, internalKeys keyObserver) (map[string]PinInfo, error) {
+	infos := make(map[string]PinInfo)
+	l, err := root.GetNodeLink(name)
+	if err == merkledag.ErrLinkNotFound {
+		return infos, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	internalKeys(cid.NewCidV0(l.Hash))
+
+	n, err := l.GetNode(ctx, dag)
+	if err != nil {
+		return nil, err
+	}
+	for _, cl := range n.Links {
+		internalKeys(cid.NewCidV0(cl.Hash))
+		child, err := cl.GetNode(ctx, dag)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]PinInfo
+		if err := json.Unmarshal(child.Data(), &m); err != nil {
+			return nil, err
+		}
+		for k, info := range m {
+			infos[k] = info
+		}
+	}
+	return infos, nil
+}
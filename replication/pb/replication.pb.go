@@ -0,0 +1,59 @@
+// Code generated by protoc-gen-gogo.
+// source: replication.proto
+// DO NOT EDIT!
+
+/*
+Package replication_pb is a generated protocol buffer package.
+
+It is generated from these files:
+	replication.proto
+
+It has these top-level messages:
+	Request
+	Response
+*/
+package replication_pb
+
+import proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+// Request asks a peer to recursively pin an object.
+type Request struct {
+	Cid              *string `protobuf:"bytes,1,opt,name=cid" json:"cid,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Request) Reset()         { *m = Request{} }
+func (m *Request) String() string { return proto.CompactTextString(m) }
+func (*Request) ProtoMessage()    {}
+
+func (m *Request) GetCid() string {
+	if m != nil && m.Cid != nil {
+		return *m.Cid
+	}
+	return ""
+}
+
+// Response reports the outcome of a Request. error is empty on success.
+type Response struct {
+	Error            *string `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Response) Reset()         { *m = Response{} }
+func (m *Response) String() string { return proto.CompactTextString(m) }
+func (*Response) ProtoMessage()    {}
+
+func (m *Response) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+func init() {
+}
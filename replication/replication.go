@@ -0,0 +1,475 @@
+// Package replication keeps a minimum number of recursive pins of an
+// object among the members of a domain.
+//
+// A replication target (an object and a factor N) is stored in the repo
+// datastore. The Replicator compares each target with the inventory of
+// the domain, and asks connected members that do not hold the object yet
+// to pin it over the replication protocol, until N live members hold a
+// recursive pin. Members that disconnect no longer count as holders, so
+// the object is re-replicated when a holder disappears.
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	inventory "github.com/ipfs/go-ipfs/inventory"
+	pb "github.com/ipfs/go-ipfs/replication/pb"
+
+	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	host "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	inet "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/net"
+	protocol "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/protocol"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+	ctxio "gx/ipfs/QmX6DhWrpBB5NtadXmPSXYNdVvuLfJXoFNMvUMoVvP5UJa/go-context/io"
+	ma "gx/ipfs/QmYzDkkgAEmrcNzFCiYo6L1dTX4EAG1gZkbtdbd9trL4vd/go-multiaddr"
+	ggio "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/io"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dsq "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/query"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+var log = logging.Logger("replication")
+
+// ProtocolReplicate is the replication protocol.ID
+var ProtocolReplicate protocol.ID = "/ipfs/replicate/1.0.0"
+
+// ReconcileInterval is how often all targets are checked.
+var ReconcileInterval = time.Minute * 5
+
+// PinTimeout bounds how long we wait for a peer to pin an object, which
+// includes fetching it.
+var PinTimeout = time.Minute * 30
+
+var targetsPrefix = ds.NewKey("/local/replication/targets")
+
+var ErrNotEnoughPeers = errors.New("not enough domain members to reach the replication factor")
+
+// PinFunc recursively pins c on the local node, fetching it if needed.
+type PinFunc func(ctx context.Context, c *cid.Cid) error
+
+// Status describes the replication of an object.
+type Status struct {
+	Cid     string
+	Factor  int
+	Holders []string // live members holding a recursive pin
+}
+
+// Replicator enforces the replication targets of the local node and pins
+// objects on behalf of other members.
+type Replicator struct {
+	host    host.Host
+	dstore  ds.Datastore
+	inv     *inventory.Inventory
+	syncer  *inventory.Syncer
+	members func() []peer.ID
+	pin     PinFunc
+
+	// asked lists, by object, the peers a round is asking to pin it, so
+	// that concurrent rounds do not ask the same peers twice.
+	lk    sync.Mutex
+	asked map[string]map[peer.ID]struct{}
+
+	kick chan struct{}
+}
+
+// New creates a Replicator and serves replication requests on h. members
+// lists the live members of the domain. syncer may be nil; when set, the
+// inventory of a peer is pulled right after it pinned an object for us.
+func New(h host.Host, d ds.Datastore, inv *inventory.Inventory, syncer *inventory.Syncer, members func() []peer.ID, pin PinFunc) *Replicator {
+	r := &Replicator{
+		host:    h,
+		dstore:  d,
+		inv:     inv,
+		syncer:  syncer,
+		members: members,
+		pin:     pin,
+		asked:   make(map[string]map[peer.ID]struct{}),
+		kick:    make(chan struct{}, 1),
+	}
+	h.SetStreamHandler(ProtocolReplicate, r.handleNewStream)
+	h.Network().Notify((*netNotifiee)(r))
+	return r
+}
+
+// Replicate sets the replication factor of c and replicates it right away.
+// The local node pins c first. A factor of zero removes the target, but
+// leaves the existing pins alone.
+func (r *Replicator) Replicate(ctx context.Context, c *cid.Cid, factor int) (*Status, error) {
+	k := targetsPrefix.ChildString(c.String())
+	switch {
+	case factor < 0:
+		return nil, fmt.Errorf("invalid replication factor: %d", factor)
+	case factor == 0:
+		if err := r.dstore.Delete(k); err != nil && err != ds.ErrNotFound {
+			return nil, err
+		}
+		return r.Status(c, 0)
+	}
+
+	if err := r.dstore.Put(k, []byte(strconv.Itoa(factor))); err != nil {
+		return nil, err
+	}
+
+	if err := r.pin(ctx, c); err != nil {
+		return nil, err
+	}
+	return r.reconcile(ctx, c, factor)
+}
+
+// Targets returns the status of all replication targets.
+func (r *Replicator) Targets() ([]*Status, error) {
+	targets, err := r.targets()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*Status
+	for _, t := range targets {
+		st, err := r.Status(t.c, t.factor)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// Status reports how many live members hold c.
+func (r *Replicator) Status(c *cid.Cid, factor int) (*Status, error) {
+	holders, err := r.holders(c)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &Status{Cid: c.String(), Factor: factor}
+	for p := range holders {
+		st.Holders = append(st.Holders, p.Pretty())
+	}
+	sort.Strings(st.Holders)
+	return st, nil
+}
+
+// Run reconciles all targets every ReconcileInterval, and whenever a
+// member disconnects, until proc closes.
+func (r *Replicator) Run(proc goprocess.Process) {
+	tick := time.NewTicker(ReconcileInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+		case <-r.kick:
+		case <-proc.Closing():
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-proc.Closing():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		r.ReconcileAll(ctx)
+		cancel()
+	}
+}
+
+// ReconcileAll replicates all targets that are below their factor.
+func (r *Replicator) ReconcileAll(ctx context.Context) {
+	targets, err := r.targets()
+	if err != nil {
+		log.Errorf("failed to load replication targets: %s", err)
+		return
+	}
+
+	for _, t := range targets {
+		if _, err := r.reconcile(ctx, t.c, t.factor); err != nil {
+			log.Warningf("replicating %s: %s", t.c, err)
+		}
+	}
+}
+
+// reconcile asks members to pin c until factor of them hold it. Members
+// that another round is asking to pin c are left out; once they pinned
+// it, they count as holders in the next round.
+func (r *Replicator) reconcile(ctx context.Context, c *cid.Cid, factor int) (*Status, error) {
+	holders, err := r.holders(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(holders) < factor {
+		candidates := r.candidates(c, holders)
+		for len(holders) < factor {
+			var p peer.ID
+			p, candidates = r.claim(c, candidates)
+			if p == "" {
+				break
+			}
+			err := r.pinOn(ctx, p, c)
+			r.release(c, p)
+			if err != nil {
+				log.Debugf("%s did not pin %s: %s", p, c, err)
+				continue
+			}
+			holders[p] = struct{}{}
+		}
+	}
+
+	st := &Status{Cid: c.String(), Factor: factor}
+	for p := range holders {
+		st.Holders = append(st.Holders, p.Pretty())
+	}
+	sort.Strings(st.Holders)
+
+	if len(holders) < factor {
+		return st, fmt.Errorf("%s: %d of %d", ErrNotEnoughPeers, len(holders), factor)
+	}
+	return st, nil
+}
+
+// claim takes the first of candidates that no other round is asking to
+// pin c, marks it as asked, and returns it along with the candidates left
+// after it. It returns the empty ID when there is none.
+func (r *Replicator) claim(c *cid.Cid, candidates []peer.ID) (peer.ID, []peer.ID) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	asked := r.asked[c.String()]
+	for i, p := range candidates {
+		if _, ok := asked[p]; ok {
+			continue
+		}
+		if asked == nil {
+			asked = make(map[peer.ID]struct{})
+			r.asked[c.String()] = asked
+		}
+		asked[p] = struct{}{}
+		return p, candidates[i+1:]
+	}
+	return "", nil
+}
+
+// release undoes claim once p answered.
+func (r *Replicator) release(c *cid.Cid, p peer.ID) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	asked := r.asked[c.String()]
+	delete(asked, p)
+	if len(asked) == 0 {
+		delete(r.asked, c.String())
+	}
+}
+
+// holders returns the live members, including ourselves, known to hold a
+// recursive pin of c.
+func (r *Replicator) holders(c *cid.Cid) (map[peer.ID]struct{}, error) {
+	live := r.live()
+
+	hs, err := r.inv.Where(c)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[peer.ID]struct{})
+	for _, h := range hs {
+		if !h.PinnedRecursively() {
+			continue
+		}
+		p, err := peer.IDB58Decode(h.Peer)
+		if err != nil {
+			continue
+		}
+		if _, ok := live[p]; ok {
+			out[p] = struct{}{}
+		}
+	}
+	return out, nil
+}
+
+// candidates lists the live members that do not hold c yet. Ourselves
+// first, then the members that already have (some of) the blocks.
+func (r *Replicator) candidates(c *cid.Cid, holders map[peer.ID]struct{}) []peer.ID {
+	cached := make(map[string]bool)
+	if hs, err := r.inv.Where(c); err == nil {
+		for _, h := range hs {
+			cached[h.Peer] = true
+		}
+	}
+
+	var out []peer.ID
+	for p := range r.live() {
+		if _, ok := holders[p]; !ok {
+			out = append(out, p)
+		}
+	}
+
+	sort.Sort(&byPreference{peers: out, self: r.host.ID(), cached: cached})
+	return out
+}
+
+type byPreference struct {
+	peers  []peer.ID
+	self   peer.ID
+	cached map[string]bool
+}
+
+func (s *byPreference) Len() int      { return len(s.peers) }
+func (s *byPreference) Swap(i, j int) { s.peers[i], s.peers[j] = s.peers[j], s.peers[i] }
+func (s *byPreference) Less(i, j int) bool {
+	a, b := s.peers[i], s.peers[j]
+	if (a == s.self) != (b == s.self) {
+		return a == s.self
+	}
+	if s.cached[a.Pretty()] != s.cached[b.Pretty()] {
+		return s.cached[a.Pretty()]
+	}
+	return a < b
+}
+
+func (r *Replicator) live() map[peer.ID]struct{} {
+	live := map[peer.ID]struct{}{r.host.ID(): struct{}{}}
+	for _, p := range r.members() {
+		live[p] = struct{}{}
+	}
+	return live
+}
+
+// pinOn asks p to pin c, or pins c locally if p is ourselves.
+func (r *Replicator) pinOn(ctx context.Context, p peer.ID, c *cid.Cid) error {
+	ctx, cancel := context.WithTimeout(ctx, PinTimeout)
+	defer cancel()
+
+	if p == r.host.ID() {
+		return r.pin(ctx, c)
+	}
+
+	s, err := r.host.NewStream(ctx, p, ProtocolReplicate)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	w := ggio.NewDelimitedWriter(ctxio.NewWriter(ctx, s))
+	if err := w.WriteMsg(&pb.Request{Cid: proto.String(c.String())}); err != nil {
+		return err
+	}
+
+	resp := new(pb.Response)
+	rd := ggio.NewDelimitedReader(ctxio.NewReader(ctx, s), inet.MessageSizeMax)
+	if err := rd.ReadMsg(resp); err != nil {
+		return err
+	}
+	if resp.GetError() != "" {
+		return errors.New(resp.GetError())
+	}
+
+	// learn about the new pin now, rather than on the next sync.
+	if r.syncer != nil {
+		if err := r.syncer.SyncPeer(ctx, p); err != nil {
+			log.Debugf("failed to sync inventory with %s: %s", p, err)
+		}
+	}
+	return nil
+}
+
+func (r *Replicator) handleNewStream(s inet.Stream) {
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), PinTimeout)
+	defer cancel()
+
+	req := new(pb.Request)
+	rd := ggio.NewDelimitedReader(ctxio.NewReader(ctx, s), inet.MessageSizeMax)
+	if err := rd.ReadMsg(req); err != nil {
+		log.Debugf("replication: failed to read request: %s", err)
+		return
+	}
+
+	resp := new(pb.Response)
+	c, err := cid.Decode(req.GetCid())
+	if err == nil {
+		log.Infof("pinning %s for %s", c, s.Conn().RemotePeer())
+		err = r.pin(ctx, c)
+	}
+	if err != nil {
+		resp.Error = proto.String(err.Error())
+	}
+
+	w := ggio.NewDelimitedWriter(ctxio.NewWriter(ctx, s))
+	if err := w.WriteMsg(resp); err != nil {
+		log.Debugf("replication: failed to write response: %s", err)
+	}
+}
+
+type target struct {
+	c      *cid.Cid
+	factor int
+}
+
+func (r *Replicator) targets() ([]target, error) {
+	res, err := r.dstore.Query(dsq.Query{Prefix: targetsPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Process().Close()
+
+	var out []target
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+
+		k := ds.NewKey(e.Key)
+		c, err := cid.Decode(k.BaseNamespace())
+		if err != nil {
+			return nil, fmt.Errorf("invalid replication target %s: %s", k, err)
+		}
+
+		b, ok := e.Value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("replication target %s has unexpected type %T", k, e.Value)
+		}
+		factor, err := strconv.Atoi(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("invalid replication target %s: %s", k, err)
+		}
+		out = append(out, target{c, factor})
+	}
+	return out, nil
+}
+
+// netNotifiee triggers a reconciliation round when a peer disconnects.
+type netNotifiee Replicator
+
+func (nn *netNotifiee) replicator() *Replicator {
+	return (*Replicator)(nn)
+}
+
+func (nn *netNotifiee) Disconnected(n inet.Network, v inet.Conn) {
+	r := nn.replicator()
+	if len(n.ConnsToPeer(v.RemotePeer())) > 0 {
+		return
+	}
+	select {
+	case r.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (nn *netNotifiee) Connected(n inet.Network, v inet.Conn)      {}
+func (nn *netNotifiee) OpenedStream(n inet.Network, v inet.Stream) {}
+func (nn *netNotifiee) ClosedStream(n inet.Network, v inet.Stream) {}
+func (nn *netNotifiee) Listen(n inet.Network, a ma.Multiaddr)      {}
+func (nn *netNotifiee) ListenClose(n inet.Network, a ma.Multiaddr) {}
@@ -0,0 +1,253 @@
+package replication
+
+import (
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	inventory "github.com/ipfs/go-ipfs/inventory"
+
+	host "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/host"
+	mocknet "gx/ipfs/QmUuwQUJmtvC6ReYcu7xaYKEUM3pD46H18dFn3LBhVt2Di/go-libp2p/p2p/net/mock"
+	u "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dssync "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/sync"
+	cid "gx/ipfs/QmfSc2xehWmWLnwwYR91Y8QF4xdASypTFVknutoKQS3GHp/go-cid"
+)
+
+type testNode struct {
+	host   host.Host
+	inv    *inventory.Inventory
+	repl   *Replicator
+	lk     sync.Mutex
+	pinned map[string]bool
+
+	// hold delays the pins of the objects it lists until their channel is
+	// closed.
+	hold map[string]chan struct{}
+}
+
+func (tn *testNode) hasPinned(c *cid.Cid) bool {
+	tn.lk.Lock()
+	defer tn.lk.Unlock()
+	return tn.pinned[c.String()]
+}
+
+func genNodes(t *testing.T, ctx context.Context, n int) (mocknet.Mocknet, []*testNode) {
+	mn := mocknet.New(ctx)
+	var nodes []*testNode
+	for i := 0; i < n; i++ {
+		h, err := mn.GenPeer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := dssync.MutexWrap(ds.NewMapDatastore())
+		inv, err := inventory.New(d, h.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tn := &testNode{
+			host:   h,
+			inv:    inv,
+			pinned: make(map[string]bool),
+			hold:   make(map[string]chan struct{}),
+		}
+		pin := func(ctx context.Context, c *cid.Cid) error {
+			if hold, ok := tn.hold[c.String()]; ok {
+				select {
+				case <-hold:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			tn.lk.Lock()
+			tn.pinned[c.String()] = true
+			tn.lk.Unlock()
+			_, err := tn.inv.Record(inventory.Pin, c, "", 0)
+			return err
+		}
+		syncer := inventory.NewSyncer(h, inv, h.Network().Peers)
+		tn.repl = New(h, d, inv, syncer, h.Network().Peers, pin)
+		nodes = append(nodes, tn)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	return mn, nodes
+}
+
+func randCid(t *testing.T) *cid.Cid {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV0(u.Hash(buf))
+}
+
+func countPinned(nodes []*testNode, c *cid.Cid) int {
+	var n int
+	for _, tn := range nodes {
+		if tn.hasPinned(c) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReplicate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, nodes := genNodes(t, ctx, 4)
+	c := randCid(t)
+
+	st, err := nodes[0].repl.Replicate(ctx, c, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Holders) != 3 {
+		t.Fatalf("expected 3 holders, got %v", st.Holders)
+	}
+	if !nodes[0].hasPinned(c) {
+		t.Fatal("replicating should pin the object locally")
+	}
+	if n := countPinned(nodes, c); n != 3 {
+		t.Fatalf("expected the object to be pinned on 3 nodes, got %d", n)
+	}
+
+	// already satisfied, nobody else is asked.
+	nodes[0].repl.ReconcileAll(ctx)
+	if n := countPinned(nodes, c); n != 3 {
+		t.Fatalf("reconciling a satisfied target pinned more copies: %d", n)
+	}
+
+	if _, err := nodes[0].repl.Replicate(ctx, c, 5); err == nil {
+		t.Fatal("expected an error when there are not enough members")
+	}
+}
+
+func TestReplicateAfterHolderLeaves(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	mn, nodes := genNodes(t, ctx, 3)
+	c := randCid(t)
+
+	st, err := nodes[0].repl.Replicate(ctx, c, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var holder, spare *testNode
+	for _, tn := range nodes[1:] {
+		if tn.hasPinned(c) {
+			holder = tn
+		} else {
+			spare = tn
+		}
+	}
+	if holder == nil || spare == nil {
+		t.Fatalf("expected exactly one other holder, got %v", st.Holders)
+	}
+
+	if err := mn.UnlinkPeers(nodes[0].host.ID(), holder.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.DisconnectPeers(nodes[0].host.ID(), holder.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes[0].repl.ReconcileAll(ctx)
+	if !spare.hasPinned(c) {
+		t.Fatal("object was not re-replicated after a holder left")
+	}
+
+	targets, err := nodes[0].repl.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || len(targets[0].Holders) != 2 {
+		t.Fatalf("unexpected targets: %v", targets)
+	}
+
+	if _, err := nodes[0].repl.Replicate(ctx, c, 0); err != nil {
+		t.Fatal(err)
+	}
+	targets, err = nodes[0].repl.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 0 {
+		t.Fatal("a factor of zero should remove the target")
+	}
+}
+
+func TestDirectPinsAreNotReplicas(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, nodes := genNodes(t, ctx, 3)
+	c := randCid(t)
+
+	for _, tn := range nodes[1:] {
+		if _, err := tn.inv.RecordPin(c, false, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := nodes[0].repl.syncer.SyncPeer(ctx, tn.host.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hs, err := nodes[0].inv.Where(c); err != nil || len(hs) != 2 {
+		t.Fatalf("expected the direct pins to be synced, got %v (%v)", hs, err)
+	}
+
+	st, err := nodes[0].repl.Replicate(ctx, c, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Holders) != 3 || countPinned(nodes, c) != 3 {
+		t.Fatalf("members with a direct pin should be asked to pin recursively, got %v", st.Holders)
+	}
+}
+
+func TestReplicateDuringSlowRound(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, nodes := genNodes(t, ctx, 3)
+	slow, fast := randCid(t), randCid(t)
+
+	// a background round waits for nodes[1] to pin slow.
+	hold := make(chan struct{})
+	nodes[1].hold[slow.String()] = hold
+	if err := nodes[0].repl.dstore.Put(targetsPrefix.ChildString(slow.String()), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		nodes[0].repl.ReconcileAll(ctx)
+	}()
+
+	// another object is replicated meanwhile, without nodes[1].
+	st, err := nodes[0].repl.Replicate(ctx, fast, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Holders) != 2 {
+		t.Fatalf("expected 2 holders, got %v", st.Holders)
+	}
+
+	close(hold)
+	<-done
+	if n := countPinned(nodes, slow); n != 3 {
+		t.Fatalf("expected the slow round to pin on 3 nodes, got %d", n)
+	}
+}
@@ -18,7 +18,9 @@ var log = logging.Logger("config")
 // Config is used to load IPFS config files.
 type Config struct {
 	Identity         Identity              // local node's peer identity
+	Domain           Domain                // local node's private domain membership
 	Datastore        Datastore             // local node's storage
+	Inventory        Inventory             // local node's inventory ledger
 	Addresses        Addresses             // local node's addresses
 	Mounts           Mounts                // local node's mount points
 	Discovery        Discovery             // local node's discovery mechanisms
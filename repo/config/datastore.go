@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 )
 
 // DefaultDataStoreDirectory is the directory to store all the local IPFS data.
@@ -14,11 +16,28 @@ type Datastore struct {
 	StorageMax         string // in B, kB, kiB, MB, ...
 	StorageGCWatermark int64  // in percentage to multiply on StorageMax
 	GCPeriod           string // in ns, us, ms, s, m, h
+	EnforceStorageMax  bool   // fail writes of blocks beyond StorageMax
+	GCOnStorageMax     bool   // run a GC before failing such writes
+	GCPolicy           string // "all" or "lru"; which blocks automatic GCs remove
 
 	Params          *json.RawMessage
 	NoSync          bool
 	HashOnRead      bool
 	BloomFilterSize int
+	Encrypted       bool   // values are encrypted with a passphrase, see 'ipfs repo rekey'
+	Compression     string // "deflate", "gzip" or "zlib"; blocks are not compressed if empty
+
+	Tiers *DatastoreTiers `json:",omitempty"`
+}
+
+// DatastoreTiers adds a cold tier to the blocks datastore. New and
+// recently used blocks are kept in the blocks datastore, the hot tier, and
+// the others are moved to a flatfs datastore at ColdPath.
+type DatastoreTiers struct {
+	ColdPath string // relative to the repo unless absolute, "coldblocks" if empty
+	HotSize  string // in B, kB, kiB, MB, ...
+	Policy   string // "lru" or "atime"
+	MaxIdle  string // in ns, us, ms, s, m, h; used by "atime"
 }
 
 func (d *Datastore) ParamData() []byte {
@@ -29,10 +48,37 @@ func (d *Datastore) ParamData() []byte {
 	return []byte(*d.Params)
 }
 
+// S3Datastore holds the Datastore.Params of the "s3" datastore type, which
+// keeps blocks in an S3 compatible bucket instead of flatfs.
 type S3Datastore struct {
 	Region string `json:"region"`
 	Bucket string `json:"bucket"`
 	ACL    string `json:"acl"`
+
+	// Endpoint of the service, for S3 compatible stores. Defaults to AWS.
+	Endpoint string `json:"endpoint,omitempty"`
+	// RootDirectory is prepended to object names.
+	RootDirectory string `json:"rootDirectory,omitempty"`
+	// AccessKey and SecretKey default to AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY from the environment.
+	AccessKey string `json:"accessKey,omitempty"`
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// S3Params decodes Params for the "s3" datastore type.
+func (d *Datastore) S3Params() (*S3Datastore, error) {
+	if d.Params == nil {
+		return nil, errors.New("the s3 datastore requires Datastore.Params")
+	}
+
+	var p S3Datastore
+	if err := json.Unmarshal(d.ParamData(), &p); err != nil {
+		return nil, fmt.Errorf("invalid s3 datastore params: %s", err)
+	}
+	if p.Bucket == "" {
+		return nil, errors.New("the s3 datastore requires a bucket")
+	}
+	return &p, nil
 }
 
 // DataStorePath returns the default data store path given a configuration root
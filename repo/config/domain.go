@@ -0,0 +1,197 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	ic "gx/ipfs/QmVoi5es8D5fNHZDqoW6DgDAEPEV5hQp8GBz161vZXiwpQ/go-libp2p-crypto"
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
+)
+
+// Domain describes the private domain this node belongs to. Nodes that
+// share a domain share a GroupID and only talk to each other.
+type Domain struct {
+	Name     string // human readable domain name
+	NodeUUID string // identifies this node within the domain
+	GroupID  string // peer ID of the domain authority key
+
+	// Certificate is this node's base64 encoded membership certificate,
+	// signed by the domain authority.
+	Certificate string `json:",omitempty"`
+
+	// AuthorityKey is the base64 encoded private key of the domain
+	// authority. It is only present on the node that created the domain.
+	AuthorityKey string `json:",omitempty"`
+
+	// ServeAllowlist lists peers outside the domain that may still fetch
+	// blocks from this node over bitswap.
+	ServeAllowlist []string `json:",omitempty"`
+
+	// KnownDomains maps the names of other domains to their GroupIDs,
+	// so that /domain/<name> paths of those domains can be resolved.
+	KnownDomains map[string]string `json:",omitempty"`
+
+	// LegacyGroupID is the Identity.GroupID of older versions, moved here
+	// when the repo is opened. It is kept until the node creates or joins
+	// a domain, see ParseLegacyGroupID.
+	LegacyGroupID string `json:",omitempty"`
+}
+
+var (
+	ErrDomainNameEmpty   = errors.New("domain name is empty")
+	ErrDomainNameInvalid = errors.New("domain name may not contain whitespace or '/'")
+	ErrNotAuthority      = errors.New("this node is not the authority of its domain")
+)
+
+// Enabled reports whether the node belongs to a domain at all.
+func (d *Domain) Enabled() bool {
+	return d.Name != ""
+}
+
+// IsAuthority reports whether this node holds the domain authority key.
+func (d *Domain) IsAuthority() bool {
+	return d.AuthorityKey != ""
+}
+
+// DecodeAuthorityKey is a helper to decode the domain authority key.
+func (d *Domain) DecodeAuthorityKey() (ic.PrivKey, error) {
+	if !d.IsAuthority() {
+		return nil, ErrNotAuthority
+	}
+
+	skb, err := base64.StdEncoding.DecodeString(d.AuthorityKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// sealed on disk in encrypted repos, the repo opens it on load.
+	return ic.UnmarshalPrivateKey(skb)
+}
+
+// LookupGroupID returns the GroupID of the domain called name: our own
+// domain or one of the KnownDomains.
+func (d *Domain) LookupGroupID(name string) (string, bool) {
+	if d.Enabled() && name == d.Name {
+		return d.GroupID, true
+	}
+	gid, ok := d.KnownDomains[name]
+	return gid, ok
+}
+
+// ServeAllowlistIDs is a helper to decode ServeAllowlist.
+func (d *Domain) ServeAllowlistIDs() ([]peer.ID, error) {
+	var out []peer.ID
+	for _, s := range d.ServeAllowlist {
+		p, err := peer.IDB58Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID in Domain.ServeAllowlist: %q", s)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// EnsureNodeUUID generates a node UUID if none was set yet.
+func (d *Domain) EnsureNodeUUID() error {
+	if d.NodeUUID != "" {
+		return nil
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+	d.NodeUUID = id
+	return nil
+}
+
+// Validate checks that the domain section is consistent. An empty section
+// is valid and means the node participates in the public network. The
+// certificate itself is verified when the node comes online.
+func (d *Domain) Validate() error {
+	if !d.Enabled() {
+		if d.GroupID != "" || d.Certificate != "" {
+			return errors.New("Domain.GroupID or Domain.Certificate is set but Domain.Name is empty")
+		}
+		return nil
+	}
+
+	if err := ValidDomainName(d.Name); err != nil {
+		return err
+	}
+
+	if !validUUID(d.NodeUUID) {
+		return fmt.Errorf("Domain.NodeUUID is not a valid UUID: %q", d.NodeUUID)
+	}
+
+	if d.GroupID == "" {
+		return errors.New("Domain.GroupID is not set")
+	}
+
+	if d.Certificate == "" {
+		return errors.New("Domain.Certificate is not set (run 'ipfs domain join')")
+	}
+
+	_, err := d.ServeAllowlistIDs()
+	return err
+}
+
+// ParseLegacyGroupID splits an Identity.GroupID of older versions, the
+// base64 encoding of the domain name followed by the node UUID.
+func ParseLegacyGroupID(gid string) (name, uuid string, ok bool) {
+	b, err := base64.StdEncoding.DecodeString(gid)
+	if err != nil || len(b) < uuidLen {
+		return "", "", false
+	}
+	name, uuid = string(b[:len(b)-uuidLen]), string(b[len(b)-uuidLen:])
+	if !validUUID(uuid) {
+		return "", "", false
+	}
+	return name, uuid, true
+}
+
+// ValidDomainName checks that name can be used as a domain name.
+func ValidDomainName(name string) error {
+	if name == "" {
+		return ErrDomainNameEmpty
+	}
+	if strings.ContainsAny(name, " \t\r\n/") {
+		return ErrDomainNameInvalid
+	}
+	return nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+const uuidLen = 36
+
+func validUUID(s string) bool {
+	if len(s) != uuidLen {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
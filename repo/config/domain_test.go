@@ -0,0 +1,94 @@
+package config
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+const testUUID = "0f5c3b4e-7a36-4d2d-9b1e-2a9f8c1d6e4b"
+
+func TestDomainValidate(t *testing.T) {
+	valid := func() Domain {
+		return Domain{
+			Name:           "example",
+			NodeUUID:       testUUID,
+			GroupID:        "QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
+			Certificate:    "certificate",
+			ServeAllowlist: []string{"QmSoLPppuBtQSGwKDZT2M73ULpjvfd3aZ6ha4oFGL1KrGM"},
+		}
+	}
+
+	cases := []struct {
+		name   string
+		modify func(d *Domain)
+		ok     bool
+	}{
+		{"valid", func(d *Domain) {}, true},
+		{"empty", func(d *Domain) { *d = Domain{} }, true},
+		{"legacy group only", func(d *Domain) { *d = Domain{LegacyGroupID: "Z3JvdXA="} }, true},
+		{"group without name", func(d *Domain) { d.Name = "" }, false},
+		{"certificate without name", func(d *Domain) { *d = Domain{Certificate: "certificate"} }, false},
+		{"name with slash", func(d *Domain) { d.Name = "a/b" }, false},
+		{"name with space", func(d *Domain) { d.Name = "a b" }, false},
+		{"missing uuid", func(d *Domain) { d.NodeUUID = "" }, false},
+		{"bad uuid", func(d *Domain) { d.NodeUUID = "0f5c3b4e-7a36-4d2d-9b1e-2a9f8c1d6e4g" }, false},
+		{"missing group", func(d *Domain) { d.GroupID = "" }, false},
+		{"missing certificate", func(d *Domain) { d.Certificate = "" }, false},
+		{"bad allowlist", func(d *Domain) { d.ServeAllowlist = []string{"not a peer"} }, false},
+	}
+
+	for _, c := range cases {
+		d := valid()
+		c.modify(&d)
+		err := d.Validate()
+		if c.ok && err != nil {
+			t.Errorf("%s: expected valid, got %s", c.name, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+}
+
+func TestEnsureNodeUUID(t *testing.T) {
+	var d Domain
+	if err := d.EnsureNodeUUID(); err != nil {
+		t.Fatal(err)
+	}
+	if !validUUID(d.NodeUUID) {
+		t.Fatalf("generated an invalid UUID: %q", d.NodeUUID)
+	}
+
+	d.NodeUUID = testUUID
+	if err := d.EnsureNodeUUID(); err != nil {
+		t.Fatal(err)
+	}
+	if d.NodeUUID != testUUID {
+		t.Fatal("an existing UUID should be kept")
+	}
+}
+
+func TestParseLegacyGroupID(t *testing.T) {
+	enc := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	cases := []struct {
+		gid, name, uuid string
+		ok              bool
+	}{
+		{enc("iServDB" + testUUID), "iServDB", testUUID, true},
+		{enc(testUUID), "", testUUID, true},
+		{enc("iServDB" + "NO FILE"), "", "", false},
+		{enc("short"), "", "", false},
+		{"not base64!", "", "", false},
+	}
+
+	for _, c := range cases {
+		name, uuid, ok := ParseLegacyGroupID(c.gid)
+		if ok != c.ok || name != c.name || uuid != c.uuid {
+			t.Errorf("ParseLegacyGroupID(%q) = %q, %q, %t; expected %q, %q, %t",
+				c.gid, name, uuid, ok, c.name, c.uuid, c.ok)
+		}
+	}
+}
@@ -1,13 +1,6 @@
 package config
 
 import (
-"os/exec"
-"bufio"
-"os"
-"strings"
-
- "io/ioutil"
-
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -128,60 +121,6 @@ func identityConfig(out io.Writer, nbits int) (Identity, error) {
 	}
 	ident.PeerID = id.Pretty()
 
-/////cmd := exec.Command("sudo","cp","/sys/class/dmi/id/product_uuid","/opt/iservstor/data/.uuid.txt")
-cmd := exec.Command("sudo","cp","/proc/sys/kernel/random/uuid","/opt/iservstor/data/.uuid.txt")
-cmd.Run()
-cmd2 := exec.Command("sudo","chmod","0777","/opt/iservstor/data/.uuid.txt")
-cmd2.Run()
-Estring := base64.StdEncoding.EncodeToString([]byte(GetDomainName()+GetUuid()))/////
-// Should readfile here
-ident.GroupID = Estring
-/////ident.GroupID = "iServDB"+GetUuid()
-
 	fmt.Fprintf(out, "peer identity: %s\n", ident.PeerID)
 	return ident, nil
 }
-
-func GetUuid() string{
-        inputFile, Error := os.Open("/opt/iservstor/data/.uuid.txt")
-        if Error != nil {
-                fmt.Println("get uuid error !!")
-                return "NO FILE"
-        }
-        defer inputFile.Close()
-        inputReader := bufio.NewReader(inputFile)
-        inputString, Error := inputReader.ReadString('\n')
-        if Error == io.EOF {
-                return "NO CONTENT"
-        }
-        return strings.Replace(inputString,"\n","",-1)
-}
-
-func GetDomainName() string{
-	dat, err := ioutil.ReadFile("/opt/iservstor/conf/iservstor.conf")
-	if err != nil{
-		fmt.Println("get domain name error !!")
-		return "NO FILE"
-	}
-	 tmp := strings.Split(string(dat),"DOMAIN_NAME")[1]
-	 tmpp := strings.Split(tmp,"\n")[0]
-	 tmppp := strings.Split(tmpp,"=")[1]
-	 DomainName := strings.Replace(tmppp," ","",-1)
-	 fmt.Printf("\nKEVIN DOMAIN NAME : %s\n",DomainName)
-	 return DomainName
-/*
-	inputFile, Error := os.Open("/tmp/.config.txt")
-	if Error != nil {
-		fmt.Println("error !!")
-		return "NO FILE"
-	}
-	defer inputFile.Close()
-	inputReader := bufio.NewReader(inputFile)
-	inputString, Error := inputReader.ReadString('\n')
-	if Error == io.EOF {
-		return "NO CONTENT"
-	}
-	fmt.Printf("\n\nKEVIN GetUUID Test : %s 123123\n\n",inputReader.ReadString('\n'));
-	return strings.Replace(inputString,"\n","",-1)
-*/
-}
@@ -0,0 +1,15 @@
+package config
+
+// Inventory configures the inventory ledger, which records every add, pin,
+// unpin and garbage collection of the local node.
+type Inventory struct {
+	// Sink streams every recorded event to an external consumer, e.g. a
+	// management node.
+	Sink InventorySink
+}
+
+// InventorySink describes where inventory events are streamed to.
+type InventorySink struct {
+	Type   string // "" (disabled), "file" or "webhook"
+	Target string // path of the file or URL of the webhook
+}
@@ -0,0 +1,54 @@
+package fsrepo
+
+import (
+	"fmt"
+
+	compressds "github.com/ipfs/go-ipfs/thirdparty/compressds"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// compressionKey is set in the leveldb datastore once blocks may have
+// been compressed. logicalUsageKey and coldLogicalUsageKey hold the sizes
+// of the blocks before compression.
+var (
+	compressionKey      = ds.NewKey("/local/compression")
+	logicalUsageKey     = ds.NewKey("/local/usage/blocks-logical")
+	coldLogicalUsageKey = ds.NewKey("/local/usage/coldblocks-logical")
+)
+
+// openCompression reads the compression settings. Repos that held
+// compressed blocks keep reading them through the compression layer after
+// Datastore.Compression is unset.
+func (r *FSRepo) openCompression(meta ds.Datastore) error {
+	if name := r.config.Datastore.Compression; name != "" {
+		alg, err := compressds.Lookup(name)
+		if err != nil {
+			return fmt.Errorf("invalid Datastore.Compression: %s", err)
+		}
+		r.compression = alg
+		r.compressed = true
+		return meta.Put(compressionKey, []byte{1})
+	}
+
+	has, err := meta.Has(compressionKey)
+	if err != nil {
+		return err
+	}
+	r.compressed = has
+	return nil
+}
+
+// compress wraps d to compress its values, if blocks are compressed. The
+// size of the values before compression is counted in meta under k.
+func (r *FSRepo) compress(d, meta ds.Datastore, k ds.Key) (ds.Datastore, *usageDatastore, error) {
+	if !r.compressed {
+		return d, nil, nil
+	}
+
+	c := compressds.Wrap(d, r.compression)
+	u, err := newUsageDatastore(c, meta, k, keysUsage(c))
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, u, nil
+}
@@ -3,10 +3,12 @@ package fsrepo
 import (
 	"fmt"
 	"path"
+	"path/filepath"
 
 	repo "github.com/ipfs/go-ipfs/repo"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	"github.com/ipfs/go-ipfs/thirdparty/dir"
+	s3ds "github.com/ipfs/go-ipfs/thirdparty/s3ds"
 	"gx/ipfs/QmU4VzzKNLJXJ72SedXBQKyf5Jo8W89iWpbWQjHn9qef8N/go-ds-flatfs"
 	levelds "gx/ipfs/QmUHmMGmcwCrjHQHcYhBnqGCSWs5pBSMbGZmfwavETR1gg/go-ds-leveldb"
 	ldbopts "gx/ipfs/QmbBhyDKsY4mbY6xsKt3qu9Y7FPvMJ6qbD8AMjYYvPRw1g/goleveldb/leveldb/opt"
@@ -18,6 +20,7 @@ import (
 const (
 	leveldbDirectory = "datastore"
 	flatfsDirectory  = "blocks"
+	coldDirectory    = "coldblocks"
 )
 
 func openDefaultDatastore(r *FSRepo) (repo.Datastore, error) {
@@ -31,13 +34,31 @@ func openDefaultDatastore(r *FSRepo) (repo.Datastore, error) {
 		return nil, fmt.Errorf("unable to open leveldb datastore: %v", err)
 	}
 
-	syncfs := !r.config.Datastore.NoSync
-	// 5 bytes of prefix gives us 25 bits of freedom, 16 of which are taken by
-	// by the Qm prefix. Leaving us with 9 bits, or 512 way sharding
-	blocksDS, err := flatfs.New(path.Join(r.path, flatfsDirectory), 5, syncfs)
+	// values are encrypted above the usage datastores, so that they count
+	// the bytes on disk
+	levelDS := r.encrypt(leveldbDS)
+
+	if err := r.openCompression(levelDS); err != nil {
+		return nil, err
+	}
+
+	blocksDS, count, err := openBlocksDatastore(r)
+	if err != nil {
+		return nil, err
+	}
+
+	usageDS, err := newUsageDatastore(blocksDS, levelDS, usageKey, count)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open flatfs datastore: %v", err)
+		return nil, fmt.Errorf("unable to measure the blocks datastore: %v", err)
 	}
+	r.usage = usageDS
+
+	// compression goes above encryption, encrypted data does not compress
+	blocks, logicalDS, err := r.compress(r.encrypt(usageDS), levelDS, logicalUsageKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to measure the blocks datastore: %v", err)
+	}
+	r.logicalUsage = logicalDS
 
 	// Add our PeerID to metrics paths to keep them unique
 	//
@@ -49,9 +70,9 @@ func openDefaultDatastore(r *FSRepo) (repo.Datastore, error) {
 		id = fmt.Sprintf("uninitialized_%p", r)
 	}
 	prefix := "fsrepo." + id + ".datastore."
-	metricsBlocks := measure.New(prefix+"blocks", blocksDS)
-	metricsLevelDB := measure.New(prefix+"leveldb", leveldbDS)
-	mountDS := mount.New([]mount.Mount{
+	metricsBlocks := measure.New(prefix+"blocks", blocks)
+	metricsLevelDB := measure.New(prefix+"leveldb", levelDS)
+	mounts := []mount.Mount{
 		{
 			Prefix:    ds.NewKey("/blocks"),
 			Datastore: metricsBlocks,
@@ -60,9 +81,80 @@ func openDefaultDatastore(r *FSRepo) (repo.Datastore, error) {
 			Prefix:    ds.NewKey("/"),
 			Datastore: metricsLevelDB,
 		},
-	})
+	}
+
+	if tiers := r.config.Datastore.Tiers; tiers != nil {
+		coldPath := coldTierPath(r.path, tiers)
+		coldDS, err := flatfs.New(coldPath, 5, !r.config.Datastore.NoSync)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open the cold tier datastore: %v", err)
+		}
+		coldUsageDS, err := newUsageDatastore(coldDS, levelDS, coldUsageKey, dirUsage(coldPath))
+		if err != nil {
+			return nil, fmt.Errorf("unable to measure the cold tier datastore: %v", err)
+		}
+		r.coldUsage = coldUsageDS
+
+		cold, coldLogicalDS, err := r.compress(r.encrypt(coldUsageDS), levelDS, coldLogicalUsageKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to measure the cold tier datastore: %v", err)
+		}
+		r.coldLogicalUsage = coldLogicalDS
+
+		mounts = append(mounts, mount.Mount{
+			Prefix:    ds.NewKey("/coldblocks"),
+			Datastore: measure.New(prefix+"coldblocks", cold),
+		})
+	}
 
-	return mountDS, nil
+	return mount.New(mounts), nil
+}
+
+// coldTierPath returns the directory of the cold tier flatfs datastore.
+func coldTierPath(repoPath string, tiers *config.DatastoreTiers) string {
+	if tiers.ColdPath == "" {
+		return filepath.Join(repoPath, coldDirectory)
+	}
+	if filepath.IsAbs(tiers.ColdPath) {
+		return tiers.ColdPath
+	}
+	return filepath.Join(repoPath, tiers.ColdPath)
+}
+
+// openBlocksDatastore opens the datastore for the /blocks mount, which is
+// flatfs unless Datastore.Type selects another backend. It also returns a
+// function measuring the size of the datastore.
+func openBlocksDatastore(r *FSRepo) (ds.Datastore, func() (uint64, error), error) {
+	switch r.config.Datastore.Type {
+	case "s3":
+		p, err := r.config.Datastore.S3Params()
+		if err != nil {
+			return nil, nil, err
+		}
+		d, err := s3ds.New(s3ds.Options{
+			Endpoint:      p.Endpoint,
+			Region:        p.Region,
+			Bucket:        p.Bucket,
+			ACL:           p.ACL,
+			RootDirectory: p.RootDirectory,
+			AccessKey:     p.AccessKey,
+			SecretKey:     p.SecretKey,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to open s3 datastore: %v", err)
+		}
+		return d, queryUsage(d), nil
+	}
+
+	syncfs := !r.config.Datastore.NoSync
+	// 5 bytes of prefix gives us 25 bits of freedom, 16 of which are taken by
+	// by the Qm prefix. Leaving us with 9 bits, or 512 way sharding
+	flatfsPath := path.Join(r.path, flatfsDirectory)
+	blocksDS, err := flatfs.New(flatfsPath, 5, syncfs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open flatfs datastore: %v", err)
+	}
+	return blocksDS, dirUsage(flatfsPath), nil
 }
 
 func initDefaultDatastore(repoPath string, conf *config.Config) error {
@@ -73,9 +165,20 @@ func initDefaultDatastore(repoPath string, conf *config.Config) error {
 		return fmt.Errorf("datastore: %s", err)
 	}
 
+	if conf.Datastore.Type == "s3" {
+		_, err := conf.Datastore.S3Params()
+		return err
+	}
+
 	flatfsPath := path.Join(repoPath, flatfsDirectory)
 	if err := dir.Writable(flatfsPath); err != nil {
 		return fmt.Errorf("datastore: %s", err)
 	}
+
+	if tiers := conf.Datastore.Tiers; tiers != nil {
+		if err := dir.Writable(coldTierPath(repoPath, tiers)); err != nil {
+			return fmt.Errorf("datastore: %s", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,165 @@
+package fsrepo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cryptds "github.com/ipfs/go-ipfs/thirdparty/cryptds"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// EnvPassphrase is the environment variable holding the passphrase of
+// repos with Datastore.Encrypted set.
+const EnvPassphrase = "IPFS_PASSPHRASE"
+
+// keyFile holds the datastore keys, encrypted with the passphrase.
+const keyFile = "datastore_key"
+
+var ErrNoPassphrase = errors.New("the repo datastore is encrypted, please set " + EnvPassphrase + " or provide a passphrase file")
+
+// ReadPassphraseFile returns the passphrase stored in the file at path.
+// A trailing newline is not part of the passphrase.
+func ReadPassphraseFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func readKeyFile(repoPath string) (*cryptds.KeyFile, error) {
+	b, err := ioutil.ReadFile(filepath.Join(repoPath, keyFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("the repo datastore is encrypted but its key file is missing")
+		}
+		return nil, err
+	}
+
+	var f cryptds.KeyFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("corrupt datastore key file: %s", err)
+	}
+	return &f, nil
+}
+
+// writeKeyFile replaces the key file atomically, a torn write would lose
+// the keys.
+func writeKeyFile(repoPath string, f *cryptds.KeyFile) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	p := filepath.Join(repoPath, keyFile)
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// initKeys creates the key file of a new encrypted repo, holding k.
+func initKeys(repoPath, passphrase string, k *cryptds.Key) error {
+	f, err := cryptds.SealKeys(passphrase, []*cryptds.Key{k})
+	if err != nil {
+		return err
+	}
+	return writeKeyFile(repoPath, f)
+}
+
+// openKeys loads the datastore keys if the datastore is encrypted.
+func (r *FSRepo) openKeys(passphrase string) error {
+	if !r.config.Datastore.Encrypted {
+		return nil
+	}
+	if passphrase == "" {
+		return ErrNoPassphrase
+	}
+
+	f, err := readKeyFile(r.path)
+	if err != nil {
+		return err
+	}
+	keys, err := f.Open(passphrase)
+	if err != nil {
+		return err
+	}
+
+	r.dsKeys = cryptds.NewKeyring(keys[0], keys[1:]...)
+	r.passphrase = passphrase
+	return nil
+}
+
+// encrypt wraps d to encrypt its values, if the datastore is encrypted.
+func (r *FSRepo) encrypt(d ds.Datastore) ds.Datastore {
+	if r.dsKeys == nil {
+		return d
+	}
+	c := cryptds.Wrap(d, r.dsKeys)
+	r.crypt = append(r.crypt, c)
+	return c
+}
+
+// Rekey encrypts the datastore with a new key, protected by newPassphrase
+// or by the current passphrase if it is empty. It returns the number of
+// values rewritten. Nothing else may use the repo while it runs.
+func (r *FSRepo) Rekey(newPassphrase string) (int, error) {
+	if r.dsKeys == nil {
+		return 0, errors.New("the repo datastore is not encrypted")
+	}
+	if newPassphrase == "" {
+		newPassphrase = r.passphrase
+	}
+
+	k, err := cryptds.GenerateKey()
+	if err != nil {
+		return 0, err
+	}
+
+	// the old keys stay in the key file until all values are sealed with
+	// the new one, an interrupted rekey is finished by running it again.
+	f, err := cryptds.SealKeys(newPassphrase, append([]*cryptds.Key{k}, r.dsKeys.Keys()...))
+	if err != nil {
+		return 0, err
+	}
+	if err := writeKeyFile(r.path, f); err != nil {
+		return 0, err
+	}
+	r.passphrase = newPassphrase
+	r.dsKeys.Rotate(k)
+
+	var n int
+	for _, c := range r.crypt {
+		m, err := c.Rekey()
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	// the private keys in the config and the keystore
+	conf, err := r.Config()
+	if err != nil {
+		return n, err
+	}
+	if err := r.SetConfig(conf); err != nil {
+		return n, err
+	}
+	if sk, ok := r.Keystore().(*sealedKeystore); ok {
+		if err := sk.reseal(); err != nil {
+			return n, err
+		}
+	}
+
+	f, err = cryptds.SealKeys(newPassphrase, []*cryptds.Key{k})
+	if err != nil {
+		return n, err
+	}
+	return n, writeKeyFile(r.path, f)
+}
@@ -11,12 +11,15 @@ import (
 	"sync"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/mitchellh/go-homedir"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	repo "github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/common"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
 	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 	serialize "github.com/ipfs/go-ipfs/repo/fsrepo/serialize"
+	compressds "github.com/ipfs/go-ipfs/thirdparty/compressds"
+	cryptds "github.com/ipfs/go-ipfs/thirdparty/cryptds"
 	dir "github.com/ipfs/go-ipfs/thirdparty/dir"
 	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
 	util "gx/ipfs/QmZNVWh8LLjAavuQ2JXuFmuYH3C11xo988vSgp7UQrTRj1/go-ipfs-util"
@@ -28,8 +31,8 @@ var log = logging.Logger("fsrepo")
 // version number that we are currently expecting to see
 var RepoVersion = 4
 
-var migrationInstructions = `See https://github.com/ipfs/fs-repo-migrations/blob/master/run.md
-Sorry for the inconvenience. In the future, these will run automatically.`
+var migrationInstructions = `Run 'ipfs repo migrate' to migrate the repo with the migrations built into
+this program, or see https://github.com/ipfs/fs-repo-migrations/blob/master/run.md`
 
 var errIncorrectRepoFmt = `Repo has incorrect version: %s
 Program version is: %s
@@ -45,7 +48,7 @@ See https://github.com/ipfs/fs-repo-migrations/blob/master/run.md for details.`
 var (
 	ErrNoVersion     = errors.New("no version file found, please run 0-to-1 migration tool.\n" + migrationInstructions)
 	ErrOldRepo       = errors.New("ipfs repo found in old '~/.go-ipfs' location, please run migration tool.\n" + migrationInstructions)
-	ErrNeedMigration = errors.New("ipfs repo needs migration.")
+	ErrNeedMigration = errors.New("ipfs repo needs migration, run 'ipfs repo migrate'.")
 )
 
 type NoRepoError struct {
@@ -59,6 +62,7 @@ func (err NoRepoError) Error() string {
 }
 
 const apiFile = "api"
+const keystoreDir = "keystore"
 
 var (
 
@@ -93,20 +97,43 @@ type FSRepo struct {
 	lockfile io.Closer
 	config   *config.Config
 	ds       repo.Datastore
+	keys     keystore.Keystore
+	// usage counts the bytes in the blocks datastore, and coldUsage
+	// those in the cold tier, if configured
+	usage     *usageDatastore
+	coldUsage *usageDatastore
+	// logicalUsage and coldLogicalUsage count the bytes before
+	// compression, if blocks are compressed
+	logicalUsage     *usageDatastore
+	coldLogicalUsage *usageDatastore
+	compression      *compressds.Algorithm
+	compressed       bool
+	// dsKeys encrypts the datastores in crypt, if Datastore.Encrypted
+	// is set
+	dsKeys     *cryptds.Keyring
+	crypt      []*cryptds.Datastore
+	passphrase string
 }
 
 var _ repo.Repo = (*FSRepo)(nil)
 
 // Open the FSRepo at path. Returns an error if the repo is not
-// initialized.
+// initialized. The passphrase of encrypted repos is taken from the
+// IPFS_PASSPHRASE environment variable.
 func Open(repoPath string) (repo.Repo, error) {
+	return OpenWithPassphrase(repoPath, os.Getenv(EnvPassphrase))
+}
+
+// OpenWithPassphrase is like Open, decrypting the datastore with
+// passphrase. It is ignored if the repo is not encrypted.
+func OpenWithPassphrase(repoPath, passphrase string) (repo.Repo, error) {
 	fn := func() (repo.Repo, error) {
-		return open(repoPath)
+		return open(repoPath, passphrase)
 	}
 	return onlyOne.Open(repoPath, fn)
 }
 
-func open(repoPath string) (repo.Repo, error) {
+func open(repoPath, passphrase string) (repo.Repo, error) {
 	packageLock.Lock()
 	defer packageLock.Unlock()
 
@@ -157,10 +184,29 @@ func open(repoPath string) (repo.Repo, error) {
 		return nil, err
 	}
 
+	if err := r.openKeys(passphrase); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := unsealConfig(r.dsKeys, r.config)
+	if err != nil {
+		return nil, err
+	}
+	if plaintext && r.dsKeys != nil {
+		// encrypted before private keys were sealed, or set by hand
+		if err := r.setConfigUnsynced(r.config); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := r.openDatastore(); err != nil {
 		return nil, err
 	}
 
+	if err := r.openKeystore(); err != nil {
+		return nil, err
+	}
+
 	keepLocked = true
 	return r, nil
 }
@@ -232,6 +278,8 @@ func initConfig(path string, conf *config.Config) error {
 }
 
 // Init initializes a new FSRepo at the given path with the provided config.
+// If conf.Datastore.Encrypted is set, the datastore key is protected with
+// the passphrase in the IPFS_PASSPHRASE environment variable.
 // TODO add support for custom datastores.
 func Init(repoPath string, conf *config.Config) error {
 
@@ -244,6 +292,24 @@ func Init(repoPath string, conf *config.Config) error {
 		return nil
 	}
 
+	passphrase := os.Getenv(EnvPassphrase)
+	if conf.Datastore.Encrypted && passphrase == "" {
+		return ErrNoPassphrase
+	}
+
+	var dsKey *cryptds.Key
+	if conf.Datastore.Encrypted {
+		k, err := cryptds.GenerateKey()
+		if err != nil {
+			return err
+		}
+		sealed := *conf
+		if err := sealConfig(cryptds.NewKeyring(k), &sealed); err != nil {
+			return err
+		}
+		conf, dsKey = &sealed, k
+	}
+
 	if err := initConfig(repoPath, conf); err != nil {
 		return err
 	}
@@ -252,6 +318,12 @@ func Init(repoPath string, conf *config.Config) error {
 		return err
 	}
 
+	if dsKey != nil {
+		if err := initKeys(repoPath, passphrase, dsKey); err != nil {
+			return err
+		}
+	}
+
 	if err := mfsr.RepoPath(repoPath).WriteVersion(RepoVersion); err != nil {
 		return err
 	}
@@ -259,6 +331,29 @@ func Init(repoPath string, conf *config.Config) error {
 	return nil
 }
 
+// Migrate runs the migrations compiled into this program, taking the repo
+// at repoPath to version to. It fails if the repo is in use.
+func Migrate(repoPath string, to int, opts mfsr.Options) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	r, err := newFSRepo(repoPath)
+	if err != nil {
+		return err
+	}
+	if err := checkInitialized(r.path); err != nil {
+		return err
+	}
+
+	lk, err := lockfile.Lock(r.path)
+	if err != nil {
+		return err
+	}
+	defer lk.Close()
+
+	return mfsr.Migrate(mfsr.RepoPath(r.path), to, opts)
+}
+
 // LockedByOtherProcess returns true if the FSRepo is locked by another
 // process. If true, then the repo cannot be opened by this process.
 func LockedByOtherProcess(repoPath string) (bool, error) {
@@ -319,6 +414,11 @@ func (r *FSRepo) openConfig() error {
 	if err != nil {
 		return err
 	}
+	if util.FileExists(configFilename) {
+		if err := migrateConfigFile(configFilename); err != nil {
+			return err
+		}
+	}
 	conf, err := serialize.Load(configFilename)
 	if err != nil {
 		return err
@@ -330,7 +430,7 @@ func (r *FSRepo) openConfig() error {
 // openDatastore returns an error if the config file is not present.
 func (r *FSRepo) openDatastore() error {
 	switch r.config.Datastore.Type {
-	case "default", "leveldb", "":
+	case "default", "leveldb", "", "s3":
 		d, err := openDefaultDatastore(r)
 		if err != nil {
 			return err
@@ -357,6 +457,27 @@ func (r *FSRepo) openDatastore() error {
 	return nil
 }
 
+// openKeystore opens the keystore directory, creating it for repos
+// initialized before we had one.
+func (r *FSRepo) openKeystore() error {
+	dir := filepath.Join(r.path, keystoreDir)
+	ks, err := keystore.NewFSKeystore(dir)
+	if err != nil {
+		return err
+	}
+	if r.dsKeys == nil {
+		r.keys = ks
+		return nil
+	}
+
+	sk, err := newSealedKeystore(ks, dir, r.dsKeys)
+	if err != nil {
+		return err
+	}
+	r.keys = sk
+	return nil
+}
+
 // Close closes the FSRepo, releasing held resources.
 func (r *FSRepo) Close() error {
 	packageLock.Lock()
@@ -371,6 +492,16 @@ func (r *FSRepo) Close() error {
 		log.Warning("error removing api file: ", err)
 	}
 
+	// save the sizes before the leveldb datastore they go to is closed
+	for _, u := range []*usageDatastore{r.logicalUsage, r.coldLogicalUsage, r.usage, r.coldUsage} {
+		if u == nil {
+			continue
+		}
+		if err := u.shutdown(); err != nil {
+			log.Warning("failed to store the size of the blocks datastore: ", err)
+		}
+	}
+
 	if err := r.ds.Close(); err != nil {
 		return err
 	}
@@ -420,7 +551,20 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	if err := serialize.ReadConfigFile(configFilename, &mapconf); err != nil {
 		return err
 	}
-	m, err := config.ToMap(updated)
+	// the private keys are kept in plaintext in memory, sealed on disk
+	plain := *updated
+	if _, err := unsealConfig(r.dsKeys, &plain); err != nil {
+		return err
+	}
+	onDisk := &plain
+	if r.dsKeys != nil {
+		sealed := plain
+		if err := sealConfig(r.dsKeys, &sealed); err != nil {
+			return err
+		}
+		onDisk = &sealed
+	}
+	m, err := config.ToMap(onDisk)
 	if err != nil {
 		return err
 	}
@@ -430,7 +574,7 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	if err := serialize.WriteConfigFile(configFilename, mapconf); err != nil {
 		return err
 	}
-	*r.config = *updated // copy so caller cannot modify this private config
+	*r.config = plain // copy so caller cannot modify this private config
 	return nil
 }
 
@@ -461,7 +605,18 @@ func (r *FSRepo) GetConfigKey(key string) (interface{}, error) {
 	if err := serialize.ReadConfigFile(filename, &cfg); err != nil {
 		return nil, err
 	}
-	return common.MapGetKV(cfg, key)
+	v, err := common.MapGetKV(cfg, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// sealed private keys are returned in the clear, so they can be backed up
+	for _, s := range configSecrets {
+		if key == s.selector {
+			return *s.field(r.config), nil
+		}
+	}
+	return v, nil
 }
 
 // SetConfigKey writes the value of a particular key.
@@ -542,6 +697,21 @@ func (r *FSRepo) SetConfigKey(key string, value interface{}) error {
 	if err != nil {
 		return err
 	}
+
+	// private keys set by hand must not reach the disk in plaintext
+	if r.dsKeys != nil {
+		sealed := *conf
+		if err := sealConfig(r.dsKeys, &sealed); err != nil {
+			return err
+		}
+		for _, s := range configSecrets {
+			if v := *s.field(&sealed); v != "" {
+				if err := common.MapSetKV(mapconf, s.selector, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
 	if err := serialize.WriteConfigFile(filename, mapconf); err != nil {
 		return err
 	}
@@ -557,25 +727,44 @@ func (r *FSRepo) Datastore() repo.Datastore {
 	return d
 }
 
-// GetStorageUsage computes the storage space taken by the repo in bytes
+// Keystore returns the repo-owned keystore. If FSRepo is Closed, return
+// value is undefined.
+func (r *FSRepo) Keystore() keystore.Keystore {
+	packageLock.Lock()
+	k := r.keys
+	packageLock.Unlock()
+	return k
+}
+
+// GetStorageUsage returns the storage space taken by blocks in bytes. It
+// is tracked as blocks are added and removed, see usageDatastore.
 func (r *FSRepo) GetStorageUsage() (uint64, error) {
-	pth, err := config.PathRoot()
-	if err != nil {
-		return 0, err
+	packageLock.Lock()
+	u, cold := r.usage, r.coldUsage
+	packageLock.Unlock()
+	if u == nil {
+		return 0, errors.New("repo is closed")
+	}
+	if cold != nil {
+		return u.Usage() + cold.Usage(), nil
 	}
+	return u.Usage(), nil
+}
 
-	var du uint64
-	err = filepath.Walk(pth, func(p string, f os.FileInfo, err error) error {
-		if err != nil {
-			log.Debugf("filepath.Walk error: %s", err)
-			return nil
-		}
-		if f != nil {
-			du += uint64(f.Size())
-		}
-		return nil
-	})
-	return du, err
+// GetLogicalStorageUsage returns the size of the blocks before they were
+// compressed. It is the same as GetStorageUsage if blocks are not
+// compressed.
+func (r *FSRepo) GetLogicalStorageUsage() (uint64, error) {
+	packageLock.Lock()
+	u, cold := r.logicalUsage, r.coldLogicalUsage
+	packageLock.Unlock()
+	if u == nil {
+		return r.GetStorageUsage()
+	}
+	if cold != nil {
+		return u.Usage() + cold.Usage(), nil
+	}
+	return u.Usage(), nil
 }
 
 var _ io.Closer = &FSRepo{}
@@ -2,13 +2,18 @@ package fsrepo
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
 
+	repo "github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/config"
+	serialize "github.com/ipfs/go-ipfs/repo/fsrepo/serialize"
 	"github.com/ipfs/go-ipfs/thirdparty/assert"
+	s3test "github.com/ipfs/go-ipfs/thirdparty/s3ds/s3test"
 	datastore "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
 )
 
@@ -117,3 +122,224 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestS3BlocksDatastore(t *testing.T) {
+	t.Parallel()
+	s, hs := s3test.NewServer()
+	defer hs.Close()
+
+	params := json.RawMessage(`{"bucket": "blocks", "endpoint": "` + hs.URL + `", "rootDirectory": "node1"}`)
+	conf := &config.Config{
+		Datastore: config.Datastore{Type: "s3", Params: &params},
+	}
+
+	path := testRepoPath("s3", t)
+	assert.Nil(Init(path, conf), t)
+	r, err := Open(path)
+	assert.Nil(err, t, "repo should open successfully")
+
+	d := r.Datastore()
+	assert.Nil(d.Put(datastore.NewKey("/blocks/CIQFOO"), []byte("block")), t)
+	assert.Nil(d.Put(datastore.NewKey("/local/pins"), []byte("pins")), t)
+
+	objs := s.Objects("blocks")
+	assert.True(len(objs) == 1 && objs[0] == "node1/CIQFOO", t, "only blocks should be stored in the bucket")
+
+	v, err := d.Get(datastore.NewKey("/blocks/CIQFOO"))
+	assert.Nil(err, t)
+	assert.True(bytes.Equal(v.([]byte), []byte("block")), t, "data should match")
+	assert.Nil(r.Close(), t)
+}
+
+func TestStorageUsage(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("usage", t)
+	assert.Nil(Init(path, &config.Config{}), t)
+
+	usage := func(r repo.Repo) uint64 {
+		u, err := r.GetStorageUsage()
+		assert.Nil(err, t)
+		return u
+	}
+
+	r1, err := Open(path)
+	assert.Nil(err, t)
+	assert.True(usage(r1) == 0, t, "a new repo should be empty")
+
+	d := r1.Datastore()
+	assert.Nil(d.Put(datastore.NewKey("/blocks/CIQA"), make([]byte, 100)), t)
+	assert.Nil(d.Put(datastore.NewKey("/blocks/CIQB"), make([]byte, 50)), t)
+	assert.Nil(d.Put(datastore.NewKey("/blocks/CIQA"), make([]byte, 100)), t)
+	assert.Nil(d.Put(datastore.NewKey("/local/pins"), make([]byte, 1000)), t)
+	assert.True(usage(r1) == 150, t, "only new blocks should count")
+
+	assert.Nil(d.Delete(datastore.NewKey("/blocks/CIQB")), t)
+	assert.True(usage(r1) == 100, t, "deleted blocks should not count")
+	assert.Nil(r1.Close(), t)
+
+	r2, err := Open(path)
+	assert.Nil(err, t)
+	assert.True(usage(r2) == 100, t, "usage should persist across opens")
+	assert.Nil(r2.Close(), t)
+}
+
+func TestEncryptedDatastore(t *testing.T) {
+	path := testRepoPath("encrypted", t)
+	conf := &config.Config{Datastore: config.Datastore{Encrypted: true}}
+
+	os.Setenv(EnvPassphrase, "")
+	assert.Err(Init(path, conf), t, "init should require a passphrase")
+	os.Setenv(EnvPassphrase, "secret")
+	defer os.Unsetenv(EnvPassphrase)
+	assert.Nil(Init(path, conf), t)
+
+	_, err := OpenWithPassphrase(path, "wrong")
+	assert.Err(err, t, "the repo should not open with a wrong passphrase")
+
+	r1, err := Open(path)
+	assert.Nil(err, t)
+	d := r1.Datastore()
+	assert.Nil(d.Put(datastore.NewKey("/blocks/CIQA"), []byte("block data")), t)
+	assert.Nil(d.Put(datastore.NewKey("/local/pins"), []byte("pin data")), t)
+
+	n, err := r1.(*FSRepo).Rekey("new secret")
+	assert.Nil(err, t)
+	// the usage counter in leveldb is rewritten along with the values
+	assert.True(n >= 2, t, "the values should be rewritten")
+	assert.Nil(r1.Close(), t)
+
+	err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		assert.False(bytes.Contains(b, []byte("block data")), t, p, "should not hold the data in the clear")
+		return nil
+	})
+	assert.Nil(err, t)
+
+	_, err = OpenWithPassphrase(path, "secret")
+	assert.Err(err, t, "the old passphrase should not work anymore")
+
+	r2, err := OpenWithPassphrase(path, "new secret")
+	assert.Nil(err, t)
+	v, err := r2.Datastore().Get(datastore.NewKey("/local/pins"))
+	assert.Nil(err, t)
+	assert.True(bytes.Equal(v.([]byte), []byte("pin data")), t, "data should match")
+	v, err = r2.Datastore().Get(datastore.NewKey("/blocks/CIQA"))
+	assert.Nil(err, t)
+	assert.True(bytes.Equal(v.([]byte), []byte("block data")), t, "data should match")
+	assert.Nil(r2.Close(), t)
+}
+
+func TestEncryptedPrivateKeys(t *testing.T) {
+	path := testRepoPath("sealed", t)
+	conf := &config.Config{Datastore: config.Datastore{Encrypted: true}}
+	conf.Identity.PrivKey = "private identity key"
+	conf.Domain.AuthorityKey = "private authority key"
+
+	os.Setenv(EnvPassphrase, "secret")
+	defer os.Unsetenv(EnvPassphrase)
+	assert.Nil(Init(path, conf), t)
+
+	r1, err := Open(path)
+	assert.Nil(err, t)
+	assert.Nil(r1.Keystore().Put("other", []byte("keystore key")), t)
+	_, err = r1.(*FSRepo).Rekey("")
+	assert.Nil(err, t)
+	assert.Nil(r1.Close(), t)
+
+	for _, p := range []string{"config", filepath.Join(keystoreDir, "other")} {
+		b, err := ioutil.ReadFile(filepath.Join(path, p))
+		assert.Nil(err, t)
+		assert.False(bytes.Contains(b, []byte("private")), t, p, "should not hold the private keys in the clear")
+		assert.False(bytes.Contains(b, []byte("keystore key")), t, p, "should not hold the keystore keys in the clear")
+	}
+
+	r2, err := Open(path)
+	assert.Nil(err, t)
+	c, err := r2.Config()
+	assert.Nil(err, t)
+	assert.True(c.Identity.PrivKey == "private identity key", t, "the identity key should be opened")
+	assert.True(c.Domain.AuthorityKey == "private authority key", t, "the authority key should be opened")
+	k, err := r2.Keystore().Get("other")
+	assert.Nil(err, t)
+	assert.True(bytes.Equal(k, []byte("keystore key")), t, "the keystore key should be opened")
+
+	assert.Nil(r2.SetConfigKey("Domain.AuthorityKey", "private new key"), t)
+	c, err = r2.Config()
+	assert.Nil(err, t)
+	assert.True(c.Domain.AuthorityKey == "private new key", t, "the authority key should be set")
+	assert.Nil(r2.Close(), t)
+
+	b, err := ioutil.ReadFile(filepath.Join(path, "config"))
+	assert.Nil(err, t)
+	assert.False(bytes.Contains(b, []byte("private")), t, "a key set by hand should be sealed")
+}
+
+func TestLegacyGroupID(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("legacy", t)
+	assert.Nil(Init(path, &config.Config{}), t)
+
+	const uuid = "0f5c3b4e-7a36-4d2d-9b1e-2a9f8c1d6e4b"
+	gid := base64.StdEncoding.EncodeToString([]byte("iServDB" + uuid))
+	filename := filepath.Join(path, "config")
+	var mapconf map[string]interface{}
+	assert.Nil(serialize.ReadConfigFile(filename, &mapconf), t)
+	mapconf["Identity"].(map[string]interface{})["GroupID"] = gid
+	assert.Nil(serialize.WriteConfigFile(filename, mapconf), t)
+
+	r, err := Open(path)
+	assert.Nil(err, t)
+	c, err := r.Config()
+	assert.Nil(err, t)
+	assert.True(c.Domain.LegacyGroupID == gid, t, "the old GroupID should be kept")
+	assert.True(c.Domain.NodeUUID == uuid, t, "the old node UUID should be kept")
+	assert.Nil(c.Domain.Validate(), t)
+	assert.Nil(r.Close(), t)
+
+	mapconf = nil
+	assert.Nil(serialize.ReadConfigFile(filename, &mapconf), t)
+	_, ok := mapconf["Identity"].(map[string]interface{})["GroupID"]
+	assert.False(ok, t, "Identity.GroupID should be removed from the config file")
+}
+
+func TestCompressedBlocks(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("compressed", t)
+	conf := &config.Config{Datastore: config.Datastore{Compression: "deflate"}}
+	assert.Nil(Init(path, conf), t)
+
+	r1, err := Open(path)
+	assert.Nil(err, t)
+	text := bytes.Repeat([]byte("some text that compresses well\n"), 100)
+	assert.Nil(r1.Datastore().Put(datastore.NewKey("/blocks/CIQTEXT"), text), t)
+
+	physical, err := r1.GetStorageUsage()
+	assert.Nil(err, t)
+	logical, err := r1.GetLogicalStorageUsage()
+	assert.Nil(err, t)
+	assert.True(logical == uint64(len(text)), t, "the logical size should be the size of the block")
+	assert.True(physical < logical/2, t, "the block should be compressed")
+	assert.Nil(r1.Close(), t)
+
+	// turning compression off keeps compressed blocks readable
+	r2, err := Open(path)
+	assert.Nil(err, t)
+	conf2, err := r2.Config()
+	assert.Nil(err, t)
+	conf2.Datastore.Compression = ""
+	assert.Nil(r2.SetConfig(conf2), t)
+	assert.Nil(r2.Close(), t)
+
+	r3, err := Open(path)
+	assert.Nil(err, t)
+	v, err := r3.Datastore().Get(datastore.NewKey("/blocks/CIQTEXT"))
+	assert.Nil(err, t)
+	assert.True(bytes.Equal(v.([]byte), text), t, "data should match")
+	assert.Nil(r3.Close(), t)
+}
@@ -0,0 +1,56 @@
+package fsrepo
+
+import (
+	config "github.com/ipfs/go-ipfs/repo/config"
+	serialize "github.com/ipfs/go-ipfs/repo/fsrepo/serialize"
+)
+
+// Older versions kept the group of the node in Identity.GroupID, which the
+// Domain section replaced. The config is converted when the repo is opened,
+// so that the old group is not silently dropped by the config decoder.
+
+// migrateGroupID moves Identity.GroupID of the raw config mapconf to
+// Domain.LegacyGroupID, and returns true if it changed mapconf. The node
+// UUID encoded in the old GroupID is kept as Domain.NodeUUID.
+func migrateGroupID(mapconf map[string]interface{}) bool {
+	ident, ok := mapconf[config.IdentityTag].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	v, ok := ident["GroupID"]
+	if !ok {
+		return false
+	}
+	delete(ident, "GroupID")
+	gid, _ := v.(string)
+	if gid == "" {
+		return true
+	}
+
+	domain, ok := mapconf["Domain"].(map[string]interface{})
+	if !ok {
+		domain = map[string]interface{}{}
+		mapconf["Domain"] = domain
+	}
+	domain["LegacyGroupID"] = gid
+
+	if _, uuid, ok := config.ParseLegacyGroupID(gid); ok {
+		if cur, _ := domain["NodeUUID"].(string); cur == "" {
+			domain["NodeUUID"] = uuid
+		}
+	}
+	return true
+}
+
+// migrateConfigFile converts the config file of older versions in place.
+func migrateConfigFile(filename string) error {
+	var mapconf map[string]interface{}
+	if err := serialize.ReadConfigFile(filename, &mapconf); err != nil {
+		return err
+	}
+	if !migrateGroupID(mapconf) {
+		return nil
+	}
+	log.Warning("moved Identity.GroupID of an older version to Domain.LegacyGroupID")
+	return serialize.WriteConfigFile(filename, mapconf)
+}
@@ -0,0 +1,254 @@
+package mfsr
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// backupDir is the directory of the repo that backups are kept in.
+const backupDir = "migration-backup"
+
+// Migration changes a repo from version From to version From+1. Migrations
+// are compiled in and registered with Register, so that repos can be
+// migrated without fetching anything.
+type Migration struct {
+	From        int
+	Description string
+
+	// Touches lists the files and directories the migration changes,
+	// relative to the repo. They are backed up before the migration runs,
+	// and restored if it fails.
+	Touches []string
+
+	// Apply migrates the repo to version From+1, Revert migrates it back to
+	// From. With opts.DryRun set, they must check that they can run and
+	// report what they would do to opts.Out, without changing anything.
+	// Revert may be nil if the migration cannot be undone.
+	Apply  func(rp RepoPath, opts Options) error
+	Revert func(rp RepoPath, opts Options) error
+}
+
+// Options control how migrations run.
+type Options struct {
+	// DryRun checks the migrations without changing the repo. Each
+	// migration is checked against the repo as it is now.
+	DryRun bool
+
+	// KeepBackup keeps the backup of each migration once it succeeded.
+	KeepBackup bool
+
+	// Out receives the progress of the migrations.
+	Out io.Writer
+}
+
+func (o Options) printf(format string, args ...interface{}) {
+	if o.Out != nil {
+		fmt.Fprintf(o.Out, format, args...)
+	}
+}
+
+var registry = make(map[int]*Migration)
+
+// Register adds m to the compiled in migrations. It panics if a migration
+// from the same version is already registered.
+func Register(m *Migration) {
+	if _, ok := registry[m.From]; ok {
+		panic(fmt.Sprintf("migration from version %d registered twice", m.From))
+	}
+	registry[m.From] = m
+}
+
+// Registered returns the versions the compiled in migrations start from.
+func Registered() []int {
+	var out []int
+	for v := range registry {
+		out = append(out, v)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// NoMigrationError is returned when no migration is compiled in for a step.
+type NoMigrationError struct {
+	From, To int
+}
+
+func (e NoMigrationError) Error() string {
+	return fmt.Sprintf("no migration from repo version %d to %d is compiled in", e.From, e.To)
+}
+
+type step struct {
+	m        *Migration
+	from, to int
+	run      func(RepoPath, Options) error
+}
+
+// plan returns the steps migrating a repo from version from to version to.
+func plan(from, to int) ([]step, error) {
+	var steps []step
+	for v := from; v < to; v++ {
+		m, ok := registry[v]
+		if !ok {
+			return nil, NoMigrationError{From: v, To: v + 1}
+		}
+		steps = append(steps, step{m: m, from: v, to: v + 1, run: m.Apply})
+	}
+	for v := from; v > to; v-- {
+		m, ok := registry[v-1]
+		if !ok || m.Revert == nil {
+			return nil, NoMigrationError{From: v, To: v - 1}
+		}
+		steps = append(steps, step{m: m, from: v, to: v - 1, run: m.Revert})
+	}
+	return steps, nil
+}
+
+// Migrate runs the compiled in migrations taking the repo at rp to version
+// to, which may be lower than its version. The repo must not be in use.
+// Every step is backed up first, and rolled back if it fails, so a failed
+// migration leaves the repo at the version of the last step that
+// succeeded.
+func Migrate(rp RepoPath, to int, opts Options) error {
+	from, err := rp.Version()
+	if err != nil {
+		return err
+	}
+
+	// fail before changing anything if a step is missing
+	steps, err := plan(from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range steps {
+		opts.printf("  => Migrating repo from version %d to %d: %s\n", s.from, s.to, s.m.Description)
+		if opts.DryRun {
+			if err := s.run(rp, opts); err != nil {
+				return fmt.Errorf("migration from version %d to %d would fail: %s", s.from, s.to, err)
+			}
+			continue
+		}
+
+		backup := filepath.Join(string(rp), backupDir, fmt.Sprintf("%d-to-%d", s.from, s.to))
+		if err := backupPaths(rp, backup, s.m.Touches); err != nil {
+			return fmt.Errorf("backing up the repo: %s", err)
+		}
+
+		err := s.run(rp, opts)
+		if err == nil {
+			err = rp.WriteVersion(s.to)
+		}
+		if err != nil {
+			opts.printf("  => Failed, rolling back to version %d.\n", s.from)
+			if rerr := restorePaths(rp, backup, s.m.Touches); rerr != nil {
+				return fmt.Errorf("migration from version %d to %d failed: %s, and rolling it back failed: %s (the backup is in %s)", s.from, s.to, err, rerr, backup)
+			}
+			os.RemoveAll(backup)
+			return fmt.Errorf("migration from version %d to %d failed: %s", s.from, s.to, err)
+		}
+
+		if opts.KeepBackup {
+			opts.printf("  => Backup of version %d kept in %s\n", s.from, backup)
+		} else if err := os.RemoveAll(backup); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		opts.printf("  => Dry run, the repo was not changed.\n")
+	} else if len(steps) > 0 {
+		opts.printf("  => Success: the repo is at version %d.\n", to)
+	}
+	return nil
+}
+
+// backupPaths copies the version file and the paths of the repo into
+// backup, replacing an older backup.
+func backupPaths(rp RepoPath, backup string, paths []string) error {
+	if err := os.RemoveAll(backup); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backup, 0755); err != nil {
+		return err
+	}
+	for _, p := range append([]string{VersionFile}, paths...) {
+		src := filepath.Join(string(rp), p)
+		if _, err := os.Lstat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyTree(src, filepath.Join(backup, p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restorePaths puts the paths of the repo back as they are in backup.
+// Paths missing from the backup did not exist, they are removed.
+func restorePaths(rp RepoPath, backup string, paths []string) error {
+	for _, p := range append([]string{VersionFile}, paths...) {
+		dst := filepath.Join(string(rp), p)
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		src := filepath.Join(backup, p)
+		if _, err := os.Lstat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyTree(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTree copies the file or directory src to dst, keeping the modes.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, fi.Mode().Perm())
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			return copyFile(p, target, fi.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,143 @@
+package mfsr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testRepo(t *testing.T, version int) RepoPath {
+	dir, err := ioutil.TempDir("", "mfsr-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := RepoPath(dir)
+	if err := rp.WriteVersion(version); err != nil {
+		t.Fatal(err)
+	}
+	writeRepoFile(t, rp, "config", "old")
+	return rp
+}
+
+func writeRepoFile(t *testing.T, rp RepoPath, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(string(rp), name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectRepo(t *testing.T, rp RepoPath, version int, config string) {
+	v, err := rp.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != version {
+		t.Fatalf("expected repo version %d, got %d", version, v)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(string(rp), "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != config {
+		t.Fatalf("expected config %q, got %q", config, b)
+	}
+}
+
+// withMigrations replaces the registered migrations for the length of a
+// test.
+func withMigrations(t *testing.T, ms ...*Migration) func() {
+	old := registry
+	registry = make(map[int]*Migration)
+	for _, m := range ms {
+		Register(m)
+	}
+	return func() { registry = old }
+}
+
+func rewriteConfig(from, to string) *Migration {
+	return &Migration{
+		Description: "rewrite the config",
+		Touches:     []string{"config"},
+		Apply: func(rp RepoPath, opts Options) error {
+			if opts.DryRun {
+				return nil
+			}
+			return ioutil.WriteFile(filepath.Join(string(rp), "config"), []byte(to), 0644)
+		},
+		Revert: func(rp RepoPath, opts Options) error {
+			if opts.DryRun {
+				return nil
+			}
+			return ioutil.WriteFile(filepath.Join(string(rp), "config"), []byte(from), 0644)
+		},
+	}
+}
+
+func TestMigrateAndRevert(t *testing.T) {
+	first := rewriteConfig("old", "middle")
+	first.From = 1
+	second := rewriteConfig("middle", "new")
+	second.From = 2
+	defer withMigrations(t, first, second)()
+
+	rp := testRepo(t, 1)
+	defer os.RemoveAll(string(rp))
+
+	if err := Migrate(rp, 3, Options{DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	expectRepo(t, rp, 1, "old")
+
+	if err := Migrate(rp, 3, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	expectRepo(t, rp, 3, "new")
+	if _, err := os.Stat(filepath.Join(string(rp), backupDir, "2-to-3")); !os.IsNotExist(err) {
+		t.Fatal("the backup should be removed once the migration succeeded")
+	}
+
+	if err := Migrate(rp, 1, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	expectRepo(t, rp, 1, "old")
+
+	if _, ok := Migrate(rp, 4, Options{}).(NoMigrationError); !ok {
+		t.Fatal("expected a NoMigrationError for a missing step")
+	}
+	expectRepo(t, rp, 1, "old")
+}
+
+func TestMigrateRollback(t *testing.T) {
+	broken := &Migration{
+		From:        1,
+		Description: "fail half way",
+		Touches:     []string{"config", "datastore"},
+		Apply: func(rp RepoPath, opts Options) error {
+			if opts.DryRun {
+				return nil
+			}
+			writeRepoFile(t, rp, "config", "half")
+			if err := os.Mkdir(filepath.Join(string(rp), "datastore"), 0755); err != nil {
+				return err
+			}
+			return errors.New("broken migration")
+		},
+	}
+	defer withMigrations(t, broken)()
+
+	rp := testRepo(t, 1)
+	defer os.RemoveAll(string(rp))
+
+	if err := Migrate(rp, 2, Options{}); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	expectRepo(t, rp, 1, "old")
+	if _, err := os.Stat(filepath.Join(string(rp), "datastore")); !os.IsNotExist(err) {
+		t.Fatal("paths created by a failed migration should be removed")
+	}
+
+	if _, ok := Migrate(rp, 0, Options{}).(NoMigrationError); !ok {
+		t.Fatal("a migration without Revert cannot be undone")
+	}
+}
@@ -0,0 +1,181 @@
+package fsrepo
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	cryptds "github.com/ipfs/go-ipfs/thirdparty/cryptds"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// The private keys of encrypted repos are sealed with the datastore keys,
+// in the config file and in the keystore, so that the disk alone gives
+// neither the node identity nor the domain authority key.
+
+// sealedPrefix marks the config values sealed with the datastore keys.
+const sealedPrefix = "sealed:"
+
+// keystoreSealedMarker is created in the keystore directory once all its
+// keys are sealed. Names starting with a period are not keys.
+const keystoreSealedMarker = ".sealed"
+
+var errSealedConfig = errors.New("the config holds sealed keys, the repo must be opened with its passphrase")
+
+// configSecret is a config field holding a private key.
+type configSecret struct {
+	selector string
+	field    func(*config.Config) *string
+}
+
+var configSecrets = []configSecret{
+	{config.PrivKeySelector, func(c *config.Config) *string { return &c.Identity.PrivKey }},
+	{"Domain.AuthorityKey", func(c *config.Config) *string { return &c.Domain.AuthorityKey }},
+}
+
+// key binds the sealed value to the field, so that values cannot be
+// swapped between fields.
+func (s configSecret) key() ds.Key {
+	return ds.NewKey("/config").ChildString(s.selector)
+}
+
+// sealConfig seals the private keys of c that are not sealed yet.
+func sealConfig(keys *cryptds.Keyring, c *config.Config) error {
+	for _, s := range configSecrets {
+		v := s.field(c)
+		if *v == "" || strings.HasPrefix(*v, sealedPrefix) {
+			continue
+		}
+		sealed, err := keys.Seal(s.key(), []byte(*v))
+		if err != nil {
+			return err
+		}
+		*v = sealedPrefix + base64.StdEncoding.EncodeToString(sealed)
+	}
+	return nil
+}
+
+// unsealConfig opens the sealed private keys of c, and returns true if
+// some were stored in plaintext. keys may be nil for repos that are not
+// encrypted.
+func unsealConfig(keys *cryptds.Keyring, c *config.Config) (bool, error) {
+	var plaintext bool
+	for _, s := range configSecrets {
+		v := s.field(c)
+		if *v == "" {
+			continue
+		}
+		if !strings.HasPrefix(*v, sealedPrefix) {
+			plaintext = true
+			continue
+		}
+		if keys == nil {
+			return false, errSealedConfig
+		}
+		sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(*v, sealedPrefix))
+		if err != nil {
+			return false, err
+		}
+		plain, err := keys.Open(s.key(), sealed)
+		if err != nil {
+			return false, err
+		}
+		*v = string(plain)
+	}
+	return plaintext, nil
+}
+
+// sealedKeystore seals the keys of an FSKeystore with the datastore keys.
+type sealedKeystore struct {
+	*keystore.FSKeystore
+	keys *cryptds.Keyring
+}
+
+func keystoreKey(name string) ds.Key {
+	return ds.NewKey("/keystore").ChildString(name)
+}
+
+// newSealedKeystore seals the keys of ks in dir, first sealing those that
+// were stored before the repo sealed them.
+func newSealedKeystore(ks *keystore.FSKeystore, dir string, keys *cryptds.Keyring) (*sealedKeystore, error) {
+	sk := &sealedKeystore{FSKeystore: ks, keys: keys}
+
+	marker := filepath.Join(dir, keystoreSealedMarker)
+	if _, err := os.Stat(marker); err == nil {
+		return sk, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	names, err := ks.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		plain, err := ks.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := keys.Open(keystoreKey(name), plain); err == nil {
+			// sealed before an interrupted run
+			continue
+		}
+		if err := sk.Replace(name, plain); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(marker, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return sk, f.Close()
+}
+
+func (sk *sealedKeystore) Put(name string, key []byte) error {
+	sealed, err := sk.keys.Seal(keystoreKey(name), key)
+	if err != nil {
+		return err
+	}
+	return sk.FSKeystore.Put(name, sealed)
+}
+
+// Replace stores key under name, sealed with the current datastore key.
+func (sk *sealedKeystore) Replace(name string, key []byte) error {
+	sealed, err := sk.keys.Seal(keystoreKey(name), key)
+	if err != nil {
+		return err
+	}
+	return sk.FSKeystore.Replace(name, sealed)
+}
+
+func (sk *sealedKeystore) Get(name string) ([]byte, error) {
+	sealed, err := sk.FSKeystore.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return sk.keys.Open(keystoreKey(name), sealed)
+}
+
+// reseal seals all keys again with the current datastore key.
+func (sk *sealedKeystore) reseal() error {
+	names, err := sk.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		plain, err := sk.Get(name)
+		if err != nil {
+			return err
+		}
+		if err := sk.Replace(name, plain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,520 @@
+package fsrepo
+
+import (
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dsq "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/query"
+)
+
+// usageKey and coldUsageKey are where the sizes of the blocks datastores
+// are kept between runs, in the leveldb datastore.
+var (
+	usageKey     = ds.NewKey("/local/usage/blocks")
+	coldUsageKey = ds.NewKey("/local/usage/coldblocks")
+)
+
+// usageSaveInterval is how often the count and the sizes of the values
+// stored since the last save are written to the leveldb datastore.
+var usageSaveInterval = 30 * time.Second
+
+// usageLocks is the number of locks serializing the accounting of
+// operations on the same key.
+const usageLocks = 64
+
+// usageDatastore keeps count of the bytes stored in the blocks datastore,
+// so that the repo size is known without walking the disk.
+//
+// The sizes of the values are recorded too, so that deletes do not read
+// the values. The count and the sizes are saved periodically and on Close.
+// A repo that was not closed is measured again when opened, as the saved
+// count may be behind.
+type usageDatastore struct {
+	ds.Datastore
+
+	// meta is where the count is persisted, under key.
+	meta ds.Datastore
+	key  ds.Key
+
+	// locks serialize the check and the write of a key, so that
+	// concurrent puts of the same value count it once.
+	locks [usageLocks]sync.Mutex
+
+	lk    sync.Mutex
+	usage uint64
+	sizes map[ds.Key]int64 // sizes not saved yet, -1 once deleted
+	dirty bool
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// newUsageDatastore wraps d, loading the count from k in meta. Repos that
+// have no count yet, or were not closed, are measured with count.
+func newUsageDatastore(d, meta ds.Datastore, k ds.Key, count func() (uint64, error)) (*usageDatastore, error) {
+	u := &usageDatastore{
+		Datastore: d,
+		meta:      meta,
+		key:       k,
+		sizes:     make(map[ds.Key]int64),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	measured, err := u.load()
+	if err != nil {
+		return nil, err
+	}
+	if !measured {
+		log.Info("measuring the blocks datastore, this may take a while")
+		u.usage, err = count()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the open marker is removed on Close, a repo that still has it was
+	// not closed
+	if err := meta.Put(u.openKey(), []byte{}); err != nil {
+		return nil, err
+	}
+	if err := u.save(u.usage, nil); err != nil {
+		return nil, err
+	}
+	go u.run()
+	return u, nil
+}
+
+// load reads the saved count, and returns false if there is none that can
+// be trusted.
+func (u *usageDatastore) load() (bool, error) {
+	open, err := u.meta.Has(u.openKey())
+	if err != nil {
+		return false, err
+	}
+	if open {
+		log.Warning("the repo was not closed, its size must be measured again")
+		return false, nil
+	}
+
+	v, err := u.meta.Get(u.key)
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return false, ds.ErrInvalidType
+	}
+	u.usage, err = strconv.ParseUint(string(b), 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (u *usageDatastore) openKey() ds.Key {
+	return u.key.ChildString("open")
+}
+
+func (u *usageDatastore) sizeKey(k ds.Key) ds.Key {
+	return u.key.ChildString("sizes").Child(k)
+}
+
+func (u *usageDatastore) keyLock(k ds.Key) *sync.Mutex {
+	return &u.locks[keyLockIndex(k)]
+}
+
+func keyLockIndex(k ds.Key) int {
+	h := fnv.New32a()
+	h.Write([]byte(k.String()))
+	return int(h.Sum32() % usageLocks)
+}
+
+// Usage returns the number of bytes in the blocks datastore.
+func (u *usageDatastore) Usage() uint64 {
+	u.lk.Lock()
+	defer u.lk.Unlock()
+	return u.usage
+}
+
+// add applies delta to the count and records the sizes of the values
+// stored or deleted, -1 for deleted ones.
+func (u *usageDatastore) add(delta int64, sizes map[ds.Key]int64) {
+	u.lk.Lock()
+	defer u.lk.Unlock()
+	if delta < 0 && uint64(-delta) > u.usage {
+		u.usage = 0
+	} else {
+		u.usage = uint64(int64(u.usage) + delta)
+	}
+	for k, s := range sizes {
+		u.sizes[k] = s
+	}
+	u.dirty = true
+}
+
+// size returns the size of the value of k. Values stored before their
+// sizes were recorded are read.
+func (u *usageDatastore) size(k ds.Key) (int64, error) {
+	u.lk.Lock()
+	s, ok := u.sizes[k]
+	u.lk.Unlock()
+	if ok && s >= 0 {
+		return s, nil
+	}
+
+	if !ok {
+		v, err := u.meta.Get(u.sizeKey(k))
+		switch err {
+		case nil:
+			if b, ok := v.([]byte); ok {
+				if s, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+					return s, nil
+				}
+			}
+		case ds.ErrNotFound:
+		default:
+			return 0, err
+		}
+	}
+
+	v, err := u.Datastore.Get(k)
+	if err != nil {
+		return 0, err
+	}
+	b, _ := v.([]byte)
+	return int64(len(b)), nil
+}
+
+func (u *usageDatastore) run() {
+	defer close(u.done)
+	tick := time.NewTicker(usageSaveInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := u.flush(); err != nil {
+				log.Warning("failed to store the size of the blocks datastore: ", err)
+			}
+		case <-u.closing:
+			return
+		}
+	}
+}
+
+// flush saves the count and the sizes recorded since the last save.
+func (u *usageDatastore) flush() error {
+	u.lk.Lock()
+	if !u.dirty {
+		u.lk.Unlock()
+		return nil
+	}
+	usage, sizes := u.usage, u.sizes
+	u.sizes = make(map[ds.Key]int64)
+	u.dirty = false
+	u.lk.Unlock()
+
+	if err := u.save(usage, sizes); err != nil {
+		u.lk.Lock()
+		for k, s := range sizes {
+			if _, ok := u.sizes[k]; !ok {
+				u.sizes[k] = s
+			}
+		}
+		u.dirty = true
+		u.lk.Unlock()
+		return err
+	}
+	return nil
+}
+
+// save writes usage and sizes to meta, in a single batch where possible.
+func (u *usageDatastore) save(usage uint64, sizes map[ds.Key]int64) error {
+	var b ds.Batch
+	if bm, ok := u.meta.(ds.Batching); ok {
+		var err error
+		b, err = bm.Batch()
+		if err != nil {
+			return err
+		}
+	} else {
+		b = ds.NewBasicBatch(u.meta)
+	}
+
+	var deleted []ds.Key
+	for k, s := range sizes {
+		if s < 0 {
+			deleted = append(deleted, u.sizeKey(k))
+			continue
+		}
+		if err := b.Put(u.sizeKey(k), []byte(strconv.FormatInt(s, 10))); err != nil {
+			return err
+		}
+	}
+	if err := b.Put(u.key, []byte(strconv.FormatUint(usage, 10))); err != nil {
+		return err
+	}
+	if err := b.Commit(); err != nil {
+		return err
+	}
+
+	for _, k := range deleted {
+		if err := u.meta.Delete(k); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *usageDatastore) Put(k ds.Key, v interface{}) error {
+	l := u.keyLock(k)
+	l.Lock()
+	defer l.Unlock()
+
+	delta, err := u.putDelta(k, v)
+	if err != nil {
+		return err
+	}
+	if err := u.Datastore.Put(k, v); err != nil {
+		return err
+	}
+	if delta > 0 {
+		u.add(delta, map[ds.Key]int64{k: delta})
+	}
+	return nil
+}
+
+// putDelta returns how much storing v under k grows the datastore. Blocks
+// are content addressed, overwriting one does not change its size. The
+// lock of k must be held.
+func (u *usageDatastore) putDelta(k ds.Key, v interface{}) (int64, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return 0, nil
+	}
+	has, err := u.Datastore.Has(k)
+	if err != nil || has {
+		return 0, err
+	}
+	return int64(len(b)), nil
+}
+
+func (u *usageDatastore) Delete(k ds.Key) error {
+	l := u.keyLock(k)
+	l.Lock()
+	defer l.Unlock()
+
+	size, err := u.size(k)
+	if err != nil {
+		return err
+	}
+	if err := u.Datastore.Delete(k); err != nil {
+		return err
+	}
+	u.add(-size, map[ds.Key]int64{k: -1})
+	return nil
+}
+
+func (u *usageDatastore) Batch() (ds.Batch, error) {
+	bds, ok := u.Datastore.(ds.Batching)
+	if !ok {
+		return ds.NewBasicBatch(u), nil
+	}
+
+	b, err := bds.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &usageBatch{u: u, b: b, ops: make(map[ds.Key]interface{})}, nil
+}
+
+// Close saves the count and the sizes, and closes the wrapped datastore.
+func (u *usageDatastore) Close() error {
+	err := u.shutdown()
+	if c, ok := u.Datastore.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// shutdown stops the periodic saves, saves the count and marks the repo
+// as closed. Calls after the first do nothing.
+func (u *usageDatastore) shutdown() error {
+	select {
+	case <-u.closing:
+		return nil
+	default:
+	}
+	close(u.closing)
+	<-u.done
+
+	if err := u.flush(); err != nil {
+		return err
+	}
+	return u.meta.Delete(u.openKey())
+}
+
+// deleteOp marks the keys deleted in a usageBatch.
+type deleteOp struct{}
+
+// usageBatch accounts for the operations of a batch when it is committed,
+// holding the locks of their keys.
+type usageBatch struct {
+	u   *usageDatastore
+	b   ds.Batch
+	ops map[ds.Key]interface{} // the last value put, or deleteOp
+}
+
+func (b *usageBatch) Put(k ds.Key, v interface{}) error {
+	if err := b.b.Put(k, v); err != nil {
+		return err
+	}
+	b.ops[k] = v
+	return nil
+}
+
+func (b *usageBatch) Delete(k ds.Key) error {
+	if err := b.b.Delete(k); err != nil {
+		return err
+	}
+	b.ops[k] = deleteOp{}
+	return nil
+}
+
+func (b *usageBatch) Commit() error {
+	// take the locks in order, so that batches do not deadlock
+	var idx []int
+	taken := make(map[int]bool)
+	for k := range b.ops {
+		if i := keyLockIndex(k); !taken[i] {
+			taken[i] = true
+			idx = append(idx, i)
+		}
+	}
+	sort.Ints(idx)
+	for _, i := range idx {
+		b.u.locks[i].Lock()
+		defer b.u.locks[i].Unlock()
+	}
+
+	var delta int64
+	sizes := make(map[ds.Key]int64)
+	for k, v := range b.ops {
+		if _, ok := v.(deleteOp); ok {
+			size, err := b.u.size(k)
+			if err == ds.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			delta -= size
+			sizes[k] = -1
+			continue
+		}
+		d, err := b.u.putDelta(k, v)
+		if err != nil {
+			return err
+		}
+		if d > 0 {
+			delta += d
+			sizes[k] = d
+		}
+	}
+
+	if err := b.b.Commit(); err != nil {
+		return err
+	}
+	b.u.add(delta, sizes)
+	b.ops = make(map[ds.Key]interface{})
+	return nil
+}
+
+// dirUsage returns a count function summing up the sizes of the files
+// below dir, for flatfs.
+func dirUsage(dir string) func() (uint64, error) {
+	return func() (uint64, error) {
+		var du uint64
+		err := filepath.Walk(dir, func(p string, f os.FileInfo, err error) error {
+			if err != nil {
+				log.Debugf("filepath.Walk error: %s", err)
+				return nil
+			}
+			if f.Mode().IsRegular() {
+				du += uint64(f.Size())
+			}
+			return nil
+		})
+		return du, err
+	}
+}
+
+// keysUsage returns a count function summing up the sizes of all values
+// in d, reading them one by one. It works on datastores that can only
+// list their keys.
+func keysUsage(d ds.Datastore) func() (uint64, error) {
+	return func() (uint64, error) {
+		res, err := d.Query(dsq.Query{KeysOnly: true})
+		if err != nil {
+			return 0, err
+		}
+		defer res.Close()
+
+		var du uint64
+		for e := range res.Next() {
+			if e.Error != nil {
+				return 0, e.Error
+			}
+			v, err := d.Get(ds.NewKey(e.Key))
+			if err == ds.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			b, ok := v.([]byte)
+			if !ok {
+				return 0, ds.ErrInvalidType
+			}
+			du += uint64(len(b))
+		}
+		return du, nil
+	}
+}
+
+// queryUsage returns a count function summing up the sizes of all values
+// in d, for backends that are not on the local disk.
+func queryUsage(d ds.Datastore) func() (uint64, error) {
+	return func() (uint64, error) {
+		res, err := d.Query(dsq.Query{})
+		if err != nil {
+			return 0, err
+		}
+
+		var du uint64
+		for e := range res.Next() {
+			if e.Error != nil {
+				return 0, e.Error
+			}
+			b, ok := e.Value.([]byte)
+			if !ok {
+				return 0, ds.ErrInvalidType
+			}
+			du += uint64(len(b))
+		}
+		return du, nil
+	}
+}
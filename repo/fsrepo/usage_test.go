@@ -0,0 +1,141 @@
+package fsrepo
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dssync "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/sync"
+)
+
+// noReads fails the reads of values, deletes must not need them.
+type noReads struct {
+	ds.Datastore
+}
+
+func (noReads) Get(ds.Key) (interface{}, error) {
+	return nil, errors.New("unexpected read")
+}
+
+type usageTest struct {
+	d, meta ds.Datastore
+	counts  int
+}
+
+func newUsageTest() *usageTest {
+	return &usageTest{
+		d:    dssync.MutexWrap(ds.NewMapDatastore()),
+		meta: dssync.MutexWrap(ds.NewMapDatastore()),
+	}
+}
+
+func (ut *usageTest) open(t *testing.T) *usageDatastore {
+	u, err := newUsageDatastore(ut.d, ut.meta, usageKey, func() (uint64, error) {
+		ut.counts++
+		return keysUsage(ut.d)()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func expectUsage(t *testing.T, u *usageDatastore, expected uint64) {
+	if got := u.Usage(); got != expected {
+		t.Fatalf("expected usage %d, got %d", expected, got)
+	}
+}
+
+func TestUsageConcurrentPuts(t *testing.T) {
+	u := newUsageTest().open(t)
+	defer u.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := u.Put(ds.NewKey("/CIQA"), make([]byte, 100)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	expectUsage(t, u, 100)
+}
+
+func TestUsageBatch(t *testing.T) {
+	u := newUsageTest().open(t)
+	defer u.Close()
+
+	b, err := u.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Put(ds.NewKey("/CIQA"), make([]byte, 100))
+	b.Put(ds.NewKey("/CIQA"), make([]byte, 100))
+	b.Put(ds.NewKey("/CIQB"), make([]byte, 50))
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectUsage(t, u, 150)
+
+	b, err = u.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Delete(ds.NewKey("/CIQB"))
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectUsage(t, u, 100)
+}
+
+func TestUsageDeleteUsesSizes(t *testing.T) {
+	ut := newUsageTest()
+	u := ut.open(t)
+	if err := u.Put(ds.NewKey("/CIQA"), make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ut.d = noReads{ut.d}
+	u = ut.open(t)
+	defer u.Close()
+	expectUsage(t, u, 100)
+	if err := u.Delete(ds.NewKey("/CIQA")); err != nil {
+		t.Fatal(err)
+	}
+	expectUsage(t, u, 0)
+}
+
+func TestUsageRecountAfterCrash(t *testing.T) {
+	ut := newUsageTest()
+	u := ut.open(t)
+	if ut.counts != 1 {
+		t.Fatal("a new datastore should be measured")
+	}
+	if err := u.Put(ds.NewKey("/CIQA"), make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// not closed, the saved count may be behind
+	u = ut.open(t)
+	if ut.counts != 2 {
+		t.Fatal("a datastore that was not closed should be measured again")
+	}
+	expectUsage(t, u, 100)
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	u = ut.open(t)
+	defer u.Close()
+	if ut.counts != 2 {
+		t.Fatal("a closed datastore should not be measured again")
+	}
+	expectUsage(t, u, 100)
+}
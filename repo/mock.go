@@ -3,6 +3,7 @@ package repo
 import (
 	"errors"
 
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	"github.com/ipfs/go-ipfs/repo/config"
 )
 
@@ -12,6 +13,7 @@ var errTODO = errors.New("TODO: mock repo")
 type Mock struct {
 	C config.Config
 	D Datastore
+	K keystore.Keystore
 }
 
 func (m *Mock) Config() (*config.Config, error) {
@@ -33,8 +35,17 @@ func (m *Mock) GetConfigKey(key string) (interface{}, error) {
 
 func (m *Mock) Datastore() Datastore { return m.D }
 
+func (m *Mock) Keystore() keystore.Keystore {
+	if m.K == nil {
+		m.K = keystore.NewMemKeystore()
+	}
+	return m.K
+}
+
 func (m *Mock) GetStorageUsage() (uint64, error) { return 0, nil }
 
+func (m *Mock) GetLogicalStorageUsage() (uint64, error) { return 0, nil }
+
 func (m *Mock) Close() error { return errTODO }
 
 func (m *Mock) SetAPIAddr(addr string) error { return errTODO }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
 )
@@ -21,6 +22,12 @@ type Repo interface {
 
 	Datastore() Datastore
 	GetStorageUsage() (uint64, error)
+	// GetLogicalStorageUsage returns the size of the blocks before they
+	// were compressed.
+	GetLogicalStorageUsage() (uint64, error)
+
+	// Keystore returns the store of secret keys belonging to the repo.
+	Keystore() keystore.Keystore
 
 	// SetAPIAddr sets the API address in the repo.
 	SetAPIAddr(addr string) error
@@ -3,6 +3,7 @@ package supernode
 import (
 	"errors"
 	"fmt"
+	"sync"
 
 	proxy "github.com/ipfs/go-ipfs/routing/supernode/proxy"
 
@@ -17,17 +18,40 @@ import (
 	pb "gx/ipfs/Qme7D9iKHYxwq28p6PzCymywsYSRBx9uyGzW7qNB3s9VbC/go-libp2p-record/pb"
 )
 
+// GroupFunc returns the GroupID of the domain p belongs to, or the empty
+// string for peers outside of any domain. It returns an error if p's
+// membership cannot be established.
+type GroupFunc func(ctx context.Context, p peer.ID) (string, error)
+
 // Server handles routing queries using a database backend
 type Server struct {
 	local           peer.ID
 	routingBackend  datastore.Datastore
 	peerstore       pstore.Peerstore
 	*proxy.Loopback // so server can be injected into client
+
+	groupOf GroupFunc
+	groupsL sync.Mutex
+	groups  map[peer.ID]string // last group each requesting peer was seen in
 }
 
 // NewServer creates a new Supernode routing Server
 func NewServer(ds datastore.Datastore, ps pstore.Peerstore, local peer.ID) (*Server, error) {
-	s := &Server{local, ds, ps, nil}
+	return NewGroupServer(ds, ps, local, nil)
+}
+
+// NewGroupServer creates a Supernode routing Server shared by several
+// domains. Records are kept in a separate namespace per GroupID, as
+// reported by groupOf, so that domains never see each other's providers
+// or values. A nil groupOf puts every peer in the public namespace.
+func NewGroupServer(ds datastore.Datastore, ps pstore.Peerstore, local peer.ID, groupOf GroupFunc) (*Server, error) {
+	s := &Server{
+		local:          local,
+		routingBackend: ds,
+		peerstore:      ps,
+		groupOf:        groupOf,
+		groups:         make(map[peer.ID]string),
+	}
 	s.Loopback = &proxy.Loopback{
 		Handler: s,
 		Local:   local,
@@ -51,11 +75,17 @@ func (s *Server) handleMessage(
 
 	defer log.EventBegin(ctx, "routingMessageReceived", req, p).Done()
 
+	ns, err := s.namespace(ctx, p)
+	if err != nil {
+		log.Event(ctx, "groupCheckFailed", p, req)
+		return "", nil
+	}
+
 	var response = dhtpb.NewMessage(req.GetType(), req.GetKey(), req.GetClusterLevel())
 	switch req.GetType() {
 
 	case dhtpb.Message_GET_VALUE:
-		rawRecord, err := getRoutingRecord(s.routingBackend, key.Key(req.GetKey()))
+		rawRecord, err := getRoutingRecord(s.routingBackend, ns, key.Key(req.GetKey()))
 		if err != nil {
 			return "", nil
 		}
@@ -69,11 +99,16 @@ func (s *Server) handleMessage(
 		// 	log.Event(ctx, "validationFailed", req, p)
 		// 	return "", nil
 		// }
-		putRoutingRecord(s.routingBackend, key.Key(req.GetKey()), req.GetRecord())
+		putRoutingRecord(s.routingBackend, ns, key.Key(req.GetKey()), req.GetRecord())
 		return p, req
 
 	case dhtpb.Message_FIND_NODE:
-		p := s.peerstore.PeerInfo(peer.ID(req.GetKey()))
+		target := peer.ID(req.GetKey())
+		if !s.inNamespace(target, ns) {
+			log.Event(ctx, "findNodeOtherGroup", p, req)
+			return "", nil
+		}
+		p := s.peerstore.PeerInfo(target)
 		pri := []dhtpb.PeerRoutingInfo{
 			{
 				PeerInfo: p,
@@ -89,7 +124,7 @@ func (s *Server) handleMessage(
 			if providerID == p {
 				store := []*dhtpb.Message_Peer{provider}
 				storeProvidersToPeerstore(s.peerstore, p, store)
-				if err := putRoutingProviders(s.routingBackend, key.Key(req.GetKey()), store); err != nil {
+				if err := putRoutingProviders(s.routingBackend, ns, key.Key(req.GetKey()), store); err != nil {
 					return "", nil
 				}
 			} else {
@@ -99,7 +134,7 @@ func (s *Server) handleMessage(
 		return "", nil
 
 	case dhtpb.Message_GET_PROVIDERS:
-		providers, err := getRoutingProviders(s.routingBackend, key.Key(req.GetKey()))
+		providers, err := getRoutingProviders(s.routingBackend, ns, key.Key(req.GetKey()))
 		if err != nil {
 			return "", nil
 		}
@@ -116,8 +151,37 @@ func (s *Server) handleMessage(
 var _ proxy.RequestHandler = &Server{}
 var _ proxy.Proxy = &Server{}
 
-func getRoutingRecord(ds datastore.Datastore, k key.Key) (*pb.Record, error) {
-	dskey := k.DsKey()
+// namespace returns the record namespace of the group p belongs to. The
+// local node always uses the public namespace.
+func (s *Server) namespace(ctx context.Context, p peer.ID) (string, error) {
+	if s.groupOf == nil || p == s.local {
+		return "", nil
+	}
+
+	ns, err := s.groupOf(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	s.groupsL.Lock()
+	s.groups[p] = ns
+	s.groupsL.Unlock()
+	return ns, nil
+}
+
+// inNamespace reports whether p was last seen in namespace ns. Peers that
+// never sent us a request are only visible in the public namespace.
+func (s *Server) inNamespace(p peer.ID, ns string) bool {
+	s.groupsL.Lock()
+	defer s.groupsL.Unlock()
+	return s.groups[p] == ns
+}
+
+func getRoutingRecord(ds datastore.Datastore, ns string, k key.Key) (*pb.Record, error) {
+	dskey, err := recordKey(ns, k)
+	if err != nil {
+		return nil, err
+	}
 	val, err := ds.Get(dskey)
 	if err != nil {
 		return nil, err
@@ -133,22 +197,24 @@ func getRoutingRecord(ds datastore.Datastore, k key.Key) (*pb.Record, error) {
 	return &record, nil
 }
 
-func putRoutingRecord(ds datastore.Datastore, k key.Key, value *pb.Record) error {
+func putRoutingRecord(ds datastore.Datastore, ns string, k key.Key, value *pb.Record) error {
 	data, err := proto.Marshal(value)
 	if err != nil {
 		return err
 	}
-	dskey := k.DsKey()
-	// TODO namespace
+	dskey, err := recordKey(ns, k)
+	if err != nil {
+		return err
+	}
 	if err := ds.Put(dskey, data); err != nil {
 		return err
 	}
 	return nil
 }
 
-func putRoutingProviders(ds datastore.Datastore, k key.Key, newRecords []*dhtpb.Message_Peer) error {
+func putRoutingProviders(ds datastore.Datastore, ns string, k key.Key, newRecords []*dhtpb.Message_Peer) error {
 	log.Event(context.Background(), "putRoutingProviders", &k)
-	oldRecords, err := getRoutingProviders(ds, k)
+	oldRecords, err := getRoutingProviders(ds, ns, k)
 	if err != nil {
 		return err
 	}
@@ -168,7 +234,7 @@ func putRoutingProviders(ds datastore.Datastore, k key.Key, newRecords []*dhtpb.
 	if err != nil {
 		return err
 	}
-	return ds.Put(providerKey(k), data)
+	return ds.Put(providerKey(ns, k), data)
 }
 
 func storeProvidersToPeerstore(ps pstore.Peerstore, p peer.ID, providers []*dhtpb.Message_Peer) {
@@ -185,11 +251,11 @@ func storeProvidersToPeerstore(ps pstore.Peerstore, p peer.ID, providers []*dhtp
 	}
 }
 
-func getRoutingProviders(ds datastore.Datastore, k key.Key) ([]*dhtpb.Message_Peer, error) {
+func getRoutingProviders(ds datastore.Datastore, ns string, k key.Key) ([]*dhtpb.Message_Peer, error) {
 	e := log.EventBegin(context.Background(), "getProviders", &k)
 	defer e.Done()
 	var providers []*dhtpb.Message_Peer
-	if v, err := ds.Get(providerKey(k)); err == nil {
+	if v, err := ds.Get(providerKey(ns, k)); err == nil {
 		if data, ok := v.([]byte); ok {
 			var msg dhtpb.Message
 			if err := proto.Unmarshal(data, &msg); err != nil {
@@ -201,8 +267,33 @@ func getRoutingProviders(ds datastore.Datastore, k key.Key) ([]*dhtpb.Message_Pe
 	return providers, nil
 }
 
-func providerKey(k key.Key) datastore.Key {
-	return datastore.KeyWithNamespaces([]string{"routing", "providers", k.String()})
+var errReservedKey = errors.New("record key collides with the namespaced records of a group")
+
+// recordKey returns the key of the value record k in namespace ns. The
+// public namespace keeps the layout used before records were namespaced,
+// so its keys must not reach into the groups' namespaces.
+func recordKey(ns string, k key.Key) (datastore.Key, error) {
+	if ns != "" {
+		return groupKey(ns).ChildString("records").Child(k.DsKey()), nil
+	}
+	dskey := k.DsKey()
+	if groupsRoot.IsAncestorOf(dskey) {
+		return datastore.Key{}, errReservedKey
+	}
+	return dskey, nil
+}
+
+func providerKey(ns string, k key.Key) datastore.Key {
+	if ns == "" {
+		return datastore.KeyWithNamespaces([]string{"routing", "providers", k.String()})
+	}
+	return groupKey(ns).ChildString("providers").ChildString(k.String())
+}
+
+var groupsRoot = datastore.NewKey("/routing/groups")
+
+func groupKey(ns string) datastore.Key {
+	return groupsRoot.ChildString(ns)
 }
 
 func verify(ps pstore.Peerstore, r *pb.Record) error {
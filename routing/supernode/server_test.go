@@ -1,11 +1,18 @@
 package supernode
 
 import (
+	"errors"
 	"testing"
 
+	testutil "github.com/ipfs/go-ipfs/thirdparty/testutil"
+
+	peer "gx/ipfs/QmWXjJo15p4pzT7cayEwZi2sWgJqLnGDof6ZGMh9xBgU1p/go-libp2p-peer"
 	dhtpb "gx/ipfs/QmYvLYkYiVEi5LBHP2uFqiUaHqH7zWnEuRqoNEuGLNG6JB/go-libp2p-kad-dht/pb"
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
 	datastore "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
 	key "gx/ipfs/Qmce4Y4zg3sYr7xKM5UueS67vhNni6EeWgCRnb7MbLJMew/go-key"
+	pstore "gx/ipfs/QmdMfSLMDBDYhtc4oF3NYGCZr5dy4wQb6Ji26N4D4mdxa2/go-libp2p-peerstore"
+	pb "gx/ipfs/Qme7D9iKHYxwq28p6PzCymywsYSRBx9uyGzW7qNB3s9VbC/go-libp2p-record/pb"
 )
 
 func TestPutProviderDoesntResultInDuplicates(t *testing.T) {
@@ -15,14 +22,14 @@ func TestPutProviderDoesntResultInDuplicates(t *testing.T) {
 		convPeer("bob", "127.0.0.1/tcp/4001"),
 		convPeer("alice", "10.0.0.10/tcp/4001"),
 	}
-	if err := putRoutingProviders(routingBackend, k, put); err != nil {
+	if err := putRoutingProviders(routingBackend, "", k, put); err != nil {
 		t.Fatal(err)
 	}
-	if err := putRoutingProviders(routingBackend, k, put); err != nil {
+	if err := putRoutingProviders(routingBackend, "", k, put); err != nil {
 		t.Fatal(err)
 	}
 
-	got, err := getRoutingProviders(routingBackend, k)
+	got, err := getRoutingProviders(routingBackend, "", k)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,6 +38,67 @@ func TestPutProviderDoesntResultInDuplicates(t *testing.T) {
 	}
 }
 
+func TestGroupNamespaces(t *testing.T) {
+	ctx := context.Background()
+	alice := testutil.RandPeerIDFatal(t)
+	bob := testutil.RandPeerIDFatal(t)
+	carol := testutil.RandPeerIDFatal(t)
+	mallory := testutil.RandPeerIDFatal(t)
+	groups := map[peer.ID]string{alice: "groupA", bob: "groupB"}
+	groupOf := func(ctx context.Context, p peer.ID) (string, error) {
+		if p == mallory {
+			return "", errors.New("bad certificate")
+		}
+		return groups[p], nil
+	}
+
+	s, err := NewGroupServer(datastore.NewMapDatastore(), pstore.NewPeerstore(), testutil.RandPeerIDFatal(t), groupOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := "/ipns/foo"
+	put := dhtpb.NewMessage(dhtpb.Message_PUT_VALUE, k, 0)
+	put.Record = &pb.Record{Key: &k, Value: []byte("alice's value")}
+	s.HandleRequest(ctx, alice, put)
+
+	get := dhtpb.NewMessage(dhtpb.Message_GET_VALUE, k, 0)
+	if resp := s.HandleRequest(ctx, alice, get); resp == nil || string(resp.GetRecord().GetValue()) != "alice's value" {
+		t.Fatal("member could not read its own group's record")
+	}
+	for _, p := range []peer.ID{bob, carol, mallory} {
+		if resp := s.HandleRequest(ctx, p, get); resp != nil && resp.GetRecord() != nil {
+			t.Fatalf("%s read a record of another group", p)
+		}
+	}
+
+	prov := dhtpb.NewMessage(dhtpb.Message_ADD_PROVIDER, "obj", 0)
+	prov.ProviderPeers = dhtpb.RawPeerInfosToPBPeers([]pstore.PeerInfo{{ID: bob}})
+	s.HandleRequest(ctx, bob, prov)
+
+	getProv := dhtpb.NewMessage(dhtpb.Message_GET_PROVIDERS, "obj", 0)
+	if resp := s.HandleRequest(ctx, bob, getProv); resp == nil || len(resp.GetProviderPeers()) != 1 {
+		t.Fatal("member could not find the providers of its own group")
+	}
+	if resp := s.HandleRequest(ctx, carol, getProv); resp != nil && len(resp.GetProviderPeers()) != 0 {
+		t.Fatal("public peer found providers of a group")
+	}
+
+	findBob := dhtpb.NewMessage(dhtpb.Message_FIND_NODE, string(bob), 0)
+	if resp := s.HandleRequest(ctx, alice, findBob); resp != nil {
+		t.Fatal("member of another group could look up a peer")
+	}
+	if resp := s.HandleRequest(ctx, mallory, dhtpb.NewMessage(dhtpb.Message_PING, "", 0)); resp != nil {
+		t.Fatal("request from a peer with an invalid certificate was answered")
+	}
+
+	reserved := "/routing/groups/groupA/records/ipns/foo"
+	steal := dhtpb.NewMessage(dhtpb.Message_GET_VALUE, reserved, 0)
+	if resp := s.HandleRequest(ctx, carol, steal); resp != nil && resp.GetRecord() != nil {
+		t.Fatal("public peer reached into a group namespace")
+	}
+}
+
 func convPeer(name string, addrs ...string) *dhtpb.Message_Peer {
 	var rawAddrs [][]byte
 	for _, addr := range addrs {
@@ -121,6 +121,39 @@ test_expect_success "clean up ipfs dir" '
 	rm -rf "$IPFS_PATH"
 '
 
+test_expect_success "'ipfs init --domain' succeeds" '
+	BITS="1024" &&
+	ipfs init --bits="$BITS" --empty-repo --domain=example >actual_init
+'
+
+test_expect_success "ipfs config shows the domain" '
+	echo example >expected_domain &&
+	ipfs config Domain.Name >actual_domain &&
+	test_cmp expected_domain actual_domain &&
+	PEERID=$(ipfs config Identity.PeerID) &&
+	GROUPID=$(ipfs config Domain.GroupID) &&
+	test_check_peerid "$GROUPID"
+'
+
+test_expect_success "'ipfs init --domain' output looks good" '
+	echo "initializing ipfs node at $IPFS_PATH" >expected &&
+	echo "generating $BITS-bit RSA keypair...done" >>expected &&
+	echo "peer identity: $PEERID" >>expected &&
+	echo "generating $BITS-bit RSA domain authority keypair...done" >>expected &&
+	echo "created domain example: $GROUPID" >>expected &&
+	test_cmp expected actual_init
+'
+
+test_expect_success "clean up ipfs dir" '
+	rm -rf "$IPFS_PATH"
+'
+
+test_expect_success "'ipfs init --domain' fails with an invalid name" '
+	test_must_fail ipfs init --bits=1024 --empty-repo --domain="a/b" 2>init_domain_err &&
+	grep "domain name may not contain" init_domain_err &&
+	test_must_fail ipfs config Identity.PeerID
+'
+
 test_init_ipfs
 
 test_launch_ipfs_daemon
@@ -49,4 +49,18 @@ test_expect_success "output looks good" '
 	grep "Please get fs-repo-migrations from https://dist.ipfs.io" daemon_out > /dev/null
 '
 
+test_expect_success "'ipfs repo migrate' does not download migrations" '
+	test_expect_code 1 ipfs repo migrate > migrate_out 2>&1 &&
+	grep "no migration from repo version 3 to 4 is compiled in" migrate_out &&
+	test_expect_code 1 ipfs repo migrate --dry-run > dry_out 2>&1 &&
+	grep "is compiled in" dry_out &&
+	grep "^3$" "$IPFS_PATH"/version
+'
+
+test_expect_success "'ipfs repo migrate' has nothing to do on a current repo" '
+	echo "4" > "$IPFS_PATH"/version &&
+	ipfs repo migrate > migrate_out &&
+	grep "The repo is already at version 4." migrate_out
+'
+
 test_done
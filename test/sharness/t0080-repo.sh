@@ -260,6 +260,63 @@ test_expect_success "repo version came out correct" '
 	egrep "^fs-repo@[0-9]+" repo-version-q >/dev/null
 '
 
+test_expect_success "'ipfs repo gc --incremental' removes unpinned blocks" '
+	UNPINNED=$(echo "incremental gc garbage" | ipfs block put) &&
+	KEPT=$(echo "incremental gc kept" | ipfs add -q) &&
+	ipfs repo gc --incremental >actual_inc &&
+	grep "removed $UNPINNED" actual_inc &&
+	grep "marked [0-9]* blocks to keep" actual_inc &&
+	grep "scanned [0-9]* blocks" actual_inc &&
+	test_must_fail ipfs block stat "$UNPINNED" &&
+	ipfs cat "$KEPT"
+'
+
+test_expect_success "'ipfs repo gc --incremental -q' only lists keys" '
+	UNPINNED=$(echo "more incremental gc garbage" | ipfs block put) &&
+	ipfs repo gc --incremental -q >actual_inc_q &&
+	grep "$UNPINNED" actual_inc_q &&
+	test_must_fail grep "marked" actual_inc_q
+'
+
+test_expect_success "put some garbage" '
+	for i in $(seq 20); do echo "garbage $i" | ipfs block put; done >/dev/null
+'
+
+test_expect_success "adds complete during an incremental gc" '
+	ipfs repo gc --incremental --batch-size=1 >/dev/null &
+	GC_PID=$! &&
+	ADDED=$(echo "added during gc" | ipfs add -q) &&
+	wait $GC_PID &&
+	ipfs cat "$ADDED" >added_out &&
+	echo "added during gc" >added_exp &&
+	test_cmp added_exp added_out
+'
+
+test_expect_success "'ipfs repo gc --dry-run' lists blocks without removing them" '
+	UNPINNED=$(echo "dry run garbage" | ipfs block put) &&
+	ipfs repo gc --dry-run >actual_dry &&
+	grep "would remove $UNPINNED 16" actual_dry &&
+	ipfs block stat "$UNPINNED"
+'
+
+test_expect_success "'ipfs repo gc --dry-run --enc=json' is machine readable" '
+	ipfs repo gc --dry-run --enc=json >actual_dry_json &&
+	grep "\"Size\":16" actual_dry_json
+'
+
+test_expect_success "'ipfs repo gc --summary' reports the totals" '
+	ipfs repo gc --summary --top=100 >actual_summary &&
+	grep "^blocks: [1-9]" actual_summary &&
+	grep "^bytes: [1-9]" actual_summary &&
+	grep "largest unpinned roots:" actual_summary &&
+	grep "$UNPINNED 16" actual_summary &&
+	ipfs block stat "$UNPINNED"
+'
+
+test_expect_success "'ipfs repo gc --dry-run --incremental' fails" '
+	test_must_fail ipfs repo gc --dry-run --incremental
+'
+
 test_kill_ipfs_daemon
 
 test_done
@@ -39,14 +39,116 @@ test_pins() {
 	'
 }
 
+test_pin_labels() {
+	test_expect_success "pin with a name and labels" '
+		ipfs pin add --name=dataset --label=owner=alice,ticket=OPS-12 $HASH_A &&
+		ipfs pin add -r=false --label=owner=bob $HASH_B
+	'
+
+	test_expect_success "'ipfs pin ls' shows names and labels" '
+		ipfs pin ls --type=recursive >actual &&
+		grep "^$HASH_A recursive \"dataset\" owner=alice ticket=OPS-12$" actual &&
+		ipfs pin ls $HASH_B >actual &&
+		echo "$HASH_B direct owner=bob" >expected &&
+		test_cmp expected actual
+	'
+
+	test_expect_success "'ipfs pin ls --label' filters pins" '
+		ipfs pin ls --label=owner=alice >actual &&
+		echo "$HASH_A recursive \"dataset\" owner=alice ticket=OPS-12" >expected &&
+		test_cmp expected actual &&
+		ipfs pin ls -q --label=owner=bob >actual &&
+		echo "$HASH_B" >expected &&
+		test_cmp expected actual &&
+		ipfs pin ls --label=owner=carol >actual &&
+		test_must_be_empty actual
+	'
+
+	test_expect_success "pinning again adds labels" '
+		ipfs pin add --label=expiry=2017-01-01 $HASH_A &&
+		ipfs pin ls -q --label=owner=alice,expiry=2017-01-01 >actual &&
+		echo "$HASH_A" >expected &&
+		test_cmp expected actual
+	'
+
+	test_expect_success "invalid labels are rejected" '
+		test_must_fail ipfs pin ls --label=owner 2>err &&
+		grep "invalid label" err
+	'
+
+	test_expect_success "unpinning removes the labels" '
+		ipfs pin rm $HASH_A &&
+		ipfs pin rm -r=false $HASH_B &&
+		ipfs pin add $HASH_A &&
+		ipfs pin ls --type=recursive $HASH_A >actual &&
+		echo "$HASH_A recursive" >expected &&
+		test_cmp expected actual &&
+		ipfs pin rm $HASH_A
+	'
+}
+
+test_pin_ttl() {
+	test_expect_success "pin with a ttl" '
+		ipfs pin add --ttl=72h $HASH_C &&
+		ipfs pin ls --type=recursive $HASH_C >actual &&
+		grep "^$HASH_C recursive ttl=7[12]h" actual
+	'
+
+	test_expect_success "pinning again without a ttl removes it" '
+		ipfs pin add $HASH_C &&
+		ipfs pin ls --type=recursive $HASH_C >actual &&
+		echo "$HASH_C recursive" >expected &&
+		test_cmp expected actual &&
+		ipfs pin add --ttl=72h $HASH_C
+	'
+
+	test_expect_success "invalid ttls are rejected" '
+		test_must_fail ipfs pin add --ttl=72h -r=false $HASH_D 2>err &&
+		grep "only recursive pins can have a ttl" err &&
+		test_must_fail ipfs pin add --ttl=-1h $HASH_D 2>err &&
+		grep "must be positive" err &&
+		test_must_fail ipfs pin add --ttl=soon $HASH_D
+	'
+
+	test_expect_success "unpin the pin with a ttl" '
+		ipfs pin rm $HASH_C
+	'
+}
+
 test_init_ipfs
 
 test_pins
 
+test_pin_labels
+
+test_pin_ttl
+
+test_expect_success "pin with a ttl that expires" '
+	ipfs pin add --ttl=1s $HASH_E &&
+	sleep 2 &&
+	ipfs pin ls --type=recursive $HASH_E >actual &&
+	echo "$HASH_E recursive ttl=expired" >expected &&
+	test_cmp expected actual
+'
+
 test_launch_ipfs_daemon --offline
 
+test_expect_success "the daemon unpins expired pins" '
+	for i in 1 2 3 4 5 6 7 8 9 10; do
+		ipfs pin ls -q --type=recursive >actual &&
+		! grep "$HASH_E" actual && break
+		sleep 1
+	done &&
+	ipfs pin ls -q --type=recursive >actual &&
+	test_must_fail grep "$HASH_E" actual
+'
+
 test_pins
 
+test_pin_labels
+
+test_pin_ttl
+
 test_kill_ipfs_daemon
 
 test_done
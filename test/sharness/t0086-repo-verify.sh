@@ -57,4 +57,32 @@ do
 	check_random_corruption
 done
 
+test_expect_success "add an unpinned block and a pinned one" '
+	UNPINNED=$(echo "unpinned block" | ipfs block put) &&
+	PINNED=$(echo "pinned block" | ipfs block put) &&
+	ipfs pin add -r=false "$PINNED"
+'
+
+test_expect_success "corrupt both blocks" '
+	for f in $(find "$IPFS_PATH/blocks" -type f); do
+		if grep -q "pinned block" "$f"; then
+			echo "this is super broken" > "$f"
+		fi
+	done &&
+	test_expect_code 1 ipfs repo verify
+'
+
+test_expect_success "repo verify --repair removes the orphaned block" '
+	test_expect_code 1 ipfs repo verify --repair > repair_out &&
+	grep "block $UNPINNED was removed, nothing keeps it" repair_out &&
+	grep "block $PINNED could not be fetched again" repair_out &&
+	grep "repaired: 0, unrecoverable: 1, orphaned: 1" repair_out
+'
+
+test_expect_success "the corrupt blocks are gone" '
+	test_must_fail ipfs block stat "$UNPINNED" &&
+	ipfs pin rm "$PINNED" &&
+	ipfs repo verify
+'
+
 test_done
@@ -0,0 +1,63 @@
+#!/bin/sh
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs repo export and import"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add some files" '
+	mkdir -p files/sub &&
+	echo "file one" > files/one &&
+	echo "file two" > files/sub/two &&
+	HASH=$(ipfs add -r -q files | tail -n1) &&
+	DIRECT=$(echo "direct block" | ipfs block put) &&
+	ipfs pin add -r=false "$DIRECT" &&
+	ipfs files mkdir /mfsdir &&
+	echo "in mfs" | ipfs files write --create /mfsdir/file
+'
+
+test_expect_success "ipfs repo export succeeds" '
+	ipfs repo export > backup.tar &&
+	ipfs repo export "$DIRECT" > subset.tar
+'
+
+test_expect_success "the archives look right" '
+	tar tf backup.tar > backup_list &&
+	grep "ipfs-repo-export.json" backup_list &&
+	grep "blocks/$HASH" backup_list &&
+	tar tf subset.tar > subset_list &&
+	test $(grep -c "^blocks/" subset_list) -eq 1
+'
+
+test_expect_success "exporting an unpinned root fails" '
+	test_must_fail ipfs repo export QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n
+'
+
+test_expect_success "ipfs repo import into a new repo succeeds" '
+	export IPFS_PATH="$(pwd)/.ipfs-import" &&
+	ipfs init -b=1024 -e > /dev/null &&
+	ipfs repo import backup.tar > import_out &&
+	grep "restored files root" import_out
+'
+
+test_expect_success "pins and files were restored" '
+	ipfs pin ls --type=recursive | grep "$HASH" &&
+	ipfs pin ls --type=direct | grep "$DIRECT" &&
+	ipfs cat "$HASH/sub/two" > two_out &&
+	echo "file two" > two_exp &&
+	test_cmp two_exp two_out &&
+	ipfs files read /mfsdir/file > mfs_out &&
+	echo "in mfs" > mfs_exp &&
+	test_cmp mfs_exp mfs_out
+'
+
+test_expect_success "importing a truncated archive fails" '
+	head -c 2048 backup.tar > truncated.tar &&
+	test_must_fail ipfs repo import --mfs-path="" truncated.tar
+'
+
+test_done
@@ -0,0 +1,290 @@
+// Package compressds implements a datastore that compresses the values of
+// another one. Keys are stored as they are.
+//
+// Values that do not get smaller are stored as they are, so compressed
+// values are marked with a header. Values that happen to start with the
+// header are stored behind a header marking them as uncompressed, which
+// keeps values written through the datastore unambiguous.
+package compressds
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dsq "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/query"
+)
+
+// magic starts the header of the values that were changed, it is followed
+// by the ID of the algorithm.
+var magic = []byte{0x8f, 'c', 'd', 's'}
+
+const headerSize = 4 + 1
+
+// rawID marks values stored uncompressed behind a header.
+const rawID = 0
+
+// ErrUnknownAlgorithm is returned for values compressed with an algorithm
+// this package does not know.
+var ErrUnknownAlgorithm = errors.New("compressds: value is compressed with an unknown algorithm")
+
+// Algorithm is a compression algorithm.
+type Algorithm struct {
+	Name string
+
+	// id identifies the algorithm in the header of values, it must never
+	// change.
+	id        byte
+	newWriter func(io.Writer) (io.WriteCloser, error)
+	newReader func(io.Reader) (io.ReadCloser, error)
+}
+
+var algorithms = []*Algorithm{
+	{
+		Name: "deflate",
+		id:   1,
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return flate.NewReader(r), nil
+		},
+	},
+	{
+		Name: "gzip",
+		id:   2,
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		Name: "zlib",
+		id:   3,
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zlib.NewWriter(w), nil
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return zlib.NewReader(r)
+		},
+	},
+}
+
+// Lookup returns the algorithm called name.
+func Lookup(name string) (*Algorithm, error) {
+	for _, a := range algorithms {
+		if a.Name == name {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown compression algorithm: %s", name)
+}
+
+func byID(id byte) *Algorithm {
+	for _, a := range algorithms {
+		if a.id == id {
+			return a
+		}
+	}
+	return nil
+}
+
+func (a *Algorithm) compress(b []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(b)/2))
+	buf.Write(magic)
+	buf.WriteByte(a.id)
+
+	w, err := a.newWriter(buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (a *Algorithm) decompress(b []byte) ([]byte, error) {
+	r, err := a.newReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// encode returns the value to store for b.
+func encode(alg *Algorithm, b []byte) ([]byte, error) {
+	if alg != nil {
+		c, err := alg.compress(b)
+		if err != nil {
+			return nil, err
+		}
+		if len(c) < len(b) {
+			return c, nil
+		}
+	}
+
+	if !bytes.HasPrefix(b, magic) {
+		return b, nil
+	}
+	out := make([]byte, 0, headerSize+len(b))
+	out = append(out, magic...)
+	out = append(out, rawID)
+	return append(out, b...), nil
+}
+
+// decode returns the value stored as b.
+func decode(b []byte) ([]byte, error) {
+	if len(b) < headerSize || !bytes.HasPrefix(b, magic) {
+		return b, nil
+	}
+
+	id := b[len(magic)]
+	if id == rawID {
+		return b[headerSize:], nil
+	}
+	alg := byID(id)
+	if alg == nil {
+		return nil, ErrUnknownAlgorithm
+	}
+	out, err := alg.decompress(b[headerSize:])
+	if err != nil {
+		return nil, fmt.Errorf("compressds: corrupt value: %s", err)
+	}
+	return out, nil
+}
+
+// Datastore compresses the values of its child datastore.
+type Datastore struct {
+	child ds.Datastore
+	alg   *Algorithm
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+
+// Wrap returns a Datastore compressing the values of child with alg. If
+// alg is nil, new values are stored uncompressed, but compressed values
+// are still read.
+func Wrap(child ds.Datastore, alg *Algorithm) *Datastore {
+	return &Datastore{child: child, alg: alg}
+}
+
+func (d *Datastore) Put(k ds.Key, value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+	v, err := encode(d.alg, b)
+	if err != nil {
+		return err
+	}
+	return d.child.Put(k, v)
+}
+
+func (d *Datastore) Get(k ds.Key) (interface{}, error) {
+	v, err := d.child.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(v)
+}
+
+func decodeValue(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, ds.ErrInvalidType
+	}
+	return decode(b)
+}
+
+func (d *Datastore) Has(k ds.Key) (bool, error) {
+	return d.child.Has(k)
+}
+
+func (d *Datastore) Delete(k ds.Key) error {
+	return d.child.Delete(k)
+}
+
+// Query decompresses the values of the results. Filters and orders are
+// applied to the decompressed values, so only the prefix is passed on.
+func (d *Datastore) Query(q dsq.Query) (dsq.Results, error) {
+	if q.KeysOnly {
+		return d.child.Query(q)
+	}
+
+	res, err := d.child.Query(dsq.Query{Prefix: q.Prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	reschan := make(chan dsq.Result, dsq.KeysOnlyBufSize)
+	go func() {
+		defer close(reschan)
+		defer res.Close()
+
+		for r := range res.Next() {
+			if r.Error == nil {
+				r.Value, r.Error = decodeValue(r.Value)
+			}
+			reschan <- r
+		}
+	}()
+	return dsq.NaiveQueryApply(q, dsq.ResultsWithChan(q, reschan)), nil
+}
+
+func (d *Datastore) Batch() (ds.Batch, error) {
+	bds, ok := d.child.(ds.Batching)
+	if !ok {
+		return ds.NewBasicBatch(d), nil
+	}
+
+	b, err := bds.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &batch{alg: d.alg, b: b}, nil
+}
+
+func (d *Datastore) Close() error {
+	if c, ok := d.child.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type batch struct {
+	alg *Algorithm
+	b   ds.Batch
+}
+
+func (b *batch) Put(k ds.Key, value interface{}) error {
+	v, ok := value.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+	enc, err := encode(b.alg, v)
+	if err != nil {
+		return err
+	}
+	return b.b.Put(k, enc)
+}
+
+func (b *batch) Delete(k ds.Key) error {
+	return b.b.Delete(k)
+}
+
+func (b *batch) Commit() error {
+	return b.b.Commit()
+}
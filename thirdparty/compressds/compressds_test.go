@@ -0,0 +1,124 @@
+package compressds
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dsq "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/query"
+)
+
+func stored(t *testing.T, child ds.Datastore, k ds.Key) []byte {
+	v, err := child.Get(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.([]byte)
+}
+
+func expectValue(t *testing.T, d ds.Datastore, k ds.Key, value []byte) {
+	v, err := d.Get(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v.([]byte), value) {
+		t.Fatalf("%s: got a different value back", k)
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	text := bytes.Repeat([]byte("a line of a log file\n"), 100)
+	for _, name := range []string{"deflate", "gzip", "zlib"} {
+		alg, err := Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		child := ds.NewMapDatastore()
+		d := Wrap(child, alg)
+		k := ds.NewKey("/text")
+		if err := d.Put(k, text); err != nil {
+			t.Fatal(err)
+		}
+		if len(stored(t, child, k)) >= len(text)/2 {
+			t.Fatalf("%s: the value was not compressed", name)
+		}
+		expectValue(t, d, k, text)
+
+		// values compressed with another algorithm are still read.
+		expectValue(t, Wrap(child, nil), k, text)
+	}
+
+	if _, err := Lookup("bogus"); err == nil {
+		t.Fatal("expected an error for an unknown algorithm")
+	}
+}
+
+func TestIncompressible(t *testing.T) {
+	alg, _ := Lookup("deflate")
+	child := ds.NewMapDatastore()
+	d := Wrap(child, alg)
+
+	random := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(random)
+	if err := d.Put(ds.NewKey("/random"), random); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored(t, child, ds.NewKey("/random")), random) {
+		t.Fatal("a value that does not shrink should be stored as it is")
+	}
+	expectValue(t, d, ds.NewKey("/random"), random)
+
+	// a value that looks like a compressed one must round trip.
+	tricky := append(append([]byte(nil), magic...), 1, 'x')
+	if err := d.Put(ds.NewKey("/tricky"), tricky); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, d, ds.NewKey("/tricky"), tricky)
+
+	// and so must values stored before compression was used.
+	if err := child.Put(ds.NewKey("/old"), []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, d, ds.NewKey("/old"), []byte("old"))
+}
+
+func TestQueryAndBatch(t *testing.T) {
+	alg, _ := Lookup("gzip")
+	d := Wrap(ds.NewMapDatastore(), alg)
+
+	values := map[string][]byte{
+		"/a": bytes.Repeat([]byte("a"), 500),
+		"/b": bytes.Repeat([]byte("b"), 500),
+	}
+	b, err := d.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range values {
+		if err := b.Put(ds.NewKey(k), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := d.Query(dsq.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(values) {
+		t.Fatalf("expected %d entries, got %d", len(values), len(entries))
+	}
+	for _, e := range entries {
+		if !bytes.Equal(e.Value.([]byte), values[e.Key]) {
+			t.Fatalf("%s: got a different value back", e.Key)
+		}
+	}
+}
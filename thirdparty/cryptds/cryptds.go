@@ -0,0 +1,343 @@
+// Package cryptds implements a datastore that encrypts the values of
+// another one with AES-256-GCM. Keys are stored as they are.
+//
+// Each value records the ID of the key it was sealed with, so the key can
+// be rotated without re-encrypting everything at once: new values are
+// sealed with the current key of the Keyring, and older ones are read
+// with the key they name until Rekey gets to them.
+package cryptds
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dsq "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/query"
+)
+
+const (
+	// KeySize is the size of a data key in bytes.
+	KeySize = 32
+
+	version   = 1
+	idSize    = 8
+	nonceSize = 12
+
+	// Overhead is how much larger a value gets by sealing it.
+	Overhead = 1 + idSize + nonceSize + 16
+)
+
+var (
+	// ErrDecrypt is returned when a value fails authentication.
+	ErrDecrypt = errors.New("cryptds: failed to decrypt value, the data is corrupt or the key is wrong")
+
+	// ErrUnknownKey is returned for values sealed with a key that is not
+	// in the Keyring.
+	ErrUnknownKey = errors.New("cryptds: value is encrypted with an unknown key")
+)
+
+// Key is a data key.
+type Key struct {
+	raw  []byte
+	id   []byte
+	aead cipher.AEAD
+}
+
+// NewKey wraps raw key material of KeySize bytes.
+func NewKey(raw []byte) (*Key, error) {
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("cryptds: keys must be %d bytes long, got %d", KeySize, len(raw))
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hmac.New(sha256.New, raw)
+	h.Write([]byte("cryptds key id"))
+	return &Key{
+		raw:  append([]byte(nil), raw...),
+		id:   h.Sum(nil)[:idSize],
+		aead: aead,
+	}, nil
+}
+
+// GenerateKey returns a new random key.
+func GenerateKey() (*Key, error) {
+	raw := make([]byte, KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	return NewKey(raw)
+}
+
+// Bytes returns the raw key material.
+func (k *Key) Bytes() []byte {
+	return append([]byte(nil), k.raw...)
+}
+
+// Keyring holds the key new values are sealed with, and the older keys
+// values may still be sealed with.
+type Keyring struct {
+	lk      sync.RWMutex
+	current *Key
+	keys    map[string]*Key
+}
+
+// NewKeyring returns a Keyring sealing values with current.
+func NewKeyring(current *Key, old ...*Key) *Keyring {
+	kr := &Keyring{keys: make(map[string]*Key)}
+	for _, k := range old {
+		kr.keys[string(k.id)] = k
+	}
+	kr.Rotate(current)
+	return kr
+}
+
+// Rotate makes k the key new values are sealed with. The previous key is
+// kept for reading.
+func (kr *Keyring) Rotate(k *Key) {
+	kr.lk.Lock()
+	defer kr.lk.Unlock()
+	kr.current = k
+	kr.keys[string(k.id)] = k
+}
+
+// Keys returns all keys, the current one first.
+func (kr *Keyring) Keys() []*Key {
+	kr.lk.RLock()
+	defer kr.lk.RUnlock()
+	out := []*Key{kr.current}
+	for _, k := range kr.keys {
+		if k != kr.current {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// Seal encrypts value, binding it to k so that values cannot be swapped
+// between keys. The result is version || key ID || nonce || ciphertext.
+func (kr *Keyring) Seal(k ds.Key, value []byte) ([]byte, error) {
+	kr.lk.RLock()
+	key := kr.current
+	kr.lk.RUnlock()
+
+	out := make([]byte, 1+idSize+nonceSize, Overhead+len(value))
+	out[0] = version
+	copy(out[1:], key.id)
+	nonce := out[1+idSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return key.aead.Seal(out, nonce, value, additionalData(out[:1+idSize], k)), nil
+}
+
+// Open decrypts a value sealed for k with any key of the keyring.
+func (kr *Keyring) Open(k ds.Key, sealed []byte) ([]byte, error) {
+	if len(sealed) < Overhead || sealed[0] != version {
+		return nil, ErrDecrypt
+	}
+
+	kr.lk.RLock()
+	key, ok := kr.keys[string(sealed[1:1+idSize])]
+	kr.lk.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	nonce := sealed[1+idSize : 1+idSize+nonceSize]
+	out, err := key.aead.Open(nil, nonce, sealed[1+idSize+nonceSize:], additionalData(sealed[:1+idSize], k))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return out, nil
+}
+
+// isCurrent returns true if sealed was sealed with the current key.
+func (kr *Keyring) isCurrent(sealed []byte) bool {
+	kr.lk.RLock()
+	defer kr.lk.RUnlock()
+	return len(sealed) >= 1+idSize && bytes.Equal(sealed[1:1+idSize], kr.current.id)
+}
+
+func additionalData(header []byte, k ds.Key) []byte {
+	return append(append([]byte(nil), header...), k.Bytes()...)
+}
+
+// Datastore encrypts the values of its child datastore.
+type Datastore struct {
+	child ds.Datastore
+	keys  *Keyring
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+
+// Wrap returns a Datastore encrypting the values of child with keys.
+func Wrap(child ds.Datastore, keys *Keyring) *Datastore {
+	return &Datastore{child: child, keys: keys}
+}
+
+func (d *Datastore) Put(k ds.Key, value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+	sealed, err := d.keys.Seal(k, b)
+	if err != nil {
+		return err
+	}
+	return d.child.Put(k, sealed)
+}
+
+func (d *Datastore) Get(k ds.Key) (interface{}, error) {
+	v, err := d.child.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	return d.decrypt(k, v)
+}
+
+func (d *Datastore) decrypt(k ds.Key, v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, ds.ErrInvalidType
+	}
+	return d.keys.Open(k, b)
+}
+
+func (d *Datastore) Has(k ds.Key) (bool, error) {
+	return d.child.Has(k)
+}
+
+func (d *Datastore) Delete(k ds.Key) error {
+	return d.child.Delete(k)
+}
+
+// Query decrypts the values of the results. Filters and orders are
+// applied to the decrypted values, so only the prefix is passed on.
+func (d *Datastore) Query(q dsq.Query) (dsq.Results, error) {
+	if q.KeysOnly {
+		return d.child.Query(q)
+	}
+
+	res, err := d.child.Query(dsq.Query{Prefix: q.Prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	reschan := make(chan dsq.Result, dsq.KeysOnlyBufSize)
+	go func() {
+		defer close(reschan)
+		defer res.Close()
+
+		for r := range res.Next() {
+			if r.Error == nil {
+				r.Value, r.Error = d.decrypt(ds.NewKey(r.Key), r.Value)
+			}
+			reschan <- r
+		}
+	}()
+	return dsq.NaiveQueryApply(q, dsq.ResultsWithChan(q, reschan)), nil
+}
+
+func (d *Datastore) Batch() (ds.Batch, error) {
+	bds, ok := d.child.(ds.Batching)
+	if !ok {
+		return ds.NewBasicBatch(d), nil
+	}
+
+	b, err := bds.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &batch{d: d, b: b}, nil
+}
+
+func (d *Datastore) Close() error {
+	if c, ok := d.child.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Rekey seals the values that are not sealed with the current key of the
+// Keyring with it. It returns the number of values rewritten.
+func (d *Datastore) Rekey() (int, error) {
+	res, err := d.child.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	var n int
+	for r := range res.Next() {
+		if r.Error != nil {
+			return n, r.Error
+		}
+
+		k := ds.NewKey(r.Key)
+		v, err := d.child.Get(k)
+		if err == ds.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		b, ok := v.([]byte)
+		if !ok {
+			return n, ds.ErrInvalidType
+		}
+		if d.keys.isCurrent(b) {
+			continue
+		}
+
+		plain, err := d.keys.Open(k, b)
+		if err != nil {
+			return n, fmt.Errorf("%s: %s", k, err)
+		}
+		if err := d.Put(k, plain); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+type batch struct {
+	d *Datastore
+	b ds.Batch
+}
+
+func (b *batch) Put(k ds.Key, value interface{}) error {
+	v, ok := value.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+	sealed, err := b.d.keys.Seal(k, v)
+	if err != nil {
+		return err
+	}
+	return b.b.Put(k, sealed)
+}
+
+func (b *batch) Delete(k ds.Key) error {
+	return b.b.Delete(k)
+}
+
+func (b *batch) Commit() error {
+	return b.b.Commit()
+}
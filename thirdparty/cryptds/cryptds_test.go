@@ -0,0 +1,181 @@
+package cryptds
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dsq "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/query"
+)
+
+func newTestKey(t *testing.T) *Key {
+	k, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestPutGetEncrypts(t *testing.T) {
+	child := ds.NewMapDatastore()
+	d := Wrap(child, NewKeyring(newTestKey(t)))
+
+	k := ds.NewKey("/foo")
+	value := []byte("some secret value")
+	if err := d.Put(k, value); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := child.Get(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw.([]byte), value) {
+		t.Fatal("the value was stored in the clear")
+	}
+	if len(raw.([]byte)) != len(value)+Overhead {
+		t.Fatalf("expected %d bytes of overhead, got %d", Overhead, len(raw.([]byte))-len(value))
+	}
+
+	got, err := d.Get(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.([]byte), value) {
+		t.Fatal("got a different value back")
+	}
+
+	if err := d.Put(k, "not bytes"); err != ds.ErrInvalidType {
+		t.Fatalf("expected ErrInvalidType, got %v", err)
+	}
+}
+
+func TestWrongKeyOrTampering(t *testing.T) {
+	child := ds.NewMapDatastore()
+	d := Wrap(child, NewKeyring(newTestKey(t)))
+	if err := d.Put(ds.NewKey("/a"), []byte("aaa")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Put(ds.NewKey("/b"), []byte("bbb")); err != nil {
+		t.Fatal(err)
+	}
+
+	other := Wrap(child, NewKeyring(newTestKey(t)))
+	if _, err := other.Get(ds.NewKey("/a")); err != ErrUnknownKey {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+
+	// values are bound to their keys.
+	rawA, _ := child.Get(ds.NewKey("/a"))
+	child.Put(ds.NewKey("/b"), rawA)
+	if _, err := d.Get(ds.NewKey("/b")); err != ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt for a moved value, got %v", err)
+	}
+
+	sealed := append([]byte(nil), rawA.([]byte)...)
+	sealed[len(sealed)-1] ^= 1
+	child.Put(ds.NewKey("/a"), sealed)
+	if _, err := d.Get(ds.NewKey("/a")); err != ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt for a modified value, got %v", err)
+	}
+}
+
+func TestQueryDecrypts(t *testing.T) {
+	d := Wrap(ds.NewMapDatastore(), NewKeyring(newTestKey(t)))
+	values := map[string]string{"/q/a": "1", "/q/b": "2", "/r/c": "3"}
+	for k, v := range values {
+		if err := d.Put(ds.NewKey(k), []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := d.Query(dsq.Query{Prefix: "/q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if string(e.Value.([]byte)) != values[e.Key] {
+			t.Fatalf("%s: expected %q, got %q", e.Key, values[e.Key], e.Value)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	child := ds.NewMapDatastore()
+	oldKey := newTestKey(t)
+	kr := NewKeyring(oldKey)
+	d := Wrap(child, kr)
+
+	for _, k := range []string{"/a", "/b", "/c"} {
+		if err := d.Put(ds.NewKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newKey := newTestKey(t)
+	kr.Rotate(newKey)
+	if err := d.Put(ds.NewKey("/d"), []byte("/d")); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := d.Rekey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 values to be rewritten, got %d", n)
+	}
+
+	// the old key is not needed anymore.
+	fresh := Wrap(child, NewKeyring(newKey))
+	for _, k := range []string{"/a", "/b", "/c", "/d"} {
+		v, err := fresh.Get(ds.NewKey(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(v.([]byte)) != k {
+			t.Fatalf("%s: got %q", k, v)
+		}
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// from RFC 6070
+	out := pbkdf2([]byte("password"), []byte("salt"), 4096, 20, sha1.New)
+	if hex.EncodeToString(out) != "4b007901b765489abead49d926f721d065a429c1" {
+		t.Fatalf("wrong pbkdf2 output: %x", out)
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	a, b := newTestKey(t), newTestKey(t)
+	f, err := SealKeys("correct horse", []*Key{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Open("battery staple"); err != ErrPassphrase {
+		t.Fatalf("expected ErrPassphrase, got %v", err)
+	}
+
+	keys, err := f.Open("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !bytes.Equal(keys[0].Bytes(), a.Bytes()) || !bytes.Equal(keys[1].Bytes(), b.Bytes()) {
+		t.Fatal("got different keys back")
+	}
+
+	if _, err := SealKeys("", []*Key{a}); err == nil {
+		t.Fatal("sealing keys with an empty passphrase should fail")
+	}
+}
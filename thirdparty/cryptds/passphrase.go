@@ -0,0 +1,130 @@
+package cryptds
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// DefaultIterations is the PBKDF2 iteration count used by SealKeys.
+const DefaultIterations = 100000
+
+// ErrPassphrase is returned when the keys of a KeyFile cannot be opened.
+var ErrPassphrase = errors.New("cryptds: wrong passphrase")
+
+// KeyFile holds data keys encrypted with a key derived from a passphrase,
+// so that they can be stored next to the data.
+type KeyFile struct {
+	Salt       []byte
+	Iterations int
+
+	// Keys are nonce || ciphertext, the current key first.
+	Keys [][]byte
+}
+
+// SealKeys encrypts keys with passphrase.
+func SealKeys(passphrase string, keys []*Key) (*KeyFile, error) {
+	if passphrase == "" {
+		return nil, errors.New("cryptds: the passphrase is empty")
+	}
+
+	f := &KeyFile{
+		Salt:       make([]byte, 16),
+		Iterations: DefaultIterations,
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := f.kek(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		f.Keys = append(f.Keys, aead.Seal(nonce, nonce, k.raw, nil))
+	}
+	return f, nil
+}
+
+// Open decrypts the keys of f with passphrase. It returns ErrPassphrase if
+// the passphrase is wrong.
+func (f *KeyFile) Open(passphrase string) ([]*Key, error) {
+	if len(f.Keys) == 0 {
+		return nil, errors.New("cryptds: the key file holds no keys")
+	}
+
+	aead, err := f.kek(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := aead.NonceSize()
+	keys := make([]*Key, 0, len(f.Keys))
+	for _, sealed := range f.Keys {
+		if len(sealed) < ns {
+			return nil, ErrPassphrase
+		}
+		raw, err := aead.Open(nil, sealed[:ns], sealed[ns:], nil)
+		if err != nil {
+			return nil, ErrPassphrase
+		}
+		k, err := NewKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// kek returns the cipher for the keys of f.
+func (f *KeyFile) kek(passphrase string) (cipher.AEAD, error) {
+	if f.Iterations <= 0 {
+		return nil, errors.New("cryptds: invalid iteration count")
+	}
+	block, err := aes.NewCipher(pbkdf2([]byte(passphrase), f.Salt, f.Iterations, KeySize, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 implements PBKDF2 from RFC 2898.
+func pbkdf2(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
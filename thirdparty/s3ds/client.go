@@ -0,0 +1,282 @@
+package s3ds
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// client speaks the small subset of the S3 REST API the datastore needs,
+// using path style addressing and signature version 4.
+type client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	acl       string
+	accessKey string
+	secretKey string
+	http      *http.Client
+}
+
+// errNotFound is returned by get and head for missing objects.
+var errNotFound = fmt.Errorf("s3: object not found")
+
+// s3Error is an error response from the server.
+type s3Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+func (c *client) put(key string, data []byte) error {
+	hdr := make(http.Header)
+	if c.acl != "" {
+		hdr.Set("x-amz-acl", c.acl)
+	}
+	resp, err := c.do("PUT", key, nil, hdr, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *client) get(key string) ([]byte, error) {
+	resp, err := c.do("GET", key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (c *client) head(key string) error {
+	resp, err := c.do("HEAD", key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *client) delete(key string) error {
+	resp, err := c.do("DELETE", key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type listResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list returns one page of the keys starting with prefix. An empty
+// continuation token is returned with the last page.
+func (c *client) list(prefix, token string) ([]string, string, error) {
+	q := url.Values{}
+	q.Set("list-type", "2")
+	q.Set("prefix", prefix)
+	if token != "" {
+		q.Set("continuation-token", token)
+	}
+
+	resp, err := c.do("GET", "", q, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var res listResult
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, "", err
+	}
+
+	keys := make([]string, 0, len(res.Contents))
+	for _, o := range res.Contents {
+		keys = append(keys, o.Key)
+	}
+	if !res.IsTruncated {
+		return keys, "", nil
+	}
+	if res.NextContinuationToken == "" {
+		return nil, "", fmt.Errorf("s3: truncated listing without a continuation token")
+	}
+	return keys, res.NextContinuationToken, nil
+}
+
+// do sends a signed request for key in our bucket. Non-2xx responses are
+// turned into errors, 404 into errNotFound.
+func (c *client) do(method, key string, query url.Values, hdr http.Header, body []byte) (*http.Response, error) {
+	path := strings.TrimRight(c.endpoint.EscapedPath(), "/") + "/" + uriEncodePath(c.bucket)
+	if key != "" {
+		path += "/" + uriEncodePath(key)
+	}
+	u := c.endpoint.Scheme + "://" + c.endpoint.Host + path
+	if qs := canonicalQuery(query); qs != "" {
+		u += "?" + qs
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(len(body))
+	c.sign(req, path, body, time.Now().UTC())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, errNotFound
+	}
+
+	e := &s3Error{Status: resp.StatusCode}
+	if method != "HEAD" {
+		xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(e)
+	}
+	return nil, e
+}
+
+// sign adds an AWS signature version 4 Authorization header to req.
+func (c *client) sign(req *http.Request, path string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	if c.accessKey == "" {
+		// anonymous access, for public buckets and local stand-ins.
+		return
+	}
+
+	// we only ever set headers we want signed.
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(req.Header.Get(k))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonHeaders bytes.Buffer
+	for _, k := range names {
+		fmt.Fprintf(&canonHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonReq := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	crHash := sha256.Sum256([]byte(canonReq))
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	k := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	k = hmacSHA256(k, c.region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(k, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, sig))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes query the way signature version 4 expects it:
+// sorted by name, with spaces as %20 rather than +.
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(query))
+	for k := range query {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, k := range names {
+		vals := query[k]
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncodePath is uriEncode for object keys, which keep their slashes.
+func uriEncodePath(s string) string {
+	parts := strings.Split(s, "/")
+	for i, p := range parts {
+		parts[i] = uriEncode(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters.
+func uriEncode(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
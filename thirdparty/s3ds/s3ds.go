@@ -0,0 +1,292 @@
+// package s3ds implements a datastore on top of an S3 compatible object
+// store. It is meant for the /blocks mount: values are stored as one
+// object each, and must be []byte.
+package s3ds
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+	dsq "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore/query"
+)
+
+// BatchWorkers is how many requests a batch commit keeps in flight.
+var BatchWorkers = 16
+
+// Options configures an S3 datastore.
+type Options struct {
+	// Endpoint is the base URL of the service. Defaults to the AWS
+	// endpoint of Region.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// ACL is the canned ACL objects are created with, if any.
+	ACL string
+	// RootDirectory is a prefix prepended to all object keys, so that
+	// several repos can share a bucket.
+	RootDirectory string
+
+	// AccessKey and SecretKey default to the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY environment variables. Requests are sent
+	// unsigned if neither is set.
+	AccessKey string
+	SecretKey string
+
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Datastore stores values as objects in an S3 bucket.
+type Datastore struct {
+	c    *client
+	root string
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+
+// New returns a datastore for the bucket described by opts. It does not
+// contact the service.
+func New(opts Options) (*Datastore, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("s3ds: no bucket given")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3-" + opts.Region + ".amazonaws.com"
+		if opts.Region == "us-east-1" {
+			opts.Endpoint = "https://s3.amazonaws.com"
+		}
+	}
+	if opts.AccessKey == "" && opts.SecretKey == "" {
+		opts.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		opts.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	ep, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if ep.Scheme != "http" && ep.Scheme != "https" {
+		return nil, fmt.Errorf("s3ds: invalid endpoint %q", opts.Endpoint)
+	}
+
+	root := strings.Trim(opts.RootDirectory, "/")
+	if root != "" {
+		root += "/"
+	}
+
+	return &Datastore{
+		c: &client{
+			endpoint:  ep,
+			region:    opts.Region,
+			bucket:    opts.Bucket,
+			acl:       opts.ACL,
+			accessKey: opts.AccessKey,
+			secretKey: opts.SecretKey,
+			http:      opts.HTTPClient,
+		},
+		root: root,
+	}, nil
+}
+
+// objectKey maps /foo/bar to <root>foo/bar.
+func (d *Datastore) objectKey(k ds.Key) string {
+	return d.root + strings.TrimPrefix(k.String(), "/")
+}
+
+// dsKey is the inverse of objectKey.
+func (d *Datastore) dsKey(obj string) ds.Key {
+	return ds.NewKey("/" + strings.TrimPrefix(obj, d.root))
+}
+
+func (d *Datastore) Put(k ds.Key, value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+	return d.c.put(d.objectKey(k), val)
+}
+
+func (d *Datastore) Get(k ds.Key) (interface{}, error) {
+	val, err := d.c.get(d.objectKey(k))
+	if err == errNotFound {
+		return nil, ds.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func (d *Datastore) Has(k ds.Key) (bool, error) {
+	err := d.c.head(d.objectKey(k))
+	switch {
+	case err == errNotFound:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete removes the object for k. S3 does not tell us whether the object
+// existed, so we ask first to return ErrNotFound like other datastores.
+func (d *Datastore) Delete(k ds.Key) error {
+	has, err := d.Has(k)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return ds.ErrNotFound
+	}
+	return d.c.delete(d.objectKey(k))
+}
+
+// Query lists the bucket, page by page. Only keys are listed efficiently,
+// queries for values fetch each object in turn.
+func (d *Datastore) Query(q dsq.Query) (dsq.Results, error) {
+	prefix := d.root + strings.TrimPrefix(q.Prefix, "/")
+
+	reschan := make(chan dsq.Result, dsq.KeysOnlyBufSize)
+	go func() {
+		defer close(reschan)
+
+		var token string
+		for {
+			keys, next, err := d.c.list(prefix, token)
+			if err != nil {
+				reschan <- dsq.Result{Error: err}
+				return
+			}
+
+			for _, obj := range keys {
+				e := dsq.Entry{Key: d.dsKey(obj).String()}
+				if !q.KeysOnly {
+					val, err := d.c.get(obj)
+					if err == errNotFound {
+						// deleted while we were listing
+						continue
+					}
+					if err != nil {
+						reschan <- dsq.Result{Error: err}
+						return
+					}
+					e.Value = val
+				}
+				reschan <- dsq.Result{Entry: e}
+			}
+
+			if next == "" {
+				return
+			}
+			token = next
+		}
+	}()
+
+	// the listing is by object key prefix, which may match keys that
+	// are not below q.Prefix (/foo matches /foobar); let the naive
+	// filters sort that out along with the rest of the query.
+	return dsq.NaiveQueryApply(q, dsq.ResultsWithChan(q, reschan)), nil
+}
+
+func (d *Datastore) Batch() (ds.Batch, error) {
+	return &batch{
+		d:    d,
+		puts: make(map[ds.Key][]byte),
+		dels: make(map[ds.Key]struct{}),
+	}, nil
+}
+
+func (d *Datastore) Close() error {
+	return nil
+}
+
+// batch collects writes and sends them concurrently on Commit.
+type batch struct {
+	d    *Datastore
+	lk   sync.Mutex
+	puts map[ds.Key][]byte
+	dels map[ds.Key]struct{}
+}
+
+func (b *batch) Put(k ds.Key, value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	delete(b.dels, k)
+	b.puts[k] = val
+	return nil
+}
+
+func (b *batch) Delete(k ds.Key) error {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	delete(b.puts, k)
+	b.dels[k] = struct{}{}
+	return nil
+}
+
+func (b *batch) Commit() error {
+	b.lk.Lock()
+	puts, dels := b.puts, b.dels
+	b.puts = make(map[ds.Key][]byte)
+	b.dels = make(map[ds.Key]struct{})
+	b.lk.Unlock()
+
+	ops := make(chan func() error)
+	errs := make(chan error, BatchWorkers)
+	var wg sync.WaitGroup
+	for i := 0; i < BatchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var first error
+			for op := range ops {
+				if err := op(); err != nil && first == nil {
+					first = err
+				}
+			}
+			errs <- first
+		}()
+	}
+
+	for k, v := range puts {
+		obj, val := b.d.objectKey(k), v
+		ops <- func() error { return b.d.c.put(obj, val) }
+	}
+	for k := range dels {
+		obj := b.d.objectKey(k)
+		ops <- func() error {
+			// deleting a missing key in a batch is not an error
+			err := b.d.c.delete(obj)
+			if err == errNotFound {
+				return nil
+			}
+			return err
+		}
+	}
+	close(ops)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
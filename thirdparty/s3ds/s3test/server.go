@@ -0,0 +1,168 @@
+// package s3test provides an in-memory stand-in for an S3 bucket, for
+// testing code that uses s3ds without network access.
+package s3test
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server serves any number of buckets from memory. It implements object
+// PUT, GET, HEAD and DELETE and ListObjectsV2, with path style
+// addressing. Signatures are not checked.
+type Server struct {
+	// PageSize is the number of keys per listing page, small values
+	// exercise pagination.
+	PageSize int
+
+	lk      sync.Mutex
+	buckets map[string]map[string][]byte
+	reqs    int
+}
+
+// NewServer starts a stand-in and returns it with its HTTP server; the
+// endpoint is the server's URL.
+func NewServer() (*Server, *httptest.Server) {
+	s := &Server{
+		PageSize: 1000,
+		buckets:  make(map[string]map[string][]byte),
+	}
+	return s, httptest.NewServer(s)
+}
+
+// Requests returns the number of requests served so far.
+func (s *Server) Requests() int {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.reqs
+}
+
+// Objects returns the names of the objects in bucket, sorted.
+func (s *Server) Objects(bucket string) []string {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	var out []string
+	for k := range s.buckets[bucket] {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lk.Lock()
+	s.reqs++
+	s.lk.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	if bucket == "" {
+		writeError(w, http.StatusBadRequest, "InvalidBucketName", "no bucket given")
+		return
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		if r.Method != "GET" || r.URL.Query().Get("list-type") != "2" {
+			writeError(w, http.StatusNotImplemented, "NotImplemented", "only ListObjectsV2 is supported on buckets")
+			return
+		}
+		s.list(w, bucket, r.URL.Query().Get("prefix"), r.URL.Query().Get("continuation-token"))
+		return
+	}
+	key := parts[1]
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	objs := s.buckets[bucket]
+
+	switch r.Method {
+	case "PUT":
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		if objs == nil {
+			objs = make(map[string][]byte)
+			s.buckets[bucket] = objs
+		}
+		objs[key] = data
+		w.WriteHeader(http.StatusOK)
+	case "GET", "HEAD":
+		data, ok := objs[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == "GET" {
+			w.Write(data)
+		}
+	case "DELETE":
+		delete(objs, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+type listResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	Prefix                string
+	KeyCount              int
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+	Contents              []listEntry
+}
+
+type listEntry struct {
+	Key  string
+	Size int
+}
+
+func (s *Server) list(w http.ResponseWriter, bucket, prefix, token string) {
+	s.lk.Lock()
+	var keys []string
+	for k := range s.buckets[bucket] {
+		if strings.HasPrefix(k, prefix) && k > token {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	res := listResult{Name: bucket, Prefix: prefix}
+	if len(keys) > s.PageSize {
+		keys = keys[:s.PageSize]
+		res.IsTruncated = true
+		// keys are listed in order, the last one we return makes a fine
+		// token.
+		res.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, k := range keys {
+		res.Contents = append(res.Contents, listEntry{Key: k, Size: len(s.buckets[bucket][k])})
+	}
+	res.KeyCount = len(res.Contents)
+	s.lk.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(res)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: msg})
+}
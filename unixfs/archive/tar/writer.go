@@ -55,11 +55,15 @@ func (w *Writer) writeDir(nd *mdag.Node, fpath string) error {
 }
 
 func (w *Writer) writeFile(nd *mdag.Node, pb *upb.Data, fpath string) error {
+	dagr, err := uio.NewDataFileReader(w.ctx, nd, pb, w.Dag)
+	if err != nil {
+		return err
+	}
+
 	if err := writeFileHeader(w.TarW, fpath, pb.GetFilesize()); err != nil {
 		return err
 	}
 
-	dagr := uio.NewDataFileReader(w.ctx, nd, pb, w.Dag)
 	if _, err := dagr.WriteTo(w.TarW); err != nil {
 		return err
 	}
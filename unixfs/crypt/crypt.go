@@ -0,0 +1,150 @@
+// package crypt seals the data of unixfs nodes with a symmetric content
+// key, so that blocks leaking out of a domain are unreadable.
+//
+// Chunks are encrypted with AES-256-GCM. The nonce is derived from the
+// key and the plaintext, so adding the same file twice with the same key
+// yields the same blocks and deduplicates like unencrypted content does.
+// The flip side is that peers holding the key can tell two encrypted
+// chunks are equal, which is fine within a domain. The encryption key, the
+// nonce key and the key ID are each derived from the content key with a
+// labelled HMAC, so the content key itself is never used directly.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+)
+
+const (
+	// KeySize is the size of a content key in bytes.
+	KeySize = 32
+
+	nonceSize = 12
+	tagSize   = 16
+
+	// Overhead is how much larger a chunk gets by sealing it.
+	Overhead = nonceSize + tagSize
+
+	// idSize is the length of key IDs stored in encrypted nodes.
+	idSize = 8
+)
+
+var (
+	// ErrMissingKey is returned when reading content encrypted with a key
+	// we do not hold.
+	ErrMissingKey = errors.New("content is encrypted with a key this node does not have")
+
+	// ErrDecrypt is returned when a sealed chunk fails authentication.
+	ErrDecrypt = errors.New("failed to decrypt content, the data is corrupt or the key is wrong")
+)
+
+// Key is a content key. Its ID is stored next to the sealed data, so
+// readers can tell which key they need without trying all of them.
+type Key struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+	id       []byte
+}
+
+// subkey derives the key for one use from raw.
+func subkey(raw []byte, label string) []byte {
+	h := hmac.New(sha256.New, raw)
+	h.Write([]byte(label))
+	return h.Sum(nil)
+}
+
+// NewKey wraps raw key material of KeySize bytes.
+func NewKey(raw []byte) (*Key, error) {
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("content keys must be %d bytes long, got %d", KeySize, len(raw))
+	}
+
+	block, err := aes.NewCipher(subkey(raw, "ipfs content encryption key"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		aead:     aead,
+		nonceKey: subkey(raw, "ipfs content nonce key"),
+		id:       subkey(raw, "ipfs content key id")[:idSize],
+	}, nil
+}
+
+// GenerateKey returns fresh random key material.
+func GenerateKey() ([]byte, error) {
+	raw := make([]byte, KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// ID returns the identifier of k stored in the nodes it sealed.
+func (k *Key) ID() []byte {
+	return k.id
+}
+
+// Seal encrypts plaintext, returning nonce || ciphertext || tag.
+func (k *Key) Seal(plaintext []byte) []byte {
+	h := hmac.New(sha256.New, k.nonceKey)
+	h.Write(plaintext)
+	nonce := h.Sum(nil)[:nonceSize]
+
+	out := make([]byte, nonceSize, nonceSize+len(plaintext)+tagSize)
+	copy(out, nonce)
+	return k.aead.Seal(out, nonce, plaintext, k.id)
+}
+
+// Open decrypts data sealed by Seal.
+func (k *Key) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < Overhead {
+		return nil, ErrDecrypt
+	}
+
+	out, err := k.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], k.id)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return out, nil
+}
+
+type keysCtxKey struct{}
+
+// WithKeys returns a context carrying keys. Readers of unixfs files find
+// the keys of encrypted nodes in their context.
+func WithKeys(ctx context.Context, keys ...*Key) context.Context {
+	if len(keys) == 0 {
+		return ctx
+	}
+	keys = append(keys, keysFromContext(ctx)...)
+	return context.WithValue(ctx, keysCtxKey{}, keys)
+}
+
+func keysFromContext(ctx context.Context) []*Key {
+	keys, _ := ctx.Value(keysCtxKey{}).([]*Key)
+	return keys
+}
+
+// KeyFromContext returns the key with the given ID from ctx, or
+// ErrMissingKey.
+func KeyFromContext(ctx context.Context, id []byte) (*Key, error) {
+	for _, k := range keysFromContext(ctx) {
+		if bytes.Equal(k.id, id) {
+			return k, nil
+		}
+	}
+	return nil, ErrMissingKey
+}
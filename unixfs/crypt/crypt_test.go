@@ -0,0 +1,115 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+
+	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
+)
+
+func newTestKey(t *testing.T) *Key {
+	raw, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := newTestKey(t)
+	data := []byte("the quick brown fox jumps over the lazy dog")
+
+	sealed := k.Seal(data)
+	if len(sealed) != len(data)+Overhead {
+		t.Fatalf("expected %d sealed bytes, got %d", len(data)+Overhead, len(sealed))
+	}
+	if bytes.Contains(sealed, data) {
+		t.Fatal("sealed data contains the plaintext")
+	}
+	if !bytes.Equal(sealed, k.Seal(data)) {
+		t.Fatal("sealing the same data twice should give the same result")
+	}
+
+	out, err := k.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("opened data does not match")
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := k.Open(sealed); err != ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt for tampered data, got %v", err)
+	}
+
+	if _, err := newTestKey(t).Open(k.Seal(data)); err != ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt with the wrong key, got %v", err)
+	}
+}
+
+func TestSubkeys(t *testing.T) {
+	raw, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	sealed := k.Seal(data)
+
+	// neither the nonce nor the encryption use the content key itself
+	h := hmac.New(sha256.New, raw)
+	h.Write(data)
+	if bytes.Equal(sealed[:nonceSize], h.Sum(nil)[:nonceSize]) {
+		t.Fatal("the nonce should not be derived with the content key")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], k.ID()); err == nil {
+		t.Fatal("the data should not be encrypted with the content key")
+	}
+}
+
+func TestKeysFromContext(t *testing.T) {
+	k1 := newTestKey(t)
+	k2 := newTestKey(t)
+
+	ctx := context.Background()
+	if _, err := KeyFromContext(ctx, k1.ID()); err != ErrMissingKey {
+		t.Fatalf("expected ErrMissingKey, got %v", err)
+	}
+
+	ctx = WithKeys(WithKeys(ctx, k1), k2)
+	for _, k := range []*Key{k1, k2} {
+		found, err := KeyFromContext(ctx, k.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != k {
+			t.Fatal("found the wrong key")
+		}
+	}
+}
+
+func TestNewKeySize(t *testing.T) {
+	if _, err := NewKey(make([]byte, 16)); err == nil {
+		t.Fatal("expected short keys to be rejected")
+	}
+}
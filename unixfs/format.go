@@ -7,6 +7,7 @@ import (
 	"errors"
 
 	dag "github.com/ipfs/go-ipfs/merkledag"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
 	pb "github.com/ipfs/go-ipfs/unixfs/pb"
 	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
 )
@@ -117,6 +118,9 @@ func DataSize(data []byte) (uint64, error) {
 	case pb.Data_File:
 		return pbdata.GetFilesize(), nil
 	case pb.Data_Raw:
+		if pbdata.Keyid != nil {
+			return pbdata.GetFilesize(), nil
+		}
 		return uint64(len(pbdata.GetData())), nil
 	default:
 		return 0, errors.New("Unrecognized node data type!")
@@ -134,6 +138,9 @@ type FSNode struct {
 
 	// node type of this node
 	Type pb.Data_DataType
+
+	// ID of the content key Data is sealed with, nil if it is plaintext
+	KeyID []byte
 }
 
 func FSNodeFromBytes(b []byte) (*FSNode, error) {
@@ -145,8 +152,9 @@ func FSNodeFromBytes(b []byte) (*FSNode, error) {
 
 	n := new(FSNode)
 	n.Data = pbn.Data
+	n.KeyID = pbn.Keyid
 	n.blocksizes = pbn.Blocksizes
-	n.subtotal = pbn.GetFilesize() - uint64(len(n.Data))
+	n.subtotal = pbn.GetFilesize() - n.dataSize()
 	n.Type = pbn.GetType()
 	return n, nil
 }
@@ -165,14 +173,24 @@ func (n *FSNode) RemoveBlockSize(i int) {
 func (n *FSNode) GetBytes() ([]byte, error) {
 	pbn := new(pb.Data)
 	pbn.Type = &n.Type
-	pbn.Filesize = proto.Uint64(uint64(len(n.Data)) + n.subtotal)
+	pbn.Filesize = proto.Uint64(n.dataSize() + n.subtotal)
 	pbn.Blocksizes = n.blocksizes
 	pbn.Data = n.Data
+	pbn.Keyid = n.KeyID
 	return proto.Marshal(pbn)
 }
 
 func (n *FSNode) FileSize() uint64 {
-	return uint64(len(n.Data)) + n.subtotal
+	return n.dataSize() + n.subtotal
+}
+
+// dataSize returns the size of the file data held in this node, which
+// is less than len(n.Data) if it is encrypted.
+func (n *FSNode) dataSize() uint64 {
+	if n.KeyID != nil && len(n.Data) >= crypt.Overhead {
+		return uint64(len(n.Data) - crypt.Overhead)
+	}
+	return uint64(len(n.Data))
 }
 
 func (n *FSNode) NumChildren() int {
@@ -12,6 +12,7 @@ import (
 
 	mdag "github.com/ipfs/go-ipfs/merkledag"
 	ft "github.com/ipfs/go-ipfs/unixfs"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
 	ftpb "github.com/ipfs/go-ipfs/unixfs/pb"
 )
 
@@ -29,6 +30,9 @@ type DagReader struct {
 	// cached protobuf structure from node.Data
 	pbdata *ftpb.Data
 
+	// file data held in node itself, decrypted if need be
+	data []byte
+
 	// the current data buffer to be read from
 	// will either be a bytes.Reader or a child DagReader
 	buf ReadSeekCloser
@@ -69,7 +73,7 @@ func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*Dag
 		// Dont allow reading directories
 		return nil, ErrIsDir
 	case ftpb.Data_File, ftpb.Data_Raw:
-		return NewDataFileReader(ctx, n, pb, serv), nil
+		return NewDataFileReader(ctx, n, pb, serv)
 	case ftpb.Data_Metadata:
 		if len(n.Links) == 0 {
 			return nil, errors.New("incorrectly formatted metadata object")
@@ -86,18 +90,46 @@ func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*Dag
 	}
 }
 
-func NewDataFileReader(ctx context.Context, n *mdag.Node, pb *ftpb.Data, serv mdag.DAGService) *DagReader {
+// NewDataFileReader creates a reader for the file node n, whose data was
+// already unmarshaled into pb. Encrypted data is decrypted with the keys
+// carried by ctx, see crypt.WithKeys.
+func NewDataFileReader(ctx context.Context, n *mdag.Node, pb *ftpb.Data, serv mdag.DAGService) (*DagReader, error) {
+	data, err := nodeData(ctx, pb)
+	if err != nil {
+		return nil, err
+	}
+
 	fctx, cancel := context.WithCancel(ctx)
 	promises := mdag.GetDAG(fctx, serv, n)
 	return &DagReader{
 		node:     n,
 		serv:     serv,
-		buf:      NewRSNCFromBytes(pb.GetData()),
+		buf:      NewRSNCFromBytes(data),
 		promises: promises,
 		ctx:      fctx,
 		cancel:   cancel,
 		pbdata:   pb,
+		data:     data,
+	}, nil
+}
+
+// nodeData returns the file data held in pb, opening it with the matching
+// key from ctx if it was sealed. The key is required even if the node
+// holds no data itself, which is the case for the root of most encrypted
+// files.
+func nodeData(ctx context.Context, pb *ftpb.Data) ([]byte, error) {
+	if pb.Keyid == nil {
+		return pb.GetData(), nil
+	}
+
+	k, err := crypt.KeyFromContext(ctx, pb.GetKeyid())
+	if err != nil {
+		return nil, err
+	}
+	if len(pb.GetData()) == 0 {
+		return nil, nil
 	}
+	return k.Open(pb.GetData())
 }
 
 // precalcNextBuf follows the next link in line and loads it from the
@@ -125,10 +157,18 @@ func (dr *DagReader) precalcNextBuf(ctx context.Context) error {
 		// A directory should not exist within a file
 		return ft.ErrInvalidDirLocation
 	case ftpb.Data_File:
-		dr.buf = NewDataFileReader(dr.ctx, nxt, pb, dr.serv)
+		child, err := NewDataFileReader(dr.ctx, nxt, pb, dr.serv)
+		if err != nil {
+			return err
+		}
+		dr.buf = child
 		return nil
 	case ftpb.Data_Raw:
-		dr.buf = NewRSNCFromBytes(pb.GetData())
+		data, err := nodeData(dr.ctx, pb)
+		if err != nil {
+			return err
+		}
+		dr.buf = NewRSNCFromBytes(data)
 		return nil
 	case ftpb.Data_Metadata:
 		return errors.New("shouldnt have had metadata object inside file")
@@ -228,10 +268,10 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 
 		// left represents the number of bytes remaining to seek to (from beginning)
 		left := offset
-		if int64(len(pb.Data)) >= offset {
+		if int64(len(dr.data)) >= offset {
 			// Close current buf to close potential child dagreader
 			dr.buf.Close()
-			dr.buf = NewRSNCFromBytes(pb.GetData()[offset:])
+			dr.buf = NewRSNCFromBytes(dr.data[offset:])
 
 			// start reading links from the beginning
 			dr.linkPosition = 0
@@ -239,7 +279,7 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 			return offset, nil
 		} else {
 			// skip past root block data
-			left -= int64(len(pb.Data))
+			left -= int64(len(dr.data))
 		}
 
 		// iterate through links and find where we need to be
@@ -7,8 +7,11 @@ import (
 	"strings"
 	"testing"
 
+	imp "github.com/ipfs/go-ipfs/importer"
+	"github.com/ipfs/go-ipfs/importer/chunk"
 	mdag "github.com/ipfs/go-ipfs/merkledag"
 	"github.com/ipfs/go-ipfs/unixfs"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
 
 	context "gx/ipfs/QmZy2y8t9zQH2a1b8q2ZSLKp17ATuJoCNxxyMFG5qFExpt/go-net/context"
 
@@ -236,6 +239,68 @@ func TestReaderSzie(t *testing.T) {
 	}
 }
 
+func TestEncryptedRead(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf := make([]byte, 2000)
+	for i := range inbuf {
+		inbuf[i] = byte(i % 7)
+	}
+
+	raw, err := crypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := crypt.NewKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := imp.BuildEncryptedDagFromReader(dserv, chunk.NewSizeSplitter(bytes.NewReader(inbuf), 500), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range node.Links {
+		child, err := l.GetNode(context.Background(), dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(child.Data(), inbuf[:100]) {
+			t.Fatal("chunk was stored in the clear")
+		}
+	}
+
+	ctx, closer := context.WithCancel(crypt.WithKeys(context.Background(), key))
+	defer closer()
+
+	reader, err := NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Size() != uint64(len(inbuf)) {
+		t.Fatalf("expected size %d, got %d", len(inbuf), reader.Size())
+	}
+
+	outbuf, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(inbuf, outbuf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.Seek(1234, os.SEEK_SET); err != nil {
+		t.Fatal(err)
+	}
+	if b := readByte(t, reader); b != inbuf[1234] {
+		t.Fatalf("read %d after seeking, expected %d", b, inbuf[1234])
+	}
+
+	if _, err := NewDagReader(context.Background(), node, dserv); err != crypt.ErrMissingKey {
+		t.Fatalf("expected ErrMissingKey without the key, got %v", err)
+	}
+}
+
 func readByte(t testing.TB, reader *DagReader) byte {
 	out := make([]byte, 1)
 	c, err := reader.Read(out)
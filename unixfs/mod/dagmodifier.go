@@ -22,6 +22,10 @@ import (
 var ErrSeekFail = errors.New("failed to seek properly")
 var ErrUnrecognizedWhence = errors.New("unrecognized whence")
 
+// ErrEncrypted is returned when writing to a file sealed with a content
+// key, as the new data would be stored in plaintext.
+var ErrEncrypted = errors.New("cannot modify encrypted files")
+
 // 2MB
 var writebufferSize = 1 << 21
 
@@ -43,19 +47,31 @@ type DagModifier struct {
 	wrBuf      *bytes.Buffer
 
 	read *uio.DagReader
+
+	// encrypted files can be read with the keys in ctx, not modified
+	encrypted bool
 }
 
 func NewDagModifier(ctx context.Context, from *mdag.Node, serv mdag.DAGService, spl chunk.SplitterGen) (*DagModifier, error) {
+	var encrypted bool
+	if pbn, err := ft.FromBytes(from.Data()); err == nil {
+		encrypted = pbn.Keyid != nil
+	}
 	return &DagModifier{
-		curNode:  from.Copy(),
-		dagserv:  serv,
-		splitter: spl,
-		ctx:      ctx,
+		curNode:   from.Copy(),
+		dagserv:   serv,
+		splitter:  spl,
+		ctx:       ctx,
+		encrypted: encrypted,
 	}, nil
 }
 
 // WriteAt will modify a dag file in place
 func (dm *DagModifier) WriteAt(b []byte, offset int64) (int, error) {
+	if dm.encrypted {
+		return 0, ErrEncrypted
+	}
+
 	// TODO: this is currently VERY inneficient
 	// each write that happens at an offset other than the current one causes a
 	// flush to disk, and dag rewrite
@@ -115,6 +131,9 @@ func (dm *DagModifier) expandSparse(size int64) error {
 
 // Write continues writing to the dag at the current offset
 func (dm *DagModifier) Write(b []byte) (int, error) {
+	if dm.encrypted {
+		return 0, ErrEncrypted
+	}
 	if dm.read != nil {
 		dm.read = nil
 	}
@@ -395,6 +414,10 @@ func (dm *DagModifier) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (dm *DagModifier) Truncate(size int64) error {
+	if dm.encrypted {
+		return ErrEncrypted
+	}
+
 	err := dm.Sync()
 	if err != nil {
 		return err
@@ -1,6 +1,7 @@
 package mod
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,10 +10,13 @@ import (
 	"github.com/ipfs/go-ipfs/blocks/blockstore"
 	bs "github.com/ipfs/go-ipfs/blockservice"
 	"github.com/ipfs/go-ipfs/exchange/offline"
+	imp "github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
 	h "github.com/ipfs/go-ipfs/importer/helpers"
 	trickle "github.com/ipfs/go-ipfs/importer/trickle"
 	mdag "github.com/ipfs/go-ipfs/merkledag"
 	ft "github.com/ipfs/go-ipfs/unixfs"
+	crypt "github.com/ipfs/go-ipfs/unixfs/crypt"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
 	testu "github.com/ipfs/go-ipfs/unixfs/test"
 
@@ -691,6 +695,58 @@ func TestCtxRead(t *testing.T) {
 	// because this is exacelly the same.
 }
 
+func TestEncryptedFile(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	raw, err := crypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := crypt.NewKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("some secret file data")
+	spl := chunk.NewSizeSplitter(bytes.NewReader(data), 8)
+	n, err := imp.BuildEncryptedTrickleDagFromReader(dserv, spl, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := crypt.WithKeys(context.Background(), key)
+	dagmod, err := NewDagModifier(ctx, n, dserv, testu.SizeSplitterGen(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writes would mix plaintext into the file
+	if _, err := dagmod.WriteAt([]byte("plain"), 0); err != ErrEncrypted {
+		t.Fatalf("expected ErrEncrypted, got %v", err)
+	}
+	if _, err := dagmod.Write([]byte("plain")); err != ErrEncrypted {
+		t.Fatalf("expected ErrEncrypted, got %v", err)
+	}
+	if err := dagmod.Truncate(4); err != ErrEncrypted {
+		t.Fatalf("expected ErrEncrypted, got %v", err)
+	}
+
+	// reads decrypt with the keys of the context
+	out, err := ioutil.ReadAll(dagmod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(out, data); err != nil {
+		t.Fatal(err)
+	}
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(n.Cid()) {
+		t.Fatal("the file should not have changed")
+	}
+}
+
 func BenchmarkDagmodWrite(b *testing.B) {
 	b.StopTimer()
 	dserv := testu.GetDAGServ()
@@ -68,6 +68,7 @@ type Data struct {
 	Data             []byte         `protobuf:"bytes,2,opt" json:"Data,omitempty"`
 	Filesize         *uint64        `protobuf:"varint,3,opt,name=filesize" json:"filesize,omitempty"`
 	Blocksizes       []uint64       `protobuf:"varint,4,rep,name=blocksizes" json:"blocksizes,omitempty"`
+	Keyid            []byte         `protobuf:"bytes,5,opt,name=keyid" json:"keyid,omitempty"`
 	XXX_unrecognized []byte         `json:"-"`
 }
 
@@ -103,6 +104,13 @@ func (m *Data) GetBlocksizes() []uint64 {
 	return nil
 }
 
+func (m *Data) GetKeyid() []byte {
+	if m != nil {
+		return m.Keyid
+	}
+	return nil
+}
+
 type Metadata struct {
 	MimeType         *string `protobuf:"bytes,1,req" json:"MimeType,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`